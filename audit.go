@@ -0,0 +1,100 @@
+package axe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AuditEntry is a line of the audit log: one tool invocation, see WithAuditLog.
+type AuditEntry struct {
+	Time      time.Time     `json:"time"` // when the call started
+	RunID     string        `json:"run_id"`
+	Tool      string        `json:"tool"`
+	CallID    string        `json:"call_id,omitempty"`
+	Arguments string        `json:"arguments"`
+	Workdir   string        `json:"workdir,omitempty"`   // for CLI tools
+	ExitCode  *int          `json:"exit_code,omitempty"` // for CLI tools that ran
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"`
+	// Denied is the policy violation of a call that was not run, see WithToolPolicy.
+	Denied string `json:"denied,omitempty"`
+	// OutputSHA256 is the hash of the response returned to the model, of OutputBytes bytes. The
+	// response itself is in the trace, see WithTrace.
+	OutputSHA256 string `json:"output_sha256"`
+	OutputBytes  int    `json:"output_bytes"`
+}
+
+// auditLog appends the tool invocations of runs to the audit file.
+type auditLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	err  error // first write error, reported once at close
+}
+
+// newAuditLog opens the audit file at path for appending, creating it if needed.
+func newAuditLog(path string) (*auditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("axe: create audit log dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("axe: open audit log: %w", err)
+	}
+	return &auditLog{path: path, file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// record appends the entry of a tool call that returned output. Entries arriving after close are
+// dropped.
+func (a *auditLog) record(e AuditEntry, output string) {
+	sum := sha256.Sum256([]byte(output))
+	e.OutputSHA256, e.OutputBytes = hex.EncodeToString(sum[:]), len(output)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil || a.err != nil {
+		return
+	}
+	a.err = a.enc.Encode(e)
+}
+
+func (a *auditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	if a.err != nil {
+		err = a.err
+	}
+	if err != nil {
+		return fmt.Errorf("axe: write audit log %s: %w", a.path, err)
+	}
+	return nil
+}
+
+// auditEntry returns the audit entry of a finished tool call.
+func (r *Runner) auditEntry(rec *ToolCallRecord) AuditEntry {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+	return AuditEntry{
+		Time:      rec.StartedAt,
+		RunID:     r.RunID,
+		Tool:      rec.Tool,
+		CallID:    rec.CallID,
+		Arguments: rec.Arguments,
+		Workdir:   rec.Workdir,
+		ExitCode:  rec.ExitCode,
+		Duration:  rec.Duration,
+		Error:     rec.Error,
+	}
+}
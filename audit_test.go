@@ -0,0 +1,75 @@
+package axe_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+	"github.com/stumble/axe/tools/finalize"
+)
+
+func TestRunnerAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	audit := filepath.Join(dir, "audit", "tools.jsonl")
+	model := axetest.NewScriptedModel(
+		axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./a"]`}),
+		axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./b"]`}),
+		axetest.Finalize("success", "tested"),
+	)
+	exec := axetest.NewFakeExecutor().On("go test ./a", 1, "--- FAIL: TestA")
+	runner, err := axe.NewRunner(dir, []string{"test"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithToolPolicy(axe.ToolPolicy{MaxInvocations: map[string]int{"go_test": 1}}),
+		axe.WithAuditLog(audit),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(audit)
+	require.NoError(t, err)
+	var entries []axe.AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e axe.AuditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 3)
+	ran, denied, finalizeCall := entries[0], entries[1], entries[2]
+	assert.Equal(t, runner.RunID, ran.RunID)
+	assert.Equal(t, "go_test", ran.Tool)
+	assert.Contains(t, ran.Arguments, "./a")
+	assert.Equal(t, dir, ran.Workdir)
+	require.NotNil(t, ran.ExitCode)
+	assert.Equal(t, 1, *ran.ExitCode)
+	assert.Len(t, ran.OutputSHA256, 64)
+	assert.Positive(t, ran.OutputBytes)
+	assert.Contains(t, denied.Denied, "reached its limit of 1 calls")
+	assert.Nil(t, denied.ExitCode)
+	assert.Equal(t, finalize.FinalizeToolName, finalizeCall.Tool)
+
+	// later runs append to the same file
+	model = axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))
+	runner, err = axe.NewRunner(dir, []string{"test"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model), axe.WithAuditLog(audit), axe.WithSink(io.Discard))
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	data, err = os.ReadFile(audit)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(data), "\n"))
+}
@@ -6,23 +6,35 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cloudwego/eino/callbacks"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/flow/agent"
 	"github.com/cloudwego/eino/flow/agent/react"
 	"github.com/cloudwego/eino/schema"
 	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/repomap"
+	"github.com/stumble/axe/code/v4a"
 	"github.com/stumble/axe/history"
+	"github.com/stumble/axe/internal/kinderr"
+	"github.com/stumble/axe/streamview"
+	"github.com/stumble/axe/tools"
+	"github.com/stumble/axe/tools/ask"
 	clitool "github.com/stumble/axe/tools/cli"
 	"github.com/stumble/axe/tools/code"
 	"github.com/stumble/axe/tools/finalize"
+	gittool "github.com/stumble/axe/tools/git"
 )
 
 const (
@@ -34,30 +46,192 @@ const (
 type RunnerState struct {
 	Code    *container.CodeContainer // Always only one code container
 	Outputs []container.CodeOutput   // Outputs from the agent
+	// Messages is the conversation of the last run, which Continue extends.
+	Messages []*schema.Message
 }
 
 // Runner is the core workflow executor.
 // Agent / logger -> write_to -> Output channel -> OutputRecorder
-// OutputRecorder fan out to the sink and a string buffer.
+// OutputRecorder fan out to the sinks and a string buffer.
 type Runner struct {
 	BaseDir      string // a base directory, relative to the current working directory.
 	History      *history.History
 	MinInterval  time.Duration // if > 0, skip run when last edit is within this duration
 	Instructions []string
-	Model        ModelName
-	MaxSteps     int
+	// InstructionVars, if set, fills the instructions, which are Jinja2 templates, when the runner is
+	// created. See WithInstructionVariables.
+	InstructionVars map[string]any
+	// InstructionSources are read when a run starts, filled with InstructionVars, and come before
+	// Instructions. See WithInstructionSources.
+	InstructionSources []InstructionSource
+	// CarryOverTODO prepends the TODO of the last changelog to the instructions, so scheduled runs
+	// make incremental progress.
+	CarryOverTODO bool
+	// InstructionTurns gives each instruction to the agent as a separate turn of the conversation,
+	// after the previous one was finalized with success, instead of joining them into one message.
+	InstructionTurns bool
+	Model            ModelName
+	ModelConfig      ModelConfig
+	Endpoint         Endpoint // base URL, proxy and HTTP client of the model API
+	// ChatModel, if set, is used instead of the OpenAI model selected by Model and Endpoint.
+	ChatModel model.ToolCallingChatModel
+	MaxSteps  int
+	// StepReminder, if > 0, reminds the agent to finalize the task when this many steps or fewer
+	// remain before MaxSteps. See WithStepReminder.
+	StepReminder int
+	// CodeInputLimits bounds the size of the files rendered into the prompt. Without it the files are
+	// rendered whole; ContextReserve fits them to the context window of the model instead.
+	CodeInputLimits container.InputLimits
+	// ContextReserve, if > 0, is the fraction of the context window kept for the conversation and
+	// tool outputs: the code input gets the rest of the window, spent on the files most relevant to
+	// the instruction first. See WithContextBudget.
+	ContextReserve float64
+	// RandomSeed draws a new ModelConfig.Seed for every run, recorded in its manifest.
+	RandomSeed bool
+	// Reproduce, if set, is the manifest of the run this runner reproduces: runs whose prompt or
+	// tools differ from it are reported. See WithManifest.
+	Reproduce *Manifest
+	// RepoMap, if set, adds a map of the repository (its files and their exported Go symbols) to the
+	// prompt, and gives the agent the open_files tool to load files that are not in the container.
+	RepoMap *repomap.Options
+	// EditFormat is the format the agent writes its edits in, v4a patches when empty.
+	EditFormat container.EditFormat
+	// PatchOptions tune how apply_edit matches the context of v4a patches, e.g. MinSimilarity.
+	PatchOptions v4a.Options
+	// FewShot, if set, shows the model worked apply_edit calls: FewShotExamples, or the curated
+	// examples of EditFormat.
+	FewShot         FewShotMode
+	FewShotExamples []code.EditExample
+	// ExternalChangePolicy decides what happens to files changed on disk during the run, e.g. by a
+	// human, when the agent's edits are written.
+	ExternalChangePolicy container.ExternalChangePolicy
+	// EditCheck, if set, is a command (e.g. go build ./...) run in BaseDir after every apply_edit;
+	// the result is part of the tool response.
+	EditCheck []string
+	// NewFilePolicy, if set, limits the files apply_edit may create.
+	NewFilePolicy *code.NewFilePolicy
+	// Quota, if set, limits how much apply_edit may change in a run.
+	Quota *code.Quota
+	// ProtectedPaths are globs of the files the agent must not change, see container.MatchGlob.
+	// They protect the files of the container and the files the git tools of ExtraTools commit or
+	// check out.
+	ProtectedPaths []string
 	// CLI tools that the agent can call
-	Tools []clitool.Definition
+	Tools      []clitool.Definition
+	ExtraTools []tool.InvokableTool // other tools the agent can call, e.g. gittool.NewTools
+	ToolPolicy *ToolPolicy          // optional restrictions on tool calls
+	Executor   clitool.Executor     // runs the commands of Tools, a subprocess executor when nil
+	// BaseEnv is merged under the Env of every CLI tool and of EditCheck, e.g. GOFLAGS or CI=true.
+	BaseEnv map[string]string
+	// RepeatLimit, if > 0, is how many times in a row the agent may call a tool with the same
+	// arguments; further identical calls are not run and the model is told to change strategy.
+	// With AbortOnRepeat, an identical call after that message aborts the run.
+	RepeatLimit   int
+	AbortOnRepeat bool
+	// ParallelTools, if > 1, runs up to this many CLI tool calls of one model response concurrently.
+	// The other tools, which edit the code or the changelog, still run one at a time.
+	ParallelTools int
+	// ReadOnly runs the agent without apply_edit: it produces an analysis (review, audit, summary...)
+	// saved to the history and, if AnalysisPath is set, written to that file.
+	ReadOnly     bool
+	AnalysisPath string
+	// FinalizeValidators must pass before the agent can finalize the task with status success.
+	FinalizeValidators []finalize.Validator
+	// AskUser, if set, backs the ask_user tool the agent calls to clarify ambiguous instructions.
+	AskUser ask.AskFunc
+	// ResponseCache, if set, stores model responses and replays them according to CacheMode.
+	ResponseCache ResponseCache
+	CacheMode     CacheMode
+	// RateLimiter, if set, is waited on before every model request. It may be shared between runners.
+	RateLimiter *RateLimiter
 
 	// The state of the runner
 	State  *RunnerState
-	Output chan string // output buffer for the agent's output. This will be consumed by outputRecorder.
-	Sink   io.Writer   // the sink to write the agent's output to
-
-	KeepHistory bool // if true, previous changelogs will be kept.
-
+	Output chan OutputChunk // output buffer for the agent's output. This will be consumed by outputRecorder.
+	Sink   io.Writer        // the sink to write the agent's output to
+	Sinks  []NamedSink      // additional, optionally filtered, sinks
+	// OutputPolicy decides what happens when Output is full because the sinks are slow.
+	OutputPolicy OutputPolicy
+	// Verbosity selects the output written to the sinks and the changelog logs, everything by default.
+	Verbosity Verbosity
+
+	KeepHistory      bool              // if true, previous changelogs will be kept.
+	HistoryRetention history.Retention // limits applied to kept changelogs when saving history.
+	LogLimit         history.LogLimit  // bounds the run output stored in the changelog.
+	// HistoryEncoding caps and compresses the log entries written to the history file.
+	HistoryEncoding history.Encoding
+	// LogSummarizer, if set, replaces the run output stored in the changelog by its result, e.g. a
+	// summary written by a model. On error the output is stored as is. LogLimit applies to the result.
+	LogSummarizer func(ctx context.Context, output string) (string, error)
+	// SummaryModel and SummaryChatModel select the model of WithModelSummary; SummaryChatModel,
+	// if set, is used instead of the OpenAI model SummaryModel.
+	SummaryModel     ModelName
+	SummaryChatModel model.BaseChatModel
+	LockTimeout      time.Duration // how long Run waits for another run holding the history lock.
+	// PostMortem asks a model, PostMortemModel or the model of WithModelSummary, to diagnose the runs
+	// that end in failure or error from their transcript. See WithPostMortem.
+	PostMortem      bool
+	PostMortemModel model.BaseChatModel
+	// if > 0, running CLI tools report a heartbeat to the sinks at this interval.
+	HeartbeatInterval time.Duration
+	// StallTimeout, if > 0, aborts a run without model tokens or tool activity for this long, unless
+	// OnStall returns false. The output of CLI tools only counts with a HeartbeatInterval.
+	StallTimeout time.Duration
+	OnStall      func(ctx context.Context, stall Stall) (abort bool)
+	ReportPath   string // if set, a JSON RunReport is written here at the end of every run.
+	TraceDir     string // if set, every step of a run is written to <TraceDir>/<run id>.jsonl
+	// AuditLogPath, if set, is a JSONL file every tool invocation of every run is appended to.
+	AuditLogPath string
+	// DiffLimit clips the diff of the run in its report and changelog, DefaultDiffLimit bytes when 0;
+	// negative leaves it out. ChangelogDiff also stores it in the changelog.
+	DiffLimit     int
+	ChangelogDiff bool
+	// RestorePoints stores the previous content of the files a run changes in its changelog, so
+	// Restore can undo the run.
+	RestorePoints bool
+
+	// RunID identifies the current (or last) run. It is set before Run produces any output and kept
+	// after it returns; logs, the changelog, the report and callback events of the run carry it.
+	RunID string
+
+	// eino callback handlers attached to every agent execution, e.g. tracing or metrics integrations.
+	Callbacks []callbacks.Handler
+	// AgentConfigMutators are applied in order to the react.AgentConfig built by the runner, right
+	// before the agent is created. This is an escape hatch for eino settings axe doesn't expose.
+	AgentConfigMutators []func(*react.AgentConfig)
+	// MessageModifiers transform, in order, the messages sent to the model at every step, after the
+	// runner reported the tool responses. They return a new slice and must not change the messages it
+	// is given, which are the conversation the next steps build on. See WithMessageModifier.
+	MessageModifiers []react.MessageModifier
+
+	Logger   *zerolog.Logger // logger for the runner and its tools, the global zerolog logger when nil
+	LogLevel *zerolog.Level  // if set, minimum level of Logger for this runner
+
+	log            zerolog.Logger  // Logger with the run id, set by Run
+	lastReport     *RunReport      // report of the last run, guarded by mu
 	outputRecorder *outputRecorder // the recorder to record the agent's output to a string buffer & write to sink
 	wg             sync.WaitGroup
+	stats          *runStats    // tool calls and token usage of the current run
+	trace          *tracer      // trace of the current run, nil unless TraceDir is set
+	audit          *auditLog    // audit log of the current run, nil unless AuditLogPath is set
+	output         *outputQueue // applies OutputPolicy to sends on Output during the current run
+
+	mu            sync.Mutex // guards the fields below, which let Shutdown reach an in-progress run
+	shuttingDown  bool
+	cancelRun     context.CancelCauseFunc
+	runDone       chan struct{}
+	toolsInFlight sync.WaitGroup
+	activeTools   map[int64]*ToolLiveness
+	nextToolID    int64
+	repeats       repeatTracker
+	lastActivity  atomic.Int64 // unix nanoseconds of the last model or tool activity
+	// repoMap is the repository map of the current run, built on first use; opened holds the
+	// content of the files loaded by open_files during the run.
+	repoMap *string
+	opened  map[string]string
+
+	toolGate  sync.RWMutex  // held for reading by parallel tool calls, for writing by the others
+	toolSlots chan struct{} // bounds the parallel tool calls to ParallelTools
 }
 
 func NewRunner(baseDir string, instructions []string, code *container.CodeContainer, opts ...RunnerOption) (*Runner, error) {
@@ -67,7 +241,7 @@ func NewRunner(baseDir string, instructions []string, code *container.CodeContai
 		State: &RunnerState{
 			Code: code,
 		},
-		Output: make(chan string, DefaultOutputBufferSize),
+		Output: make(chan OutputChunk, DefaultOutputBufferSize),
 	}
 	for _, opt := range opts {
 		if err := opt(r); err != nil {
@@ -77,12 +251,65 @@ func NewRunner(baseDir string, instructions []string, code *container.CodeContai
 	if err := r.applyDefaults(); err != nil {
 		return nil, err
 	}
+	if r.InstructionVars != nil {
+		rendered, err := renderInstructions(r.Instructions, r.InstructionVars)
+		if err != nil {
+			return nil, err
+		}
+		r.Instructions = rendered
+	}
+	if code != nil {
+		code.SetExternalChangePolicy(r.ExternalChangePolicy)
+		if len(r.ProtectedPaths) > 0 {
+			if err := code.SetProtectedPaths(r.ProtectedPaths); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sinks := r.Sinks
+	if r.Sink != nil {
+		sinks = append([]NamedSink{{Name: "default", Writer: r.Sink}}, sinks...)
+	}
 	r.outputRecorder = &outputRecorder{
-		sink: r.Sink,
+		sinks:     sinks,
+		verbosity: r.Verbosity,
 	}
 	return r, nil
 }
 
+// newModel creates the chat model of a run, behind the response cache and the rate limiter.
+// Replaying from the cache never reaches the provider, so no API key is needed.
+func (r *Runner) newModel(ctx context.Context, cfg ModelConfig) (model.ToolCallingChatModel, error) {
+	var chatModel model.ToolCallingChatModel = replayOnlyModel{}
+	switch {
+	case r.ChatModel != nil:
+		chatModel = withRateLimiter(r.ChatModel, r.RateLimiter)
+	case r.ResponseCache == nil || r.CacheMode != CacheReplay:
+		var err error
+		if chatModel, err = newChatModel(ctx, r.Model, cfg, r.Endpoint, r.stats.addReasoningTokens); err != nil {
+			return nil, err
+		}
+		chatModel = withRateLimiter(chatModel, r.RateLimiter)
+	}
+	id := struct {
+		Model  ModelName   `json:"model"`
+		Config ModelConfig `json:"config"`
+	}{r.Model, cfg}
+	return withResponseCache(chatModel, r.ResponseCache, r.CacheMode, id), nil
+}
+
+// baseLogger returns Logger, or the global logger, limited to LogLevel.
+func (r *Runner) baseLogger() zerolog.Logger {
+	logger := log.Logger
+	if r.Logger != nil {
+		logger = *r.Logger
+	}
+	if r.LogLevel != nil {
+		logger = logger.Level(*r.LogLevel)
+	}
+	return logger
+}
+
 func (r *Runner) applyDefaults() error {
 	if r.History == nil {
 		historyFile := filepath.Join(r.BaseDir, DefaultHistoryFile)
@@ -92,90 +319,266 @@ func (r *Runner) applyDefaults() error {
 		}
 		r.History = history
 	}
+	r.History.Retention = r.HistoryRetention
+	r.History.Encoding = r.HistoryEncoding
 	if r.MaxSteps <= 0 {
 		r.MaxSteps = DefaultMaxSteps
 	}
 	if r.Model == "" {
 		r.Model = ModelGPT4o
 	}
+	caps := r.Model.Capabilities()
+	if r.ChatModel == nil && !caps.ToolCalling {
+		return kinderr.Errorf(ErrModelRejected, "axe: model %s does not support tool calling", r.Model)
+	}
 	return nil
 }
 
-func (r *Runner) Run(ctx context.Context, loadDotEnv bool) error {
+// Run executes the agent once and returns the result of the run, nil if it was skipped or failed
+// before the agent started. If ctx is cancelled mid-run, the output is flushed, the changelog is
+// saved marked as interrupted and Run returns the result with an error wrapping the cancellation cause.
+func (r *Runner) Run(ctx context.Context, loadDotEnv bool) (*RunResult, error) {
+	if r == nil {
+		return nil, errors.New("axe: nil runner")
+	}
+	return r.run(ctx, loadDotEnv, "")
+}
+
+// Continue runs the agent again on the conversation of the last run, with followup as the next
+// instruction and the code as the last run left it, for interactive back-and-forth sessions. It is
+// a new run with its own run id, changelog and report; MinInterval doesn't apply.
+func (r *Runner) Continue(ctx context.Context, followup string) (*RunResult, error) {
 	if r == nil {
-		return errors.New("axe: nil runner")
+		return nil, errors.New("axe: nil runner")
+	}
+	if strings.TrimSpace(followup) == "" {
+		return nil, errors.New("axe: empty follow-up instruction")
 	}
+	if len(r.State.Messages) == 0 {
+		return nil, errors.New("axe: no conversation to continue, call Run first")
+	}
+	return r.run(ctx, false, strings.TrimSpace(followup))
+}
+
+// run executes the agent on the instructions, or continues the last conversation with followup.
+func (r *Runner) run(ctx context.Context, loadDotEnv bool, followup string) (*RunResult, error) {
+	r.log = r.baseLogger()
 	if loadDotEnv {
 		if err := godotenv.Load(); err != nil {
-			log.Warn().Err(err).Msg("axe: load .env file")
+			r.log.Warn().Err(err).Msg("axe: load .env file")
 		}
 	}
-	if r.shouldSkipRun() {
-		return nil
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	endRun, err := r.beginRun(cancel)
+	if err != nil {
+		return nil, err
+	}
+	defer endRun()
+
+	unlock, err := r.lockHistory()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if followup == "" && r.shouldSkipRun() {
+		return nil, nil
+	}
+	r.RunID = newRunID()
+	r.setLastReport(nil)
+	r.log = r.baseLogger().With().Str("run_id", r.RunID).Logger()
+	r.outputRecorder.log = r.log
+	ctx = tools.WithLogger(ctx, r.log)
+	ctx = context.WithValue(ctx, runIDCtxKey{}, r.RunID)
+	r.stats = &runStats{}
+	r.mu.Lock()
+	r.repeats = repeatTracker{}
+	r.repoMap, r.opened = nil, nil
+	r.mu.Unlock()
+	r.toolSlots = nil
+	if r.ParallelTools > 1 {
+		r.toolSlots = make(chan struct{}, r.ParallelTools)
+	}
+	r.trace = nil
+	if r.TraceDir != "" {
+		if r.trace, err = newTracer(r.TraceDir, r.RunID); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := r.trace.close(); err != nil {
+				r.log.Warn().Err(err).Msg("axe: close trace")
+			}
+		}()
+	}
+	r.audit = nil
+	if r.AuditLogPath != "" {
+		if r.audit, err = newAuditLog(r.AuditLogPath); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := r.audit.close(); err != nil {
+				r.log.Warn().Err(err).Msg("axe: close audit log")
+			}
+		}()
+	}
+	startedAt := time.Now()
+	initialFiles := r.State.Code.Files()
+	if r.StallTimeout > 0 {
+		go r.watchStalls(ctx, cancel)
 	}
 
 	// spawn a goroutine to consume the output from the agent and write to the outputRecorder. This goroutine will exit when Output is closed.
-	closeOutputOnce := sync.OnceFunc(func() {
-		close(r.Output)
-	})
-	defer closeOutputOnce()
+	r.output = newOutputQueue(r.Output, r.OutputPolicy, r.log)
+	closeOutputOnce := sync.OnceFunc(r.output.close)
+	defer func() {
+		// early returns must not leak the consumer goroutine or lose buffered sink output
+		closeOutputOnce()
+		r.wg.Wait()
+		r.outputRecorder.flush()
+		// Output is closed at the end of every run; reopen it so the runner can run again
+		r.Output = make(chan OutputChunk, cap(r.Output))
+	}()
 	r.wg.Add(1)
 	go func() {
 		defer r.wg.Done()
 		r.outputRecorder.consume(r.Output)
 	}()
 
-	chatModel, err := newChatModel(ctx, r.Model)
+	cfg := r.runConfig()
+	chatModel, err := r.newModel(ctx, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.Debug().Msgf("axe: using model %s", r.Model)
-	r.outputRecorder.Write(fmt.Sprintf("axe: using model %s\n", r.Model))
+	r.log.Debug().Msgf("axe: using model %s", r.Model)
+	r.outputRecorder.Write(OutputKindRunner, fmt.Sprintf("axe: run %s using model %s\n", r.RunID, r.Model))
 
-	changelog := history.Changelog{Timestamp: time.Now()}
+	changelog := history.Changelog{RunID: r.RunID, Timestamp: time.Now()}
+	if r.trace != nil {
+		changelog.Trace = r.trace.path
+	}
 	tools := r.buildToolset(&changelog)
 
 	agt, err := react.NewAgent(ctx, r.buildAgentConfig(chatModel, tools))
 	if err != nil {
-		return fmt.Errorf("axe: create agent: %w", err)
+		return nil, fmt.Errorf("axe: create agent: %w", err)
 	}
 
-	initialState, err := r.State.Code.BuildCodeInput(nil).ToXML()
+	// Every turn continues the conversation with the next instruction. A turn that doesn't finalize
+	// with success ends the run, the remaining instructions are left in the TODO.
+	instructions, err := r.instructions(ctx)
 	if err != nil {
-		return fmt.Errorf("axe: build code input: %w", err)
+		return nil, err
 	}
-	messages, err := buildInitialMessages(ctx, r, initialState)
-	if err != nil {
-		return fmt.Errorf("axe: format prompt: %w", err)
+	turns := r.turns(instructions)
+	var conversation []*schema.Message
+	if followup != "" {
+		turns, instructions = []string{followup}, []string{followup}
+		conversation = slices.Clip(r.State.Messages)
+	}
+	var agentExecErr error
+	var remaining []string // the instructions not done when the agent ran out of steps
+	var manifest *Manifest
+	for i, instruction := range turns {
+		codeInput := r.State.Code.BuildCodeInputWithLimits(nil, r.codeInputLimits(ctx, instruction))
+		r.State.Code.MarkShown(codeInput.Paths()...)
+		var messages []*schema.Message
+		if len(conversation) == 0 {
+			messages, err = buildInitialMessages(ctx, r, instruction, codeInput)
+		} else {
+			var msg *schema.Message
+			msg, err = buildTurnMessage(ctx, instruction, codeInput)
+			messages = []*schema.Message{msg}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("axe: format prompt: %w", err)
+		}
+		if manifest == nil {
+			if manifest, err = r.buildManifest(ctx, cfg, messages, tools); err != nil {
+				return nil, err
+			}
+			r.checkManifest(manifest)
+		}
+		for _, msg := range messages {
+			r.outputRecorder.Write(OutputKindPrompt, fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+		}
+		if r.trace != nil {
+			r.trace.messages(messages)
+		}
+		conversation = append(conversation, messages...)
+
+		changelog.Finalized = false
+		var turn []*schema.Message
+		turn, agentExecErr, err = r.runTurn(ctx, agt, conversation)
+		if err != nil {
+			return nil, err
+		}
+		conversation = append(conversation, turn...)
+		if agentExecErr != nil {
+			remaining = turns[i:]
+			break
+		}
+		if rest := turns[i+1:]; len(rest) > 0 && !(changelog.Finalized && changelog.Success) {
+			r.outputRecorder.Write(OutputKindRunner, fmt.Sprintf("axe: instruction %d of %d did not finish successfully, skipping the remaining %d\n", i+1, len(turns), len(rest)))
+			changelog.TODO = strings.TrimSpace(strings.Join(append([]string{changelog.TODO}, rest...), "\n"))
+			break
+		}
 	}
-	for _, msg := range messages {
-		r.outputRecorder.Write(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	r.State.Messages = conversation
+	// files opened during the run were there all along: they are not added by the agent
+	for key, content := range r.openedFiles() {
+		if _, ok := initialFiles[key]; !ok {
+			initialFiles[key] = content
+		}
 	}
 
-	msgReader, err := agt.Stream(ctx, messages)
-	if err != nil {
-		return fmt.Errorf("axe: agent execution failed: %w", err)
+	// A cancelled run still persists its changelog.
+	var interruptErr error
+	if agentExecErr != nil && ctx.Err() != nil {
+		interruptErr = fmt.Errorf("axe: run %s interrupted: %w", r.RunID, context.Cause(ctx))
+		changelog.Interrupted = true
 	}
-	defer msgReader.Close()
 
-	agentExecErr := r.consumeAgentStream(msgReader)
-	log.Debug().Err(agentExecErr).Msg("axe: agent execution finished")
+	outOfSteps := interruptErr == nil && errors.Is(agentExecErr, ErrMaxSteps)
+	if outOfSteps {
+		r.finalizeOutOfSteps(&changelog, remaining, initialFiles)
+	}
 
-	if agentExecErr != nil {
-		r.outputRecorder.Write(fmt.Sprintf("Agent execution failed: %v\n", agentExecErr))
-	} else {
-		r.outputRecorder.Write("Agent execution finished successfully.\n")
+	switch {
+	case interruptErr != nil:
+		r.outputRecorder.Write(OutputKindSummary, fmt.Sprintf("Agent execution interrupted: %v\n", context.Cause(ctx)))
+	case outOfSteps:
+		r.outputRecorder.Write(OutputKindSummary, fmt.Sprintf("Agent ran out of steps, finalized as a failure. TODO: %s\n", changelog.TODO))
+	case agentExecErr != nil:
+		r.outputRecorder.Write(OutputKindSummary, fmt.Sprintf("Agent execution failed: %v\n", agentExecErr))
+	default:
+		r.outputRecorder.Write(OutputKindSummary, "Agent execution finished successfully.\n")
 	}
 
 	// time to close output and wait for the outputRecorder to finish.
 	closeOutputOnce()
 	r.wg.Wait()
+	r.outputRecorder.flush()
+
+	status := runStatus(agentExecErr, changelog.Interrupted, changelog.Finalized, changelog.Success)
+	pm, err := r.postMortem(context.WithoutCancel(ctx), status, agentExecErr, instructions, r.outputRecorder.String())
+	if err != nil {
+		r.log.Warn().Err(err).Msg("axe: post-mortem of the failed run")
+	}
+	changelog.PostMortem = pm
 
 	// after close, write the outputRecorder's string buffer to the changelog.
-	if output := r.outputRecorder.String(); output != "" {
+	if output := r.changelogLog(ctx); output != "" {
 		changelog.AddLog(output)
 	}
 
+	diff := r.runDiff(initialFiles)
+	if r.ChangelogDiff && diff != "" {
+		changelog.Diff = &history.LogEntry{Value: diff}
+	}
+	if r.RestorePoints {
+		changelog.Before = restorePoint(initialFiles, r.State.Code.Files())
+	}
+
 	if !r.KeepHistory {
 		// clear previous changelogs
 		r.History.Changelogs = []history.Changelog{changelog}
@@ -183,9 +586,132 @@ func (r *Runner) Run(ctx context.Context, loadDotEnv bool) error {
 		r.History.AppendChangelog(changelog)
 	}
 	if err := r.History.SaveHistoryToFile(); err != nil {
-		return fmt.Errorf("axe: save history: %w", err)
+		return nil, fmt.Errorf("axe: save history: %w", err)
 	}
-	return nil
+
+	// the usage of the last streamed model call may still be on its way
+	r.stats.streams.Wait()
+	report := r.buildReport(startedAt, instructions, initialFiles, &changelog, agentExecErr)
+	report.Diff = diff
+	report.Manifest = manifest
+	r.setLastReport(report)
+	result := newRunResult(report, changelog, agentExecErr)
+
+	if r.AnalysisPath != "" && changelog.Report != nil {
+		if err := writeAnalysis(r.AnalysisPath, changelog.Report.Value); err != nil {
+			return result, err
+		}
+	}
+	if r.ReportPath != "" {
+		if err := report.WriteFile(r.ReportPath); err != nil {
+			return result, err
+		}
+	}
+	return result, interruptErr
+}
+
+// finalizeOutOfSteps finalizes the task as a failure for an agent that ran out of steps, with the
+// instructions it did not finish in the TODO, so a later run (see WithCarryOverTODO) or a scheduler
+// can pick up where it stopped.
+func (r *Runner) finalizeOutOfSteps(changelog *history.Changelog, remaining []string, initialFiles map[string]string) {
+	todo := strings.TrimSpace(strings.Join(append([]string{changelog.TODO}, remaining...), "\n"))
+	changelog.Finalized, changelog.Success, changelog.OutOfSteps = true, false, true
+	changelog.TODO = "ran out of steps, remaining TODO: " + todo
+
+	var changed []string
+	for _, f := range diffFiles(initialFiles, r.State.Code.Files()) {
+		changed = append(changed, f.Path+" ("+f.Action+")")
+	}
+	entry := fmt.Sprintf("axe: the agent ran out of steps after %d model calls without finalizing the task", r.stats.stepCount())
+	if len(changed) > 0 {
+		entry += "; files changed so far: " + strings.Join(changed, ", ")
+	}
+	changelog.AddLog(entry)
+}
+
+// LastReport returns the report of the last run, or nil if it was skipped or failed before the
+// agent started.
+func (r *Runner) LastReport() *RunReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastReport
+}
+
+func (r *Runner) setLastReport(report *RunReport) {
+	r.mu.Lock()
+	r.lastReport = report
+	r.mu.Unlock()
+}
+
+func (r *Runner) buildReport(startedAt time.Time, instructions []string, initialFiles map[string]string, changelog *history.Changelog, agentErr error) *RunReport {
+	calls, usage := r.stats.snapshot()
+	steps := r.stats.stepCount()
+	report := &RunReport{
+		RunID:        r.RunID,
+		Model:        r.Model,
+		Instructions: instructions,
+		StartedAt:    startedAt,
+		FinishedAt:   time.Now(),
+		Status:       runStatus(agentErr, changelog.Interrupted, changelog.Finalized, changelog.Success),
+		TODO:         changelog.TODO,
+		FilesTouched: diffFiles(initialFiles, r.State.Code.Files()),
+		Steps:        steps,
+		ToolCalls:    calls,
+		TokenUsage:   usage,
+		Result:       newTaskResult(changelog.Result),
+		CostUSD:      r.Model.Capabilities().Cost(usage),
+		PostMortem:   newPostMortem(changelog.PostMortem),
+	}
+	if changelog.Report != nil {
+		report.Analysis = changelog.Report.Value
+	}
+	if agentErr != nil {
+		report.Error = agentErr.Error()
+	}
+	return report
+}
+
+// changelogLog returns the run output to store in the changelog, summarized and limited.
+func (r *Runner) changelogLog(ctx context.Context) string {
+	output := r.outputRecorder.String()
+	if output == "" {
+		return ""
+	}
+	if r.LogSummarizer != nil {
+		// an interrupted run is still recorded
+		summary, err := r.LogSummarizer(context.WithoutCancel(ctx), output)
+		if err != nil {
+			r.log.Warn().Err(err).Msg("axe: summarize run output, storing it as is")
+		} else {
+			output = summary
+		}
+	}
+	return r.LogLimit.Apply(output)
+}
+
+// lockHistory takes the history file lock for the duration of the run and reloads the changelogs,
+// since another process may have saved the file after this runner was created.
+func (r *Runner) lockHistory() (func(), error) {
+	path := strings.TrimSpace(r.History.FilePath)
+	if path == "" {
+		return func() {}, nil
+	}
+	lock, err := history.AcquireLock(path, r.LockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("axe: lock history: %w", err)
+	}
+	unlock := func() {
+		if err := lock.Unlock(); err != nil {
+			r.log.Error().Err(err).Msg("axe: unlock history")
+		}
+	}
+	fresh, err := history.ReadHistoryFromFile(path)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("axe: read history file: %w", err)
+	}
+	r.History.Changelogs = fresh.Changelogs
+	return unlock, nil
 }
 
 func (r *Runner) shouldSkipRun() bool {
@@ -194,7 +720,7 @@ func (r *Runner) shouldSkipRun() bool {
 	}
 	if ts, ok := r.History.LastChangelogTimestamp(); ok {
 		if time.Since(ts) < r.MinInterval {
-			log.Info().Msgf("axe: skipping run, last edit %s ago < min interval %s", time.Since(ts).String(), r.MinInterval.String())
+			r.log.Info().Msgf("axe: skipping run, last edit %s ago < min interval %s", time.Since(ts).String(), r.MinInterval.String())
 			return true
 		}
 	}
@@ -203,54 +729,177 @@ func (r *Runner) shouldSkipRun() bool {
 
 func (r *Runner) buildToolset(changelog *history.Changelog) []tool.BaseTool {
 	tools := []tool.BaseTool{
-		&code.ApplyEditTool{Code: r.State.Code},
-		&finalize.FinalizeTool{Changelog: changelog},
+		r.wrapTool(&finalize.FinalizeTool{Changelog: changelog, Validators: r.FinalizeValidators, RequireReport: r.ReadOnly}),
+	}
+	if !r.ReadOnly {
+		tools = append(tools,
+			r.wrapTool(&code.ApplyEditTool{Code: r.State.Code, Format: r.EditFormat, PatchOptions: r.PatchOptions, Check: r.editCheck(), NewFiles: r.NewFilePolicy, Quota: r.Quota}),
+			r.wrapTool(&code.ValidatePatchTool{Code: r.State.Code, Format: r.EditFormat, PatchOptions: r.PatchOptions}),
+		)
+	}
+	if r.CodeInputLimits.Enabled() || r.ContextReserve > 0 {
+		// the prompt may only show outlines or excerpts of the files
+		tools = append(tools, r.wrapTool(&code.FetchFunctionTool{Code: r.State.Code}))
+	}
+	if r.RepoMap != nil {
+		tools = append(tools, r.wrapTool(&code.OpenFilesTool{Code: r.State.Code, OnLoad: r.onFileOpened}))
+	}
+	if r.AskUser != nil {
+		tools = append(tools, r.wrapTool(&ask.AskUserTool{Ask: r.AskUser, Changelog: changelog}))
 	}
 	for _, cli := range r.Tools {
-		tools = append(tools, &clitool.CliTool{Def: cli})
+		if len(r.BaseEnv) > 0 {
+			cli.Env = clitool.MergeEnv(r.BaseEnv, cli.Env)
+		}
+		tools = append(tools, r.wrapParallelTool(&clitool.CliTool{
+			Def:               cli,
+			HeartbeatInterval: r.HeartbeatInterval,
+			OnHeartbeat:       r.onToolHeartbeat,
+			OnOutcome:         r.stats.onToolOutcome,
+			Executor:          r.Executor,
+			BaseDir:           r.BaseDir,
+		}))
+	}
+	for _, extra := range r.ExtraTools {
+		tools = append(tools, r.wrapTool(r.protectGit(extra)))
 	}
 	return tools
 }
 
+// protectGit returns a copy of the git tools that change files, which also refuses to change
+// ProtectedPaths. Other tools are returned as they are.
+func (r *Runner) protectGit(t tool.InvokableTool) tool.InvokableTool {
+	if len(r.ProtectedPaths) == 0 {
+		return t
+	}
+	switch t := t.(type) {
+	case *gittool.CommitTool:
+		protected := *t
+		protected.Protected = append(slices.Clone(t.Protected), r.ProtectedPaths...)
+		return &protected
+	case *gittool.CheckoutBranchTool:
+		protected := *t
+		protected.Protected = append(slices.Clone(t.Protected), r.ProtectedPaths...)
+		return &protected
+	}
+	return t
+}
+
+func (r *Runner) editCheck() *code.EditCheck {
+	if len(r.EditCheck) == 0 {
+		return nil
+	}
+	return &code.EditCheck{Argv: r.EditCheck, Dir: r.BaseDir, Env: r.BaseEnv, Executor: r.Executor}
+}
+
+// runTurn runs the agent on the conversation until it answers or finalizes the task, and returns the
+// messages it added. agentErr is the error of the execution; err is set if it couldn't start.
+func (r *Runner) runTurn(ctx context.Context, agt *react.Agent, conversation []*schema.Message) (turn []*schema.Message, agentErr, err error) {
+	futureOpt, future := react.WithMessageFuture()
+	msgReader, err := agt.Stream(ctx, conversation, append(r.agentOptions(), futureOpt)...)
+	if err != nil {
+		// the agent ran before returning the stream; running out of steps or being cancelled ends
+		// the turn, and the run still finalizes and saves its changelog
+		err = classifyAgentError(err)
+		if ctx.Err() != nil {
+			r.toolsInFlight.Wait()
+			return nil, err, nil
+		}
+		if errors.Is(err, ErrMaxSteps) {
+			return nil, err, nil
+		}
+		return nil, nil, fmt.Errorf("axe: agent execution failed: %w", err)
+	}
+	defer msgReader.Close()
+
+	agentErr = classifyAgentError(r.consumeAgentStream(msgReader))
+	r.log.Debug().Err(agentErr).Msg("axe: agent execution finished")
+	if agentErr != nil {
+		if ctx.Err() != nil {
+			// Tool calls are awaited so no edit is half-applied when the history is written;
+			// apply_edit rolls back patches it cannot complete.
+			msgReader.Close()
+			r.toolsInFlight.Wait()
+		}
+		// the future is never completed after an error
+		return nil, agentErr, nil
+	}
+
+	messages := future.GetMessageStreams()
+	for {
+		stream, ok, err := messages.Next()
+		if err != nil || !ok {
+			return turn, err, nil
+		}
+		msg, err := schema.ConcatMessageStream(stream)
+		if err != nil {
+			return turn, err, nil
+		}
+		turn = append(turn, msg)
+	}
+}
+
 func (r *Runner) buildAgentConfig(chatModel model.ToolCallingChatModel, tools []tool.BaseTool) *react.AgentConfig {
 	maxSteps := r.MaxSteps
 	if maxSteps <= 0 {
 		maxSteps = DefaultMaxSteps
 	}
-	return &react.AgentConfig{
+	config := &react.AgentConfig{
 		StreamToolCallChecker: r.toolCallChecker,
 		ToolCallingModel:      chatModel,
 		ToolsConfig: compose.ToolsNodeConfig{
 			Tools:               tools,
-			ExecuteSequentially: true,
+			ExecuteSequentially: r.ParallelTools <= 1,
 			UnknownToolsHandler: func(ctx context.Context, name, input string) (string, error) {
-				log.Fatal().Str("name", name).Str("input", input).Msg("UnknownToolsHandler")
+				r.log.Fatal().Str("name", name).Str("input", input).Msg("UnknownToolsHandler")
 				return "", nil
 			},
 		},
-		MaxStep:            maxSteps,
-		ToolReturnDirectly: map[string]struct{}{finalize.FinalizeToolName: {}},
+		MaxStep: maxSteps,
 		MessageModifier: func(ctx context.Context, input []*schema.Message) []*schema.Message {
 			if len(input) > 0 {
-				last := input[len(input)-1]
-				if last.Role == schema.Tool {
-					log.Debug().Msgf("Tool call response: %s\n", last)
-					r.Output <- fmt.Sprintf("Tool call response: %s\n", last.Content)
+				// the responses to the tool calls of the last model response, in the order of the calls
+				first := len(input)
+				for first > 0 && input[first-1].Role == schema.Tool {
+					first--
 				}
+				for _, msg := range input[first:] {
+					r.log.Debug().Msgf("Tool call response: %s\n", msg)
+					r.output.send(OutputChunk{Kind: OutputKindToolResult, Text: fmt.Sprintf("Tool call response: %s\n", msg.Content), Tool: msg.ToolName, CallID: msg.ToolCallID})
+				}
+			}
+			input = r.remindSteps(input, maxSteps)
+			for _, modify := range r.MessageModifiers {
+				input = modify(ctx, input)
 			}
 			return input
 		},
 	}
+	for _, mutate := range r.AgentConfigMutators {
+		mutate(config)
+	}
+	return config
+}
+
+func (r *Runner) agentOptions() []agent.AgentOption {
+	handlers := []callbacks.Handler{newModelCallbackHandler(r.stats.onModelEvent, &r.stats.streams)}
+	if r.trace != nil {
+		handlers = append(handlers, r.trace.handler())
+	}
+	handlers = append(handlers, r.Callbacks...)
+	return []agent.AgentOption{agent.WithComposeOptions(compose.WithCallbacks(handlers...))}
 }
 
 func (r *Runner) consumeAgentStream(msgReader *schema.StreamReader[*schema.Message]) error {
 	var agentExecErr error
 	for {
-		if _, err := msgReader.Recv(); err != nil {
+		_, err := msgReader.Recv()
+		r.markActivity()
+		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			log.Error().Err(err).Msg("axe: agent execution failed")
+			r.log.Error().Err(err).Msg("axe: agent execution failed")
 			agentExecErr = err
 			break
 		}
@@ -261,101 +910,58 @@ func (r *Runner) consumeAgentStream(msgReader *schema.StreamReader[*schema.Messa
 // toolCallChecker observes streamed messages from the model and proxies them to the runner output channel.
 func (r *Runner) toolCallChecker(_ context.Context, sr *schema.StreamReader[*schema.Message]) (bool, error) {
 	defer sr.Close()
+	r.stats.addStep()
 	hasToolCalls := false
-	lastToolCallID := ""
-	var callStreamer *ToolCallStreamer
-	defer func() {
-		if callStreamer != nil {
-			_ = callStreamer.Close()
-		}
-	}()
+	view := streamview.NewView(func(c streamview.Chunk) {
+		r.output.send(OutputChunk{Kind: OutputKindToolCall, Text: c.Text, Tool: c.Tool, CallID: c.CallID})
+	})
+	view.Logger = &r.log
+	var chunks []*schema.Message // the response, kept for the trace
+	defer view.Close()
 	for {
 		msg, err := sr.Recv()
+		r.markActivity()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
 			return false, err
 		}
-		log.Debug().Str("type", fmt.Sprintf("%T", msg)).Any("msg", msg).Msg("stream msg")
+		r.log.Debug().Str("type", fmt.Sprintf("%T", msg)).Any("msg", msg).Msg("stream msg")
+		if r.trace != nil {
+			chunks = append(chunks, msg)
+		}
 
 		if len(msg.ToolCalls) > 0 {
 			hasToolCalls = true
-			if len(msg.ToolCalls) > 1 {
-				// XXX(yxia): we don't support stream multiple tool calls yet.
-				// I am not even sure if model would stream multiple tool calls at once.
-				// Even model has multiple tool calls, I assume it will return them one by one.
-				// Anyways, in this case, we just simply stream the message.
-				r.streamFrame(msg)
-			} else {
-				call := msg.ToolCalls[0]
-				if call.ID != "" && call.ID != lastToolCallID {
-					// close the previous call streamer and create a new one
-					if callStreamer != nil {
-						_ = callStreamer.Close()
-					}
-					lastToolCallID = call.ID
-					callStreamer = NewToolCallStreamer(call.ID, r.Output)
-				}
-				err := callStreamer.OnMsg(&call)
-				if err != nil {
-					// unexpected error, just return
-					return false, err
-				}
+			// Models stream their calls one after the other; a chunk holding several, e.g. a
+			// batch of calls from a non-streaming model, holds each of them whole.
+			for _, call := range msg.ToolCalls {
+				view.OnDelta(&call)
 			}
 		} else {
 			r.streamFrame(msg)
 		}
 	}
-	r.Output <- "\n"
+	r.emit(OutputKindAgent, "\n")
+	if r.trace != nil {
+		r.trace.response(chunks)
+	}
 	return hasToolCalls, nil
 }
 
+// emit sends a chunk of output to the sinks through the Output channel.
+func (r *Runner) emit(kind OutputKind, text string) {
+	r.output.send(OutputChunk{Kind: kind, Text: text})
+}
+
 func (r *Runner) streamFrame(frame any) {
 	switch frame := frame.(type) {
 	case *schema.Message:
 		if frame.Content != "" {
-			r.outputRecorder.Write(frame.Content)
+			r.outputRecorder.Write(OutputKindAgent, frame.Content)
 		} else if len(frame.ToolCalls) > 0 {
 			panic("tool calls in message")
 		}
 	}
 }
-
-// outputRecorder is a helper to record the output and write it to a sink.
-type outputRecorder struct {
-	mu   sync.Mutex
-	buf  strings.Builder
-	sink io.Writer
-}
-
-func (o *outputRecorder) Write(text string) {
-	if o == nil {
-		return
-	}
-	o.mu.Lock()
-	defer o.mu.Unlock()
-	o.buf.WriteString(text)
-	if o.sink != nil {
-		_, err := io.WriteString(o.sink, text)
-		if err != nil {
-			log.Error().Err(err).Msg("axe: write to sink")
-		}
-	}
-}
-
-func (o *outputRecorder) String() string {
-	if o == nil {
-		return ""
-	}
-	o.mu.Lock()
-	defer o.mu.Unlock()
-	return o.buf.String()
-}
-
-// consume consumes the output from the agent and writes it to the outputRecorder. This function will exit when the out channel is closed.
-func (o *outputRecorder) consume(out chan string) {
-	for msg := range out {
-		o.Write(msg)
-	}
-}
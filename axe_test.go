@@ -0,0 +1,223 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+func TestRunnerWithScriptedModel(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	history := filepath.Join(dir, "history.xml")
+
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: "+file+"\n+hello\n*** End Patch"),
+		axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["-run", "TestA"]`}),
+		axetest.Finalize("success", "added a.txt"),
+	)
+	exec := axetest.NewFakeExecutor().On("go test ./... -run TestA", 1, "--- FAIL: TestA")
+
+	runner, err := axe.NewRunner(dir, []string{"add a.txt"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test ./...", "run tests", nil)}),
+		axe.WithHistory(history),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.Success())
+	assert.Equal(t, 3, result.Steps)
+	assert.Equal(t, "added a.txt", result.Changelog.Logs[0].Value)
+	assert.Equal(t, []axe.TouchedFile{{Path: file, Action: "added"}}, result.FilesChanged)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	calls := exec.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, []string{"go", "test", "./...", "-run", "TestA"}, calls[0].Argv)
+	assert.Equal(t, dir, calls[0].Workdir)
+
+	assert.Zero(t, model.Remaining())
+	assert.Contains(t, model.ToolNames(), "go_test")
+	requests := model.Requests()
+	require.Len(t, requests, 3)
+	last := requests[2][len(requests[2])-1]
+	assert.Contains(t, last.Content, "--- FAIL: TestA")
+
+	report := runner.LastReport()
+	require.NotNil(t, report)
+	assert.Equal(t, axe.RunStatusSuccess, report.Status)
+	require.Len(t, report.ToolCalls, 3)
+	require.NotNil(t, report.ToolCalls[1].ExitCode)
+	assert.Equal(t, 1, *report.ToolCalls[1].ExitCode)
+}
+
+func TestRunnerInstructionTurns(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.Finalize("success", "first done"),
+		axetest.Finalize("failure", "second failed"),
+	)
+	runner, err := axe.NewRunner(dir, []string{"first", "second", "third"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithInstructionTurns(true),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	requests := model.Requests()
+	require.Len(t, requests, 2)
+	// the second turn continues the conversation of the first: system, user, finalize call and result
+	second := requests[1]
+	require.Len(t, second, 5)
+	assert.Contains(t, second[1].Content, "first")
+	assert.Len(t, second[2].ToolCalls, 1)
+	assert.Equal(t, "first done", second[3].Content)
+	assert.Equal(t, schema.User, second[4].Role)
+	assert.Contains(t, second[4].Content, "# Instruction: \nsecond")
+
+	changelog := runner.History.Changelogs[0]
+	assert.True(t, changelog.Finalized)
+	assert.False(t, changelog.Success)
+	assert.Equal(t, "third", changelog.TODO)
+}
+
+func TestRunnerContinue(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.Text("Which file?"),
+		axetest.Finalize("success", "done"),
+	)
+	runner, err := axe.NewRunner(dir, []string{"fix the bug"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithKeepHistory(true),
+	)
+	require.NoError(t, err)
+	_, err = runner.Continue(context.Background(), "the one in main.go")
+	require.ErrorContains(t, err, "call Run first")
+
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	firstRun := runner.RunID
+	_, err = runner.Continue(context.Background(), "the one in main.go")
+	require.NoError(t, err)
+	assert.NotEqual(t, firstRun, runner.RunID)
+
+	requests := model.Requests()
+	require.Len(t, requests, 2)
+	second := requests[1]
+	require.Len(t, second, 4)
+	assert.Contains(t, second[1].Content, "fix the bug")
+	assert.Equal(t, "Which file?", second[2].Content)
+	assert.Contains(t, second[3].Content, "# Instruction: \nthe one in main.go")
+	assert.Len(t, runner.State.Messages, 6)
+	assert.Equal(t, []string{"the one in main.go"}, runner.LastReport().Instructions)
+	require.Len(t, runner.History.Changelogs, 2)
+	assert.True(t, runner.History.Changelogs[1].Success)
+}
+
+// chunkRecorder is a sink keeping the chunks it receives.
+type chunkRecorder struct {
+	mu     sync.Mutex
+	chunks []axe.OutputChunk
+}
+
+func (c *chunkRecorder) Write(p []byte) (int, error) { return len(p), nil }
+
+func (c *chunkRecorder) WriteChunk(chunk axe.OutputChunk) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chunks = append(c.chunks, chunk)
+	return nil
+}
+
+func TestRunnerBaseEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.ToolCall("go_test", map[string]any{"workdir": dir}),
+		axetest.ToolCall("lint", map[string]any{"workdir": dir}),
+		axetest.Finalize("success", "checked"),
+	)
+	exec := axetest.NewFakeExecutor()
+	runner, err := axe.NewRunner(dir, []string{"check"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{
+			clitool.MustNewDefinition("go_test", "go test ./...", "run tests", nil),
+			clitool.MustNewDefinition("lint", "CI=false golangci-lint run", "lint", nil),
+		}),
+		axe.WithBaseEnvironment(map[string]string{"CI": "true", "GOFLAGS": "-mod=mod"}),
+		axe.WithBaseEnvironment(map[string]string{"GOPATH": "/tmp/gopath"}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	calls := exec.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, map[string]string{"CI": "true", "GOFLAGS": "-mod=mod", "GOPATH": "/tmp/gopath"}, calls[0].Env)
+	assert.Equal(t, "false", calls[1].Env["CI"], "the definition's env takes precedence")
+	assert.Equal(t, "-mod=mod", calls[1].Env["GOFLAGS"])
+}
+
+func TestRunnerMessageModifier(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: a.txt\n+a\n*** End Patch"),
+		axetest.Finalize("success", "done"),
+	)
+	var steps []int
+	code, err := cont.NewCodeContainerInDir(dir, nil)
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"Do the task."}, code,
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithMessageModifier(func(_ context.Context, input []*schema.Message) []*schema.Message {
+			steps = append(steps, len(input))
+			return append(input, schema.UserMessage("Reminder: be brief."))
+		}),
+		axe.WithMessageModifier(func(_ context.Context, input []*schema.Message) []*schema.Message {
+			return append([]*schema.Message{schema.SystemMessage("first")}, input...)
+		}),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	requests := model.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, []int{2, 4}, steps, "modifiers see the conversation, without their previous changes")
+	for _, messages := range requests {
+		assert.Equal(t, "first", messages[0].Content, "modifiers run in order")
+		assert.Equal(t, "Reminder: be brief.", messages[len(messages)-1].Content)
+	}
+	assert.Len(t, requests[1], 4+2)
+
+	_, err = axe.NewRunner(dir, nil, cont.NewCodeContainer(nil), axe.WithMessageModifier(nil))
+	assert.Error(t, err)
+}
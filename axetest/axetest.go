@@ -0,0 +1,213 @@
+// Package axetest provides a scripted chat model and a fake command executor, so applications
+// embedding axe can test their runner wiring without calling a model API or running commands.
+//
+//	m := axetest.NewScriptedModel(
+//		axetest.ToolCall("go_test", map[string]any{"workdir": "."}),
+//		axetest.Finalize("success", "tests pass"),
+//	)
+//	exec := axetest.NewFakeExecutor()
+//	runner, _ := axe.NewRunner(dir, instructions, code, axe.WithChatModel(m), axe.WithExecutor(exec))
+package axetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	clitool "github.com/stumble/axe/tools/cli"
+	"github.com/stumble/axe/tools/code"
+	"github.com/stumble/axe/tools/finalize"
+)
+
+// ErrScriptExhausted is returned when the model is called more often than it has scripted messages.
+var ErrScriptExhausted = errors.New("axetest: script exhausted")
+
+// ScriptedModel is a ToolCallingChatModel replying with a fixed sequence of assistant messages,
+// one per call, and recording the requests it receives.
+type ScriptedModel struct {
+	mu       sync.Mutex
+	script   []*schema.Message
+	next     int
+	requests [][]*schema.Message
+	tools    []*schema.ToolInfo
+}
+
+func NewScriptedModel(messages ...*schema.Message) *ScriptedModel {
+	return &ScriptedModel{script: messages}
+}
+
+func (m *ScriptedModel) Generate(_ context.Context, input []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, append([]*schema.Message(nil), input...))
+	if m.next >= len(m.script) {
+		return nil, fmt.Errorf("%w after %d messages", ErrScriptExhausted, len(m.script))
+	}
+	msg := m.script[m.next]
+	m.next++
+	return msg, nil
+}
+
+func (m *ScriptedModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := m.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+// WithTools records the tools bound by the agent and returns the model itself, so the script
+// continues across rebinding.
+func (m *ScriptedModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tools = tools
+	return m, nil
+}
+
+// Requests returns the messages of every call, in order.
+func (m *ScriptedModel) Requests() [][]*schema.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]*schema.Message(nil), m.requests...)
+}
+
+// ToolNames returns the names of the tools bound by the agent.
+func (m *ScriptedModel) ToolNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.tools))
+	for _, t := range m.tools {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// Remaining returns the number of scripted messages not yet replied.
+func (m *ScriptedModel) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.script) - m.next
+}
+
+var callSeq struct {
+	sync.Mutex
+	n int
+}
+
+// ToolCall returns an assistant message calling tool name with args, which is marshaled to JSON
+// unless it already is a string.
+func ToolCall(name string, args any) *schema.Message {
+	var arguments string
+	switch a := args.(type) {
+	case string:
+		arguments = a
+	case nil:
+		arguments = "{}"
+	default:
+		data, err := json.Marshal(a)
+		if err != nil {
+			panic(fmt.Sprintf("axetest: marshal arguments of %s: %v", name, err))
+		}
+		arguments = string(data)
+	}
+	callSeq.Lock()
+	callSeq.n++
+	id := fmt.Sprintf("call_%d", callSeq.n)
+	callSeq.Unlock()
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       id,
+		Type:     "function",
+		Function: schema.FunctionCall{Name: name, Arguments: arguments},
+	}})
+}
+
+// ToolCalls returns an assistant message making the calls of messages built with ToolCall at once,
+// as models batching independent calls do.
+func ToolCalls(calls ...*schema.Message) *schema.Message {
+	var toolCalls []schema.ToolCall
+	for _, msg := range calls {
+		for _, call := range msg.ToolCalls {
+			index := len(toolCalls)
+			call.Index = &index
+			toolCalls = append(toolCalls, call)
+		}
+	}
+	return schema.AssistantMessage("", toolCalls)
+}
+
+// Text returns an assistant message without tool calls, which ends the agent loop.
+func Text(content string) *schema.Message {
+	return schema.AssistantMessage(content, nil)
+}
+
+// ApplyEdit returns a call of apply_edit with a V4A patch, e.g.
+// "*** Begin Patch\n*** Add File: a.go\n+package a\n*** End Patch".
+func ApplyEdit(patch string) *schema.Message {
+	return ToolCall(code.ApplyEditToolName, map[string]string{
+		"code_output": "<CodeOutput><![CDATA[" + patch + "]]></CodeOutput>",
+	})
+}
+
+// Finalize returns a call of finalize_task with status and changelog.
+func Finalize(status, changelog string) *schema.Message {
+	return ToolCall(finalize.FinalizeToolName, map[string]string{"status": status, "changelog": changelog})
+}
+
+// FakeExecutor is a clitool.Executor returning canned outcomes instead of running commands.
+// Outcomes are looked up by the command line (argv joined by spaces); Default is used otherwise.
+type FakeExecutor struct {
+	mu       sync.Mutex
+	Outcomes map[string]clitool.Outcome
+	Default  clitool.Outcome
+	calls    []Call
+}
+
+// Call is a command run through a FakeExecutor.
+type Call struct {
+	Argv    []string
+	Env     map[string]string
+	Workdir string
+}
+
+// NewFakeExecutor returns an executor whose commands succeed without output unless set with On.
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{Outcomes: map[string]clitool.Outcome{}, Default: clitool.Outcome{Ran: true}}
+}
+
+// On sets the result of the command line to the given exit code and stdout.
+func (e *FakeExecutor) On(commandLine string, exitCode int, stdout string) *FakeExecutor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Outcomes == nil {
+		e.Outcomes = map[string]clitool.Outcome{}
+	}
+	e.Outcomes[commandLine] = clitool.Outcome{Ran: true, ExitCode: exitCode, Stdout: stdout}
+	return e
+}
+
+func (e *FakeExecutor) Execute(_ context.Context, argv []string, env map[string]string, workdir string) clitool.Outcome {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, Call{Argv: append([]string(nil), argv...), Env: env, Workdir: workdir})
+	line := strings.Join(argv, " ")
+	outcome, ok := e.Outcomes[line]
+	if !ok {
+		outcome = e.Default
+	}
+	outcome.Command = line
+	return outcome
+}
+
+// Calls returns the commands executed so far.
+func (e *FakeExecutor) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Call(nil), e.calls...)
+}
@@ -0,0 +1,35 @@
+package axetest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe/axetest"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+func TestScriptedModel_Exhausted(t *testing.T) {
+	model := axetest.NewScriptedModel(axetest.Text("done"))
+	msg, err := model.Generate(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "done", msg.Content)
+
+	_, err = model.Generate(context.Background(), nil)
+	assert.ErrorIs(t, err, axetest.ErrScriptExhausted)
+}
+
+func TestFakeExecutor(t *testing.T) {
+	exec := axetest.NewFakeExecutor().On("go test ./...", 1, "--- FAIL: TestA")
+	out := exec.Execute(context.Background(), []string{"go", "test", "./..."}, map[string]string{"CGO_ENABLED": "0"}, "/src")
+	assert.Equal(t, clitool.Outcome{Ran: true, Command: "go test ./...", ExitCode: 1, Stdout: "--- FAIL: TestA"}, out)
+	out = exec.Execute(context.Background(), []string{"go", "vet"}, nil, "/src")
+	assert.Equal(t, clitool.Outcome{Ran: true, Command: "go vet"}, out, "other commands succeed without output")
+
+	assert.Equal(t, []axetest.Call{
+		{Argv: []string{"go", "test", "./..."}, Env: map[string]string{"CGO_ENABLED": "0"}, Workdir: "/src"},
+		{Argv: []string{"go", "vet"}, Workdir: "/src"},
+	}, exec.Calls())
+}
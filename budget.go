@@ -0,0 +1,61 @@
+package axe
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/stumble/axe/code/container"
+)
+
+// bytesPerToken converts token budgets to the byte budgets of container.InputLimits.
+const bytesPerToken = 4
+
+// codeInputLimits returns the limits of the code input of a turn. With a ContextReserve, the code
+// gets what is left of the context window after the reserve and the rest of the prompt, spent on the
+// files most relevant to the instruction first.
+func (r *Runner) codeInputLimits(ctx context.Context, instruction string) container.InputLimits {
+	limits := r.CodeInputLimits
+	if r.ContextReserve <= 0 {
+		return limits
+	}
+	limits.Keywords = instructionKeywords(instruction)
+	window := r.Model.Capabilities().ContextWindow
+	if window == 0 {
+		return limits
+	}
+	overhead, _, err := r.promptTokens(ctx, instruction, container.CodeInput{})
+	if err != nil {
+		r.log.Warn().Err(err).Msg("axe: estimate prompt size, budgeting the code input without it")
+	}
+	budget := max(int(float64(window)*(1-r.ContextReserve))-overhead, 0) * bytesPerToken
+	if limits.MaxTotalBytes == 0 || budget < limits.MaxTotalBytes {
+		limits.MaxTotalBytes = budget
+	}
+	return limits
+}
+
+// stopWords are frequent in instructions but say nothing about which files matter.
+var stopWords = []string{
+	"about", "after", "all", "also", "and", "any", "are", "but", "can", "code", "does", "each", "file",
+	"files", "for", "from", "has", "have", "into", "its", "make", "must", "not", "only", "should", "that",
+	"the", "them", "then", "there", "these", "this", "use", "when", "which", "with", "without", "you",
+}
+
+// instructionKeywords returns the words of an instruction that may name files or symbols: words
+// of three or more letters, digits, '_', '.', '/' or '-', except stop words.
+func instructionKeywords(instruction string) []string {
+	var keywords []string
+	words := strings.FieldsFunc(instruction, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_./-", r)
+	})
+	for _, w := range words {
+		w = strings.ToLower(strings.Trim(w, "./-"))
+		if len(w) < 3 || slices.Contains(stopWords, w) || slices.Contains(keywords, w) {
+			continue
+		}
+		keywords = append(keywords, w)
+	}
+	return keywords
+}
@@ -0,0 +1,44 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerContextBudget(t *testing.T) {
+	require.NoError(t, axe.RegisterModel("budget-test-model", axe.ModelCapabilities{ContextWindow: 20_000, ToolCalling: true}))
+	dir := t.TempDir()
+	files := map[string]string{
+		"parser.txt": strings.Repeat("parse the input\n", 1_500),
+		"render.txt": strings.Repeat("render the output\n", 1_500),
+	}
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "fixed"))
+	runner, err := axe.NewRunner(dir, []string{"Fix the parser."}, cont.NewCodeContainer(files),
+		axe.WithModel("budget-test-model"),
+		axe.WithChatModel(model),
+		axe.WithContextBudget(0.5),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	estimate, err := runner.EstimatePromptTokens(context.Background())
+	require.NoError(t, err)
+	assert.LessOrEqual(t, estimate.Tokens, 10_000, "the code input leaves half of the window")
+
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	prompt := model.Requests()[0][1].Content
+	assert.Contains(t, prompt, `<File path="parser.txt" hash=`, "the file named by the instruction is kept whole")
+	assert.Contains(t, prompt, `<File path="render.txt" mode="excerpt"`)
+	assert.Contains(t, model.ToolNames(), "fetch_function")
+}
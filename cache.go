@@ -0,0 +1,313 @@
+package axe
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrCacheMiss is returned by model calls in CacheReplay mode when no response is cached.
+var ErrCacheMiss = errors.New("axe: no cached model response")
+
+// ResponseCache stores model responses by request key. Get returns (nil, nil) on a miss.
+type ResponseCache interface {
+	Get(key string) (*schema.Message, error)
+	Put(key string, msg *schema.Message) error
+}
+
+// CacheMode decides how the runner uses its ResponseCache.
+type CacheMode int
+
+const (
+	// CacheReadWrite replays cached responses and stores new ones, for cheap re-runs while
+	// iterating on prompts.
+	CacheReadWrite CacheMode = iota
+	// CacheReplay only replays cached responses and fails with ErrCacheMiss otherwise, for
+	// deterministic integration tests.
+	CacheReplay
+)
+
+// MemoryCache is an in-memory ResponseCache.
+type MemoryCache struct {
+	mu    sync.Mutex
+	items map[string]*schema.Message
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{items: map[string]*schema.Message{}}
+}
+
+func (c *MemoryCache) Get(key string) (*schema.Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.items[key], nil
+}
+
+func (c *MemoryCache) Put(key string, msg *schema.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = msg
+	return nil
+}
+
+// DirCache is a ResponseCache storing one JSON file per response in a directory, which can be
+// committed as test fixtures.
+type DirCache struct {
+	Dir string
+}
+
+func NewDirCache(dir string) *DirCache {
+	return &DirCache{Dir: dir}
+}
+
+func (c *DirCache) Get(key string) (*schema.Message, error) {
+	data, err := os.ReadFile(filepath.Join(c.Dir, key+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("axe: read cached response: %w", err)
+	}
+	var msg schema.Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("axe: decode cached response %s: %w", key, err)
+	}
+	return &msg, nil
+}
+
+func (c *DirCache) Put(key string, msg *schema.Message) error {
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("axe: encode response: %w", err)
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return fmt.Errorf("axe: create cache dir: %w", err)
+	}
+	// write then rename, so concurrent runners never read a partial file
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("axe: write cached response: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("axe: write cached response: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("axe: write cached response: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.Dir, key+".json")); err != nil {
+		return fmt.Errorf("axe: write cached response: %w", err)
+	}
+	return nil
+}
+
+// cachedModel serves model calls from a ResponseCache. Cache hits don't reach the wrapped model,
+// so they are neither rate limited nor reported to model callbacks.
+type cachedModel struct {
+	inner model.ToolCallingChatModel
+	cache ResponseCache
+	mode  CacheMode
+	id    any // model name and generation parameters, part of every key
+	tools []*schema.ToolInfo
+}
+
+func withResponseCache(m model.ToolCallingChatModel, cache ResponseCache, mode CacheMode, id any) model.ToolCallingChatModel {
+	if cache == nil {
+		return m
+	}
+	return &cachedModel{inner: m, cache: cache, mode: mode, id: id}
+}
+
+func (m *cachedModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	key, cached, err := m.lookup(input)
+	if err != nil || cached != nil {
+		return cached, err
+	}
+	msg, err := m.inner.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.cache.Put(key, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (m *cachedModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	key, cached, err := m.lookup(input)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		return schema.StreamReaderFromArray([]*schema.Message{cached}), nil
+	}
+	sr, err := m.inner.Stream(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// forward the chunks and store their concatenation once the stream completes
+	out, w := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer sr.Close()
+		defer w.Close()
+		var chunks []*schema.Message
+		for {
+			chunk, err := sr.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				w.Send(nil, err)
+				return
+			}
+			chunks = append(chunks, chunk)
+			if closed := w.Send(chunk, nil); closed {
+				return
+			}
+		}
+		msg, err := schema.ConcatMessages(chunks)
+		if err == nil {
+			err = m.cache.Put(key, msg)
+		}
+		if err != nil {
+			w.Send(nil, err)
+		}
+	}()
+	return out, nil
+}
+
+func (m *cachedModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	inner, err := m.inner.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedModel{inner: inner, cache: m.cache, mode: m.mode, id: m.id, tools: tools}, nil
+}
+
+func (m *cachedModel) IsCallbacksEnabled() bool {
+	return components.IsCallbacksEnabled(m.inner)
+}
+
+func (m *cachedModel) GetType() string {
+	typ, _ := components.GetType(m.inner)
+	return typ
+}
+
+// lookup returns the key of the request and the cached response, if any.
+func (m *cachedModel) lookup(input []*schema.Message) (string, *schema.Message, error) {
+	key, err := m.key(input)
+	if err != nil {
+		return "", nil, err
+	}
+	cached, err := m.cache.Get(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if cached == nil && m.mode == CacheReplay {
+		return "", nil, fmt.Errorf("%w for key %s", ErrCacheMiss, key)
+	}
+	return key, cached, nil
+}
+
+// key hashes the model id, the messages and the tools of a request. Response metadata and extra
+// fields of the messages (usage, ids) are left out since they change between identical runs.
+func (m *cachedModel) key(input []*schema.Message) (string, error) {
+	msgs := make([]schema.Message, 0, len(input))
+	for _, msg := range input {
+		if msg == nil {
+			continue
+		}
+		c := *msg
+		c.ResponseMeta, c.Extra = nil, nil
+		msgs = append(msgs, c)
+	}
+	type toolKey struct {
+		Name   string `json:"name"`
+		Desc   string `json:"desc"`
+		Params any    `json:"params,omitempty"`
+	}
+	tools := make([]toolKey, 0, len(m.tools))
+	for _, t := range m.tools {
+		k := toolKey{Name: t.Name, Desc: t.Desc}
+		if t.ParamsOneOf != nil {
+			s, err := t.ParamsOneOf.ToJSONSchema()
+			if err != nil {
+				return "", fmt.Errorf("axe: cache key: %w", err)
+			}
+			if k.Params, err = canonicalJSON(s); err != nil {
+				return "", fmt.Errorf("axe: cache key: %w", err)
+			}
+		}
+		tools = append(tools, k)
+	}
+	data, err := json.Marshal(struct {
+		Model    any              `json:"model"`
+		Messages []schema.Message `json:"messages"`
+		Tools    []toolKey        `json:"tools"`
+	}{m.id, msgs, tools})
+	if err != nil {
+		return "", fmt.Errorf("axe: cache key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON round-trips v through a generic value, so object keys are sorted. The required
+// lists of JSON schemas are sorted too: eino builds them from maps, in random order.
+func canonicalJSON(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	sortRequired(out)
+	return out, nil
+}
+
+func sortRequired(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if list, ok := child.([]any); ok && k == "required" {
+				sort.Slice(list, func(i, j int) bool { return fmt.Sprint(list[i]) < fmt.Sprint(list[j]) })
+			}
+			sortRequired(child)
+		}
+	case []any:
+		for _, child := range v {
+			sortRequired(child)
+		}
+	}
+}
+
+// replayOnlyModel stands in for the provider in CacheReplay mode, where misses fail before it is called.
+type replayOnlyModel struct{}
+
+func (replayOnlyModel) Generate(context.Context, []*schema.Message, ...model.Option) (*schema.Message, error) {
+	return nil, ErrCacheMiss
+}
+
+func (replayOnlyModel) Stream(context.Context, []*schema.Message, ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, ErrCacheMiss
+}
+
+func (m replayOnlyModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
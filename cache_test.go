@@ -0,0 +1,68 @@
+package axe_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerResponseCache(t *testing.T) {
+	dir, cacheDir := t.TempDir(), t.TempDir()
+	run := func(t *testing.T, model model.ToolCallingChatModel, mode axe.CacheMode, instruction string) (*axe.RunResult, error) {
+		code, err := cont.NewCodeContainerInDir(dir, nil)
+		require.NoError(t, err)
+		runner, err := axe.NewRunner(dir, []string{instruction}, code,
+			axe.WithChatModel(model),
+			axe.WithResponseCache(axe.NewDirCache(cacheDir), mode),
+			axe.WithSink(io.Discard),
+		)
+		require.NoError(t, err)
+		return runner.Run(context.Background(), false)
+	}
+
+	recorded := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: a.txt\n+hello\n*** End Patch"),
+		axetest.Finalize("success", "added a.txt"),
+	)
+	result, err := run(t, recorded, axe.CacheReadWrite, "add a.txt")
+	require.NoError(t, err)
+	assert.True(t, result.Success())
+	assert.Zero(t, recorded.Remaining())
+
+	// the streamed responses are stored whole, by rename: no temporary file is left behind
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.Equal(t, ".json", filepath.Ext(e.Name()))
+		var msg schema.Message
+		data, err := os.ReadFile(filepath.Join(cacheDir, e.Name()))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &msg))
+		require.Len(t, msg.ToolCalls, 1)
+	}
+
+	// the tools are rebuilt by the second runner: their schemas must hash the same
+	replayed := axetest.NewScriptedModel()
+	result, err = run(t, replayed, axe.CacheReplay, "add a.txt")
+	require.NoError(t, err)
+	assert.True(t, result.Success())
+	assert.Equal(t, "added a.txt", result.Changelog.Logs[0].Value)
+	assert.Empty(t, replayed.Requests(), "replays don't reach the model")
+
+	_, err = run(t, replayed, axe.CacheReplay, "add b.txt")
+	assert.ErrorIs(t, err, axe.ErrCacheMiss)
+	assert.Empty(t, replayed.Requests())
+}
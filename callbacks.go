@@ -0,0 +1,142 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	ucb "github.com/cloudwego/eino/utils/callbacks"
+)
+
+// ToolEvent describes a finished tool invocation observed through eino callbacks.
+type ToolEvent struct {
+	RunID     string // id of the run that made the call, see RunIDFromContext
+	Name      string // tool name, as exposed to the model
+	Arguments string // raw JSON arguments sent by the model
+	Response  string // tool response, empty when Err is set
+	Err       error
+}
+
+// ModelEvent describes a finished chat model call observed through eino callbacks.
+// For streamed calls, Message is the concatenation of all received chunks.
+type ModelEvent struct {
+	RunID      string // id of the run that made the call, see RunIDFromContext
+	Message    *schema.Message
+	TokenUsage *model.TokenUsage
+	Err        error
+}
+
+type toolArgsCtxKey struct{}
+
+type runIDCtxKey struct{}
+
+// RunIDFromContext returns the id of the run executing ctx, e.g. inside tools and callback
+// handlers, or "" outside of Runner.Run.
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDCtxKey{}).(string)
+	return id
+}
+
+// NewToolCallbackHandler adapts fn into an eino callbacks.Handler that is invoked once per tool call,
+// after the tool returns or fails.
+func NewToolCallbackHandler(fn func(ctx context.Context, ev ToolEvent)) callbacks.Handler {
+	return ucb.NewHandlerHelper().Tool(&ucb.ToolCallbackHandler{
+		OnStart: func(ctx context.Context, _ *callbacks.RunInfo, input *tool.CallbackInput) context.Context {
+			if input == nil {
+				return ctx
+			}
+			return context.WithValue(ctx, toolArgsCtxKey{}, input.ArgumentsInJSON)
+		},
+		OnEnd: func(ctx context.Context, info *callbacks.RunInfo, output *tool.CallbackOutput) context.Context {
+			ev := ToolEvent{RunID: RunIDFromContext(ctx), Name: info.Name, Arguments: toolArgsFromCtx(ctx)}
+			if output != nil {
+				ev.Response = output.Response
+			}
+			fn(ctx, ev)
+			return ctx
+		},
+		OnError: func(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+			fn(ctx, ToolEvent{RunID: RunIDFromContext(ctx), Name: info.Name, Arguments: toolArgsFromCtx(ctx), Err: err})
+			return ctx
+		},
+	}).Handler()
+}
+
+// NewModelCallbackHandler adapts fn into an eino callbacks.Handler that is invoked once per chat model call.
+// Streamed outputs are drained in a separate goroutine so the agent stream is not blocked.
+func NewModelCallbackHandler(fn func(ctx context.Context, ev ModelEvent)) callbacks.Handler {
+	return newModelCallbackHandler(fn, nil)
+}
+
+// newModelCallbackHandler is NewModelCallbackHandler adding the goroutines draining streamed
+// outputs to pending, if not nil, so their events can be awaited.
+func newModelCallbackHandler(fn func(ctx context.Context, ev ModelEvent), pending *sync.WaitGroup) callbacks.Handler {
+	return ucb.NewHandlerHelper().ChatModel(&ucb.ModelCallbackHandler{
+		OnEnd: func(ctx context.Context, _ *callbacks.RunInfo, output *model.CallbackOutput) context.Context {
+			if output != nil {
+				fn(ctx, ModelEvent{RunID: RunIDFromContext(ctx), Message: output.Message, TokenUsage: output.TokenUsage})
+			}
+			return ctx
+		},
+		OnEndWithStreamOutput: func(ctx context.Context, _ *callbacks.RunInfo, output *schema.StreamReader[*model.CallbackOutput]) context.Context {
+			if pending != nil {
+				pending.Add(1)
+			}
+			go func() {
+				if pending != nil {
+					defer pending.Done()
+				}
+				defer output.Close()
+				ev := drainModelStream(output)
+				ev.RunID = RunIDFromContext(ctx)
+				fn(ctx, ev)
+			}()
+			return ctx
+		},
+		OnError: func(ctx context.Context, _ *callbacks.RunInfo, err error) context.Context {
+			fn(ctx, ModelEvent{RunID: RunIDFromContext(ctx), Err: err})
+			return ctx
+		},
+	}).Handler()
+}
+
+func toolArgsFromCtx(ctx context.Context) string {
+	args, _ := ctx.Value(toolArgsCtxKey{}).(string)
+	return args
+}
+
+func drainModelStream(sr *schema.StreamReader[*model.CallbackOutput]) ModelEvent {
+	var ev ModelEvent
+	var chunks []*schema.Message
+	for {
+		out, err := sr.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				ev.Err = err
+			}
+			break
+		}
+		if out == nil {
+			continue
+		}
+		if out.Message != nil {
+			chunks = append(chunks, out.Message)
+		}
+		if out.TokenUsage != nil {
+			ev.TokenUsage = out.TokenUsage
+		}
+	}
+	if len(chunks) > 0 {
+		msg, err := schema.ConcatMessages(chunks)
+		if err != nil && ev.Err == nil {
+			ev.Err = err
+		}
+		ev.Message = msg
+	}
+	return ev
+}
@@ -0,0 +1,75 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolCallbackHandler(t *testing.T) {
+	var events []ToolEvent
+	h := NewToolCallbackHandler(func(_ context.Context, ev ToolEvent) { events = append(events, ev) })
+	info := &callbacks.RunInfo{Name: "apply_edit", Component: components.ComponentOfTool}
+	ctx := context.WithValue(context.Background(), runIDCtxKey{}, "run-1")
+
+	okCtx := h.OnStart(ctx, info, &tool.CallbackInput{ArgumentsInJSON: `{"patch":"x"}`})
+	h.OnEnd(okCtx, info, &tool.CallbackOutput{Response: "done"})
+	failCtx := h.OnStart(ctx, info, &tool.CallbackInput{ArgumentsInJSON: `{}`})
+	h.OnError(failCtx, info, errors.New("boom"))
+
+	require.Len(t, events, 2)
+	assert.Equal(t, ToolEvent{RunID: "run-1", Name: "apply_edit", Arguments: `{"patch":"x"}`, Response: "done"}, events[0])
+	assert.Equal(t, `{}`, events[1].Arguments)
+	assert.EqualError(t, events[1].Err, "boom")
+	assert.Empty(t, events[1].Response)
+}
+
+func TestModelCallbackHandler(t *testing.T) {
+	var events []ModelEvent
+	h := NewModelCallbackHandler(func(_ context.Context, ev ModelEvent) { events = append(events, ev) })
+	info := &callbacks.RunInfo{Component: components.ComponentOfChatModel}
+	ctx := context.WithValue(context.Background(), runIDCtxKey{}, "run-1")
+
+	usage := &model.TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+	h.OnEnd(ctx, info, &model.CallbackOutput{Message: schema.AssistantMessage("hi", nil), TokenUsage: usage})
+	h.OnError(ctx, info, errors.New("boom"))
+
+	require.Len(t, events, 2)
+	assert.Equal(t, "run-1", events[0].RunID)
+	assert.Equal(t, "hi", events[0].Message.Content)
+	assert.Equal(t, usage, events[0].TokenUsage)
+	assert.EqualError(t, events[1].Err, "boom")
+}
+
+func TestModelCallbackHandler_Stream(t *testing.T) {
+	var pending sync.WaitGroup
+	var events []ModelEvent
+	h := newModelCallbackHandler(func(_ context.Context, ev ModelEvent) { events = append(events, ev) }, &pending)
+	info := &callbacks.RunInfo{Component: components.ComponentOfChatModel}
+	ctx := context.WithValue(context.Background(), runIDCtxKey{}, "run-1")
+
+	last := &model.TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+	sr, sw := schema.Pipe[callbacks.CallbackOutput](4)
+	h.OnEndWithStreamOutput(ctx, info, sr)
+	sw.Send(&model.CallbackOutput{Message: schema.AssistantMessage("hel", nil)}, nil)
+	sw.Send(&model.CallbackOutput{Message: schema.AssistantMessage("lo", nil), TokenUsage: &model.TokenUsage{TotalTokens: 1}}, nil)
+	sw.Send(&model.CallbackOutput{TokenUsage: last}, nil)
+	sw.Close()
+
+	// the runner waits for the drains before reading the usage of the run
+	pending.Wait()
+	require.Len(t, events, 1)
+	assert.Equal(t, "run-1", events[0].RunID)
+	assert.Equal(t, "hello", events[0].Message.Content)
+	assert.Equal(t, last, events[0].TokenUsage)
+	assert.NoError(t, events[0].Err)
+}
@@ -0,0 +1,74 @@
+// Command axe-server exposes axe over HTTP so that other services and chat bots can drive it.
+//
+//	axe-server [-addr 127.0.0.1:8080] [-dir .] [-model gpt-4o] [-history .axe_history.xml] [-token secret]
+//
+// API:
+//
+//	POST /runs        {"instruction": "...", "paths": ["a.go"], "model": "gpt-4.1"} starts a run, 202 with its id
+//	GET  /runs/{id}   status and report of the run as JSON, or with "Accept: text/event-stream"
+//	                  its output as server-sent events: "output" events, then a final "done" event
+//
+// Paths are relative to -dir and may not leave it. When -token (or AXE_SERVER_TOKEN) is set, every
+// request needs an "Authorization: Bearer <token>" header; the server only listens on addresses
+// other than loopback with a token. Runs share the history file, so they run one at a time in the
+// order they were created, and are kept in memory only.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/stumble/axe"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address; other than loopback requires -token")
+	dir := flag.String("dir", ".", "base directory of the files runs may edit")
+	model := flag.String("model", string(axe.ModelGPT4o), "default model of runs")
+	historyFile := flag.String("history", "", "history file shared by the runs (default: the runner's default in -dir)")
+	token := flag.String("token", os.Getenv("AXE_SERVER_TOKEN"), "bearer token required by every request")
+	flag.Parse()
+
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+	if err := checkAddr(*addr, *token); err != nil {
+		logger.Fatal().Err(err).Msg("axe-server: listen")
+	}
+	var opts []axe.RunnerOption
+	if *historyFile != "" {
+		opts = append(opts, axe.WithHistory(*historyFile))
+	}
+	opts = append(opts, axe.WithLogger(logger))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	defer cancelRuns()
+
+	srv := newServer(runCtx, *dir, axe.ModelName(*model), *token, logger, opts...)
+	httpServer := &http.Server{Addr: *addr, Handler: srv.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		logger.Info().Msg("axe-server: shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		// interrupt the runs first so that event streams following them end
+		cancelRuns()
+		if err := srv.wait(shutdownCtx); err != nil {
+			logger.Warn().Err(err).Msg("axe-server: runs did not finish")
+		}
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info().Str("addr", *addr).Str("dir", *dir).Msg("axe-server: listening")
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal().Err(err).Msg("axe-server: listen")
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/stumble/axe"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+)
+
+// runStatus is the state of a run started by the server.
+type runStatus string
+
+const (
+	statusQueued  runStatus = "queued" // waiting for the run before it, see server.slot
+	statusRunning runStatus = "running"
+	statusDone    runStatus = "done"
+	statusFailed  runStatus = "failed" // Run returned an error
+)
+
+var kindNames = map[axe.OutputKind]string{
+	axe.OutputKindRunner:     "runner",
+	axe.OutputKindAgent:      "agent",
+	axe.OutputKindToolCall:   "tool_call",
+	axe.OutputKindToolResult: "tool_result",
+	axe.OutputKindHeartbeat:  "heartbeat",
+	axe.OutputKindPrompt:     "prompt",
+	axe.OutputKindSummary:    "summary",
+}
+
+// createRunRequest is the body of POST /runs.
+type createRunRequest struct {
+	Instruction string        `json:"instruction"`
+	Paths       []string      `json:"paths"`           // files loaded into the code container, relative to the base dir
+	Model       axe.ModelName `json:"model,omitempty"` // default model of the server when empty
+}
+
+// runView is the JSON representation of a run.
+type runView struct {
+	ID         string         `json:"id"`
+	Status     runStatus      `json:"status"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Report     *axe.RunReport `json:"report,omitempty"`
+}
+
+// outputEvent is the data of an SSE "output" event.
+type outputEvent struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// run is a run started by the server. Its output is kept in memory so that clients connecting
+// late get the whole stream.
+type run struct {
+	id        string
+	createdAt time.Time
+	runner    *axe.Runner
+
+	mu         sync.Mutex
+	status     runStatus
+	finishedAt time.Time
+	err        error
+	output     []outputEvent
+	changed    chan struct{} // closed and replaced on every change
+}
+
+func (r *run) append(e outputEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = append(r.output, e)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *run) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = statusRunning
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *run) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status, r.err, r.finishedAt = statusDone, err, time.Now()
+	if err != nil {
+		r.status = statusFailed
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// since returns the output after the first n events, whether the run is finished and a channel
+// closed on the next change.
+func (r *run) since(n int) ([]outputEvent, bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.output[n:], r.status == statusDone || r.status == statusFailed, r.changed
+}
+
+func (r *run) view() runView {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := runView{ID: r.id, Status: r.status, CreatedAt: r.createdAt}
+	if r.status == statusDone || r.status == statusFailed {
+		finished := r.finishedAt
+		v.FinishedAt = &finished
+		v.Report = r.runner.LastReport()
+	}
+	if r.err != nil {
+		v.Error = r.err.Error()
+	}
+	return v
+}
+
+// kindWriter is the sink of one output kind of a run.
+type kindWriter struct {
+	run  *run
+	kind string
+}
+
+func (w kindWriter) Write(p []byte) (int, error) {
+	w.run.append(outputEvent{Kind: w.kind, Text: string(p)})
+	return len(p), nil
+}
+
+// server serves the HTTP API. Runs are kept in memory until the process exits.
+type server struct {
+	baseDir string
+	model   axe.ModelName
+	token   string // bearer token required by every request, if set
+	opts    []axe.RunnerOption
+	log     zerolog.Logger
+
+	ctx context.Context // cancelled when the server shuts down
+
+	mu     sync.Mutex
+	runs   map[string]*run
+	wg     sync.WaitGroup
+	active int // runs queued or running
+	// slot is held by the running run: runs share the history file, whose lock a second
+	// concurrent run would fail to take, so they run one at a time.
+	slot chan struct{}
+}
+
+func newServer(ctx context.Context, baseDir string, model axe.ModelName, token string, logger zerolog.Logger, opts ...axe.RunnerOption) *server {
+	return &server{
+		baseDir: baseDir,
+		model:   model,
+		token:   token,
+		opts:    opts,
+		log:     logger,
+		ctx:     ctx,
+		runs:    make(map[string]*run),
+		slot:    make(chan struct{}, 1),
+	}
+}
+
+// checkAddr refuses to listen on an address other hosts can reach without a token: anyone
+// reaching the port could start runs editing the files, running tools and spending API credit.
+func checkAddr(addr, token string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("axe-server: invalid address %q: %w", addr, err)
+	}
+	if token != "" || host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("axe-server: refusing to listen on %s without a token, set -token or AXE_SERVER_TOKEN", addr)
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.createRun)
+	mux.HandleFunc("GET /runs/{id}", s.getRun)
+	return s.authenticate(mux)
+}
+
+func (s *server) authenticate(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// createRun starts a run in the background and responds with its id.
+func (s *server) createRun(w http.ResponseWriter, req *http.Request) {
+	var body createRunRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if strings.TrimSpace(body.Instruction) == "" {
+		writeError(w, http.StatusBadRequest, "instruction is required")
+		return
+	}
+	if len(body.Paths) == 0 {
+		writeError(w, http.StatusBadRequest, "paths is required")
+		return
+	}
+	code, err := cont.NewCodeContainerFromFS(s.baseDir, body.Paths)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r := &run{id: newID(), createdAt: time.Now(), status: statusQueued, changed: make(chan struct{})}
+	model := body.Model
+	if model == "" {
+		model = s.model
+	}
+	opts := append([]axe.RunnerOption{axe.WithModel(model)}, s.opts...)
+	sinks := make([]axe.NamedSink, 0, len(kindNames))
+	for kind, name := range kindNames {
+		sinks = append(sinks, axe.NamedSink{Name: name, Writer: kindWriter{run: r, kind: name}, Kinds: []axe.OutputKind{kind}})
+	}
+	opts = append(opts, axe.WithNamedSinks(sinks...))
+	r.runner, err = axe.NewRunner(s.baseDir, []string{body.Instruction}, code, opts...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "server is shutting down")
+		return
+	}
+	// the runs of the server wait for each other, but a run of another process holding the
+	// history lock would make this one fail after it was accepted
+	if s.active == 0 {
+		if err := probeLock(r.runner.History.FilePath); err != nil {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+	}
+	s.runs[r.id] = r
+	s.active++
+	s.wg.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.wg.Done()
+		var err error
+		select {
+		case s.slot <- struct{}{}:
+			r.start()
+			_, err = r.runner.Run(s.ctx, false)
+			<-s.slot
+		case <-s.ctx.Done():
+			err = s.ctx.Err()
+		}
+		if err != nil {
+			s.log.Error().Err(err).Str("id", r.id).Msg("axe-server: run failed")
+		}
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+		r.finish(err)
+	}()
+	s.log.Info().Str("id", r.id).Strs("paths", body.Paths).Msg("axe-server: run started")
+
+	w.Header().Set("Location", "/runs/"+r.id)
+	writeJSON(w, http.StatusAccepted, r.view())
+}
+
+// getRun responds with the status of a run, or streams its output as server-sent events when
+// the client accepts text/event-stream.
+func (s *server) getRun(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	r, ok := s.runs[req.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such run")
+		return
+	}
+	if strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		s.streamRun(w, req, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, r.view())
+}
+
+// streamRun sends the output of the run so far, then follows it. Every chunk is an "output" event;
+// a final "done" event carries the run's JSON representation.
+func (s *server) streamRun(w http.ResponseWriter, req *http.Request, r *run) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	for {
+		events, finished, changed := r.since(sent)
+		for _, e := range events {
+			if err := writeEvent(w, "output", e); err != nil {
+				return
+			}
+		}
+		sent += len(events)
+		if finished {
+			_ = writeEvent(w, "done", r.view())
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// probeLock checks that no other process holds the lock of the history file at path.
+func probeLock(path string) error {
+	if strings.TrimSpace(path) == "" {
+		return nil
+	}
+	lock, err := history.AcquireLock(path, 0)
+	if err != nil {
+		return fmt.Errorf("history file is in use: %v", err)
+	}
+	return lock.Unlock()
+}
+
+// wait waits for the runs in progress to finish, e.g. after ctx was cancelled.
+func (s *server) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.New("axe-server: no randomness: " + err.Error()))
+	}
+	return hex.EncodeToString(b)
+}
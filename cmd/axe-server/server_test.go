@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	"github.com/stumble/axe/history"
+)
+
+// newTestServer serves a server whose runs use model, in a directory with a.txt.
+func newTestServer(t *testing.T, ctx context.Context, token string, model *axetest.ScriptedModel) (*server, *httptest.Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644))
+	srv := newServer(ctx, dir, axe.ModelGPT4o, token, zerolog.Nop(),
+		axe.WithChatModel(model), axe.WithHistory(filepath.Join(dir, "history.xml")))
+	ts := httptest.NewServer(srv.handler())
+	t.Cleanup(ts.Close)
+	return srv, ts, dir
+}
+
+func post(t *testing.T, url, token, body string) (*http.Response, runView) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url+"/runs", strings.NewReader(body))
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var v runView
+	_ = json.NewDecoder(resp.Body).Decode(&v)
+	return resp, v
+}
+
+// waitDone polls the run until it is finished.
+func waitDone(t *testing.T, url, token, id string) runView {
+	t.Helper()
+	var v runView
+	require.Eventually(t, func() bool {
+		req, err := http.NewRequest(http.MethodGet, url+"/runs/"+id, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+		return v.Status == statusDone || v.Status == statusFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	return v
+}
+
+func TestCreateRun(t *testing.T) {
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Update File: a.txt\n-one\n+two\n*** End Patch"),
+		axetest.Finalize("success", "edited"),
+	)
+	_, ts, dir := newTestServer(t, context.Background(), "", model)
+
+	for body, want := range map[string]int{
+		`{"paths":["a.txt"]}`:                      http.StatusBadRequest,
+		`{"instruction":"edit"}`:                   http.StatusBadRequest,
+		`{"instruction":"edit","paths":["../x"]}`:  http.StatusBadRequest,
+		`{"instruction":"edit","unknown":true}`:    http.StatusBadRequest,
+		`{"instruction":"edit","paths":["b.txt"]}`: http.StatusBadRequest,
+		`{"instruction":"edit","paths":["a.txt"]}`: http.StatusAccepted,
+	} {
+		resp, _ := post(t, ts.URL, "", body)
+		assert.Equal(t, want, resp.StatusCode, body)
+		if resp.StatusCode == http.StatusAccepted {
+			waitDone(t, ts.URL, "", strings.TrimPrefix(resp.Header.Get("Location"), "/runs/"))
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "two\n", string(data))
+
+	resp, err := http.Get(ts.URL + "/runs/missing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCreateRun_HistoryLocked(t *testing.T) {
+	_, ts, dir := newTestServer(t, context.Background(), "", axetest.NewScriptedModel())
+	lock, err := history.AcquireLock(filepath.Join(dir, "history.xml"), 0)
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	resp, _ := post(t, ts.URL, "", `{"instruction":"edit","paths":["a.txt"]}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestCreateRun_Serialised(t *testing.T) {
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "first"), axetest.Finalize("success", "second"))
+	_, ts, _ := newTestServer(t, context.Background(), "", model)
+
+	var ids []string
+	for range 2 {
+		resp, v := post(t, ts.URL, "", `{"instruction":"edit","paths":["a.txt"]}`)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		ids = append(ids, v.ID)
+	}
+	for _, id := range ids {
+		v := waitDone(t, ts.URL, "", id)
+		assert.Equal(t, statusDone, v.Status, v.Error)
+	}
+}
+
+func TestStreamRun(t *testing.T) {
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))
+	_, ts, _ := newTestServer(t, context.Background(), "", model)
+	_, v := post(t, ts.URL, "", `{"instruction":"do nothing","paths":["a.txt"]}`)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/runs/"+v.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var events []string
+	var done runView
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if event, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, event)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && events[len(events)-1] == "done" {
+			require.NoError(t, json.Unmarshal([]byte(data), &done))
+		}
+	}
+	require.NotEmpty(t, events)
+	assert.Contains(t, events, "output")
+	assert.Equal(t, "done", events[len(events)-1])
+	assert.Equal(t, statusDone, done.Status)
+	require.NotNil(t, done.Report)
+}
+
+func TestAuthenticate(t *testing.T) {
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))
+	_, ts, _ := newTestServer(t, context.Background(), "secret", model)
+
+	resp, _ := post(t, ts.URL, "", `{"instruction":"edit","paths":["a.txt"]}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = post(t, ts.URL, "wrong", `{"instruction":"edit","paths":["a.txt"]}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, v := post(t, ts.URL, "secret", `{"instruction":"edit","paths":["a.txt"]}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp, err := http.Get(ts.URL + "/runs/" + v.ID)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	waitDone(t, ts.URL, "secret", v.ID)
+}
+
+func TestShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv, ts, _ := newTestServer(t, ctx, "", axetest.NewScriptedModel(axetest.Finalize("success", "done")))
+	_, v := post(t, ts.URL, "", `{"instruction":"edit","paths":["a.txt"]}`)
+
+	cancel()
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	require.NoError(t, srv.wait(waitCtx))
+	assert.NotEqual(t, statusRunning, waitDone(t, ts.URL, "", v.ID).Status)
+
+	resp, _ := post(t, ts.URL, "", `{"instruction":"edit","paths":["a.txt"]}`)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestCheckAddr(t *testing.T) {
+	assert.NoError(t, checkAddr("127.0.0.1:8080", ""))
+	assert.NoError(t, checkAddr("localhost:8080", ""))
+	assert.NoError(t, checkAddr("[::1]:8080", ""))
+	assert.NoError(t, checkAddr(":8080", "secret"))
+	assert.ErrorContains(t, checkAddr(":8080", ""), "without a token")
+	assert.ErrorContains(t, checkAddr("0.0.0.0:8080", ""), "without a token")
+	assert.Error(t, checkAddr("8080", ""))
+}
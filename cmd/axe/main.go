@@ -0,0 +1,207 @@
+// Command axe inspects the state axe keeps on disk.
+//
+//	axe history [-file .axe_history.xml] [-success|-failed] [-since 24h] [-grep keyword] [-json]
+//	axe history -run <run-id>
+//	axe restore [-file .axe_history.xml] [-dir .] [-dry-run] <run-id>
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/history"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "history":
+		err = historyCmd(os.Args[2:], os.Stdout)
+	case "restore":
+		err = restoreCmd(os.Args[2:], os.Stdout)
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "axe: unknown command %q\n", os.Args[1])
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "axe:", err)
+		os.Exit(1)
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: axe <command> [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  history   list and search past runs recorded in a history file")
+	fmt.Fprintln(w, "  restore   undo a run, and the runs after it, made with restore points")
+}
+
+func restoreCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	file := fs.String("file", axe.DefaultHistoryFile, "history file")
+	dir := fs.String("dir", ".", "base directory of the runs")
+	dryRun := fs.Bool("dry-run", false, "list the files that would be restored without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("restore: want exactly one run id")
+	}
+	h, err := history.ReadHistoryFromFile(*file)
+	if err != nil {
+		return fmt.Errorf("history: read %s: %w", *file, err)
+	}
+	restored, err := axe.Restore(*dir, h, fs.Arg(0), *dryRun)
+	for _, f := range restored {
+		fmt.Fprintf(out, "%s\t%s\n", f.Action, f.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if len(restored) == 0 {
+		fmt.Fprintln(out, "nothing to restore")
+	}
+	return nil
+}
+
+func historyCmd(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	file := fs.String("file", axe.DefaultHistoryFile, "history file")
+	success := fs.Bool("success", false, "only successful runs")
+	failed := fs.Bool("failed", false, "only failed runs")
+	since := fs.String("since", "", "only runs since a duration ago (e.g. 24h) or an RFC 3339 time")
+	grep := fs.String("grep", "", "only runs whose logs, TODO or report contain this keyword")
+	runID := fs.String("run", "", "print the full changelog of this run")
+	asJSON := fs.Bool("json", false, "print changelogs as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *success && *failed {
+		return errors.New("history: -success and -failed are exclusive")
+	}
+
+	h, err := history.ReadHistoryFromFile(*file)
+	if err != nil {
+		return fmt.Errorf("history: read %s: %w", *file, err)
+	}
+
+	if *runID != "" {
+		c, ok := h.FindByRunID(*runID)
+		if !ok {
+			return fmt.Errorf("history: no run %s in %s", *runID, *file)
+		}
+		if *asJSON {
+			return writeJSON(out, c)
+		}
+		printChangelog(out, c)
+		return nil
+	}
+
+	var filters []func(history.Changelog) bool
+	if *success || *failed {
+		filters = append(filters, history.SuccessIs(*success))
+	}
+	if *since != "" {
+		t, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		filters = append(filters, history.Since(t))
+	}
+	if *grep != "" {
+		filters = append(filters, history.Contains(*grep))
+	}
+	found := h.Find(filters...)
+	if *asJSON {
+		return writeJSON(out, found)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tTIME\tSTATUS\tTODO")
+	for _, c := range found {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", orDash(c.RunID), c.Timestamp.Local().Format(time.DateTime), status(c), oneLine(c.TODO, 60))
+	}
+	return tw.Flush()
+}
+
+// parseSince accepts a duration before now or an RFC 3339 time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("history: invalid -since %q: want a duration or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+func status(c history.Changelog) string {
+	switch {
+	case c.Interrupted:
+		return "interrupted"
+	case c.Success:
+		return "success"
+	case c.OutOfSteps:
+		return "out of steps"
+	case !c.Finalized:
+		return "unfinished"
+	}
+	return "failure"
+}
+
+func printChangelog(w io.Writer, c history.Changelog) {
+	fmt.Fprintf(w, "Run:    %s\n", orDash(c.RunID))
+	fmt.Fprintf(w, "Time:   %s\n", c.Timestamp.Local().Format(time.RFC3339))
+	fmt.Fprintf(w, "Status: %s\n", status(c))
+	if c.TODO != "" {
+		fmt.Fprintf(w, "TODO:   %s\n", c.TODO)
+	}
+	for _, q := range c.Questions {
+		fmt.Fprintf(w, "\nQ: %s\nA: %s\n", q.Question, q.Answer)
+	}
+	if c.Report != nil {
+		fmt.Fprintf(w, "\n--- report ---\n%s\n", strings.TrimRight(c.Report.Value, "\n"))
+	}
+	for _, l := range c.Logs {
+		fmt.Fprintf(w, "\n--- log ---\n%s\n", strings.TrimRight(l.Value, "\n"))
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// oneLine returns the first line of s, clipped to max runes.
+func oneLine(s string, max int) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
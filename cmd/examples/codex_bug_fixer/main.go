@@ -4,12 +4,15 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
+	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 
 	"github.com/stumble/axe"
 	cc "github.com/stumble/axe/code/container"
 	clitool "github.com/stumble/axe/tools/cli"
+	"github.com/stumble/axe/tools/finalize"
 )
 
 var instruction = `
@@ -44,7 +47,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to create runner: %v", err)
 	}
-	if err = runner.Run(context.Background(), true); err != nil {
-		log.Fatalf("failed to run: %v", err)
+	if err := godotenv.Load(); err != nil {
+		log.Printf("no .env file loaded: %v", err)
 	}
+	// the bug is fixed when the agent says so and the tests really pass
+	fixed := axe.AllOf(axe.FinalizedWithSuccess, axe.ValidatorsPass(finalize.GoTestValidator(baseDir)))
+	result, err := axe.RunUntil(context.Background(), runner, fixed, 3, axe.UntilBackoff(5*time.Second, time.Minute))
+	if err != nil {
+		log.Fatalf("bug not fixed: %v", err)
+	}
+	log.Printf("bug fixed in %d steps, %d files changed", result.Steps, len(result.FilesChanged))
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/stumble/axe"
 	cc "github.com/stumble/axe/code/container"
 	clitool "github.com/stumble/axe/tools/cli"
+	"github.com/stumble/axe/tools/gotest"
 )
 
 var instruction = `
@@ -19,6 +20,7 @@ You review go test code to check that if it follows the following standards:
 3. table-driven tests.
 4. cover both external public functions and internal functions.
 5. cover both positive and negative cases.
+6. reach at least 90% statement coverage of the code under test, check it with the go_coverage tool.
 
 If it does not follow the standards, you need to fix it. Note only fix the test code, not the code under test.
 You are not allowed to change the code under test.
@@ -28,21 +30,23 @@ Run the tests to see if it works.
 
 func main() {
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	baseDir := "demo" // relative to current working directory
+	baseDir := "demo"                                                                 // relative to current working directory
+	code := cc.MustNewCodeContainerFromFS(baseDir, []string{"add.go", "add_test.go"}) // same, relative to current wd
 	runner, err := axe.NewRunner(
 		baseDir,
 		[]string{instruction},
-		cc.MustNewCodeContainerFromFS(baseDir, []string{"add.go", "add_test.go"}), // same, relative to current wd
+		code,
 		axe.WithTools([]clitool.Definition{
 			clitool.MustNewDefinition("go_test", "go test -v", "run tests under wd with 'go test -v'", nil), // command will be executed in a wd, specified by llm.
 		}),
+		axe.WithExtraTools(&gotest.CoverageTool{Dir: baseDir, Code: code}),
 		axe.WithModel(axe.ModelGPT4Dot1),
 		axe.WithSink(os.Stdout),
 	)
 	if err != nil {
 		log.Fatalf("failed to create runner: %v", err)
 	}
-	err = runner.Run(context.Background(), true)
+	_, err = runner.Run(context.Background(), true)
 	if err != nil {
 		log.Fatalf("failed to run: %v", err)
 	}
@@ -0,0 +1,295 @@
+// Package anchor locates the declarations of a source file (functions, methods, classes, types) so
+// patches can anchor on their signatures instead of line numbers or context lines, which move with
+// unrelated edits earlier in the file. Go files are parsed with go/ast; other languages are scanned
+// for declaration lines, skipping comments.
+package anchor
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Decl is a declaration of a source file.
+type Decl struct {
+	Name      string // e.g. "Sub", or "Calc.Sub" for a Go method
+	Signature string // the first line of the declaration, without surrounding whitespace
+	Start     int    // 0-based line of the signature
+	End       int    // 0-based last line of the declaration
+}
+
+// shortName returns the name without its receiver or class.
+func (d Decl) shortName() string {
+	return d.Name[strings.LastIndexByte(d.Name, '.')+1:]
+}
+
+// Decls returns the declarations of the file at path with content src, in order. Go files that
+// don't parse, e.g. while being edited, are scanned like the other languages.
+func Decls(path, src string) []Decl {
+	if strings.HasSuffix(path, ".go") {
+		if decls, err := goDecls(path, src); err == nil {
+			return decls
+		}
+	}
+	return scanDecls(path, src)
+}
+
+func goDecls(path, src string) ([]Decl, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(src, "\n")
+	decl := func(name string, from, to token.Pos) Decl {
+		start, end := fset.Position(from).Line-1, fset.Position(to).Line-1
+		return Decl{Name: name, Signature: strings.TrimSpace(lines[start]), Start: start, End: end}
+	}
+	var decls []Decl
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = receiverType(d.Recv.List[0].Type) + "." + name
+			}
+			decls = append(decls, decl(name, d.Pos(), d.End()))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					from := ts.Pos()
+					if len(d.Specs) == 1 {
+						from = d.Pos() // the signature is the "type X ..." line
+					}
+					decls = append(decls, decl(ts.Name.Name, from, ts.End()))
+				}
+			}
+		}
+	}
+	return decls, nil
+}
+
+func receiverType(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(e.X)
+	case *ast.IndexExpr:
+		return receiverType(e.X)
+	case *ast.IndexListExpr:
+		return receiverType(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// declPatterns match the declaration lines of common languages; the first group is the name.
+var declPatterns = []*regexp.Regexp{
+	// Go
+	regexp.MustCompile(`^func\s+(?:\([^)]*\)\s*)?(\w+)`),
+	regexp.MustCompile(`^type\s+(\w+)`),
+	// Python, Ruby
+	regexp.MustCompile(`^(?:async\s+)?def\s+(?:self\.)?(\w+[?!]?)`),
+	// classes and types of most languages
+	regexp.MustCompile(`^(?:(?:export|default|public|private|protected|internal|static|final|abstract|sealed|partial|data|open)\s+)*(?:class|module|interface|enum|trait|struct|impl)\s+(\w+)`),
+	// JavaScript, TypeScript
+	regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`),
+	regexp.MustCompile(`^(?:export\s+)?(?:const|let|var)\s+(\w+)\s*=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*=>|\w+\s*=>)`),
+	// Rust
+	regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+(\w+)`),
+	regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|mod)\s+(\w+)`),
+	// Java, C#, Kotlin, C and C++ methods and functions: modifiers, a type, a name and parameters
+	regexp.MustCompile(`^(?:(?:public|private|protected|internal|static|final|abstract|virtual|override|async|inline|fun)\s+)*[\w<>\[\],.*&:]+\s+[*&]*(\w+)\s*\([^;]*$`),
+}
+
+// notNames are keywords the last pattern could take for a name.
+var notNames = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "else": true, "new": true}
+
+// declName returns the name a declaration line declares, "" if it isn't one.
+func declName(line string) string {
+	line = strings.TrimSpace(line)
+	for _, re := range declPatterns {
+		if m := re.FindStringSubmatch(line); m != nil && !notNames[m[1]] {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// isComment reports whether the trimmed line is a comment in one of the scanned languages.
+func isComment(line string) bool {
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", ";"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func scanDecls(file, src string) []Decl {
+	lines := strings.Split(src, "\n")
+	indented := path.Ext(file) == ".py"
+	var decls []Decl
+	inBlockComment := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if inBlockComment {
+			inBlockComment = !strings.Contains(trimmed, "*/")
+			continue
+		}
+		if strings.HasPrefix(trimmed, "/*") && !strings.Contains(trimmed, "*/") {
+			inBlockComment = true
+			continue
+		}
+		if trimmed == "" || isComment(trimmed) {
+			continue
+		}
+		name := declName(trimmed)
+		if name == "" {
+			continue
+		}
+		end := braceEnd(lines, i)
+		if indented {
+			end = indentEnd(lines, i)
+		}
+		decls = append(decls, Decl{Name: name, Signature: trimmed, Start: i, End: end})
+	}
+	return decls
+}
+
+// braceEnd returns the line closing the first brace opened at or after line start, start if no
+// brace opens there. Braces in strings and line comments are ignored.
+func braceEnd(lines []string, start int) int {
+	depth, opened := 0, false
+	for i := start; i < len(lines); i++ {
+		for _, c := range code(lines[i]) {
+			switch c {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+			if opened && depth <= 0 {
+				return i
+			}
+		}
+		if !opened && strings.HasSuffix(strings.TrimSpace(lines[i]), ";") {
+			return start // a declaration without body
+		}
+	}
+	return len(lines) - 1
+}
+
+// code returns the line without its string literals and line comment.
+func code(line string) string {
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '/' && strings.HasPrefix(line[i:], "//"):
+			return b.String()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// indentEnd returns the last line indented deeper than line start, the end of a Python block.
+func indentEnd(lines []string, start int) int {
+	indent := len(lines[start]) - len(strings.TrimLeft(lines[start], " \t"))
+	end := start
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		if len(lines[i])-len(strings.TrimLeft(lines[i], " \t")) <= indent {
+			break
+		}
+		end = i
+	}
+	return end
+}
+
+// Find returns the declaration anchor refers to: a signature as written in a patch header, e.g.
+// "func (c *Calc) Sub(a, b int) int" or "def sub(self, a, b):", even partial or outdated, or a bare
+// name ("Sub", "Calc.Sub"). Signatures are compared first, then names, then names without their
+// receiver or class; a name declared several times matches none of them.
+func Find(decls []Decl, anchor string) (Decl, bool) {
+	anchor = strings.TrimSpace(anchor)
+	if anchor == "" {
+		return Decl{}, false
+	}
+	if d, ok := unique(decls, func(d Decl) bool { return d.Signature == anchor }); ok {
+		return d, true
+	}
+	name, qualified := anchorName(anchor)
+	if name == "" {
+		return Decl{}, false
+	}
+	if d, ok := unique(decls, func(d Decl) bool { return d.Name == qualified }); ok {
+		return d, true
+	}
+	if qualified != name {
+		return Decl{}, false
+	}
+	return unique(decls, func(d Decl) bool { return d.shortName() == name })
+}
+
+// unique returns the only declaration matching match.
+func unique(decls []Decl, match func(Decl) bool) (Decl, bool) {
+	var found []Decl
+	for _, d := range decls {
+		if match(d) {
+			found = append(found, d)
+		}
+	}
+	if len(found) != 1 {
+		return Decl{}, false
+	}
+	return found[0], true
+}
+
+var (
+	identifier = regexp.MustCompile(`^[\w.]+$`)
+	goReceiver = regexp.MustCompile(`^func\s*\(\s*(?:\w+\s+)?\*?(\w+)`)
+)
+
+// anchorName returns the name an anchor refers to, and with the type of a Go method receiver.
+func anchorName(anchor string) (name, qualified string) {
+	if identifier.MatchString(anchor) {
+		if i := strings.LastIndexByte(anchor, '.'); i >= 0 {
+			return anchor[i+1:], anchor
+		}
+		return anchor, anchor
+	}
+	name = declName(anchor)
+	if name == "" {
+		// e.g. "Sub(a, b int)": the identifier before the parameters
+		before, _, ok := strings.Cut(anchor, "(")
+		if fields := strings.Fields(before); ok && len(fields) > 0 && identifier.MatchString(fields[len(fields)-1]) {
+			name = fields[len(fields)-1]
+		}
+	}
+	qualified = name
+	if m := goReceiver.FindStringSubmatch(anchor); m != nil && name != "" {
+		qualified = m[1] + "." + name
+	}
+	return name, qualified
+}
@@ -0,0 +1,86 @@
+package anchor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AnchorSuite struct{ suite.Suite }
+
+func TestAnchorSuite(t *testing.T) { suite.Run(t, new(AnchorSuite)) }
+
+const goSrc = `package calc
+
+// Calc adds and subtracts.
+type Calc struct {
+	total int
+}
+
+// Sub subtracts n.
+func (c *Calc) Sub(n int) {
+	c.total -= n
+}
+
+func Sub(a, b int) int {
+	return a - b
+}
+`
+
+func (s *AnchorSuite) TestDecls_Go() {
+	s.Equal([]Decl{
+		{Name: "Calc", Signature: "type Calc struct {", Start: 3, End: 5},
+		{Name: "Calc.Sub", Signature: "func (c *Calc) Sub(n int) {", Start: 8, End: 10},
+		{Name: "Sub", Signature: "func Sub(a, b int) int {", Start: 12, End: 14},
+	}, Decls("calc.go", goSrc))
+}
+
+func (s *AnchorSuite) TestDecls_OtherLanguages() {
+	py := "class Calc:\n    # def fake(self):\n    def sub(self, n):\n        self.total -= n\n\n    def add(self, n):\n        pass\n"
+	s.Equal([]Decl{
+		{Name: "Calc", Signature: "class Calc:", Start: 0, End: 6},
+		{Name: "sub", Signature: "def sub(self, n):", Start: 2, End: 3},
+		{Name: "add", Signature: "def add(self, n):", Start: 5, End: 6},
+	}, Decls("calc.py", py))
+
+	ts := "/* function hidden() {\n} */\nexport function sub(a: number, b: number): number {\n  const s = \"}\";\n  return a - b;\n}\nconst add = (a, b) => {\n  return a + b;\n};\n"
+	s.Equal([]Decl{
+		{Name: "sub", Signature: "export function sub(a: number, b: number): number {", Start: 2, End: 5},
+		{Name: "add", Signature: "const add = (a, b) => {", Start: 6, End: 8},
+	}, Decls("calc.ts", ts))
+
+	java := "public class Calc {\n    public int sub(int a, int b) {\n        if (a < b) {\n            return 0;\n        }\n        return a - b;\n    }\n}\n"
+	s.Equal([]Decl{
+		{Name: "Calc", Signature: "public class Calc {", Start: 0, End: 7},
+		{Name: "sub", Signature: "public int sub(int a, int b) {", Start: 1, End: 6},
+	}, Decls("Calc.java", java))
+}
+
+func (s *AnchorSuite) TestDecls_GoThatDoesNotParse() {
+	decls := Decls("calc.go", "package calc\n\nfunc Sub(a, b int) int {\n\treturn a -\n}\n")
+	s.Require().Len(decls, 1)
+	s.Equal("Sub", decls[0].Name)
+}
+
+func (s *AnchorSuite) TestFind() {
+	decls := Decls("calc.go", goSrc)
+	find := func(anchor string) string {
+		d, ok := Find(decls, anchor)
+		if !ok {
+			return ""
+		}
+		return d.Name
+	}
+	s.Equal("Sub", find("func Sub(a, b int) int {"), "the signature")
+	s.Equal("Sub", find("func Sub(a, b int) (int, error)"), "an outdated signature")
+	s.Equal("Calc.Sub", find("func (c *Calc) Sub(n int, more ...int)"), "the receiver tells the methods apart")
+	s.Equal("Calc.Sub", find("Calc.Sub"))
+	s.Equal("Sub", find("Sub"), "the function over the method")
+	s.Equal("Calc", find("type Calc struct"))
+	s.Equal("", find("func Add(a, b int) int"))
+	s.Equal("", find(""))
+
+	py := Decls("calc.py", "class A:\n    def run(self):\n        pass\n\nclass B:\n    def run(self):\n        pass\n")
+	_, ok := Find(py, "def run(self):")
+	s.False(ok, "an ambiguous name")
+}
@@ -10,7 +10,7 @@ package container
 //   source of truth during an editing session.
 // - CodeInput: XML serialization of selected files, with file contents wrapped
 //   in CDATA to preserve exact text.
-// - CodeOutput: XML describing edits; v4a diff text format.
+// - CodeOutput: XML describing edits; v4a diff text format by default, see EditFormat.
 //
 // Typical usage
 // 1) Load files from the file system into a CodeContainer.
@@ -20,32 +20,86 @@ package container
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
+	"github.com/stumble/axe/code/searchreplace"
+	"github.com/stumble/axe/code/udiff"
 	"github.com/stumble/axe/code/v4a"
+	"github.com/stumble/axe/internal/kinderr"
 )
 
 // CodeContainer holds an in-memory mapping of file paths to contents and offers
 // helpers to render inputs, apply outputs, and persist to disk.
 type CodeContainer struct {
+	// baseDir, if set, is the root of the files: keys are slash-separated paths relative to it and
+	// paths outside of it are rejected. Without it, paths are used as given.
+	baseDir string
 	files   map[string]string
 	deleted map[string]struct{}
+	// loaded is the content the container was created with, for Dirty; it is never mutated.
+	loaded map[string]string
+	// unsynced are the paths that may differ from the file system, written by WriteToFiles.
+	unsynced map[string]struct{}
+	// onDisk is the content of the files on disk, as last read or written by the container.
+	onDisk   map[string]string
+	policy   ExternalChangePolicy
+	external []ExternalChange
+	// shown is the hash of the content of the files as last shown to the model, see MarkShown.
+	shown map[string]string
+	// modes are the permissions set with SetMode, applied by WriteToFiles.
+	modes map[string]os.FileMode
+	// protected are the globs of the files that must not change, see SetProtectedPaths.
+	protected []string
 }
 
-// NewCodeContainer constructs a container with a copy of the provided files map.
+// NewCodeContainer constructs a container with a copy of the provided files map. The files are not
+// assumed to be on disk: the first WriteToFiles writes all of them.
 func NewCodeContainer(files map[string]string) *CodeContainer {
+	c := newCodeContainer(files)
+	for k := range files {
+		c.unsynced[k] = struct{}{}
+	}
+	return c
+}
+
+func newCodeContainer(files map[string]string) *CodeContainer {
 	copy := make(map[string]string, len(files))
 	for k, v := range files {
 		copy[k] = v
 	}
 	return &CodeContainer{
-		files:   copy,
-		deleted: make(map[string]struct{}),
+		files:    copy,
+		deleted:  make(map[string]struct{}),
+		loaded:   maps.Clone(copy),
+		unsynced: make(map[string]struct{}),
+		onDisk:   make(map[string]string),
+		shown:    make(map[string]string),
+		modes:    make(map[string]os.FileMode),
+	}
+}
+
+// NewCodeContainerInDir is NewCodeContainer with files rooted at baseDir; see Normalize for the
+// accepted paths.
+func NewCodeContainerInDir(baseDir string, files map[string]string) (*CodeContainer, error) {
+	c := NewCodeContainer(nil)
+	c.baseDir = baseDir
+	for p, content := range files {
+		key, err := c.Normalize(p)
+		if err != nil {
+			return nil, err
+		}
+		c.files[key] = content
+		c.loaded[key] = content
+		c.unsynced[key] = struct{}{}
 	}
+	return c, nil
 }
 
 // MustNewCodeContainerFromFS is a helper that panics if NewCodeContainerFromFS fails.
@@ -57,25 +111,83 @@ func MustNewCodeContainerFromFS(baseDir string, paths []string) *CodeContainer {
 	return cc
 }
 
-// NewCodeContainerFromFS reads given paths from baseDir (or absolute) into a container.
+// NewCodeContainerFromFS reads given paths from baseDir (or absolute) into a container. With a
+// baseDir, the files are keyed by their path relative to it, see Normalize.
 func NewCodeContainerFromFS(baseDir string, paths []string) (*CodeContainer, error) {
-	files := make(map[string]string, len(paths))
+	c := newCodeContainer(nil)
+	c.baseDir = baseDir
 	for _, p := range paths {
 		p = strings.TrimSpace(p)
 		if p == "" {
 			continue
 		}
-		full := p
-		if baseDir != "" && !filepath.IsAbs(p) {
-			full = filepath.Join(baseDir, p)
+		key, err := c.Normalize(p)
+		if err != nil {
+			return nil, err
 		}
-		data, err := os.ReadFile(full)
+		data, err := os.ReadFile(c.DiskPath(key))
 		if err != nil {
 			return nil, fmt.Errorf("code/context: read %s: %w", p, err)
 		}
-		files[full] = string(data)
+		c.files[key] = string(data)
 	}
-	return NewCodeContainer(files), nil
+	// the files match the disk, so WriteToFiles only writes what is edited later
+	c.loaded = maps.Clone(c.files)
+	maps.Copy(c.onDisk, c.files)
+	return c, nil
+}
+
+// BaseDir returns the root of the files, "" when paths are used as given.
+func (c *CodeContainer) BaseDir() string {
+	return c.baseDir
+}
+
+// Normalize returns the key of path in the container. With a base dir, relative paths are relative
+// to it (or, if that names no file, to the working directory when they start with the base dir),
+// absolute paths must be inside it, and keys use forward slashes: "./a/../b.go" and
+// "/abs/base/b.go" are both "b.go". Paths outside the base dir are an error.
+func (c *CodeContainer) Normalize(path string) (string, error) {
+	if c.baseDir == "" {
+		return path, nil
+	}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", errors.New("code/container: empty path")
+	}
+	var rel string
+	if filepath.IsAbs(path) {
+		base, err := filepath.Abs(c.baseDir)
+		if err != nil {
+			return "", fmt.Errorf("code/container: base dir: %w", err)
+		}
+		if rel, err = filepath.Rel(base, path); err != nil {
+			return "", fmt.Errorf("code/container: %s is outside the base dir %s", path, c.baseDir)
+		}
+	} else {
+		rel = filepath.Clean(filepath.FromSlash(path))
+		if !filepath.IsAbs(c.baseDir) {
+			// "demo/a.go" for base dir "demo" is a path relative to the working directory
+			if stripped, ok := strings.CutPrefix(rel, filepath.Clean(c.baseDir)+string(filepath.Separator)); ok {
+				if _, known := c.files[filepath.ToSlash(rel)]; !known {
+					if _, known := c.files[filepath.ToSlash(stripped)]; known {
+						rel = stripped
+					}
+				}
+			}
+		}
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("code/container: %s is outside the base dir %s", path, c.baseDir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// DiskPath returns the file system path of the file with key.
+func (c *CodeContainer) DiskPath(key string) string {
+	if c.baseDir == "" {
+		return key
+	}
+	return filepath.Join(c.baseDir, filepath.FromSlash(key))
 }
 
 // Files returns a copy of the current in-memory files map.
@@ -90,16 +202,97 @@ func (c *CodeContainer) Files() map[string]string {
 	return out
 }
 
+// Paths returns the sorted paths of the files in the container.
+func (c *CodeContainer) Paths() []string {
+	return slices.Sorted(maps.Keys(c.Files()))
+}
+
 // Clone returns a copy of the current container.
 func (c *CodeContainer) Clone() CodeContainer {
-	deleted := make(map[string]struct{}, len(c.deleted))
-	for k := range c.deleted {
-		deleted[k] = struct{}{}
-	}
 	return CodeContainer{
-		files:   c.Files(),
-		deleted: deleted,
+		baseDir:   c.baseDir,
+		files:     c.Files(),
+		deleted:   maps.Clone(c.deleted),
+		loaded:    c.loaded,
+		unsynced:  maps.Clone(c.unsynced),
+		onDisk:    maps.Clone(c.onDisk),
+		policy:    c.policy,
+		shown:     maps.Clone(c.shown),
+		modes:     maps.Clone(c.modes),
+		protected: c.protected,
+	}
+}
+
+// Change is the kind of change of a file since the container was created.
+type Change string
+
+const (
+	ChangeAdded    Change = "added"
+	ChangeModified Change = "modified"
+	ChangeDeleted  Change = "deleted"
+)
+
+// Dirty returns the files added, modified or deleted since the container was created. A file edited
+// back to its loaded content is not dirty.
+func (c *CodeContainer) Dirty() map[string]Change {
+	dirty := map[string]Change{}
+	for path, content := range c.Files() {
+		loaded, ok := c.loaded[path]
+		switch {
+		case !ok:
+			dirty[path] = ChangeAdded
+		case loaded != content:
+			dirty[path] = ChangeModified
+		}
+	}
+	for path := range c.loaded {
+		if !c.Has(path) {
+			dirty[path] = ChangeDeleted
+		}
+	}
+	return dirty
+}
+
+// Snapshot is an opaque copy of a container's state, see CodeContainer.Snapshot.
+type Snapshot struct {
+	files   map[string]string
+	deleted map[string]struct{}
+	shown   map[string]string
+	modes   map[string]os.FileMode
+}
+
+// Snapshot captures the current state so it can be restored with Restore, e.g. to roll back
+// a patch that failed half-way.
+func (c *CodeContainer) Snapshot() Snapshot {
+	clone := c.Clone()
+	return Snapshot{files: clone.files, deleted: clone.deleted, shown: clone.shown, modes: clone.modes}
+}
+
+// Restore resets the container to a state captured by Snapshot. Files changed since the snapshot
+// are written back by the next WriteToFiles, except files added since the snapshot, which are not
+// removed from disk; use Snapshot.Has to find them.
+func (c *CodeContainer) Restore(s Snapshot) {
+	restored := (&CodeContainer{files: s.files, deleted: s.deleted}).Clone()
+	paths := maps.Clone(c.deleted)
+	for p := range c.files {
+		paths[p] = struct{}{}
+	}
+	for p := range paths {
+		_, wasDeleted := s.deleted[p]
+		switch {
+		case !s.Has(p) && !wasDeleted:
+			delete(c.unsynced, p)
+		case c.Has(p) != restored.Has(p) || c.files[p] != restored.files[p] || c.modes[p] != s.modes[p]:
+			c.unsynced[p] = struct{}{}
+		}
 	}
+	c.files, c.deleted, c.shown, c.modes = restored.files, restored.deleted, maps.Clone(s.shown), maps.Clone(s.modes)
+}
+
+// Has reports whether path is part of the snapshot.
+func (s Snapshot) Has(path string) bool {
+	_, ok := s.files[path]
+	return ok
 }
 
 // BuildCodeInput renders a CodeInput for the selected paths (or all when empty).
@@ -107,48 +300,299 @@ func (c *CodeContainer) BuildCodeInput(filter []string) CodeInput {
 	return BuildCodeInput(c.files, filter)
 }
 
+// BuildCodeInputWithLimits renders a CodeInput for the selected paths, reducing oversized files.
+func (c *CodeContainer) BuildCodeInputWithLimits(filter []string, limits InputLimits) CodeInput {
+	return BuildCodeInputWithLimits(c.files, filter, limits)
+}
+
+// Has reports whether path is a (not deleted) file of the container.
+func (c *CodeContainer) Has(path string) bool {
+	path, err := c.Normalize(path)
+	if err != nil {
+		return false
+	}
+	if _, ok := c.deleted[path]; ok {
+		return false
+	}
+	_, ok := c.files[path]
+	return ok
+}
+
 func (c *CodeContainer) Open(path string) (string, error) {
+	path, err := c.Normalize(path)
+	if err != nil {
+		return "", err
+	}
 	if _, ok := c.deleted[path]; ok {
 		return "", fmt.Errorf("code/container: file %s was deleted", path)
 	}
 	return c.files[path], nil
 }
 
+// Load adds path to the container, read from disk, and returns its content. Like the files of
+// NewCodeContainerFromFS, a loaded file is not dirty until edited. A file already in the container
+// is returned as is.
+func (c *CodeContainer) Load(path string) (string, error) {
+	key, err := c.Normalize(path)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := c.deleted[key]; ok {
+		return "", fmt.Errorf("code/container: file %s was deleted", key)
+	}
+	if content, ok := c.files[key]; ok {
+		return content, nil
+	}
+	data, err := os.ReadFile(c.DiskPath(key))
+	if err != nil {
+		return "", fmt.Errorf("code/container: read %s: %w", path, err)
+	}
+	content := string(data)
+	c.files[key] = content
+	c.onDisk[key] = content
+	if _, ok := c.loaded[key]; !ok {
+		// loaded is shared by clones, never mutated: copy it on write
+		c.loaded = maps.Clone(c.loaded)
+		c.loaded[key] = content
+	}
+	return content, nil
+}
+
 func (c *CodeContainer) Write(path, content string) error {
+	path, err := c.Normalize(path)
+	if err != nil {
+		return err
+	}
+	if current, ok := c.files[path]; ok && current == content && c.Has(path) {
+		return nil
+	}
+	if err := c.checkProtected(path); err != nil {
+		return err
+	}
 	c.files[path] = content
 	delete(c.deleted, path)
+	c.unsynced[path] = struct{}{}
 	return nil
 }
 
 func (c *CodeContainer) Remove(path string) error {
+	path, err := c.Normalize(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.deleted[path]; ok {
+		return nil
+	}
+	if err := c.checkProtected(path); err != nil {
+		return err
+	}
 	delete(c.files, path)
+	delete(c.modes, path)
 	c.deleted[path] = struct{}{}
+	c.unsynced[path] = struct{}{}
+	return nil
+}
+
+// SetMode sets the permissions WriteToFiles gives the file, e.g. 0o755 for an executable script.
+// Without it, new files are created with mode 0600 and existing files keep theirs.
+func (c *CodeContainer) SetMode(path string, mode os.FileMode) error {
+	path, err := c.Normalize(path)
+	if err != nil {
+		return err
+	}
+	if !c.Has(path) {
+		return kinderr.Errorf(ErrMissingFile, "code/container: set mode of %s: missing file", path)
+	}
+	if err := c.checkProtected(path); err != nil {
+		return err
+	}
+	if mode&^os.ModePerm != 0 || mode == 0 {
+		return fmt.Errorf("code/container: set mode of %s: invalid permissions %#o", path, mode)
+	}
+	if c.modes == nil {
+		c.modes = make(map[string]os.FileMode)
+	}
+	if c.modes[path] != mode {
+		c.modes[path] = mode
+		c.unsynced[path] = struct{}{}
+	}
 	return nil
 }
 
-// Apply applies a CodeOutput to the container, mutating its files. Returns a message.
+// Mode returns the permissions set with SetMode, if any.
+func (c *CodeContainer) Mode(path string) (os.FileMode, bool) {
+	path, err := c.Normalize(path)
+	if err != nil {
+		return 0, false
+	}
+	mode, ok := c.modes[path]
+	return mode, ok
+}
+
+// Apply applies a v4a CodeOutput to the container, mutating its files. Returns a message.
 func (c *CodeContainer) Apply(output CodeOutput) (string, error) {
-	return v4a.ApplyPatch(c, output.Patch)
+	return c.ApplyFormat(output, EditFormatV4A)
 }
 
-// WriteToFiles applies all changes to the container to the file system.
-func (c *CodeContainer) WriteToFiles() error {
-	for f, c := range c.files {
-		if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
-			return fmt.Errorf("code/container: create dir for %s: %w", f, err)
+// ApplyFormat applies a CodeOutput written in format to the container. The Add, Rewrite and Delete
+// elements are applied first, in any format, then the patch text. Returns a message.
+func (c *CodeContainer) ApplyFormat(output CodeOutput, format EditFormat) (string, error) {
+	return c.ApplyFormatWithOptions(output, format, v4a.Options{})
+}
+
+// ApplyFormatWithOptions is ApplyFormat matching the context of v4a patches with opts, e.g. to
+// accept contexts that are only similar to the file.
+func (c *CodeContainer) ApplyFormatWithOptions(output CodeOutput, format EditFormat, opts v4a.Options) (string, error) {
+	if !format.Valid() {
+		return "", fmt.Errorf("code/container: unknown edit format %q", format)
+	}
+	patch := strings.TrimSpace(output.Patch)
+	hasElements := len(output.Adds)+len(output.Rewrites)+len(output.Deletes) > 0
+	switch {
+	case format == EditFormatWholeFile && patch != "":
+		return "", errors.New("code/container: the whole_file format expects Rewrite elements, not patch text")
+	case !hasElements && format == EditFormatWholeFile:
+		return "", errors.New("code/container: CodeOutput has no Rewrite element")
+	case !hasElements && patch == "":
+		return "", errors.New("code/container: CodeOutput has no edits")
+	}
+
+	if err := c.checkExpected(output.Expects); err != nil {
+		return "", err
+	}
+	if patch != "" && format != EditFormatUnified {
+		updated := v4a.UpdatedFiles(patch)
+		if format == EditFormatSearchReplace {
+			updated = searchreplace.UpdatedFiles(patch)
 		}
-		mode := os.FileMode(0o600)
-		if info, statErr := os.Stat(f); statErr == nil {
-			mode = info.Mode()
+		if err := c.checkFresh(updated); err != nil {
+			return "", err
 		}
-		if err := os.WriteFile(f, []byte(c), mode); err != nil {
-			return fmt.Errorf("code/container: write %s: %w", f, err)
+	}
+
+	before := c.Files()
+	var msgs []string
+	if hasElements {
+		msg, err := c.applyElements(output)
+		if err != nil {
+			return "", err
 		}
+		msgs = append(msgs, msg)
 	}
-	for f := range c.deleted {
-		if err := os.Remove(f); err != nil {
-			return fmt.Errorf("code/container: remove %s: %w", f, err)
+	if patch != "" {
+		var msg string
+		var err error
+		switch format {
+		case EditFormatUnified:
+			msg, err = udiff.ApplyPatch(c, strings.TrimLeft(output.Patch, "\n"))
+		case EditFormatSearchReplace:
+			msg, err = searchreplace.ApplyPatch(c, output.Patch)
+		default:
+			msg, err = v4a.ApplyPatchWithOptions(c, output.Patch, opts)
 		}
+		if err != nil {
+			return "", classifyPatchError(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	c.markEdited(before)
+	return strings.Join(msgs, "; "), nil
+}
+
+// applyElements applies the Add, Rewrite and Delete elements of output. A path may only appear in
+// one of them.
+func (c *CodeContainer) applyElements(output CodeOutput) (string, error) {
+	seen := map[string]bool{}
+	check := func(element, path string) (string, error) {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return "", fmt.Errorf("code/container: %s element without path", element)
+		}
+		if seen[path] {
+			return "", fmt.Errorf("code/container: %s is edited by more than one element", path)
+		}
+		seen[path] = true
+		return path, nil
+	}
+
+	var done []string
+	for _, add := range output.Adds {
+		path, err := check("Add", add.Path)
+		if err != nil {
+			return "", err
+		}
+		if c.Has(path) {
+			return "", fmt.Errorf("code/container: add %s: file already exists, use Rewrite", path)
+		}
+		if err := c.Write(path, add.Text()); err != nil {
+			return "", err
+		}
+		done = append(done, "added "+path)
+	}
+	for _, rw := range output.Rewrites {
+		path, err := check("Rewrite", rw.Path)
+		if err != nil {
+			return "", err
+		}
+		if err := c.Write(path, rw.Text()); err != nil {
+			return "", err
+		}
+		done = append(done, "rewrote "+path)
+	}
+	for _, del := range output.Deletes {
+		path, err := check("Delete", del.Path)
+		if err != nil {
+			return "", err
+		}
+		if !c.Has(path) {
+			return "", kinderr.Errorf(ErrMissingFile, "code/container: delete %s: missing file", path)
+		}
+		if err := c.Remove(path); err != nil {
+			return "", err
+		}
+		done = append(done, "deleted "+path)
+	}
+	return strings.Join(done, ", "), nil
+}
+
+// WriteToFiles applies the changes of the container to the file system. Only files written or
+// removed since the last WriteToFiles are touched, so unchanged files keep their mtime. Files
+// changed on disk in the meantime are handled according to the ExternalChangePolicy.
+func (c *CodeContainer) WriteToFiles() error {
+	if err := c.reconcile(slices.Sorted(maps.Keys(c.unsynced))); err != nil {
+		return err
+	}
+	for _, f := range slices.Sorted(maps.Keys(c.unsynced)) {
+		path := c.DiskPath(f)
+		if content, ok := c.files[f]; ok {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return fmt.Errorf("code/container: create dir for %s: %w", f, err)
+			}
+			mode := os.FileMode(0o600)
+			if info, statErr := os.Stat(path); statErr == nil {
+				mode = info.Mode()
+			}
+			set, hasMode := c.modes[f]
+			if hasMode {
+				mode = set
+			}
+			if err := os.WriteFile(path, []byte(content), mode); err != nil {
+				return fmt.Errorf("code/container: write %s: %w", f, err)
+			}
+			// WriteFile keeps the mode of existing files and applies the umask to new ones
+			if hasMode {
+				if err := os.Chmod(path, set); err != nil {
+					return fmt.Errorf("code/container: set mode of %s: %w", f, err)
+				}
+			}
+			c.onDisk[f] = content
+		} else if _, ok := c.deleted[f]; ok {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("code/container: remove %s: %w", f, err)
+			}
+			delete(c.onDisk, f)
+		}
+		delete(c.unsynced, f)
 	}
 	return nil
 }
@@ -176,6 +620,18 @@ type CodeInput struct {
 type CodeFile struct {
 	Path    string `xml:"path,attr"`
 	Content string `xml:"-"`
+	// Mode is set when Content is not the full file, see InputLimits; Size is then the full size in bytes.
+	Mode string `xml:"mode,attr,omitempty"`
+	Size int    `xml:"size,attr,omitempty"`
+	// Hash is the ContentHash of the full file, which an Expect element of CodeOutput can name.
+	Hash string `xml:"hash,attr,omitempty"`
+}
+
+// BuildCodeInputWithLimits is BuildCodeInput with oversized files reduced according to limits.
+func BuildCodeInputWithLimits(files map[string]string, filter []string, limits InputLimits) CodeInput {
+	ci := BuildCodeInput(files, filter)
+	limits.apply(&ci)
+	return ci
 }
 
 // BuildCodeInput builds a CodeInput document from the provided files map.
@@ -208,7 +664,7 @@ func BuildCodeInput(files map[string]string, filter []string) CodeInput {
 
 	out := CodeInput{Files: make([]CodeFile, 0, len(selected))}
 	for _, p := range selected {
-		out.Files = append(out.Files, CodeFile{Path: p, Content: files[p]})
+		out.Files = append(out.Files, CodeFile{Path: p, Content: files[p], Hash: ContentHash(files[p])})
 	}
 	return out
 }
@@ -225,11 +681,17 @@ func (f CodeFile) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	type inner struct {
 		XMLName xml.Name `xml:"File"`
 		Path    string   `xml:"path,attr"`
+		Mode    string   `xml:"mode,attr,omitempty"`
+		Size    int      `xml:"size,attr,omitempty"`
+		Hash    string   `xml:"hash,attr,omitempty"`
 		// Inject raw CDATA using innerxml
 		Data string `xml:",innerxml"`
 	}
 	safe := strings.ReplaceAll(f.Content, "]]>", "]]]]><![CDATA[>")
-	payload := inner{Path: f.Path, Data: "<![CDATA[" + safe + "]]" + ">"}
+	payload := inner{Path: f.Path, Mode: f.Mode, Size: f.Size, Hash: f.Hash, Data: "<![CDATA[" + safe + "]]" + ">"}
+	if f.Mode == FileModeSkipped {
+		payload.Data = ""
+	}
 	return e.EncodeElement(payload, xml.StartElement{Name: xml.Name{Local: "File"}})
 }
 
@@ -246,10 +708,54 @@ func (f CodeFile) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 //
 // *** End Patch
 // </CodeOutput>
+//
+// Files can also be edited as a whole, in any edit format, with Add, Rewrite and Delete elements.
+// They are applied before the patch text; with EditFormatWholeFile they are the only edits:
+// <CodeOutput>
+//
+//	<Rewrite path="notes.txt"><![CDATA[
+//	hi
+//	world
+//	]]></Rewrite>
+//	<Add path="new.txt"><![CDATA[new file]]></Add>
+//	<Delete path="old.txt"/>
+//
+// </CodeOutput>
+//
+// Expect elements are preconditions: the edits are only applied if the files still have the hash
+// the model saw in CodeInput, so it can't edit a file based on content it read many steps earlier:
+// <CodeOutput><Expect path="notes.txt" hash="3f2a9c0b1d4e"/><![CDATA[...]]></CodeOutput>
 type CodeOutput struct {
-	XMLName xml.Name `xml:"CodeOutput"`
-	Version string   `xml:"version,attr,omitempty"`
-	Patch   string   `xml:",chardata"`
+	XMLName  xml.Name      `xml:"CodeOutput"`
+	Version  string        `xml:"version,attr,omitempty"`
+	Patch    string        `xml:",chardata"`
+	Adds     []FileContent `xml:"Add"`     // new files; adding an existing file fails
+	Rewrites []FileContent `xml:"Rewrite"` // files replaced as a whole, created if needed
+	Deletes  []FileDelete  `xml:"Delete"`
+	Expects  []FileExpect  `xml:"Expect"`
+}
+
+// FileContent is the path and complete content of a file in an Add or Rewrite element.
+type FileContent struct {
+	Path    string `xml:"path,attr"`
+	Content string `xml:",chardata"`
+}
+
+// Text returns the new content of the file, without the newline models put right after
+// the opening CDATA.
+func (f FileContent) Text() string {
+	return strings.TrimPrefix(strings.TrimPrefix(f.Content, "\r"), "\n")
+}
+
+// FileDelete removes a file.
+type FileDelete struct {
+	Path string `xml:"path,attr"`
+}
+
+// FileExpect requires a file to have a content hash, see CodeFile.Hash.
+type FileExpect struct {
+	Path string `xml:"path,attr"`
+	Hash string `xml:"hash,attr"`
 }
 
 // ParseCodeOutput parses a CodeOutput XML payload.
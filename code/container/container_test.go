@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+
+	"github.com/stumble/axe/code/v4a"
 )
 
 type ContextSuite struct{ suite.Suite }
@@ -32,8 +34,8 @@ func (s *ContextSuite) TestRenderCodeInput_CDATA_And_PathAttr() {
 	s.Require().NoError(err)
 	s.Contains(xml, "<CodeInput>")
 	// paths present
-	s.Contains(xml, "<File path=\"a.go\">")
-	s.Contains(xml, "<File path=\"b.txt\">")
+	s.Contains(xml, "<File path=\"a.go\" hash=\""+ContentHash(files["a.go"])+"\">")
+	s.Contains(xml, "<File path=\"b.txt\" hash=\""+ContentHash("hello")+"\">")
 	// CDATA present
 	s.Contains(xml, "<![CDATA[")
 	s.Contains(xml, "]]>")
@@ -124,6 +126,28 @@ func (s *ContextSuite) TestCodeContainer_Apply_InvalidPatch() {
 	s.Contains(err.Error(), "Patch text must start with")
 }
 
+func (s *ContextSuite) TestCodeContainer_SnapshotRestore() {
+	cc := NewCodeContainer(map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+	})
+	snapshot := cc.Snapshot()
+
+	s.Require().NoError(cc.Write("a.txt", "changed"))
+	s.Require().NoError(cc.Write("c.txt", "c"))
+	s.Require().NoError(cc.Remove("b.txt"))
+
+	cc.Restore(snapshot)
+	s.Equal(map[string]string{"a.txt": "a", "b.txt": "b"}, cc.Files())
+	s.True(snapshot.Has("a.txt"))
+	s.False(snapshot.Has("c.txt"))
+
+	// the snapshot is not aliased by the container after Restore
+	s.Require().NoError(cc.Write("a.txt", "again"))
+	cc.Restore(snapshot)
+	s.Equal("a", cc.Files()["a.txt"])
+}
+
 func (s *ContextSuite) TestCodeContainer_WriteToFiles_WithDeletes() {
 	dir := s.T().TempDir()
 
@@ -190,3 +214,410 @@ func (s *ContextSuite) TestCodeContainer_WriteToFiles_PreservesPermissions() {
 	s.Require().NoError(err)
 	s.Equal("#!/bin/bash\necho world", string(data))
 }
+
+func (s *ContextSuite) TestCodeContainer_ApplyFormat() {
+	cc := NewCodeContainer(map[string]string{"a.txt": "one\ntwo\n"})
+
+	co, err := ParseCodeOutput("<CodeOutput>\n  <Rewrite path=\"a.txt\"><![CDATA[\nuno\ndos\n]]></Rewrite>\n  <Rewrite path=\"b.txt\"><![CDATA[b\n]]></Rewrite>\n</CodeOutput>")
+	s.Require().NoError(err)
+	msg, err := cc.ApplyFormat(co, EditFormatWholeFile)
+	s.Require().NoError(err)
+	s.Equal("rewrote a.txt, rewrote b.txt", msg)
+	s.Equal(map[string]string{"a.txt": "uno\ndos\n", "b.txt": "b\n"}, cc.Files())
+
+	co, err = ParseCodeOutput("<CodeOutput><![CDATA[\n--- a.txt\n+++ a.txt\n@@ -1,2 +1,2 @@\n-uno\n+one\n dos\n]]></CodeOutput>")
+	s.Require().NoError(err)
+	_, err = cc.ApplyFormat(co, EditFormatUnified)
+	s.Require().NoError(err)
+	s.Equal("one\ndos\n", cc.Files()["a.txt"])
+
+	co, err = ParseCodeOutput("<CodeOutput><![CDATA[\nb.txt\n<<<<<<< SEARCH\nb\n=======\nbee\n>>>>>>> REPLACE\n]]></CodeOutput>")
+	s.Require().NoError(err)
+	_, err = cc.ApplyFormat(co, EditFormatSearchReplace)
+	s.Require().NoError(err)
+	s.Equal("bee\n", cc.Files()["b.txt"])
+	_, err = cc.ApplyFormat(co, EditFormatSearchReplace)
+	s.ErrorIs(err, ErrPatchContextNotFound)
+
+	_, err = cc.ApplyFormat(co, EditFormatWholeFile)
+	s.ErrorContains(err, "expects Rewrite elements, not patch text")
+	_, err = cc.ApplyFormat(co, "xml")
+	s.ErrorContains(err, `unknown edit format "xml"`)
+}
+
+func (s *ContextSuite) TestCodeContainer_Apply_FileElements() {
+	cc := NewCodeContainer(map[string]string{"a.txt": "one\ntwo", "old.txt": "old"})
+
+	// elements are applied before the v4a patch, which can update the added file
+	co, err := ParseCodeOutput(`<CodeOutput>
+  <Add path="new.txt"><![CDATA[
+new
+]]></Add>
+  <Delete path="old.txt"/>
+  <![CDATA[
+*** Begin Patch
+*** Update File: new.txt
+-new
++newer
+*** End Patch
+]]>
+</CodeOutput>`)
+	s.Require().NoError(err)
+	msg, err := cc.Apply(co)
+	s.Require().NoError(err)
+	s.Equal("added new.txt, deleted old.txt; Done!", msg)
+	s.Equal(map[string]string{"a.txt": "one\ntwo", "new.txt": "newer\n"}, cc.Files())
+
+	for payload, want := range map[string]string{
+		`<CodeOutput><Add path="a.txt">x</Add></CodeOutput>`:                               "add a.txt: file already exists",
+		`<CodeOutput><Delete path="missing.txt"/></CodeOutput>`:                            "delete missing.txt: missing file",
+		`<CodeOutput><Rewrite path="a.txt">x</Rewrite><Delete path="a.txt"/></CodeOutput>`: "a.txt is edited by more than one element",
+		`<CodeOutput><Rewrite>x</Rewrite></CodeOutput>`:                                    "Rewrite element without path",
+		`<CodeOutput> </CodeOutput>`:                                                       "CodeOutput has no edits",
+	} {
+		co, err := ParseCodeOutput(payload)
+		s.Require().NoError(err)
+		_, err = cc.Apply(co)
+		s.ErrorContains(err, want, payload)
+	}
+}
+
+func (s *ContextSuite) TestCodeContainer_Dirty_WritesOnlyChangedFiles() {
+	dir := s.T().TempDir()
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	for _, p := range []string{a, b} {
+		s.Require().NoError(os.WriteFile(p, []byte("orig "+filepath.Base(p)), 0o644))
+	}
+	cc, err := NewCodeContainerFromFS("", []string{a, b})
+	s.Require().NoError(err)
+	s.Empty(cc.Dirty())
+
+	// b is removed from disk behind the container's back: an untouched file must not be rewritten
+	s.Require().NoError(os.Remove(b))
+	s.Require().NoError(cc.Write(a, "changed"))
+	s.Require().NoError(cc.Write(c, "new"))
+	s.Equal(map[string]Change{a: ChangeModified, c: ChangeAdded}, cc.Dirty())
+	s.Require().NoError(cc.WriteToFiles())
+	_, err = os.Stat(b)
+	s.True(os.IsNotExist(err))
+	data, err := os.ReadFile(a)
+	s.Require().NoError(err)
+	s.Equal("changed", string(data))
+
+	// after a write, only new changes reach the disk
+	s.Require().NoError(os.WriteFile(a, []byte("human edit"), 0o644))
+	s.Require().NoError(cc.Remove(c))
+	s.Require().NoError(cc.Write(a, "changed"))
+	s.Require().NoError(cc.WriteToFiles())
+	data, err = os.ReadFile(a)
+	s.Require().NoError(err)
+	s.Equal("human edit", string(data))
+	_, err = os.Stat(c)
+	s.True(os.IsNotExist(err))
+
+	s.Require().NoError(cc.Write(a, "orig a.txt"))
+	s.Require().NoError(cc.Remove(b))
+	s.Equal(map[string]Change{b: ChangeDeleted}, cc.Dirty())
+}
+
+func (s *ContextSuite) TestCodeContainer_Load() {
+	dir := s.T().TempDir()
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0o644))
+	cc, err := NewCodeContainerFromFS(dir, []string{"a.txt"})
+	s.Require().NoError(err)
+	clone := cc.Clone()
+
+	content, err := cc.Load("b.txt")
+	s.Require().NoError(err)
+	s.Equal("b", content)
+	s.True(cc.Has("b.txt"))
+	s.Empty(cc.Dirty())
+	s.False(clone.Has("b.txt"))
+	s.Empty(clone.Dirty())
+
+	// an edited file is returned as edited, not reread
+	s.Require().NoError(cc.Write("b.txt", "edited"))
+	content, err = cc.Load("b.txt")
+	s.Require().NoError(err)
+	s.Equal("edited", content)
+	s.Equal(map[string]Change{"b.txt": ChangeModified}, cc.Dirty())
+
+	_, err = cc.Load("missing.txt")
+	s.Error(err)
+	_, err = cc.Load("../outside.txt")
+	s.Error(err)
+}
+
+func (s *ContextSuite) TestCodeContainer_Restore_RewritesChangedFiles() {
+	dir := s.T().TempDir()
+	a := filepath.Join(dir, "a.txt")
+	s.Require().NoError(os.WriteFile(a, []byte("orig"), 0o644))
+	cc, err := NewCodeContainerFromFS("", []string{a})
+	s.Require().NoError(err)
+
+	snapshot := cc.Snapshot()
+	s.Require().NoError(cc.Write(a, "changed"))
+	s.Require().NoError(cc.WriteToFiles())
+	cc.Restore(snapshot)
+	s.Require().NoError(cc.WriteToFiles())
+	data, err := os.ReadFile(a)
+	s.Require().NoError(err)
+	s.Equal("orig", string(data))
+}
+
+func (s *ContextSuite) TestCodeContainer_ExternalChanges() {
+	dir := s.T().TempDir()
+	path := filepath.Join(dir, "a.txt")
+	load := func(policy ExternalChangePolicy) *CodeContainer {
+		s.Require().NoError(os.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0o644))
+		cc, err := NewCodeContainerFromFS("", []string{path})
+		s.Require().NoError(err)
+		cc.SetExternalChangePolicy(policy)
+		return cc
+	}
+	disk := func() string {
+		data, err := os.ReadFile(path)
+		s.Require().NoError(err)
+		return string(data)
+	}
+
+	// fail: nothing is written
+	cc := load(ExternalChangeFail)
+	s.Require().NoError(cc.Write(path, "ONE\ntwo\nthree\nfour\n"))
+	s.Require().NoError(os.WriteFile(path, []byte("one\ntwo\nthree\nFOUR\n"), 0o644))
+	var extErr *ExternalChangeError
+	s.Require().ErrorAs(cc.WriteToFiles(), &extErr)
+	s.Equal([]string{path}, extErr.Paths)
+	s.Equal("one\ntwo\nthree\nFOUR\n", disk())
+
+	// merge: both edits are kept
+	cc = load(ExternalChangeMerge)
+	s.Require().NoError(cc.Write(path, "ONE\ntwo\nthree\nfour\n"))
+	s.Require().NoError(os.WriteFile(path, []byte("one\ntwo\nthree\nFOUR\n"), 0o644))
+	s.Require().NoError(cc.WriteToFiles())
+	s.Equal("ONE\ntwo\nthree\nFOUR\n", disk())
+	s.Equal("ONE\ntwo\nthree\nFOUR\n", cc.Files()[path])
+	s.Equal([]ExternalChange{{Path: path, Action: "merged"}}, cc.TakeExternalChanges())
+
+	// merge: overlapping edits conflict
+	s.Require().NoError(cc.Write(path, "ONE\ntwo\nthree\nfour!\n"))
+	s.Require().NoError(os.WriteFile(path, []byte("ONE\ntwo\nthree\nfour?\n"), 0o644))
+	s.Require().ErrorAs(cc.WriteToFiles(), &extErr)
+	s.True(extErr.Conflicts)
+
+	// reload: the disk wins
+	cc = load(ExternalChangeReload)
+	s.Require().NoError(cc.Write(path, "mine\n"))
+	s.Require().NoError(os.WriteFile(path, []byte("theirs\n"), 0o644))
+	s.Require().NoError(cc.WriteToFiles())
+	s.Equal("theirs\n", disk())
+	s.Equal("theirs\n", cc.Files()[path])
+	s.Equal([]ExternalChange{{Path: path, Action: "reloaded"}}, cc.TakeExternalChanges())
+	s.Empty(cc.TakeExternalChanges())
+}
+
+func (s *ContextSuite) TestMerge3() {
+	base := "a\nb\nc\nd\ne\n"
+	merged, clean := merge3(base, "a\nB\nc\nd\ne\n", "a\nb\nc\nd\nE\nf\n")
+	s.True(clean)
+	s.Equal("a\nB\nc\nd\nE\nf\n", merged)
+
+	merged, clean = merge3(base, "x\na\nb\nc\nd\ne\n", "x\na\nb\nc\nd\ne\n")
+	s.True(clean)
+	s.Equal("x\na\nb\nc\nd\ne\n", merged)
+
+	_, clean = merge3(base, "a\nb\nC\nd\ne\n", "a\nb\nc!\nd\ne\n")
+	s.False(clean)
+}
+
+func (s *ContextSuite) TestCodeContainer_BaseDirPaths() {
+	dir := s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(dir, "pkg"), 0o755))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "pkg", "a.go"), []byte("package pkg\n"), 0o644))
+
+	cc, err := NewCodeContainerFromFS(dir, []string{"./pkg/a.go"})
+	s.Require().NoError(err)
+	s.Equal(map[string]string{"pkg/a.go": "package pkg\n"}, cc.Files())
+
+	for _, p := range []string{"pkg/a.go", "./pkg/../pkg/a.go", filepath.Join(dir, "pkg", "a.go")} {
+		key, err := cc.Normalize(p)
+		s.Require().NoError(err, p)
+		s.Equal("pkg/a.go", key, p)
+		s.True(cc.Has(p), p)
+	}
+	for _, p := range []string{"../outside.go", filepath.Join(filepath.Dir(dir), "outside.go"), "."} {
+		_, err := cc.Normalize(p)
+		s.ErrorContains(err, "outside the base dir", p)
+	}
+
+	// patches may use absolute paths, and paths outside the base dir are rejected
+	co, err := ParseCodeOutput("<CodeOutput><![CDATA[\n*** Begin Patch\n*** Update File: " + filepath.Join(dir, "pkg", "a.go") + "\n-package pkg\n+package pkg // edited\n*** Add File: pkg/b.go\n+package pkg\n*** End Patch\n]]></CodeOutput>")
+	s.Require().NoError(err)
+	_, err = cc.Apply(co)
+	s.Require().NoError(err)
+	s.Require().NoError(cc.WriteToFiles())
+	data, err := os.ReadFile(filepath.Join(dir, "pkg", "b.go"))
+	s.Require().NoError(err)
+	s.Equal("package pkg", string(data))
+	s.Equal("package pkg // edited\n", cc.Files()["pkg/a.go"])
+
+	s.ErrorContains(cc.Write("../escape.go", "x"), "outside the base dir")
+}
+
+func (s *ContextSuite) TestApply_StaleContent() {
+	c := NewCodeContainer(map[string]string{"a.txt": "one\ntwo\n", "b.txt": "b\n"})
+	c.MarkShown(c.BuildCodeInput(nil).Paths()...)
+	patch := "*** Begin Patch\n*** Update File: a.txt\n@@\n one\n-two\n+2\n*** End Patch"
+
+	// another tool edits a.txt after the model saw it
+	s.Require().NoError(c.Write("a.txt", "one\ntwo\nthree\n"))
+	_, err := c.Apply(CodeOutput{Patch: patch})
+	var stale *StaleContentError
+	s.Require().ErrorAs(err, &stale)
+	s.Equal([]string{"a.txt"}, stale.Paths)
+	s.Equal("one\ntwo\nthree\n", c.Files()["a.txt"])
+
+	// once shown again, the patch applies; the model's own edits keep the file fresh
+	c.MarkShown("a.txt")
+	_, err = c.Apply(CodeOutput{Patch: patch})
+	s.Require().NoError(err)
+	_, err = c.Apply(CodeOutput{Patch: "*** Begin Patch\n*** Update File: a.txt\n@@\n 2\n-three\n+3\n*** End Patch"})
+	s.Require().NoError(err)
+	s.Equal("one\n2\n3\n", c.Files()["a.txt"])
+}
+
+func (s *ContextSuite) TestApply_ExpectedHash() {
+	c := NewCodeContainer(map[string]string{"a.txt": "one\ntwo\n"})
+	hash := c.BuildCodeInput(nil).Files[0].Hash
+	s.Equal(ContentHash("one\ntwo\n"), hash)
+	co, err := ParseCodeOutput(`<CodeOutput><Expect path="a.txt" hash="` + hash + `"/><![CDATA[
+*** Begin Patch
+*** Update File: a.txt
+@@
+ one
+-two
++2
+*** End Patch
+]]></CodeOutput>`)
+	s.Require().NoError(err)
+	s.Equal([]FileExpect{{Path: "a.txt", Hash: hash}}, co.Expects)
+
+	// the file changed since the model read its hash
+	s.Require().NoError(c.Write("a.txt", "one\ntwo\nthree\n"))
+	_, err = c.Apply(co)
+	var stale *StaleContentError
+	s.Require().ErrorAs(err, &stale)
+	s.Equal([]string{"a.txt"}, stale.Paths)
+	s.Equal("one\ntwo\nthree\n", c.Files()["a.txt"])
+
+	co.Expects[0].Hash = ContentHash("one\ntwo\nthree\n")[:8]
+	_, err = c.Apply(co)
+	s.Require().NoError(err, "an abbreviated hash")
+	s.Equal("one\n2\nthree\n", c.Files()["a.txt"])
+
+	co.Expects[0].Hash = "abc"
+	_, err = c.Apply(co)
+	s.ErrorContains(err, "is too short")
+	co.Expects = []FileExpect{{Path: "gone.txt", Hash: hash}}
+	_, err = c.Apply(co)
+	s.Require().ErrorAs(err, &stale)
+	s.Equal([]string{"gone.txt"}, stale.Paths)
+}
+
+func (s *ContextSuite) TestApply_SetModeWritesPermissions() {
+	dir := s.T().TempDir()
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "tool.py"), []byte("print()"), 0o644))
+	c, err := NewCodeContainerFromFS(dir, []string{"tool.py"})
+	s.Require().NoError(err)
+
+	_, err = c.Apply(CodeOutput{Patch: "*** Begin Patch\n*** Add File: bin/run.sh\n*** Set Mode: 0755\n+#!/bin/sh\n*** Update File: tool.py\n*** Set Mode: 0700\n*** End Patch"})
+	s.Require().NoError(err)
+	s.Require().NoError(c.WriteToFiles())
+
+	info, err := os.Stat(filepath.Join(dir, "bin", "run.sh"))
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0o755), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(dir, "tool.py"))
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0o700), info.Mode().Perm())
+}
+
+func (s *ContextSuite) TestApply_EmptyFileInNewDirectory() {
+	dir := s.T().TempDir()
+	c, err := NewCodeContainerFromFS(dir, nil)
+	s.Require().NoError(err)
+
+	_, err = c.Apply(CodeOutput{Patch: "*** Begin Patch\n*** Add File: pkg/new/.gitkeep\n*** End Patch"})
+	s.Require().NoError(err)
+	s.True(c.Has("pkg/new/.gitkeep"))
+	s.Require().NoError(c.WriteToFiles())
+
+	content, err := os.ReadFile(filepath.Join(dir, "pkg", "new", ".gitkeep"))
+	s.Require().NoError(err)
+	s.Empty(content)
+}
+
+func (s *ContextSuite) TestApply_MissingFileSuggestion() {
+	dir := s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(dir, "pkg"), 0o755))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "pkg", "README.md"), []byte("hello\n"), 0o644))
+	c, err := NewCodeContainerFromFS(dir, []string{"pkg/README.md"})
+	s.Require().NoError(err)
+
+	_, err = c.Apply(CodeOutput{Patch: "*** Begin Patch\n*** Update File: pkg/readme.md\n@@\n-hello\n+world\n*** End Patch"})
+	s.ErrorContains(err, "missing file: pkg/readme.md (did you mean pkg/README.md?)")
+	s.ErrorIs(err, ErrMissingFile)
+	s.ErrorIs(err, v4a.ErrMissingFile)
+	s.Equal("hello\n", c.Files()["pkg/README.md"])
+	s.False(c.Has("pkg/readme.md"))
+}
+
+func (s *ContextSuite) TestStat() {
+	before := map[string]string{"a.go": "a\nb\nc\n", "b.go": "x\ny\n", "c.go": "same\n"}
+	after := map[string]string{"a.go": "a\nB\nc\nd\n", "c.go": "same\n", "n.go": "new\n"}
+	s.Equal(DiffStat{Added: 3, Removed: 3, AddedBytes: 8, RemovedBytes: 6, Deleted: 1}, Stat(before, after))
+	s.Equal(6, Stat(before, after).Changed())
+	s.Equal(DiffStat{}, Stat(before, before))
+}
+
+func (s *ContextSuite) TestMatchGlob() {
+	for _, tc := range []struct {
+		glob, name string
+		want       bool
+	}{
+		{"go.mod", "go.mod", true},
+		{"go.mod", "sub/go.mod", false},
+		{"**/go.mod", "sub/go.mod", true},
+		{"**/go.mod", "go.mod", true},
+		{".github/**", ".github/workflows/ci.yml", true},
+		{"vendor/**", "vendorx/a.go", false},
+		{"internal/*/gen.go", "internal/a/gen.go", true},
+		{"internal/*/gen.go", "internal/a/b/gen.go", false},
+		{"a/**/z.go", "a/b/c/z.go", true},
+	} {
+		s.Equal(tc.want, MatchGlob(tc.glob, tc.name), "%s %s", tc.glob, tc.name)
+	}
+
+	s.True(MatchAny([]string{"*.md", "*_test.go"}, "pkg/a_test.go"), "base names match")
+	s.True(MatchAny([]string{"pkg/**"}, "pkg/sub/a.go"))
+	s.False(MatchAny([]string{"pkg/*.go"}, "pkg/sub/a.go"))
+	s.False(MatchAny(nil, "a.go"))
+}
+
+func (s *ContextSuite) TestApply_ProtectedPaths() {
+	cc, err := NewCodeContainerInDir(s.T().TempDir(), map[string]string{"go.mod": "module m\n", "a.go": "package a\n"})
+	s.Require().NoError(err)
+	s.Require().NoError(cc.SetProtectedPaths([]string{"go.mod", ".github/**"}))
+	s.Error(cc.SetProtectedPaths([]string{"[a"}))
+
+	err = cc.Write("go.mod", "module n\n")
+	s.ErrorIs(err, ErrProtectedPath)
+	s.EqualError(err, `code/container: go.mod is protected ("go.mod") and must not be modified, leave it as it is`)
+	s.ErrorIs(cc.Remove("go.mod"), ErrProtectedPath)
+	s.ErrorIs(cc.Write(".github/workflows/ci.yml", "on: push\n"), ErrProtectedPath)
+	s.NoError(cc.Write("go.mod", "module m\n"), "writing the same content changes nothing")
+
+	_, err = cc.Apply(CodeOutput{Patch: "*** Begin Patch\n*** Update File: a.go\n-package a\n+package b\n*** Update File: go.mod\n-module m\n+module n\n*** End Patch"})
+	s.ErrorIs(err, ErrProtectedPath)
+}
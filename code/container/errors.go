@@ -0,0 +1,30 @@
+package container
+
+import (
+	"errors"
+
+	"github.com/stumble/axe/code/searchreplace"
+	"github.com/stumble/axe/code/udiff"
+	"github.com/stumble/axe/code/v4a"
+	"github.com/stumble/axe/internal/kinderr"
+)
+
+// Kinds of the errors of ApplyFormat and the file operations, to branch on with errors.Is whatever
+// the edit format. Errors of the underlying patch packages also match their own kinds, e.g.
+// v4a.ErrMissingFile.
+var (
+	ErrMissingFile          = errors.New("code/container: missing file")
+	ErrPatchContextNotFound = errors.New("code/container: patch context not found")
+	ErrProtectedPath        = errors.New("code/container: protected path")
+)
+
+// classifyPatchError adds the kind of the container to an error of the patch packages.
+func classifyPatchError(err error) error {
+	switch {
+	case errors.Is(err, v4a.ErrMissingFile), errors.Is(err, udiff.ErrMissingFile), errors.Is(err, searchreplace.ErrMissingFile):
+		return kinderr.New(ErrMissingFile, err)
+	case errors.Is(err, v4a.ErrContextNotFound), errors.Is(err, udiff.ErrContextNotFound), errors.Is(err, searchreplace.ErrSearchNotFound):
+		return kinderr.New(ErrPatchContextNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,169 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/stumble/axe/internal/linediff"
+)
+
+// ExternalChangePolicy decides what WriteToFiles does with a file that changed on disk since the
+// container read or last wrote it, e.g. because a human edited it during a long agent run.
+// Only files whose disk content is known are checked: files loaded by NewCodeContainerFromFS and
+// files written by WriteToFiles.
+type ExternalChangePolicy int
+
+const (
+	// ExternalChangeOverwrite writes the container's content regardless of the disk.
+	ExternalChangeOverwrite ExternalChangePolicy = iota
+	// ExternalChangeFail refuses to write: WriteToFiles returns an *ExternalChangeError and writes nothing.
+	ExternalChangeFail
+	// ExternalChangeReload replaces the container's content with the disk's, dropping its edits of the file.
+	ExternalChangeReload
+	// ExternalChangeMerge merges the container's and the disk's edits line by line. Overlapping
+	// edits fail as with ExternalChangeFail.
+	ExternalChangeMerge
+)
+
+// ExternalChangeError is returned by WriteToFiles when files changed on disk can't be written.
+type ExternalChangeError struct {
+	Paths     []string
+	Conflicts bool // the changes were merged, but overlap
+}
+
+func (e *ExternalChangeError) Error() string {
+	what := "changed on disk since they were read"
+	if e.Conflicts {
+		what = "changed on disk with edits conflicting with the container's"
+	}
+	return fmt.Sprintf("code/container: not writing files %s: %s", what, strings.Join(e.Paths, ", "))
+}
+
+// ExternalChange reports a file WriteToFiles reconciled with the disk.
+type ExternalChange struct {
+	Path   string
+	Action string // "reloaded" or "merged"
+}
+
+// SetExternalChangePolicy sets how WriteToFiles handles files changed on disk.
+func (c *CodeContainer) SetExternalChangePolicy(policy ExternalChangePolicy) {
+	c.policy = policy
+}
+
+// TakeExternalChanges returns the files reloaded or merged by WriteToFiles since the last call.
+func (c *CodeContainer) TakeExternalChanges() []ExternalChange {
+	changes := c.external
+	c.external = nil
+	return changes
+}
+
+// reconcile checks the unsynced files against the disk according to the policy, before anything
+// is written. Reloaded and merged files are updated in the container.
+func (c *CodeContainer) reconcile(paths []string) error {
+	if c.policy == ExternalChangeOverwrite {
+		return nil
+	}
+	type resolved struct {
+		path    string
+		content string
+		deleted bool
+		action  string
+	}
+	var done []resolved
+	var failed []string
+	conflicts := false
+	for _, f := range paths {
+		base, known := c.onDisk[f]
+		if !known {
+			continue
+		}
+		data, err := os.ReadFile(c.DiskPath(f))
+		diskDeleted := errors.Is(err, os.ErrNotExist)
+		if err != nil && !diskDeleted {
+			return fmt.Errorf("code/container: read %s: %w", f, err)
+		}
+		disk := string(data)
+		if !diskDeleted && disk == base {
+			continue
+		}
+		ours, ok := c.files[f]
+		if !ok && diskDeleted {
+			continue
+		}
+		if ok && ours == base {
+			// only the disk changed, e.g. a restored file: keep the disk's version
+			done = append(done, resolved{path: f, content: disk, deleted: diskDeleted})
+			continue
+		}
+		switch c.policy {
+		case ExternalChangeReload:
+			done = append(done, resolved{path: f, content: disk, deleted: diskDeleted, action: "reloaded"})
+		case ExternalChangeMerge:
+			if merged, clean := merge3(base, ours, disk); ok && !diskDeleted && clean {
+				done = append(done, resolved{path: f, content: merged, action: "merged"})
+				continue
+			}
+			conflicts = true
+			failed = append(failed, f)
+		default:
+			failed = append(failed, f)
+		}
+	}
+	if len(failed) > 0 {
+		return &ExternalChangeError{Paths: failed, Conflicts: conflicts}
+	}
+	for _, r := range done {
+		if r.deleted {
+			delete(c.files, r.path)
+			delete(c.onDisk, r.path)
+			delete(c.unsynced, r.path)
+			c.deleted[r.path] = struct{}{}
+		} else {
+			c.files[r.path] = r.content
+			delete(c.deleted, r.path)
+			c.onDisk[r.path] = r.content
+			if r.action != "merged" {
+				delete(c.unsynced, r.path)
+			}
+		}
+		if r.action != "" {
+			c.external = append(c.external, ExternalChange{Path: r.path, Action: r.action})
+		}
+	}
+	return nil
+}
+
+// merge3 merges the line edits of ours and theirs to base. clean is false when they overlap.
+func merge3(base, ours, theirs string) (merged string, clean bool) {
+	baseLines := linediff.Split(base)
+	a := linediff.Diff(baseLines, linediff.Split(ours))
+	b := linediff.Diff(baseLines, linediff.Split(theirs))
+	overlap := func(x, y linediff.Edit) bool {
+		return x.Start == y.Start || (x.Start < y.End && y.Start < x.End)
+	}
+
+	var out []string
+	pos, i, j := 0, 0, 0
+	for i < len(a) || j < len(b) {
+		var next linediff.Edit
+		switch {
+		case j == len(b) || (i < len(a) && !overlap(a[i], b[j]) && a[i].Start < b[j].Start):
+			next, i = a[i], i+1
+		case i == len(a) || !overlap(a[i], b[j]):
+			next, j = b[j], j+1
+		case a[i].Start == b[j].Start && a[i].End == b[j].End && slices.Equal(a[i].Lines, b[j].Lines):
+			// both sides made the same edit
+			next, i, j = a[i], i+1, j+1
+		default:
+			return "", false
+		}
+		out = append(out, baseLines[pos:next.Start]...)
+		out = append(out, next.Lines...)
+		pos = next.End
+	}
+	out = append(out, baseLines[pos:]...)
+	return strings.Join(out, ""), true
+}
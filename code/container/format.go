@@ -0,0 +1,26 @@
+package container
+
+// EditFormat is the format of the edits in a CodeOutput.
+type EditFormat string
+
+const (
+	// EditFormatV4A is a v4a patch, see package v4a. It is the default.
+	EditFormatV4A EditFormat = "v4a"
+	// EditFormatUnified is a unified diff, see package udiff.
+	EditFormatUnified EditFormat = "unified"
+	// EditFormatWholeFile is the complete new content of every edited file, in Rewrite elements.
+	// It costs more tokens but suits smaller models that can't reliably produce patches.
+	EditFormatWholeFile EditFormat = "whole_file"
+	// EditFormatSearchReplace is SEARCH/REPLACE blocks, see package searchreplace. Many models are
+	// trained on them.
+	EditFormatSearchReplace EditFormat = "search_replace"
+)
+
+// Valid reports whether f is a known format. The empty format is EditFormatV4A.
+func (f EditFormat) Valid() bool {
+	switch f {
+	case "", EditFormatV4A, EditFormatUnified, EditFormatWholeFile, EditFormatSearchReplace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package container
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OversizeStrategy decides how a file exceeding InputLimits is rendered in a CodeInput.
+type OversizeStrategy int
+
+const (
+	// OversizeExcerpt keeps the head and the tail of the file.
+	OversizeExcerpt OversizeStrategy = iota
+	// OversizeSkip leaves the content out, only the path and size are rendered.
+	OversizeSkip
+	// OversizeOutline renders Go files as a declaration outline (see GoOutline). Other files, and
+	// outlines still exceeding the limit, fall back to an excerpt.
+	OversizeOutline
+)
+
+// Values of the CodeFile mode attribute.
+const (
+	FileModeExcerpt = "excerpt"
+	FileModeSkipped = "skipped"
+	FileModeOutline = "outline"
+)
+
+// InputLimits bounds the size of a CodeInput so very large (e.g. generated) files don't blow the prompt.
+// Zero values mean no limit.
+type InputLimits struct {
+	MaxFileBytes  int // content size above which a file is reduced by Strategy
+	MaxTotalBytes int // budget for all file contents; files are reduced in path order once it is spent
+	Strategy      OversizeStrategy
+	// Keywords, e.g. taken from the instruction, spend MaxTotalBytes on the most relevant files
+	// first: files mentioning more of them, in their path or else in their content, keep their
+	// content while the others are reduced. Files are still rendered in path order.
+	Keywords []string
+	// OutlineGo renders every Go file as a declaration outline regardless of its size (symbol-level
+	// mode); the agent pulls the declarations it needs with the fetch_function tool.
+	OutlineGo bool
+}
+
+// Enabled reports whether the limits may reduce files.
+func (l InputLimits) Enabled() bool {
+	return l.MaxFileBytes > 0 || l.MaxTotalBytes > 0 || l.OutlineGo
+}
+
+// apply reduces the files of ci in place.
+func (l InputLimits) apply(ci *CodeInput) {
+	if !l.Enabled() {
+		return
+	}
+	remaining := l.MaxTotalBytes
+	for _, i := range l.budgetOrder(ci.Files) {
+		f := &ci.Files[i]
+		if l.OutlineGo {
+			outlineGoFile(f)
+		}
+		if l.MaxFileBytes <= 0 && l.MaxTotalBytes <= 0 {
+			continue
+		}
+		limit := l.MaxFileBytes
+		if l.MaxTotalBytes > 0 && (limit <= 0 || remaining < limit) {
+			limit = max(remaining, 0)
+		}
+		l.reduce(f, limit)
+		remaining -= len(f.Content)
+	}
+}
+
+// budgetOrder returns the indexes of files in the order they get the total budget: by decreasing
+// relevance to the keywords, then by path.
+func (l InputLimits) budgetOrder(files []CodeFile) []int {
+	order := make([]int, len(files))
+	scores := make([]int, len(files))
+	for i, f := range files {
+		order[i] = i
+		path, content := strings.ToLower(f.Path), strings.ToLower(f.Content)
+		for _, k := range l.Keywords {
+			switch k = strings.ToLower(k); {
+			case k == "":
+			case strings.Contains(path, k):
+				scores[i] += 3
+			case strings.Contains(content, k):
+				scores[i]++
+			}
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	return order
+}
+
+// outlineGoFile replaces the content of a Go file by its outline. Files that don't parse are kept.
+func outlineGoFile(f *CodeFile) {
+	if !strings.HasSuffix(f.Path, ".go") {
+		return
+	}
+	outline, err := GoOutline(f.Path, f.Content)
+	if err != nil {
+		return
+	}
+	f.Mode, f.Size, f.Content = FileModeOutline, len(f.Content), outline
+}
+
+// reduce applies the strategy to f if its content is larger than limit.
+func (l InputLimits) reduce(f *CodeFile, limit int) {
+	size := len(f.Content)
+	if size <= limit {
+		return
+	}
+	if f.Size == 0 {
+		f.Size = size
+	}
+	if f.Mode == FileModeOutline {
+		// already outlined, only an excerpt can make it smaller
+		l.excerpt(f, limit)
+		return
+	}
+	switch l.Strategy {
+	case OversizeSkip:
+		f.Mode, f.Content = FileModeSkipped, ""
+		return
+	case OversizeOutline:
+		if strings.HasSuffix(f.Path, ".go") {
+			if outline, err := GoOutline(f.Path, f.Content); err == nil {
+				if len(outline) <= limit {
+					f.Mode, f.Content = FileModeOutline, outline
+					return
+				}
+				f.Content = outline
+			}
+		}
+	}
+	l.excerpt(f, limit)
+}
+
+func (l InputLimits) excerpt(f *CodeFile, limit int) {
+	if excerpt, ok := excerptLines(f.Content, limit); ok {
+		f.Mode, f.Content = FileModeExcerpt, excerpt
+		return
+	}
+	f.Mode, f.Content = FileModeSkipped, ""
+}
+
+// excerptLines keeps whole lines from the head and the tail of content, within limit bytes
+// including the omission marker. It fails when not even one line fits.
+func excerptLines(content string, limit int) (string, bool) {
+	lines := strings.SplitAfter(content, "\n")
+	var head, tail []string
+	used := 0
+	budget := limit - len(omittedMarker(len(lines)))
+	for i, j := 0, len(lines)-1; i <= j; {
+		// alternate between head and tail, head first
+		if len(head) <= len(tail) {
+			if used+len(lines[i]) > budget {
+				break
+			}
+			used += len(lines[i])
+			head = append(head, lines[i])
+			i++
+		} else {
+			if used+len(lines[j]) > budget {
+				break
+			}
+			used += len(lines[j])
+			tail = append([]string{lines[j]}, tail...)
+			j--
+		}
+	}
+	if len(head) == 0 {
+		return "", false
+	}
+	omitted := len(lines) - len(head) - len(tail)
+	if omitted == 0 {
+		return content, true
+	}
+	return strings.Join(head, "") + omittedMarker(omitted) + strings.Join(tail, ""), true
+}
+
+func omittedMarker(n int) string {
+	return fmt.Sprintf("... %d lines omitted ...\n", n)
+}
@@ -0,0 +1,118 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+)
+
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %02d\n", i)
+	}
+	return b.String()
+}
+
+func (s *ContextSuite) TestBuildCodeInputWithLimits_Excerpt() {
+	files := map[string]string{"big.txt": numberedLines(100), "small.txt": "ok\n"}
+	ci := BuildCodeInputWithLimits(files, nil, InputLimits{MaxFileBytes: 100})
+
+	s.Require().Len(ci.Files, 2)
+	big := ci.Files[0]
+	s.Equal(FileModeExcerpt, big.Mode)
+	s.Equal(len(files["big.txt"]), big.Size)
+	s.LessOrEqual(len(big.Content), 100)
+	s.True(strings.HasPrefix(big.Content, "line 01\n"))
+	s.True(strings.HasSuffix(big.Content, "line 100\n"))
+	s.Contains(big.Content, "lines omitted ...")
+
+	s.Equal(CodeFile{Path: "small.txt", Content: "ok\n", Hash: ContentHash("ok\n")}, ci.Files[1])
+}
+
+func (s *ContextSuite) TestBuildCodeInputWithLimits_SkipAndTotal() {
+	files := map[string]string{"a.txt": "aaaa\n", "b.txt": "bbbb\n", "c.txt": "cccc\n"}
+	ci := BuildCodeInputWithLimits(files, nil, InputLimits{MaxTotalBytes: 10, Strategy: OversizeSkip})
+
+	s.Equal("aaaa\n", ci.Files[0].Content)
+	s.Equal("bbbb\n", ci.Files[1].Content)
+	s.Equal(CodeFile{Path: "c.txt", Mode: FileModeSkipped, Size: 5, Hash: ContentHash("cccc\n")}, ci.Files[2])
+
+	out, err := ci.ToXML()
+	s.Require().NoError(err)
+	s.Contains(out, `<File path="c.txt" mode="skipped" size="5" hash="`+ContentHash("cccc\n")+`"></File>`)
+}
+
+func (s *ContextSuite) TestBuildCodeInputWithLimits_Keywords() {
+	files := map[string]string{"a.txt": "aaaa\n", "b.txt": "bbbb\n", "parser.txt": "cccc\n", "d.txt": "lexer\n"}
+	ci := BuildCodeInputWithLimits(files, nil, InputLimits{MaxTotalBytes: 11, Strategy: OversizeSkip, Keywords: []string{"Parser", "LEXER"}})
+
+	s.Equal([]string{"a.txt", "b.txt", "d.txt", "parser.txt"}, ci.Paths(), "files stay in path order")
+	s.Equal(FileModeSkipped, ci.Files[0].Mode)
+	s.Equal(FileModeSkipped, ci.Files[1].Mode)
+	s.Equal("lexer\n", ci.Files[2].Content)
+	s.Equal("cccc\n", ci.Files[3].Content, "a keyword in the path ranks first")
+}
+
+func (s *ContextSuite) TestBuildCodeInputWithLimits_Outline() {
+	src := `package demo
+
+import "fmt"
+
+// Greet says hello.
+func Greet(name string) string {
+	// inside the body
+	return fmt.Sprintf("hello %s", name)
+}
+
+type T struct{ A int }
+`
+	files := map[string]string{"demo.go": src, "notes.txt": numberedLines(20)}
+	ci := BuildCodeInputWithLimits(files, nil, InputLimits{MaxFileBytes: 110, Strategy: OversizeOutline})
+
+	s.Equal(FileModeOutline, ci.Files[0].Mode)
+	s.Contains(ci.Files[0].Content, "// Greet says hello.\nfunc Greet(name string) string\n")
+	s.Contains(ci.Files[0].Content, "type T struct{ A int }")
+	s.NotContains(ci.Files[0].Content, "inside the body")
+	// non-Go files fall back to an excerpt
+	s.Equal(FileModeExcerpt, ci.Files[1].Mode)
+}
+
+func (s *ContextSuite) TestBuildCodeInputWithLimits_NoLimits() {
+	files := map[string]string{"a.txt": numberedLines(100)}
+	s.Equal(BuildCodeInput(files, nil), BuildCodeInputWithLimits(files, nil, InputLimits{}))
+}
+
+func (s *ContextSuite) TestBuildCodeInputWithLimits_OutlineGo() {
+	src := "package demo\n\nfunc A() int {\n\treturn 1\n}\n"
+	files := map[string]string{"demo.go": src, "broken.go": "package demo\nfunc {", "notes.txt": "n\n"}
+	ci := BuildCodeInputWithLimits(files, nil, InputLimits{OutlineGo: true})
+
+	s.Equal(CodeFile{Path: "broken.go", Content: "package demo\nfunc {", Hash: ContentHash(files["broken.go"])}, ci.Files[0])
+	s.Equal(CodeFile{Path: "demo.go", Content: "package demo\n\nfunc A() int\n", Mode: FileModeOutline, Size: len(src), Hash: ContentHash(src)}, ci.Files[1])
+	s.Equal(CodeFile{Path: "notes.txt", Content: "n\n", Hash: ContentHash("n\n")}, ci.Files[2])
+}
+
+func (s *ContextSuite) TestGoDeclaration() {
+	src := `package demo
+
+// T is a type.
+type T[K comparable] struct{}
+
+// Get returns v.
+func (t *T[K]) Get(v K) K {
+	return v
+}
+
+func Free() {}
+`
+	decl, err := GoDeclaration("demo.go", src, "(*T).Get")
+	s.Require().NoError(err)
+	s.Equal(Declaration{Name: "T.Get", StartLine: 6, EndLine: 9, Source: "// Get returns v.\nfunc (t *T[K]) Get(v K) K {\n\treturn v\n}"}, decl)
+
+	decl, err = GoDeclaration("demo.go", src, "T")
+	s.Require().NoError(err)
+	s.Equal("// T is a type.\ntype T[K comparable] struct{}", decl.Source)
+
+	_, err = GoDeclaration("demo.go", src, "Missing")
+	s.ErrorContains(err, "has no function, method or type Missing")
+}
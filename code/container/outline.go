@@ -0,0 +1,136 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+)
+
+// GoOutline renders Go source as a declaration outline: the package clause, imports, types,
+// constants, variables and function signatures with their doc comments. Function bodies and the
+// comments inside them are dropped.
+func GoOutline(path, src string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+
+	var bodies []*ast.BlockStmt
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			bodies = append(bodies, fn.Body)
+			fn.Body = nil
+		}
+	}
+	comments := file.Comments[:0]
+	for _, cg := range file.Comments {
+		if !insideAny(cg, bodies) {
+			comments = append(comments, cg)
+		}
+	}
+	file.Comments = comments
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func insideAny(n ast.Node, blocks []*ast.BlockStmt) bool {
+	for _, b := range blocks {
+		if n.Pos() >= b.Lbrace && n.End() <= b.Rbrace+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Declaration is the full source of a top-level Go declaration.
+type Declaration struct {
+	Name      string
+	StartLine int // 1-based, including the doc comment
+	EndLine   int
+	Source    string
+}
+
+// GoDeclaration finds the function, method or type called name in Go source. Methods are named
+// "Type.Method"; "(*Type).Method" is accepted too.
+func GoDeclaration(path, src, name string) (Declaration, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return Declaration{}, err
+	}
+	name = strings.NewReplacer("(", "", ")", "", "*", "").Replace(strings.TrimSpace(name))
+
+	var found ast.Node
+	var doc *ast.CommentGroup
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if funcName(d) == name {
+				found, doc = d, d.Doc
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.Name.Name != name {
+					continue
+				}
+				found, doc = ts, ts.Doc
+				if len(d.Specs) == 1 {
+					found, doc = d, d.Doc
+				}
+			}
+		}
+		if found != nil {
+			break
+		}
+	}
+	if found == nil {
+		return Declaration{}, fmt.Errorf("code/container: %s has no function, method or type %s", path, name)
+	}
+
+	start := found.Pos()
+	if doc != nil {
+		start = doc.Pos()
+	}
+	startPos, endPos := fset.Position(start), fset.Position(found.End())
+	return Declaration{
+		Name:      name,
+		StartLine: startPos.Line,
+		EndLine:   endPos.Line,
+		Source:    src[startPos.Offset:endPos.Offset],
+	}, nil
+}
+
+// funcName returns Name for functions and Recv.Name for methods.
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+			continue
+		case *ast.IndexExpr:
+			typ = t.X
+			continue
+		case *ast.IndexListExpr:
+			typ = t.X
+			continue
+		case *ast.Ident:
+			return t.Name + "." + fn.Name.Name
+		}
+		return fn.Name.Name
+	}
+}
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/stumble/axe/internal/kinderr"
+)
+
+// SetProtectedPaths sets the globs of the files Write, Remove and SetMode refuse to change, e.g.
+// "go.mod", ".github/**" or "vendor/**", so no edit format can modify them. See MatchGlob.
+func (c *CodeContainer) SetProtectedPaths(globs []string) error {
+	for _, g := range globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("code/container: protected path %q: %w", g, err)
+		}
+	}
+	c.protected = globs
+	return nil
+}
+
+// Protected returns the protected path glob key matches, if any.
+func (c *CodeContainer) Protected(key string) (string, bool) {
+	for _, g := range c.protected {
+		if MatchGlob(g, key) {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// checkProtected returns an ErrProtectedPath error if key is protected.
+func (c *CodeContainer) checkProtected(key string) error {
+	if g, ok := c.Protected(key); ok {
+		return kinderr.Errorf(ErrProtectedPath, "code/container: %s is protected (%q) and must not be modified, leave it as it is", key, g)
+	}
+	return nil
+}
+
+// MatchGlob reports whether the slash-separated name matches glob, a path.Match pattern where an
+// element "**" matches any number of directories. Globs are anchored at the root: "go.mod" only
+// matches the top-level go.mod, "**/go.mod" matches all of them.
+func MatchGlob(glob, name string) bool {
+	return matchElems(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+// MatchAny reports whether one of the globs matches the slash-separated name or its base name,
+// e.g. "*_test.go" matches the test files of every directory. See MatchGlob.
+func MatchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if MatchGlob(g, name) || MatchGlob(g, path.Base(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchElems(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchElems(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,121 @@
+package container
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// StaleContentError is returned by ApplyFormat when a patch updates files whose content changed in
+// the container since it was shown to the model, e.g. because another tool edited them: the patch
+// was written against content that no longer exists, and applying it could silently undo the
+// other change. The model should re-read the files and write the patch again.
+type StaleContentError struct {
+	Paths []string
+}
+
+func (e *StaleContentError) Error() string {
+	return fmt.Sprintf("code/container: files changed since their content was shown to you, re-read them and write the patch against their current content: %s", strings.Join(e.Paths, ", "))
+}
+
+// MarkShown records the current content of the files as the content the model has seen, for the
+// stale content check of ApplyFormat. Files never marked are not checked.
+func (c *CodeContainer) MarkShown(paths ...string) {
+	if c.shown == nil {
+		c.shown = make(map[string]string)
+	}
+	for _, p := range paths {
+		key, err := c.Normalize(p)
+		if err != nil || !c.Has(key) {
+			continue
+		}
+		c.shown[key] = contentHash(c.files[key])
+	}
+}
+
+// checkFresh returns a *StaleContentError if some of the paths changed since they were marked shown.
+func (c *CodeContainer) checkFresh(paths []string) error {
+	var stale []string
+	for _, p := range paths {
+		key, err := c.Normalize(p)
+		if err != nil {
+			continue // the patch reports the bad path
+		}
+		hash, ok := c.shown[key]
+		if !ok || slices.Contains(stale, key) {
+			continue
+		}
+		if !c.Has(key) || contentHash(c.files[key]) != hash {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) > 0 {
+		return &StaleContentError{Paths: stale}
+	}
+	return nil
+}
+
+// markEdited marks shown the files changed by an edit of the model, which knows their new content.
+func (c *CodeContainer) markEdited(before map[string]string) {
+	if c.shown == nil {
+		c.shown = make(map[string]string)
+	}
+	for p, content := range c.Files() {
+		if old, ok := before[p]; !ok || old != content {
+			c.shown[p] = contentHash(content)
+		}
+	}
+	for p := range before {
+		if !c.Has(p) {
+			delete(c.shown, p)
+		}
+	}
+}
+
+// checkExpected returns a *StaleContentError if some of the files don't have the hash they are
+// expected to have. A hash may be abbreviated, down to 8 characters.
+func (c *CodeContainer) checkExpected(expects []FileExpect) error {
+	var stale []string
+	for _, e := range expects {
+		key, err := c.Normalize(e.Path)
+		if err != nil {
+			return err
+		}
+		hash := strings.ToLower(strings.TrimSpace(e.Hash))
+		if len(hash) < 8 {
+			return fmt.Errorf("code/container: Expect %s: hash %q is too short, use the hash attribute of the file in CodeInput", e.Path, e.Hash)
+		}
+		if slices.Contains(stale, key) {
+			continue
+		}
+		if !c.Has(key) || !strings.HasPrefix(contentHash(c.files[key]), hash) {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) > 0 {
+		return &StaleContentError{Paths: stale}
+	}
+	return nil
+}
+
+// ContentHash returns the hash of a file content shown in CodeInput: the first 12 hex characters
+// of its SHA-256.
+func ContentHash(content string) string {
+	return contentHash(content)[:12]
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Paths returns the paths of the files of the input.
+func (ci CodeInput) Paths() []string {
+	paths := make([]string, len(ci.Files))
+	for i, f := range ci.Files {
+		paths[i] = f.Path
+	}
+	return paths
+}
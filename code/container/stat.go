@@ -0,0 +1,44 @@
+package container
+
+import "github.com/stumble/axe/internal/linediff"
+
+// DiffStat counts what turns one set of files into another.
+type DiffStat struct {
+	Added, Removed           int // lines
+	AddedBytes, RemovedBytes int
+	Deleted                  int // files
+}
+
+// Changed returns the number of lines added or removed.
+func (s DiffStat) Changed() int { return s.Added + s.Removed }
+
+// Stat compares the files before with the files after, e.g. two results of CodeContainer.Files.
+// A deleted file counts as removing all its lines, an added one as adding them.
+func Stat(before, after map[string]string) DiffStat {
+	var s DiffStat
+	count := func(old, new string) {
+		oldLines, newLines := linediff.Split(old), linediff.Split(new)
+		for _, e := range linediff.Diff(oldLines, newLines) {
+			s.Removed += e.End - e.Start
+			for _, l := range oldLines[e.Start:e.End] {
+				s.RemovedBytes += len(l)
+			}
+			s.Added += len(e.Lines)
+			for _, l := range e.Lines {
+				s.AddedBytes += len(l)
+			}
+		}
+	}
+	for path, content := range after {
+		if old := before[path]; old != content {
+			count(old, content)
+		}
+	}
+	for path, content := range before {
+		if _, ok := after[path]; !ok {
+			s.Deleted++
+			count(content, "")
+		}
+	}
+	return s
+}
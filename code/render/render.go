@@ -0,0 +1,216 @@
+// Package render renders unified diffs between versions of text files, plain or colored for
+// terminals, for previews, dry-run reports, approval prompts and PR descriptions. The plain output
+// applies with code/udiff and `git apply`.
+package render
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/internal/linediff"
+)
+
+// DefaultContext is the number of unchanged lines shown around changes when Options.Context is 0.
+const DefaultContext = 3
+
+// Options configure the rendering of diffs. The zero value renders plain diffs with
+// DefaultContext lines of context.
+type Options struct {
+	Context int  // unchanged lines around changes, DefaultContext when 0, none when negative
+	Color   bool // ANSI colors, for terminals
+}
+
+func (o Options) context() int {
+	switch {
+	case o.Context < 0:
+		return 0
+	case o.Context == 0:
+		return DefaultContext
+	}
+	return o.Context
+}
+
+const (
+	devNull = "/dev/null"
+
+	colorReset  = "\x1b[0m"
+	colorHeader = "\x1b[1m"
+	colorHunk   = "\x1b[36m"
+	colorDel    = "\x1b[31m"
+	colorIns    = "\x1b[32m"
+)
+
+// Diff returns the unified diff turning old into new for the file at path, or "" if they are equal.
+func Diff(path, old, new string, opts Options) string {
+	var b strings.Builder
+	writeFileDiff(&b, "a/"+path, "b/"+path, old, new, opts)
+	return b.String()
+}
+
+// Files returns the diffs of the files that differ between before and after, maps of paths to
+// contents, sorted by path. Files only in after are diffed as added, files only in before as
+// deleted.
+func Files(before, after map[string]string, opts Options) string {
+	paths := slices.Sorted(maps.Keys(before))
+	for p := range after {
+		if _, ok := before[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+
+	var b strings.Builder
+	for _, p := range paths {
+		old, inBefore := before[p]
+		new, inAfter := after[p]
+		oldPath, newPath := "a/"+p, "b/"+p
+		if !inBefore {
+			oldPath = devNull
+		}
+		if !inAfter {
+			newPath = devNull
+		}
+		writeFileDiff(&b, oldPath, newPath, old, new, opts)
+	}
+	return b.String()
+}
+
+// Containers returns the diffs of the files that differ between two containers, e.g. a snapshot
+// taken before a run (see container.CodeContainer.Clone) and the container after it.
+func Containers(before, after *container.CodeContainer, opts Options) string {
+	return Files(before.Files(), after.Files(), opts)
+}
+
+// writeFileDiff writes the diff of one file, nothing if old and new are equal and the file is
+// neither added nor deleted.
+func writeFileDiff(b *strings.Builder, oldPath, newPath, old, new string, opts Options) {
+	if old == new && oldPath != devNull && newPath != devNull {
+		return
+	}
+	oldLines, newLines := linediff.Split(old), linediff.Split(new)
+	ops := diffLines(oldLines, newLines)
+
+	writeLine(b, opts, colorHeader, "--- "+oldPath)
+	writeLine(b, opts, colorHeader, "+++ "+newPath)
+	for _, h := range hunks(ops, opts.context()) {
+		writeLine(b, opts, colorHunk, h.header())
+		for _, o := range ops[h.from:h.to] {
+			line, hasNewline := strings.CutSuffix(o.line, "\n")
+			writeLine(b, opts, opColors[o.kind], string(o.kind)+line)
+			if !hasNewline {
+				b.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+}
+
+var opColors = map[byte]string{'-': colorDel, '+': colorIns}
+
+// writeLine writes a line of the diff, colored if enabled.
+func writeLine(b *strings.Builder, opts Options, color, line string) {
+	if opts.Color && color != "" {
+		line = color + line + colorReset
+	}
+	b.WriteString(line)
+	b.WriteByte('\n')
+}
+
+// op is a line of the diff: ' ' kept, '-' deleted or '+' inserted.
+type op struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the operations turning old into new, with deletions before insertions in
+// every changed block.
+func diffLines(old, new []string) []op {
+	ops := make([]op, 0, len(old)+len(new))
+	pos := 0
+	for _, e := range linediff.Diff(old, new) {
+		for _, l := range old[pos:e.Start] {
+			ops = append(ops, op{' ', l})
+		}
+		for _, l := range old[e.Start:e.End] {
+			ops = append(ops, op{'-', l})
+		}
+		for _, l := range e.Lines {
+			ops = append(ops, op{'+', l})
+		}
+		pos = e.End
+	}
+	for _, l := range old[pos:] {
+		ops = append(ops, op{' ', l})
+	}
+	return ops
+}
+
+// hunk is the range [from, to) of the operations shown together, starting at the 1-based lines
+// oldStart and newStart of the files.
+type hunk struct {
+	from, to           int
+	oldStart, oldCount int
+	newStart, newCount int
+}
+
+func (h hunk) header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.oldStart, h.oldCount), hunkRange(h.newStart, h.newCount))
+}
+
+// hunkRange formats a range like diff -u: the count is omitted when 1, and an empty range starts
+// at the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// hunks groups the changes of ops with context lines around them. Changes separated by at most
+// twice the context share a hunk.
+func hunks(ops []op, context int) []hunk {
+	var out []hunk
+	oldLine, newLine := 1, 1 // of ops[i]
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine, newLine, i = oldLine+1, newLine+1, i+1
+			continue
+		}
+		// i is the first change of a hunk
+		from := max(i-context, 0) // after the previous hunk, which ends on unchanged lines
+		h := hunk{from: from, oldStart: oldLine - (i - from), newStart: newLine - (i - from)}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*context {
+				break
+			}
+		}
+		h.to = min(end+context, len(ops))
+		for _, o := range ops[h.from:h.to] {
+			if o.kind != '+' {
+				h.oldCount++
+			}
+			if o.kind != '-' {
+				h.newCount++
+			}
+		}
+		out = append(out, h)
+		for _, o := range ops[i:h.to] {
+			if o.kind != '+' {
+				oldLine++
+			}
+			if o.kind != '-' {
+				newLine++
+			}
+		}
+		i = h.to
+	}
+	return out
+}
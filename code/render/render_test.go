@@ -0,0 +1,124 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/udiff"
+)
+
+// memFS is a udiff.FileSystem backed by a map.
+type memFS map[string]string
+
+func (m memFS) Has(p string) bool              { _, ok := m[p]; return ok }
+func (m memFS) Open(p string) (string, error)  { return m[p], nil }
+func (m memFS) Write(p string, c string) error { m[p] = c; return nil }
+func (m memFS) Remove(p string) error          { delete(m, p); return nil }
+
+type RenderSuite struct{ suite.Suite }
+
+func TestRenderSuite(t *testing.T) { suite.Run(t, new(RenderSuite)) }
+
+func (s *RenderSuite) TestDiff() {
+	old := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	new := "one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+	s.Equal(`--- a/n.txt
++++ b/n.txt
+@@ -1,5 +1,5 @@
+ one
+-two
++2
+ three
+ four
+ five
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+`, Diff("n.txt", old, new, Options{}))
+
+	s.Equal(`--- a/n.txt
++++ b/n.txt
+@@ -2 +2 @@
+-two
++2
+@@ -10,0 +11 @@
++eleven
+`, Diff("n.txt", old, new, Options{Context: -1}))
+
+	s.Equal(`--- a/n.txt
++++ b/n.txt
+@@ -1,10 +1,11 @@
+ one
+-two
++2
+ three
+ four
+ five
+ six
+ seven
+ eight
+ nine
+ ten
++eleven
+`, Diff("n.txt", old, new, Options{Context: 4}), "changes 2*context lines apart share a hunk")
+
+	s.Empty(Diff("n.txt", old, old, Options{}))
+}
+
+func (s *RenderSuite) TestDiff_NoNewlineAtEOF() {
+	s.Equal(`--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`, Diff("a.txt", "a\nb", "a\nb\n", Options{}))
+}
+
+func (s *RenderSuite) TestDiff_Color() {
+	got := Diff("a.txt", "a\n", "b\n", Options{Color: true})
+	s.Equal("\x1b[1m--- a/a.txt\x1b[0m\n\x1b[1m+++ b/a.txt\x1b[0m\n\x1b[36m@@ -1 +1 @@\x1b[0m\n\x1b[31m-a\x1b[0m\n\x1b[32m+b\x1b[0m\n", got)
+}
+
+func (s *RenderSuite) TestFiles_AppliesWithUdiff() {
+	before := map[string]string{
+		"keep.go":   "package keep\n",
+		"edit.go":   "package edit\n\nfunc A() {}\n\nfunc B() {}\n",
+		"delete.go": "package gone\n",
+	}
+	after := map[string]string{
+		"keep.go": "package keep\n",
+		"edit.go": "package edit\n\nfunc A() { B() }\n\nfunc B() {}\n\nfunc C() {}\n",
+		"add.go":  "package add\n",
+	}
+	diff := Files(before, after, Options{})
+	s.NotContains(diff, "keep.go")
+	s.Less(strings.Index(diff, "add.go"), strings.Index(diff, "delete.go"), "sorted by path")
+	s.Contains(diff, "--- /dev/null\n+++ b/add.go\n@@ -0,0 +1 @@\n+package add\n")
+	s.Contains(diff, "--- a/delete.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-package gone\n")
+
+	fs := memFS{}
+	for p, c := range before {
+		fs[p] = c
+	}
+	_, err := udiff.ApplyPatch(fs, diff)
+	s.Require().NoError(err)
+	s.Equal(memFS(after), fs)
+}
+
+func (s *RenderSuite) TestContainers() {
+	dir := s.T().TempDir()
+	c, err := container.NewCodeContainerFromFS(dir, nil)
+	s.Require().NoError(err)
+	s.Require().NoError(c.Write("a.txt", "a\n"))
+	before := c.Clone()
+	s.Require().NoError(c.Write("a.txt", "b\n"))
+
+	s.Equal("--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n", Containers(&before, c, Options{}))
+}
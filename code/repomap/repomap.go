@@ -0,0 +1,156 @@
+// Package repomap renders a compact map of a repository for prompts: every file, with the exported
+// symbols of Go files, so the agent knows what exists beyond the files it was given.
+//
+//	cmd/axe/main.go
+//	history/history.go: type Changelog, type History, func ReadHistoryFromFile, History.SaveHistoryToFile
+//	README.md
+package repomap
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stumble/axe/code/container"
+)
+
+// DefaultMaxBytes bounds the map when Options.MaxBytes is 0.
+const DefaultMaxBytes = 16 << 10
+
+// DefaultExclude are directories never mapped, besides hidden ones.
+var DefaultExclude = []string{"vendor", "node_modules", "testdata"}
+
+// Options configure Build.
+type Options struct {
+	// Exclude skips files and directories matching one of these globs, tried on the slash-separated
+	// path relative to the directory and on the base name, e.g. "*_test.go" or "internal/**". See
+	// container.MatchAny.
+	Exclude []string
+	// MaxBytes bounds the map, DefaultMaxBytes when 0. The files past it are counted, not listed.
+	MaxBytes int
+	// NoSymbols lists the files only.
+	NoSymbols bool
+}
+
+// Build returns the map of the files of dir, sorted by path. Go files that don't parse are listed
+// without symbols.
+func Build(dir string, opts Options) (string, error) {
+	limit := opts.MaxBytes
+	if limit <= 0 {
+		limit = DefaultMaxBytes
+	}
+	var b strings.Builder
+	omitted := 0
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name()[0] == '.' || slices.Contains(DefaultExclude, d.Name()) || container.MatchAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name()[0] == '.' || container.MatchAny(opts.Exclude, rel) {
+			return nil
+		}
+		line := rel
+		if !opts.NoSymbols && strings.HasSuffix(rel, ".go") {
+			if symbols := goSymbols(p); len(symbols) > 0 {
+				line += ": " + strings.Join(symbols, ", ")
+			}
+		}
+		if omitted > 0 || b.Len()+len(line)+1 > limit {
+			omitted++
+			return nil
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("repomap: %s: %w", dir, err)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "... %d more files\n", omitted)
+	}
+	return b.String(), nil
+}
+
+// goSymbols returns the exported declarations of a Go file: "type T", "func F", "T.Method",
+// "const C" and "var V", in source order.
+func goSymbols(p string) []string {
+	src, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), p, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	var symbols []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			if recv := receiver(d); recv != "" {
+				if ast.IsExported(recv) {
+					symbols = append(symbols, recv+"."+d.Name.Name)
+				}
+				continue
+			}
+			symbols = append(symbols, "func "+d.Name.Name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						symbols = append(symbols, "type "+s.Name.Name)
+					}
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if name.IsExported() {
+							symbols = append(symbols, d.Tok.String()+" "+name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// receiver returns the type name of the receiver of a method, "" for a function.
+func receiver(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package repomap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RepoMapSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestRepoMapSuite(t *testing.T) { suite.Run(t, new(RepoMapSuite)) }
+
+func (s *RepoMapSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	for p, content := range map[string]string{
+		"a/a.go": `package a
+
+const Version = "1"
+
+var ErrX, errY = 1, 2
+
+type Parser struct{}
+
+type lexer struct{}
+
+func New() *Parser { return nil }
+
+func (p *Parser) Parse() {}
+
+func (l lexer) Next() {}
+
+func helper() {}
+`,
+		"a/broken.go":   "package a\nfunc {",
+		"README.md":     "# hi\n",
+		".git/HEAD":     "ref\n",
+		"vendor/v/v.go": "package v\n",
+		".env":          "KEY=1\n",
+	} {
+		full := filepath.Join(s.dir, filepath.FromSlash(p))
+		s.Require().NoError(os.MkdirAll(filepath.Dir(full), 0o755))
+		s.Require().NoError(os.WriteFile(full, []byte(content), 0o644))
+	}
+}
+
+func (s *RepoMapSuite) TestBuild() {
+	out, err := Build(s.dir, Options{})
+	s.Require().NoError(err)
+	s.Equal("README.md\n"+
+		"a/a.go: const Version, var ErrX, type Parser, func New, Parser.Parse\n"+
+		"a/broken.go\n", out)
+}
+
+func (s *RepoMapSuite) TestBuild_Options() {
+	out, err := Build(s.dir, Options{NoSymbols: true, Exclude: []string{"*.md"}})
+	s.Require().NoError(err)
+	s.Equal("a/a.go\na/broken.go\n", out)
+
+	out, err = Build(s.dir, Options{NoSymbols: true, Exclude: []string{"a/**"}})
+	s.Require().NoError(err)
+	s.Equal("README.md\n", out)
+
+	out, err = Build(s.dir, Options{MaxBytes: 20})
+	s.Require().NoError(err)
+	s.Equal("README.md\n... 2 more files\n", out)
+}
@@ -0,0 +1,252 @@
+// Package searchreplace applies SEARCH/REPLACE blocks, the edit format many coding models emit, to
+// a collection of text files. Each block names a file on the line before it and replaces the lines
+// of its SEARCH section, which must appear once in the file, with those of its REPLACE section:
+//
+//	calc/calc.go
+//	<<<<<<< SEARCH
+//		return a + b
+//	=======
+//		return a - b
+//	>>>>>>> REPLACE
+//
+// A block with an empty SEARCH section creates the file.
+package searchreplace
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/stumble/axe/internal/kinderr"
+)
+
+// FileSystem is the set of files blocks are applied to, see container.CodeContainer.
+type FileSystem interface {
+	Has(string) bool
+	Open(string) (string, error)
+	Write(string, string) error
+}
+
+// Kinds of the errors of ApplyPatch, to branch on with errors.Is.
+var (
+	ErrMissingFile    = errors.New("searchreplace: missing file")
+	ErrSearchNotFound = errors.New("searchreplace: search section does not match the file")
+	ErrAmbiguous      = errors.New("searchreplace: search section matches several places")
+)
+
+// Block is a SEARCH/REPLACE block. Lines have no trailing newline.
+type Block struct {
+	Path    string
+	Search  []string
+	Replace []string
+}
+
+// Models write 5 to 9 markers, and sometimes trailing spaces.
+var (
+	searchLine  = regexp.MustCompile(`^<{5,9} ?SEARCH\s*$`)
+	dividerLine = regexp.MustCompile(`^={5,9}\s*$`)
+	replaceLine = regexp.MustCompile(`^>{5,9} ?REPLACE\s*$`)
+)
+
+// Parse parses the blocks of text. The path of a block is the last non-empty line before it that
+// is not a code fence; a block without one edits the file of the previous block.
+func Parse(text string) ([]Block, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var blocks []Block
+	path := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case dividerLine.MatchString(line) || replaceLine.MatchString(line):
+			return nil, fmt.Errorf("searchreplace: line %d: %q outside of a block, a block starts with <<<<<<< SEARCH", i+1, strings.TrimSpace(line))
+		case !searchLine.MatchString(line):
+			if p := pathLine(line); p != "" {
+				path = p
+			}
+			continue
+		}
+		if path == "" {
+			return nil, fmt.Errorf("searchreplace: line %d: the block has no file path, write it on the line before <<<<<<< SEARCH", i+1)
+		}
+		block := Block{Path: path}
+		j := i + 1
+		for ; j < len(lines) && !dividerLine.MatchString(lines[j]); j++ {
+			if searchLine.MatchString(lines[j]) || replaceLine.MatchString(lines[j]) {
+				break
+			}
+			block.Search = append(block.Search, lines[j])
+		}
+		if j == len(lines) || !dividerLine.MatchString(lines[j]) {
+			return nil, fmt.Errorf("searchreplace: %s: block at line %d has no ======= line after its SEARCH section", path, i+1)
+		}
+		k := j + 1
+		for ; k < len(lines) && !replaceLine.MatchString(lines[k]); k++ {
+			if searchLine.MatchString(lines[k]) || dividerLine.MatchString(lines[k]) {
+				break
+			}
+			block.Replace = append(block.Replace, lines[k])
+		}
+		if k == len(lines) || !replaceLine.MatchString(lines[k]) {
+			return nil, fmt.Errorf("searchreplace: %s: block at line %d has no >>>>>>> REPLACE line", path, i+1)
+		}
+		blocks = append(blocks, block)
+		i = k
+	}
+	if len(blocks) == 0 {
+		return nil, errors.New("searchreplace: no <<<<<<< SEARCH block found")
+	}
+	return blocks, nil
+}
+
+// pathLine returns the path a line names, "" for code fences and empty lines. Models sometimes
+// decorate the path like markdown, e.g. "`calc.go`" or "**calc.go**:".
+func pathLine(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "```") {
+		return ""
+	}
+	return strings.Trim(strings.TrimSuffix(line, ":"), "`*")
+}
+
+// UpdatedFiles returns the paths of the existing files the blocks of text edit, i.e. those of the
+// blocks with a SEARCH section, in order and without duplicates. Malformed text has none.
+func UpdatedFiles(text string) []string {
+	blocks, err := Parse(text)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, b := range blocks {
+		if !isEmpty(b.Search) && !seen[b.Path] {
+			seen[b.Path] = true
+			out = append(out, b.Path)
+		}
+	}
+	return out
+}
+
+func isEmpty(lines []string) bool {
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyPatch parses text and applies its blocks to fs in order, each to the file as edited by the
+// previous ones.
+func ApplyPatch(fs FileSystem, text string) (string, error) {
+	blocks, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var paths []string
+	actions := map[string]string{}
+	for n, b := range blocks {
+		action, err := apply(fs, b, n+1)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := actions[b.Path]; !ok {
+			paths = append(paths, b.Path)
+			actions[b.Path] = action
+		}
+	}
+	done := make([]string, len(paths))
+	for i, p := range paths {
+		done[i] = actions[p] + " " + p
+	}
+	return strings.Join(done, ", "), nil
+}
+
+func apply(fs FileSystem, b Block, n int) (string, error) {
+	if isEmpty(b.Search) {
+		if fs.Has(b.Path) {
+			return "", fmt.Errorf("searchreplace: block %d: %s already exists, an empty SEARCH section only creates files", n, b.Path)
+		}
+		return "added", fs.Write(b.Path, strings.Join(b.Replace, "\n")+"\n")
+	}
+	if !fs.Has(b.Path) {
+		return "", kinderr.Errorf(ErrMissingFile, "searchreplace: block %d: missing file %s", n, b.Path)
+	}
+	content, err := fs.Open(b.Path)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(content, "\n")
+	at, indent, err := locate(lines, b.Search)
+	if err != nil {
+		return "", fmt.Errorf("searchreplace: block %d: %s: %w", n, b.Path, err)
+	}
+	replace := make([]string, len(b.Replace))
+	for i, l := range b.Replace {
+		if strings.TrimSpace(l) != "" {
+			l = indent + l
+		}
+		replace[i] = l
+	}
+	out := append(append(append([]string{}, lines[:at]...), replace...), lines[at+len(b.Search):]...)
+	return "updated", fs.Write(b.Path, strings.Join(out, "\n"))
+}
+
+// locate returns the line of lines where search appears once: exactly, then ignoring trailing
+// whitespace, then with an indentation the search lack, which is returned to indent the
+// replacement alike.
+func locate(lines, search []string) (int, string, error) {
+	trimRight := func(s string) string { return strings.TrimRight(s, " \t") }
+	levels := []func(line, want string) (string, bool){
+		func(line, want string) (string, bool) { return "", line == want },
+		func(line, want string) (string, bool) { return "", trimRight(line) == trimRight(want) },
+		func(line, want string) (string, bool) {
+			extra, ok := strings.CutSuffix(trimRight(line), trimRight(want))
+			return extra, ok && strings.TrimLeft(extra, " \t") == ""
+		},
+	}
+	for _, match := range levels {
+		var found []int
+		var indent string
+		for i := 0; i+len(search) <= len(lines); i++ {
+			if extra, ok := matchAt(lines[i:i+len(search)], search, match); ok {
+				found = append(found, i)
+				indent = extra
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], indent, nil
+		default:
+			return 0, "", kinderr.Errorf(ErrAmbiguous, "the SEARCH section matches %d places (lines %s), add lines around it to make it unique", len(found), lineNumbers(found))
+		}
+	}
+	return 0, "", kinderr.Errorf(ErrSearchNotFound, "the SEARCH section does not match the file, copy its lines exactly from the file")
+}
+
+// matchAt reports whether lines match search, with the same indentation added to every non-blank
+// line.
+func matchAt(lines, search []string, match func(line, want string) (string, bool)) (string, bool) {
+	indent, set := "", false
+	for i, want := range search {
+		if strings.TrimSpace(want) == "" && strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		extra, ok := match(lines[i], want)
+		if !ok || (set && extra != indent) {
+			return "", false
+		}
+		indent, set = extra, true
+	}
+	return indent, true
+}
+
+func lineNumbers(found []int) string {
+	s := make([]string, len(found))
+	for i, n := range found {
+		s[i] = fmt.Sprint(n + 1)
+	}
+	return strings.Join(s, ", ")
+}
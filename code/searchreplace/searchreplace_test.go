@@ -0,0 +1,85 @@
+package searchreplace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// memFS is a FileSystem backed by a map.
+type memFS map[string]string
+
+func (m memFS) Has(p string) bool              { _, ok := m[p]; return ok }
+func (m memFS) Open(p string) (string, error)  { return m[p], nil }
+func (m memFS) Write(p string, c string) error { m[p] = c; return nil }
+
+type SearchReplaceSuite struct{ suite.Suite }
+
+func TestSearchReplaceSuite(t *testing.T) { suite.Run(t, new(SearchReplaceSuite)) }
+
+const calc = "package calc\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n\nfunc Sub(a, b int) int {\n\treturn a + b\n}\n"
+
+func (s *SearchReplaceSuite) TestApply_UpdateAndAdd() {
+	fs := memFS{"calc.go": calc}
+	patch := "calc.go\n```go\n<<<<<<< SEARCH\nfunc Sub(a, b int) int {\n\treturn a + b\n=======\nfunc Sub(a, b int) int {\n\treturn a - b\n>>>>>>> REPLACE\n```\n\n" +
+		"<<<<<<< SEARCH\nfunc Add(a, b int) int {\n=======\n// Add adds.\nfunc Add(a, b int) int {\n>>>>>>> REPLACE\n\n" +
+		"`calc_test.go`\n<<<<<<< SEARCH\n=======\npackage calc\n>>>>>>> REPLACE\n"
+	msg, err := ApplyPatch(fs, patch)
+	s.Require().NoError(err)
+	s.Equal("updated calc.go, added calc_test.go", msg)
+	s.Equal("package calc\n\n// Add adds.\nfunc Add(a, b int) int {\n\treturn a + b\n}\n\nfunc Sub(a, b int) int {\n\treturn a - b\n}\n", fs["calc.go"])
+	s.Equal("package calc\n", fs["calc_test.go"])
+}
+
+func (s *SearchReplaceSuite) TestApply_Whitespace() {
+	fs := memFS{"calc.go": calc}
+	_, err := ApplyPatch(fs, "calc.go\n<<<<<<< SEARCH\nfunc Sub(a, b int) int {  \n=======\nfunc Sub(a, b int) (diff int) {\n>>>>>>> REPLACE\n")
+	s.Require().NoError(err)
+	s.Contains(fs["calc.go"], "func Sub(a, b int) (diff int) {\n")
+
+	fs = memFS{"calc.go": "func f() {\n\tif x {\n\t\tg()\n\t}\n}\n"}
+	_, err = ApplyPatch(fs, "calc.go\n<<<<<<< SEARCH\nif x {\n\tg()\n}\n=======\nif x {\n\tg()\n\th()\n}\n>>>>>>> REPLACE\n")
+	s.Require().NoError(err)
+	s.Equal("func f() {\n\tif x {\n\t\tg()\n\t\th()\n\t}\n}\n", fs["calc.go"], "the replacement gets the indentation of the match")
+
+	_, err = ApplyPatch(fs, "calc.go\n<<<<<<< SEARCH\nh()\n}\n=======\n>>>>>>> REPLACE\n")
+	s.True(errors.Is(err, ErrSearchNotFound), "the lines must all miss the same indentation: %v", err)
+}
+
+func (s *SearchReplaceSuite) TestApply_Errors() {
+	fs := memFS{"calc.go": calc}
+	_, err := ApplyPatch(fs, "calc.go\n<<<<<<< SEARCH\n\treturn a + b\n=======\n\treturn 0\n>>>>>>> REPLACE\n")
+	s.True(errors.Is(err, ErrAmbiguous), "%v", err)
+	s.ErrorContains(err, "matches 2 places (lines 4, 8)")
+
+	_, err = ApplyPatch(fs, "calc.go\n<<<<<<< SEARCH\nfunc Mul(a, b int) int {\n=======\n>>>>>>> REPLACE\n")
+	s.True(errors.Is(err, ErrSearchNotFound), "%v", err)
+
+	_, err = ApplyPatch(fs, "other.go\n<<<<<<< SEARCH\nx\n=======\ny\n>>>>>>> REPLACE\n")
+	s.True(errors.Is(err, ErrMissingFile), "%v", err)
+
+	_, err = ApplyPatch(fs, "calc.go\n<<<<<<< SEARCH\n=======\ny\n>>>>>>> REPLACE\n")
+	s.ErrorContains(err, "calc.go already exists")
+	s.Equal(calc, fs["calc.go"])
+}
+
+func (s *SearchReplaceSuite) TestParse_Malformed() {
+	for patch, want := range map[string]string{
+		"<<<<<<< SEARCH\nx\n=======\ny\n>>>>>>> REPLACE\n":      "has no file path",
+		"a.go\n<<<<<<< SEARCH\nx\n>>>>>>> REPLACE\n":            "has no ======= line",
+		"a.go\n<<<<<<< SEARCH\nx\n=======\ny\n":                 "has no >>>>>>> REPLACE line",
+		"a.go\n=======\ny\n>>>>>>> REPLACE\n":                   "outside of a block",
+		"a.go\n--- a.go\n+++ a.go\n@@ -1 +1 @@\n-x\n+y\n":       "no <<<<<<< SEARCH block found",
+		"a.go\n<<<<<<< SEARCH\nx\n=======\n<<<<<<< SEARCH\ny\n": "has no >>>>>>> REPLACE line",
+	} {
+		_, err := Parse(patch)
+		s.ErrorContains(err, want, patch)
+	}
+}
+
+func (s *SearchReplaceSuite) TestUpdatedFiles() {
+	patch := "a.go\n<<<<<<< SEARCH\nx\n=======\ny\n>>>>>>> REPLACE\nb.go\n<<<<<<< SEARCH\n=======\ny\n>>>>>>> REPLACE\na.go\n<<<<<<< SEARCH\nz\n=======\n>>>>>>> REPLACE\n"
+	s.Equal([]string{"a.go"}, UpdatedFiles(patch))
+	s.Nil(UpdatedFiles("not a patch"))
+}
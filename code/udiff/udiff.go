@@ -0,0 +1,305 @@
+// Package udiff applies unified diffs, as produced by `diff -u` or `git diff`, to a collection of
+// text files. Hunk line numbers are only hints: hunks are located by their context and removed
+// lines, so patches written by a model still apply when the numbers are off.
+package udiff
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stumble/axe/code/anchor"
+	"github.com/stumble/axe/internal/kinderr"
+)
+
+// FileSystem is the set of files a diff is applied to, see container.CodeContainer.
+type FileSystem interface {
+	Has(string) bool
+	Open(string) (string, error)
+	Write(string, string) error
+	Remove(string) error
+}
+
+const devNull = "/dev/null"
+
+// Kinds of the errors of ApplyPatch, to branch on with errors.Is.
+var (
+	ErrMissingFile     = errors.New("udiff: missing file")
+	ErrContextNotFound = errors.New("udiff: hunk does not match the file")
+)
+
+// FileDiff is the diff of one file. OldPath is /dev/null for added files and NewPath is /dev/null
+// for deleted files.
+type FileDiff struct {
+	OldPath string
+	NewPath string
+	Hunks   []Hunk
+}
+
+// Hunk is a block of changes. Lines keep their ' ', '-' or '+' prefix.
+type Hunk struct {
+	OldStart int // 1-based line of the hunk in the old file, as written in the header
+	Header   string
+	Lines    []string
+	// NoNewlineAtEOF is set when the new side ends with "\ No newline at end of file".
+	NoNewlineAtEOF bool
+}
+
+// section returns the text after the line ranges of the header, the declaration the hunk is in.
+func (h Hunk) section() string {
+	rest := strings.TrimPrefix(h.Header, "@@")
+	if i := strings.Index(rest, "@@"); i >= 0 {
+		return strings.TrimSpace(rest[i+2:])
+	}
+	return ""
+}
+
+// old returns the context and removed lines, new the context and added lines.
+func (h Hunk) old() []string { return h.side('-') }
+func (h Hunk) new() []string { return h.side('+') }
+
+func (h Hunk) side(keep byte) []string {
+	var out []string
+	for _, l := range h.Lines {
+		if l[0] == ' ' || l[0] == keep {
+			out = append(out, l[1:])
+		}
+	}
+	return out
+}
+
+// Parse parses the file diffs of text. Lines before the first "--- " header (e.g. "diff --git"
+// or "index" lines) are ignored.
+func Parse(text string) ([]FileDiff, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var diffs []FileDiff
+	for i := 0; i < len(lines); {
+		if !isFileHeader(lines, i) {
+			i++
+			continue
+		}
+		fd := FileDiff{OldPath: headerPath(lines[i], "--- "), NewPath: headerPath(lines[i+1], "+++ ")}
+		i += 2
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@") {
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, fmt.Errorf("udiff: %s: %w", fd.path(), err)
+			}
+			fd.Hunks = append(fd.Hunks, hunk)
+			i = next
+		}
+		if len(fd.Hunks) == 0 {
+			return nil, fmt.Errorf("udiff: %s: no hunk after the file header", fd.path())
+		}
+		diffs = append(diffs, fd)
+	}
+	if len(diffs) == 0 {
+		return nil, errors.New("udiff: no file header (--- old, +++ new) found")
+	}
+	return diffs, nil
+}
+
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// headerPath returns the path of a file header, without a trailing timestamp.
+func headerPath(line, prefix string) string {
+	p := strings.TrimPrefix(line, prefix)
+	if tab := strings.IndexByte(p, '\t'); tab >= 0 {
+		p = p[:tab]
+	}
+	return strings.TrimSpace(p)
+}
+
+func parseHunk(lines []string, i int) (Hunk, int, error) {
+	hunk := Hunk{Header: lines[i]}
+	fields := strings.Fields(strings.TrimPrefix(lines[i], "@@"))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "-") {
+		return hunk, 0, fmt.Errorf("invalid hunk header %q", lines[i])
+	}
+	start, _, _ := strings.Cut(fields[0][1:], ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return hunk, 0, fmt.Errorf("invalid hunk header %q", lines[i])
+	}
+	hunk.OldStart = n
+	i++
+	for ; i < len(lines); i++ {
+		l := lines[i]
+		if strings.HasPrefix(l, "@@") || isFileHeader(lines, i) {
+			break
+		}
+		switch {
+		case l == "":
+			// editors and models often strip the space of empty context lines
+			hunk.Lines = append(hunk.Lines, " ")
+		case l[0] == ' ' || l[0] == '-' || l[0] == '+':
+			hunk.Lines = append(hunk.Lines, l)
+		case l[0] == '\\':
+			if n := len(hunk.Lines); n > 0 && hunk.Lines[n-1][0] != '-' {
+				hunk.NoNewlineAtEOF = true
+			}
+		default:
+			return hunk, 0, fmt.Errorf("invalid line in hunk %q: %q", hunk.Header, l)
+		}
+	}
+	// a trailing empty line is the end of the text rather than context
+	for len(hunk.Lines) > 0 && hunk.Lines[len(hunk.Lines)-1] == " " && i == len(lines) {
+		hunk.Lines = hunk.Lines[:len(hunk.Lines)-1]
+	}
+	if len(hunk.Lines) == 0 {
+		return hunk, 0, fmt.Errorf("empty hunk %q", hunk.Header)
+	}
+	return hunk, i, nil
+}
+
+func (fd FileDiff) path() string {
+	if fd.NewPath != devNull {
+		return fd.NewPath
+	}
+	return fd.OldPath
+}
+
+// ApplyPatch parses text and applies every file diff to fs. Paths may carry the a/ and b/
+// prefixes of git diffs.
+func ApplyPatch(fs FileSystem, text string) (string, error) {
+	diffs, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var changed []string
+	for _, fd := range diffs {
+		msg, err := apply(fs, fd)
+		if err != nil {
+			return "", err
+		}
+		changed = append(changed, msg)
+	}
+	return strings.Join(changed, ", "), nil
+}
+
+func apply(fs FileSystem, fd FileDiff) (string, error) {
+	switch {
+	case fd.OldPath == devNull:
+		path := resolve(fs, fd.NewPath, "b/")
+		if fs.Has(path) {
+			return "", fmt.Errorf("udiff: add %s: file already exists", path)
+		}
+		var content []string
+		for _, h := range fd.Hunks {
+			content = append(content, h.new()...)
+		}
+		text := strings.Join(content, "\n")
+		if !fd.Hunks[len(fd.Hunks)-1].NoNewlineAtEOF {
+			text += "\n"
+		}
+		return "added " + path, fs.Write(path, text)
+	case fd.NewPath == devNull:
+		path := resolve(fs, fd.OldPath, "a/")
+		if !fs.Has(path) {
+			return "", kinderr.Errorf(ErrMissingFile, "udiff: delete %s: missing file", path)
+		}
+		return "deleted " + path, fs.Remove(path)
+	}
+
+	oldPath, newPath := resolve(fs, fd.OldPath, "a/"), resolve(fs, fd.NewPath, "b/")
+	if !fs.Has(oldPath) {
+		return "", kinderr.Errorf(ErrMissingFile, "udiff: update %s: missing file", oldPath)
+	}
+	orig, err := fs.Open(oldPath)
+	if err != nil {
+		return "", err
+	}
+	updated, err := applyHunks(oldPath, orig, fd.Hunks)
+	if err != nil {
+		return "", fmt.Errorf("udiff: %s: %w", oldPath, err)
+	}
+	if err := fs.Write(newPath, updated); err != nil {
+		return "", err
+	}
+	if newPath != oldPath {
+		if err := fs.Remove(oldPath); err != nil {
+			return "", err
+		}
+		return "moved " + oldPath + " to " + newPath, nil
+	}
+	return "updated " + newPath, nil
+}
+
+// resolve strips the git prefix of path unless fs has a file with the prefixed path.
+func resolve(fs FileSystem, path, prefix string) string {
+	if stripped, ok := strings.CutPrefix(path, prefix); ok && !fs.Has(path) {
+		return stripped
+	}
+	return path
+}
+
+// applyHunks applies the hunks of the file at path in order. Each hunk is searched after the
+// previous one, matching lines exactly and then ignoring trailing whitespace: first after the
+// declaration its header names (e.g. "@@ -8,5 +8,5 @@ func Sub(a, b int) int"), which line
+// numbers shifted by earlier edits don't mislead, then nearest to its header line.
+func applyHunks(path, content string, hunks []Hunk) (string, error) {
+	lines := strings.Split(content, "\n")
+	var out []string
+	var decls []anchor.Decl // parsed on the first header naming a declaration
+	pos := 0
+	for n, h := range hunks {
+		old := h.old()
+		at := -1
+		if section := h.section(); section != "" {
+			if decls == nil {
+				decls = anchor.Decls(path, content)
+			}
+			if d, ok := anchor.Find(decls, section); ok {
+				at = find(lines, old, max(pos, d.Start), d.Start)
+			}
+		}
+		if at < 0 {
+			at = find(lines, old, pos, h.OldStart-1)
+		}
+		if at < 0 {
+			return "", kinderr.Errorf(ErrContextNotFound, "hunk %d (%s) does not match the file", n+1, h.Header)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, h.new()...)
+		pos = at + len(old)
+	}
+	out = append(out, lines[pos:]...)
+	return strings.Join(out, "\n"), nil
+}
+
+func find(lines, want []string, from, hint int) int {
+	for _, eq := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	} {
+		best := -1
+		for i := from; i+len(want) <= len(lines); i++ {
+			if matches(lines[i:i+len(want)], want, eq) && (best < 0 || abs(i-hint) < abs(best-hint)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func matches(lines, want []string, eq func(a, b string) bool) bool {
+	for i := range want {
+		if !eq(lines[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
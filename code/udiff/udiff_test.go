@@ -0,0 +1,91 @@
+package udiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// memFS is a FileSystem backed by a map.
+type memFS map[string]string
+
+func (m memFS) Has(p string) bool              { _, ok := m[p]; return ok }
+func (m memFS) Open(p string) (string, error)  { return m[p], nil }
+func (m memFS) Write(p string, c string) error { m[p] = c; return nil }
+func (m memFS) Remove(p string) error          { delete(m, p); return nil }
+
+type UdiffSuite struct{ suite.Suite }
+
+func TestUdiffSuite(t *testing.T) { suite.Run(t, new(UdiffSuite)) }
+
+func (s *UdiffSuite) TestApply_UpdateAddDelete() {
+	fs := memFS{
+		"bar.txt": "one\ntwo\nthree\nfour\nfive\n",
+		"old.txt": "gone\n",
+	}
+	patch := `diff --git a/bar.txt b/bar.txt
+--- a/bar.txt
++++ b/bar.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+@@ -4,2 +4,3 @@
+ four
+ five
++six
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+`
+	msg, err := ApplyPatch(fs, patch)
+	s.Require().NoError(err)
+	s.Equal("updated bar.txt, added new.txt, deleted old.txt", msg)
+	s.Equal(memFS{
+		"bar.txt": "one\n2\nthree\nfour\nfive\nsix\n",
+		"new.txt": "hello\nworld\n",
+	}, fs)
+}
+
+func (s *UdiffSuite) TestApply_WrongLineNumbersAndStrippedContext() {
+	fs := memFS{"a.go": "package a\n\nfunc A() {}\n\nfunc B() {}\n"}
+	// the line numbers are off and the empty context line lost its space
+	patch := "--- a.go\n+++ a.go\n@@ -10,3 +10,3 @@\n\n-func B() {}\n+func B() { A() }\n"
+	_, err := ApplyPatch(fs, patch)
+	s.Require().NoError(err)
+	s.Equal("package a\n\nfunc A() {}\n\nfunc B() { A() }\n", fs["a.go"])
+}
+
+func (s *UdiffSuite) TestApply_AnchoredOnDeclaration() {
+	fs := memFS{"a.go": "package a\n\nfunc A() int {\n\treturn 0\n}\n\nfunc B() int {\n\treturn 0\n}\n"}
+	// the line numbers point at A, the header names B
+	patch := "--- a.go\n+++ a.go\n@@ -3,3 +3,3 @@ func B() int {\n-\treturn 0\n+\treturn 1\n }\n"
+	_, err := ApplyPatch(fs, patch)
+	s.Require().NoError(err)
+	s.Equal("package a\n\nfunc A() int {\n\treturn 0\n}\n\nfunc B() int {\n\treturn 1\n}\n", fs["a.go"])
+}
+
+func (s *UdiffSuite) TestApply_Errors() {
+	fs := memFS{"a.txt": "one\n"}
+
+	_, err := ApplyPatch(fs, "--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-two\n+2\n")
+	s.ErrorContains(err, "udiff: a.txt: hunk 1 (@@ -1 +1 @@) does not match the file")
+	s.ErrorIs(err, ErrContextNotFound)
+
+	_, err = ApplyPatch(fs, "just text")
+	s.ErrorContains(err, "no file header")
+
+	_, err = ApplyPatch(fs, "--- /dev/null\n+++ a.txt\n@@ -0,0 +1 @@\n+x\n")
+	s.ErrorContains(err, "file already exists")
+
+	_, err = ApplyPatch(fs, "--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n*one\n")
+	s.ErrorContains(err, "invalid line in hunk")
+	s.Equal(memFS{"a.txt": "one\n"}, fs)
+}
@@ -6,8 +6,13 @@ package v4a
 import (
 	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"unicode"
+
+	"github.com/stumble/axe/code/anchor"
 )
 
 type FileSystem interface {
@@ -16,6 +21,18 @@ type FileSystem interface {
 	Remove(string) error
 }
 
+// ModeSetter is implemented by file systems that support "*** Set Mode:" directives.
+type ModeSetter interface {
+	SetMode(path string, mode os.FileMode) error
+}
+
+// PathLister is implemented by file systems that can tell which files exist. Patches updating or
+// deleting a missing file are then rejected with the closest existing path as a suggestion.
+type PathLister interface {
+	Has(path string) bool
+	Paths() []string
+}
+
 // --------------------------------------------------------------------------- //
 //
 //	Domain objects
@@ -37,6 +54,7 @@ type FileChange struct {
 	OldContent *string
 	NewContent *string
 	MovePath   string
+	Mode       os.FileMode // permissions set by "*** Set Mode:", 0 when unchanged
 }
 
 type Commit struct {
@@ -47,16 +65,30 @@ type Commit struct {
 //  Exceptions
 // --------------------------------------------------------------------------- //
 
+// Kinds of DiffError, to branch on with errors.Is.
+var (
+	ErrMissingFile     = errors.New("v4a: missing file")
+	ErrContextNotFound = errors.New("v4a: context not found")
+)
+
 type DiffError struct {
-	msg string
+	msg  string
+	kind error // ErrMissingFile, ErrContextNotFound or nil
 }
 
 func (e *DiffError) Error() string { return e.msg }
 
+func (e *DiffError) Unwrap() error { return e.kind }
+
 func diffErrorf(format string, a ...any) *DiffError {
 	return &DiffError{msg: fmt.Sprintf(format, a...)}
 }
 
+// kindErrorf returns a DiffError of the given kind.
+func kindErrorf(kind error, format string, a ...any) *DiffError {
+	return &DiffError{msg: fmt.Sprintf(format, a...), kind: kind}
+}
+
 // --------------------------------------------------------------------------- //
 //  Helper dataclasses used while parsing patches
 // --------------------------------------------------------------------------- //
@@ -72,6 +104,7 @@ type PatchAction struct {
 	NewFile  *string
 	Chunks   []Chunk
 	MovePath string
+	Mode     os.FileMode
 }
 
 type Patch struct {
@@ -88,6 +121,20 @@ type Parser struct {
 	Index        int
 	Patch        Patch
 	Fuzz         int
+	Options      Options
+
+	known  []string      // existing paths, for suggestions in missing file errors
+	approx []approxMatch // the matches that added fuzz, reported to the model
+}
+
+// approxMatch is a header or context of a patch that did not match the file exactly.
+type approxMatch struct {
+	path  string
+	line  int      // 0-based line of the match in the file
+	lines []string // the lines of the file that matched
+	how   string   // e.g. "context matched ignoring indentation"
+	// similar is set when the context was found by the similarity pass of Options.MinSimilarity.
+	similar bool
 }
 
 // ------------- low-level helpers -------------------------------------- //
@@ -167,15 +214,20 @@ func (p *Parser) parse() error {
 			if err != nil {
 				return err
 			}
+			mode, err := p.readMode()
+			if err != nil {
+				return err
+			}
 			if _, ok := p.CurrentFiles[path]; !ok {
-				return diffErrorf("Update File Error - missing file: %s", path)
+				return kindErrorf(ErrMissingFile, "Update File Error - missing file: %s%s", path, didYouMean(path, p.known))
 			}
 			text := p.CurrentFiles[path]
-			action, err := p.parseUpdateFile(text)
+			action, err := p.parseUpdateFile(path, text)
 			if err != nil {
 				return err
 			}
 			action.MovePath = moveTo
+			action.Mode = mode
 			p.Patch.Actions[path] = &action
 			continue
 		}
@@ -188,7 +240,7 @@ func (p *Parser) parse() error {
 				return diffErrorf("Duplicate delete for file: %s", path)
 			}
 			if _, ok := p.CurrentFiles[path]; !ok {
-				return diffErrorf("Delete File Error - missing file: %s", path)
+				return kindErrorf(ErrMissingFile, "Delete File Error - missing file: %s%s", path, didYouMean(path, p.known))
 			}
 			p.Patch.Actions[path] = &PatchAction{Type: ActionDelete}
 			continue
@@ -201,13 +253,21 @@ func (p *Parser) parse() error {
 			if _, exists := p.Patch.Actions[path]; exists {
 				return diffErrorf("Duplicate add for file: %s", path)
 			}
+			if strings.HasSuffix(path, "/") {
+				return diffErrorf("Add File Error - %s is a directory: add a file in it, e.g. an empty %s.gitkeep", path, path)
+			}
 			if _, ok := p.CurrentFiles[path]; ok {
 				return diffErrorf("Add File Error - file already exists: %s", path)
 			}
+			mode, err := p.readMode()
+			if err != nil {
+				return err
+			}
 			action, err := p.parseAddFile()
 			if err != nil {
 				return err
 			}
+			action.Mode = mode
 			p.Patch.Actions[path] = &action
 			continue
 		}
@@ -223,10 +283,37 @@ func (p *Parser) parse() error {
 	return nil
 }
 
+// readMode reads the optional "*** Set Mode: 0755" line following a file header; 0 when absent.
+func (p *Parser) readMode() (os.FileMode, error) {
+	if p.isDone() {
+		return 0, nil
+	}
+	text, ok, err := p.readStr("*** Set Mode: ")
+	if err != nil || !ok {
+		return 0, err
+	}
+	return parseMode(text)
+}
+
+// parseMode parses octal permissions, "0755", "755" or git's "100755".
+func parseMode(text string) (os.FileMode, error) {
+	s := strings.TrimSpace(text)
+	if len(s) == 6 && strings.HasPrefix(s, "100") {
+		s = s[3:]
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m == 0 || m > 0o777 {
+		return 0, diffErrorf("Invalid Set Mode %q: expected octal permissions such as 0755 or 0644", strings.TrimSpace(text))
+	}
+	return os.FileMode(m), nil
+}
+
 // ------------- section parsers ---------------------------------------- //
-func (p *Parser) parseUpdateFile(text string) (PatchAction, error) {
+func (p *Parser) parseUpdateFile(path, text string) (PatchAction, error) {
 	action := PatchAction{Type: ActionUpdate}
 	lines := strings.Split(text, "\n")
+	idx := newLineIndex(lines)
+	var decls []anchor.Decl // parsed on the first header not found as is
 	index := 0
 	for !p.isDone("*** End Patch", "*** Update File:", "*** Delete File:", "*** Add File:", "*** End of File") {
 		defStr, ok, err := p.readStr("@@ ")
@@ -271,11 +358,24 @@ func (p *Parser) parseUpdateFile(text string) (PatchAction, error) {
 					if strings.TrimSpace(lines[i]) == strings.TrimSpace(defStr) {
 						index = i + 1
 						p.Fuzz += 1
+						p.approx = append(p.approx, approxMatch{path: path, line: i, lines: lines[i : i+1], how: "@@ line matched ignoring surrounding whitespace"})
 						found = true
 						break
 					}
 				}
 			}
+			// declaration pass: the function or class the header names, e.g. with another signature
+			if !found {
+				if decls == nil {
+					decls = anchor.Decls(path, text)
+				}
+				if d, ok := anchor.Find(decls, defStr); ok && d.Start >= index {
+					index = d.Start + 1
+					p.Fuzz += 1
+					p.approx = append(p.approx, approxMatch{path: path, line: d.Start, lines: lines[d.Start : d.Start+1], how: "@@ line matched the declaration of " + d.Name})
+					found = true
+				}
+			}
 			// If still not found, that's okay; we rely on context next.
 		}
 
@@ -283,16 +383,19 @@ func (p *Parser) parseUpdateFile(text string) (PatchAction, error) {
 		if err != nil {
 			return action, err
 		}
-		newIndex, fuzz := findContext(lines, nextCtx, index, eof)
+		newIndex, fuzz := idx.findContext(nextCtx, index, eof, p.Options)
 		if newIndex == -1 {
 			ctxTxt := strings.Join(nextCtx, "\n")
 			prefix := ""
 			if eof {
 				prefix = "EOF "
 			}
-			return action, diffErrorf("Invalid %scontext at %d:\n%s", prefix, index, ctxTxt)
+			return action, kindErrorf(ErrContextNotFound, "Invalid %scontext at %d:\n%s", prefix, index, ctxTxt)
 		}
 		p.Fuzz += fuzz
+		if fuzz > 0 {
+			p.approx = append(p.approx, approxMatch{path: path, line: newIndex, lines: lines[newIndex:min(newIndex+len(nextCtx), len(lines))], how: "context matched " + fuzzHow(fuzz), similar: fuzz%10_000 == fuzzSimilar})
+		}
 		for _, ch := range chunks {
 			ch.OrigIndex += newIndex
 			action.Chunks = append(action.Chunks, ch)
@@ -303,6 +406,8 @@ func (p *Parser) parseUpdateFile(text string) (PatchAction, error) {
 	return action, nil
 }
 
+// parseAddFile reads the content of an added file. A file without + lines is added empty, e.g. a
+// .gitkeep creating a new directory; blank lines after the last + line are ignored.
 func (p *Parser) parseAddFile() (PatchAction, error) {
 	var lines []string
 	for !p.isDone("*** End Patch", "*** Update File:", "*** Delete File:", "*** Add File:") {
@@ -310,6 +415,9 @@ func (p *Parser) parseAddFile() (PatchAction, error) {
 		if err != nil {
 			return PatchAction{}, err
 		}
+		if strings.TrimSpace(s) == "" && p.onlyBlankLinesLeft() {
+			continue
+		}
 		if !strings.HasPrefix(s, "+") {
 			return PatchAction{}, diffErrorf("Invalid Add File line (missing '+'): %s", s)
 		}
@@ -319,51 +427,24 @@ func (p *Parser) parseAddFile() (PatchAction, error) {
 	return PatchAction{Type: ActionAdd, NewFile: &content}, nil
 }
 
-// --------------------------------------------------------------------------- //
-//  Helper functions
-// --------------------------------------------------------------------------- //
-
-func findContextCore(lines, context []string, start int) (int, int) {
-	if len(context) == 0 {
-		return start, 0
-	}
-	// Strict match
-	for i := start; i+len(context) <= len(lines); i++ {
-		if slicesEqual(lines[i:i+len(context)], context) {
-			return i, 0
-		}
-	}
-	// rstrip match
-	for i := start; i+len(context) <= len(lines); i++ {
-		if slicesEqualRStrip(lines[i:i+len(context)], context) {
-			return i, 1
+// onlyBlankLinesLeft reports whether the lines up to the next file header or the end of the patch
+// are blank.
+func (p *Parser) onlyBlankLinesLeft() bool {
+	for i := p.Index; i < len(p.Lines); i++ {
+		line := norm(p.Lines[i])
+		if strings.HasPrefix(line, "*** ") {
+			return true
 		}
-	}
-	// strip match
-	for i := start; i+len(context) <= len(lines); i++ {
-		if slicesEqualStrip(lines[i:i+len(context)], context) {
-			return i, 100
+		if strings.TrimSpace(line) != "" {
+			return false
 		}
 	}
-	return -1, 0
+	return true
 }
 
-func findContext(lines, context []string, start int, eof bool) (int, int) {
-	if eof {
-		pos := len(lines) - len(context)
-		if pos < 0 {
-			pos = 0
-		}
-		if newIndex, fuzz := findContextCore(lines, context, pos); newIndex != -1 {
-			return newIndex, fuzz
-		}
-		if newIndex, fuzz := findContextCore(lines, context, start); newIndex != -1 {
-			return newIndex, fuzz + 10_000
-		}
-		return -1, 0
-	}
-	return findContextCore(lines, context, start)
-}
+// --------------------------------------------------------------------------- //
+//  Helper functions
+// --------------------------------------------------------------------------- //
 
 // Replace the entire peekNextSection with this version.
 func peekNextSection(lines []string, index int) ([]string, []Chunk, int, bool, error) {
@@ -511,6 +592,7 @@ func patchToCommit(patch Patch, orig map[string]string) (Commit, error) {
 			commit.Changes[path] = FileChange{
 				Type:       ActionAdd,
 				NewContent: action.NewFile,
+				Mode:       action.Mode,
 			}
 		case ActionUpdate:
 			newContent, err := getUpdatedFile(orig[path], *action, path)
@@ -524,6 +606,7 @@ func patchToCommit(patch Patch, orig map[string]string) (Commit, error) {
 				OldContent: &old,
 				NewContent: &nc,
 				MovePath:   action.MovePath,
+				Mode:       action.Mode,
 			}
 		}
 	}
@@ -534,10 +617,10 @@ func patchToCommit(patch Patch, orig map[string]string) (Commit, error) {
 //  User-facing helpers
 // --------------------------------------------------------------------------- //
 
-func textToPatch(text string, orig map[string]string) (Patch, int, error) {
+func textToPatch(text string, orig map[string]string, known []string, opts Options) (Patch, *Parser, error) {
 	lines := splitLinesLikePython(text) // preserves blank lines, no strip()
 	if len(lines) < 2 || !strings.HasPrefix(norm(lines[0]), "*** Begin Patch") || norm(lines[len(lines)-1]) != "*** End Patch" {
-		return Patch{}, 0, diffErrorf("Invalid patch text - missing sentinels")
+		return Patch{}, nil, diffErrorf("Invalid patch text - missing sentinels")
 	}
 	parser := &Parser{
 		CurrentFiles: orig,
@@ -545,11 +628,13 @@ func textToPatch(text string, orig map[string]string) (Patch, int, error) {
 		Index:        1,
 		Patch:        Patch{Actions: map[string]*PatchAction{}},
 		Fuzz:         0,
+		Options:      opts,
+		known:        known,
 	}
 	if err := parser.parse(); err != nil {
-		return Patch{}, 0, err
+		return Patch{}, nil, err
 	}
-	return parser.Patch, parser.Fuzz, nil
+	return parser.Patch, parser, nil
 }
 
 func identifyFilesNeeded(text string) []string {
@@ -568,6 +653,17 @@ func identifyFilesNeeded(text string) []string {
 	return out
 }
 
+// UpdatedFiles returns the paths of the Update File sections of a patch, in order.
+func UpdatedFiles(text string) []string {
+	var out []string
+	for _, line := range splitLinesLikePython(strings.TrimSpace(text)) {
+		if path, ok := strings.CutPrefix(line, "*** Update File: "); ok {
+			out = append(out, strings.TrimSpace(path))
+		}
+	}
+	return out
+}
+
 func identifyFilesAdded(text string) []string {
 	lines := splitLinesLikePython(text)
 	var out []string
@@ -587,9 +683,14 @@ type OpenFn func(string) (string, error)
 type WriteFn func(string, string) error
 type RemoveFn func(string) error
 
-func loadFiles(paths []string, openFn OpenFn) (map[string]string, error) {
+// loadFiles opens the files of paths. Paths the lister doesn't have are left out, the parser
+// reports them as missing.
+func loadFiles(paths []string, openFn OpenFn, lister PathLister) (map[string]string, error) {
 	m := make(map[string]string, len(paths))
 	for _, p := range paths {
+		if lister != nil && !lister.Has(p) {
+			continue
+		}
 		txt, err := openFn(p)
 		if err != nil {
 			return nil, err
@@ -634,21 +735,45 @@ func applyCommit(commit Commit, writeFn WriteFn, removeFn RemoveFn) error {
 	return nil
 }
 
+// applyModes sets the permissions of the files changed with "*** Set Mode:", after their content
+// was written.
+func applyModes(commit Commit, setMode func(string, os.FileMode) error) error {
+	for path, change := range commit.Changes {
+		if change.Mode == 0 {
+			continue
+		}
+		if change.MovePath != "" {
+			path = change.MovePath
+		}
+		if err := setMode(path, change.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func processPatch(
 	text string,
 	openFn OpenFn,
 	writeFn WriteFn,
 	removeFn RemoveFn,
+	setMode func(string, os.FileMode) error,
+	lister PathLister,
+	opts Options,
 ) (string, error) {
 	if !strings.HasPrefix(text, "*** Begin Patch") {
 		return "", diffErrorf("Patch text must start with *** Begin Patch")
 	}
 	paths := identifyFilesNeeded(text)
-	orig, err := loadFiles(paths, openFn)
+	orig, err := loadFiles(paths, openFn, lister)
 	if err != nil {
 		return "", err
 	}
-	patch, _fuzz, err := textToPatch(text, orig)
+	var known []string
+	if lister != nil {
+		known = lister.Paths()
+	}
+	patch, parser, err := textToPatch(text, orig, known, opts)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse patch: %w", err)
 	}
@@ -656,18 +781,105 @@ func processPatch(
 	if err != nil {
 		return "", fmt.Errorf("failed to convert patch to commit: %w", err)
 	}
+	if setMode == nil {
+		// refuse before anything is written
+		for path, change := range commit.Changes {
+			if change.Mode != 0 {
+				return "", diffErrorf("Set Mode is not supported here: %s", path)
+			}
+		}
+	}
 	if err := applyCommit(commit, writeFn, removeFn); err != nil {
 		return "", fmt.Errorf("failed to apply commit: %w", err)
 	}
-	_ = _fuzz // kept for parity; could be logged if desired
-	return "Done!", nil
+	if err := applyModes(commit, setMode); err != nil {
+		return "", fmt.Errorf("failed to apply commit: %w", err)
+	}
+	return doneMessage(parser.Fuzz, parser.approx), nil
+}
+
+// maxApproxLines bounds the file lines shown per approximate match.
+const maxApproxLines = 8
+
+// doneMessage reports the fuzz of the context matches of an applied patch, 0 when all matched
+// exactly, with the lines the approximate matches landed on so the model can check them rather
+// than assume the patch applied as written.
+func doneMessage(fuzz int, approx []approxMatch) string {
+	var b strings.Builder
+	switch {
+	case slices.ContainsFunc(approx, func(m approxMatch) bool { return m.similar }):
+		fmt.Fprintf(&b, "Done! (fuzz %d: some context only matched similar lines, check the result)", fuzz)
+	case fuzz > 0:
+		fmt.Fprintf(&b, "Done! (fuzz %d)", fuzz)
+	default:
+		return "Done!"
+	}
+	if len(approx) == 0 {
+		return b.String()
+	}
+	b.WriteString("\nWarning: the patch did not match exactly and was applied where it matched approximately. Verify these places of the files:")
+	for _, m := range approx {
+		fmt.Fprintf(&b, "\n%s line %d, %s:", m.path, m.line+1, m.how)
+		for i, line := range m.lines {
+			if i == maxApproxLines {
+				fmt.Fprintf(&b, "\n  ... (%d more lines)", len(m.lines)-i)
+				break
+			}
+			fmt.Fprintf(&b, "\n%6d| %s", m.line+i+1, line)
+		}
+	}
+	return b.String()
 }
 
+// fuzzHow describes how a context with fuzz from findContext matched.
+func fuzzHow(fuzz int) string {
+	var how []string
+	if fuzz >= 10_000 {
+		how = append(how, "away from the end of the file")
+		fuzz -= 10_000
+	}
+	switch fuzz {
+	case 1:
+		how = append(how, "ignoring trailing whitespace")
+	case 100:
+		how = append(how, "ignoring indentation")
+	case fuzzSimilar:
+		how = append(how, "only similar lines")
+	}
+	return strings.Join(how, ", ")
+}
+
+// Options tune how ApplyPatchWithOptions applies a patch.
+type Options struct {
+	// SearchWindow bounds the search for the context of a chunk to this many lines after the
+	// previous chunk, in every whitespace mode, before the rest of the file is searched. A nearby
+	// match ignoring whitespace is then preferred over an exact match far away. 0 searches the
+	// whole file from the start.
+	SearchWindow int
+	// MinSimilarity enables a last matching pass for contexts found in no whitespace mode, e.g.
+	// after a variable was renamed: the context matches where it is the most similar to the
+	// file, if that similarity, between 0 and 1, is at least MinSimilarity. The lines then
+	// deleted are the lines of the file. 0 disables the pass; 0.8 allows about one edit in five
+	// characters.
+	MinSimilarity float64
+}
+
+// ApplyPatch applies a V4A patch to the file system with the default options.
 func ApplyPatch(cc FileSystem, patchText string) (string, error) {
+	return ApplyPatchWithOptions(cc, patchText, Options{})
+}
+
+// ApplyPatchWithOptions applies a V4A patch to the file system.
+func ApplyPatchWithOptions(cc FileSystem, patchText string, opts Options) (string, error) {
 	// remove newlines at the beginning and end
 	patchText = strings.TrimSpace(patchText)
 	patchText += "\n"
-	return processPatch(patchText, cc.Open, cc.Write, cc.Remove)
+	var setMode func(string, os.FileMode) error
+	if ms, ok := cc.(ModeSetter); ok {
+		setMode = ms.SetMode
+	}
+	lister, _ := cc.(PathLister)
+	return processPatch(patchText, cc.Open, cc.Write, cc.Remove, setMode, lister, opts)
 }
 
 // --------------------------------------------------------------------------- //
@@ -710,42 +922,6 @@ func rstripSpaces(s string) string {
 	return strings.TrimRightFunc(s, unicode.IsSpace)
 }
 
-func slicesEqual(a, b []string) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
-	}
-	return true
-}
-
-func slicesEqualRStrip(a, b []string) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if rstripSpaces(a[i]) != rstripSpaces(b[i]) {
-			return false
-		}
-	}
-	return true
-}
-
-func slicesEqualStrip(a, b []string) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if strings.TrimSpace(a[i]) != strings.TrimSpace(b[i]) {
-			return false
-		}
-	}
-	return true
-}
-
 func sliceContains(ss []string, s string) bool {
 	for _, v := range ss {
 		if v == s {
@@ -764,3 +940,57 @@ func sliceContainsTrim(ss []string, s string) bool {
 	}
 	return false
 }
+
+// didYouMean returns " (did you mean X?)" for the existing path closest to a missing one, or ""
+// when none is close enough. In order it tries: the same path up to case, whitespace and a "./"
+// or "/" prefix; the only path ending with it, or that it ends with, as when the base directory
+// was added or left out; the only path with the same file name.
+func didYouMean(path string, known []string) string {
+	key := pathKey(path)
+	if key == "" {
+		return ""
+	}
+	var suffix, base []string
+	for _, k := range known {
+		kk := pathKey(k)
+		switch {
+		case kk == key:
+			return fmt.Sprintf(" (did you mean %s?)", k)
+		case strings.HasSuffix(kk, "/"+key) || strings.HasSuffix(key, "/"+kk):
+			suffix = append(suffix, k)
+		case pathBase(kk) == pathBase(key):
+			base = append(base, k)
+		}
+	}
+	switch {
+	case len(suffix) == 1:
+		return fmt.Sprintf(" (did you mean %s?)", suffix[0])
+	case len(suffix) == 0 && len(base) == 1:
+		return fmt.Sprintf(" (did you mean %s?)", base[0])
+	}
+	return ""
+}
+
+// pathKey is the form of a path compared by didYouMean.
+func pathKey(path string) string {
+	key := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		if r == '\\' {
+			return '/'
+		}
+		return unicode.ToLower(r)
+	}, path)
+	for {
+		trimmed := strings.TrimPrefix(strings.TrimPrefix(key, "./"), "/")
+		if trimmed == key {
+			return key
+		}
+		key = trimmed
+	}
+}
+
+func pathBase(key string) string {
+	return key[strings.LastIndexByte(key, '/')+1:]
+}
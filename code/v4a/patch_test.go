@@ -2,6 +2,9 @@ package v4a
 
 import (
 	"fmt"
+	"maps"
+	"os"
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -115,7 +118,7 @@ func (s *PatchSuite) TestFindContext() {
 	for _, tc := range cases {
 		tc := tc
 		s.Run(tc.name, func() {
-			gotIndex, gotFuzz := findContext(tc.lines, tc.context, tc.start, tc.eof)
+			gotIndex, gotFuzz := newLineIndex(tc.lines).findContext(tc.context, tc.start, tc.eof, Options{})
 			s.Equal(tc.wantIndex, gotIndex)
 			s.Equal(tc.wantFuzz, gotFuzz)
 		})
@@ -765,3 +768,119 @@ func TestAddTestSuite(t *testing.T) {
 	s.Equal("Done!", result)
 	s.Equal(expectedContent, fs.files["demo/add_test.go"])
 }
+
+type modeFileSystem struct {
+	*fakeFileSystem
+	modes map[string]os.FileMode
+}
+
+func (fs *modeFileSystem) SetMode(path string, mode os.FileMode) error {
+	fs.modes[path] = mode
+	return nil
+}
+
+func (s *PatchSuite) TestApplyPatchSetMode() {
+	patch := "*** Begin Patch\n" +
+		"*** Add File: run.sh\n" +
+		"*** Set Mode: 0755\n" +
+		"+#!/bin/sh\n" +
+		"*** Update File: tool.py\n" +
+		"*** Set Mode: 100755\n" +
+		"*** End Patch"
+	fs := &modeFileSystem{fakeFileSystem: newFakeFileSystem(map[string]string{"tool.py": "print()"}), modes: map[string]os.FileMode{}}
+	_, err := ApplyPatch(fs, patch)
+	s.Require().NoError(err)
+	s.Equal("#!/bin/sh", fs.files["run.sh"])
+	s.Equal("print()", fs.files["tool.py"])
+	s.Equal(map[string]os.FileMode{"run.sh": 0o755, "tool.py": 0o755}, fs.modes)
+
+	plain := newFakeFileSystem(map[string]string{"tool.py": "print()"})
+	_, err = ApplyPatch(plain, patch)
+	s.ErrorContains(err, "Set Mode is not supported")
+	s.Empty(plain.writes)
+
+	_, err = ApplyPatch(fs, "*** Begin Patch\n*** Add File: x.sh\n*** Set Mode: rwx\n+x\n*** End Patch")
+	s.ErrorContains(err, `Invalid Set Mode "rwx"`)
+}
+
+func (s *PatchSuite) TestApplyPatchAnchoredOnDeclaration() {
+	fs := newFakeFileSystem(map[string]string{
+		"calc.go": "package calc\n\nfunc Add(a, b int) (int, error) {\n\treturn 0, nil\n}\n\nfunc Sub(a, b int) (int, error) {\n\treturn 0, nil\n}\n",
+	})
+	// the header has the old signature of Sub: without it, the context matches in Add
+	result, err := ApplyPatch(fs, "*** Begin Patch\n"+
+		"*** Update File: calc.go\n"+
+		"@@ func Sub(a, b int) int {\n"+
+		"-\treturn 0, nil\n"+
+		"+\treturn a - b, nil\n"+
+		" }\n"+
+		"*** End Patch")
+	s.Require().NoError(err)
+	s.Contains(result, "fuzz")
+	s.Contains(result, "calc.go line 7, @@ line matched the declaration of Sub:\n     7| func Sub(a, b int) (int, error) {")
+	s.Equal("package calc\n\nfunc Add(a, b int) (int, error) {\n\treturn 0, nil\n}\n\nfunc Sub(a, b int) (int, error) {\n\treturn a - b, nil\n}\n", fs.files["calc.go"])
+}
+
+func (s *PatchSuite) TestApplyPatchEmptyAddFile() {
+	fs := newFakeFileSystem(nil)
+	_, err := ApplyPatch(fs, "*** Begin Patch\n"+
+		"*** Add File: pkg/new/.gitkeep\n"+
+		"*** Add File: pkg/blank/.gitkeep\n"+
+		"\n"+
+		"  \r\n"+
+		"*** Add File: pkg/new/doc.go\n"+
+		"+package new\n"+
+		"\n"+
+		"*** End Patch")
+	s.Require().NoError(err)
+	s.Equal(map[string]string{"pkg/new/.gitkeep": "", "pkg/blank/.gitkeep": "", "pkg/new/doc.go": "package new"}, fs.files)
+
+	_, err = ApplyPatch(newFakeFileSystem(nil), "*** Begin Patch\n*** Add File: a.txt\n\n+a\n*** End Patch")
+	s.ErrorContains(err, "Invalid Add File line (missing '+')")
+
+	_, err = ApplyPatch(newFakeFileSystem(nil), "*** Begin Patch\n*** Add File: pkg/new/\n*** End Patch")
+	s.ErrorContains(err, "pkg/new/ is a directory")
+}
+
+type listFileSystem struct {
+	*fakeFileSystem
+}
+
+func (fs *listFileSystem) Has(path string) bool {
+	_, ok := fs.files[path]
+	return ok
+}
+
+func (fs *listFileSystem) Paths() []string {
+	return slices.Sorted(maps.Keys(fs.files))
+}
+
+func (s *PatchSuite) TestApplyPatchMissingFileSuggestion() {
+	fs := &listFileSystem{newFakeFileSystem(map[string]string{
+		"pkg/server/Handler.go": "package server",
+		"pkg/util/util.go":      "package util",
+		"cmd/main.go":           "package main",
+		"internal/main.go":      "package main",
+	})}
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"pkg/server/handler.go", "missing file: pkg/server/handler.go (did you mean pkg/server/Handler.go?)"},
+		{"./pkg/util/util.go ", "(did you mean pkg/util/util.go?)"},
+		{"util/util.go", "(did you mean pkg/util/util.go?)"},
+		{"repo/pkg/util/util.go", "(did you mean pkg/util/util.go?)"},
+		{"lib/handler.go", "(did you mean pkg/server/Handler.go?)"},
+	}
+	for _, tc := range cases {
+		_, err := ApplyPatch(fs, "*** Begin Patch\n*** Update File: "+tc.path+"\n@@\n-package x\n+package y\n*** End Patch")
+		s.ErrorContains(err, tc.want, tc.path)
+	}
+
+	_, err := ApplyPatch(fs, "*** Begin Patch\n*** Delete File: main.go\n*** End Patch")
+	s.ErrorContains(err, "Delete File Error - missing file: main.go")
+	s.ErrorIs(err, ErrMissingFile)
+	s.NotContains(err.Error(), "did you mean", "two files are named main.go")
+	s.Empty(fs.writes)
+	s.Empty(fs.removes)
+}
@@ -0,0 +1,201 @@
+package v4a
+
+import (
+	"slices"
+	"strings"
+)
+
+// matchMode is one of the ways findContext compares context lines to file lines, from strict to
+// loose, with the fuzz a match in it adds.
+type matchMode struct {
+	key  func(string) string
+	fuzz int
+}
+
+var matchModes = []matchMode{
+	{key: func(s string) string { return s }, fuzz: 0},
+	{key: rstripSpaces, fuzz: 1},
+	{key: strings.TrimSpace, fuzz: 100},
+}
+
+// lineIndex maps the lines of a file, in the form compared by each match mode, to their positions
+// in ascending order. Looking up the rarest line of a context gives the few positions where it
+// may match, instead of comparing it at every line of the file.
+type lineIndex struct {
+	lines     []string
+	positions []map[string][]int // by match mode
+}
+
+func newLineIndex(lines []string) *lineIndex {
+	idx := &lineIndex{lines: lines, positions: make([]map[string][]int, len(matchModes))}
+	for m, mode := range matchModes {
+		pos := make(map[string][]int, len(lines))
+		for i, line := range lines {
+			k := mode.key(line)
+			pos[k] = append(pos[k], i)
+		}
+		idx.positions[m] = pos
+	}
+	return idx
+}
+
+// fuzzSimilar is the fuzz of a context found by the similarity pass of Options.MinSimilarity.
+const fuzzSimilar = 1_000
+
+// findContext returns the first position at or after start where context matches, in the
+// strictest mode that has a match, and the fuzz of that mode; -1 if there is none. With a search
+// window, the modes are first tried on the window lines after start only, then on the rest of the
+// file; with a minimum similarity, the most similar position is the last resort. With eof the
+// context is first looked for at the end of the file.
+func (idx *lineIndex) findContext(context []string, start int, eof bool, opts Options) (int, int) {
+	if eof {
+		pos := max(len(idx.lines)-len(context), 0)
+		if i, fuzz := idx.findContextCore(context, pos, opts); i != -1 {
+			return i, fuzz
+		}
+		if i, fuzz := idx.findContextCore(context, start, opts); i != -1 {
+			return i, fuzz + 10_000
+		}
+		return -1, 0
+	}
+	return idx.findContextCore(context, start, opts)
+}
+
+func (idx *lineIndex) findContextCore(context []string, start int, opts Options) (int, int) {
+	if len(context) == 0 {
+		return start, 0
+	}
+	if window := opts.SearchWindow; window > 0 && start+window < len(idx.lines) {
+		for m, mode := range matchModes {
+			if i := idx.find(m, context, start, start+window); i != -1 {
+				return i, mode.fuzz
+			}
+		}
+	}
+	for m, mode := range matchModes {
+		if i := idx.find(m, context, start, len(idx.lines)); i != -1 {
+			return i, mode.fuzz
+		}
+	}
+	if opts.MinSimilarity > 0 {
+		if i := idx.findSimilar(context, start, opts.MinSimilarity); i != -1 {
+			return i, fuzzSimilar
+		}
+	}
+	return -1, 0
+}
+
+// find returns the first position i in [start, end) where context matches in match mode m, -1 if
+// there is none.
+func (idx *lineIndex) find(m int, context []string, start, end int) int {
+	key := matchModes[m].key
+	end = min(end, len(idx.lines)-len(context)+1)
+	if start >= end {
+		return -1
+	}
+
+	// anchor on the context line with the fewest occurrences
+	anchor, candidates := -1, []int(nil)
+	for j, line := range context {
+		pos := idx.positions[m][key(line)]
+		if len(pos) == 0 {
+			return -1
+		}
+		if anchor == -1 || len(pos) < len(candidates) {
+			anchor, candidates = j, pos
+		}
+	}
+
+	first, _ := slices.BinarySearch(candidates, start+anchor)
+	for _, pos := range candidates[first:] {
+		i := pos - anchor
+		if i >= end {
+			break
+		}
+		if matchesAt(idx.lines[i:i+len(context)], context, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchesAt(lines, context []string, key func(string) string) bool {
+	for j := range context {
+		if key(lines[j]) != key(context[j]) {
+			return false
+		}
+	}
+	return true
+}
+
+// findSimilar returns the position at or after start where the context is the most similar to
+// the file lines, if that similarity is at least minSimilarity; -1 otherwise. The similarity is 1 -
+// the sum of the Levenshtein distances of the lines / the sum of the lengths of the longer of each
+// pair, ignoring the whitespace around the lines.
+func (idx *lineIndex) findSimilar(context []string, start int, minSimilarity float64) int {
+	want := make([][]rune, len(context))
+	total := 0
+	for j, line := range context {
+		want[j] = []rune(strings.TrimSpace(line))
+		total += len(want[j])
+	}
+	if total == 0 {
+		return -1 // blank lines are found by the trimmed match if anywhere
+	}
+
+	best, bestDist := -1, 0
+	for i := start; i+len(context) <= len(idx.lines); i++ {
+		// the distance must stay below that of the best position and within the similarity
+		length, dist := 0, 0
+		for j := range context {
+			length += max(len(want[j]), len([]rune(strings.TrimSpace(idx.lines[i+j]))))
+		}
+		budget := int((1 - minSimilarity) * float64(length))
+		if best != -1 {
+			budget = min(budget, bestDist-1)
+		}
+		if budget < 0 {
+			continue
+		}
+		for j := range context {
+			dist += levenshtein(want[j], []rune(strings.TrimSpace(idx.lines[i+j])), budget-dist)
+			if dist > budget {
+				break
+			}
+		}
+		if dist <= budget {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// levenshtein returns the edit distance of a and b, or a value above limit as soon as the
+// distance is known to exceed it.
+func levenshtein(a, b []rune, limit int) int {
+	if d := len(a) - len(b); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
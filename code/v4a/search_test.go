@@ -0,0 +1,194 @@
+package v4a
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// scanContext is the linear search the line index replaces.
+func scanContext(lines, context []string, start int) (int, int) {
+	if len(context) == 0 {
+		return start, 0
+	}
+	for _, mode := range matchModes {
+		for i := start; i+len(context) <= len(lines); i++ {
+			if matchesAt(lines[i:i+len(context)], context, mode.key) {
+				return i, mode.fuzz
+			}
+		}
+	}
+	return -1, 0
+}
+
+func (s *PatchSuite) TestLineIndexMatchesScan() {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a", "a ", " a", "b", "b\t", "}", "", "  "}
+	for range 500 {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = words[rng.Intn(len(words))]
+		}
+		context := make([]string, 1+rng.Intn(3))
+		for i := range context {
+			context[i] = words[rng.Intn(len(words))]
+		}
+		start := rng.Intn(len(lines) + 1)
+
+		wantIndex, wantFuzz := scanContext(lines, context, start)
+		gotIndex, gotFuzz := newLineIndex(lines).findContext(context, start, false, Options{})
+		s.Require().Equal(wantIndex, gotIndex, "lines %q context %q start %d", lines, context, start)
+		s.Require().Equal(wantFuzz, gotFuzz, "lines %q context %q start %d", lines, context, start)
+	}
+}
+
+func (s *PatchSuite) TestLineIndexSearchWindow() {
+	lines := []string{"func a() {", "\treturn 1  ", "}", "", "", "", "func b() {", "\treturn 1", "}"}
+	idx := newLineIndex(lines)
+
+	i, fuzz := idx.findContext([]string{"\treturn 1"}, 0, false, Options{})
+	s.Equal(7, i, "the exact match is preferred without a window")
+	s.Equal(0, fuzz)
+
+	i, fuzz = idx.findContext([]string{"\treturn 1"}, 0, false, Options{SearchWindow: 3})
+	s.Equal(1, i, "the nearby match is preferred with a window")
+	s.Equal(1, fuzz)
+
+	i, fuzz = idx.findContext([]string{"func b() {"}, 0, false, Options{SearchWindow: 3})
+	s.Equal(6, i, "falls back to the rest of the file")
+	s.Equal(0, fuzz)
+
+	fs := newFakeFileSystem(map[string]string{"a.go": strings.Join(lines, "\n")})
+	_, err := ApplyPatchWithOptions(fs, "*** Begin Patch\n*** Update File: a.go\n@@\n-\treturn 1\n+\treturn 2\n*** End Patch", Options{SearchWindow: 3})
+	s.Require().NoError(err)
+	s.Equal("func a() {\n\treturn 2\n}\n\n\n\nfunc b() {\n\treturn 1\n}", fs.files["a.go"])
+}
+
+func (s *PatchSuite) TestLevenshtein() {
+	cases := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"kitten", "sitting", 10, 3},
+		{"", "abc", 10, 3},
+		{"same", "same", 0, 0},
+		{"kitten", "sitting", 2, 3},
+		{"a", "abcdef", 2, 3},
+	}
+	for _, tc := range cases {
+		s.Equal(tc.want, levenshtein([]rune(tc.a), []rune(tc.b), tc.limit), "%q %q limit %d", tc.a, tc.b, tc.limit)
+	}
+}
+
+func (s *PatchSuite) TestApplyPatchSimilarContext() {
+	file := "func total(items []int) int {\n\tsum := 0\n\tfor _, item := range items {\n\t\tsum += item\n\t}\n\treturn sum\n}"
+	// written against the file before sum was renamed to acc
+	patch := "*** Begin Patch\n*** Update File: total.go\n@@\n \tfor _, item := range items {\n-\t\tsum += item\n+\t\tsum += item * 2\n \t}\n*** End Patch"
+	file = strings.ReplaceAll(file, "sum", "acc")
+
+	_, err := ApplyPatch(newFakeFileSystem(map[string]string{"total.go": file}), patch)
+	s.ErrorContains(err, "Invalid context")
+	s.ErrorIs(err, ErrContextNotFound)
+
+	fs := newFakeFileSystem(map[string]string{"total.go": file})
+	result, err := ApplyPatchWithOptions(fs, patch, Options{MinSimilarity: 0.8})
+	s.Require().NoError(err)
+	s.Equal("Done! (fuzz 1000: some context only matched similar lines, check the result)\n"+
+		"Warning: the patch did not match exactly and was applied where it matched approximately. Verify these places of the files:\n"+
+		"total.go line 3, context matched only similar lines:\n"+
+		"     3| \tfor _, item := range items {\n"+
+		"     4| \t\tacc += item\n"+
+		"     5| \t}", result)
+	s.Equal("func total(items []int) int {\n\tacc := 0\n\tfor _, item := range items {\n\t\tsum += item * 2\n\t}\n\treturn acc\n}", fs.files["total.go"])
+
+	_, err = ApplyPatchWithOptions(newFakeFileSystem(map[string]string{"total.go": file}), patch, Options{MinSimilarity: 0.99})
+	s.ErrorContains(err, "Invalid context", "below the threshold")
+
+	i, fuzz := newLineIndex([]string{"a := 1", "b := 2", "a := 1", "b := 3"}).findContext([]string{"a := 1", "b := 4"}, 0, false, Options{MinSimilarity: 0.5})
+	s.Equal(0, i, "the first of equally similar positions")
+	s.Equal(fuzzSimilar, fuzz)
+}
+
+func (s *PatchSuite) TestDoneMessageFuzz() {
+	// an end-of-file context found elsewhere has a large fuzz without matching similar lines
+	fs := newFakeFileSystem(map[string]string{"a.txt": "one\ntwo\nthree"})
+	result, err := ApplyPatch(fs, "*** Begin Patch\n*** Update File: a.txt\n@@\n-one\n+uno\n*** End of File\n*** End Patch")
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(result, "Done! (fuzz 10000)\n"), result)
+	s.Contains(result, "context matched away from the end of the file")
+	s.NotContains(result, "similar")
+
+	// as do many contexts matched ignoring indentation
+	var file, patch strings.Builder
+	patch.WriteString("*** Begin Patch\n*** Update File: b.txt\n")
+	for i := range 12 {
+		fmt.Fprintf(&file, "  line %d\n", i)
+		fmt.Fprintf(&patch, "@@\n-line %d\n+line %d!\n", i, i)
+	}
+	patch.WriteString("*** End Patch")
+	fs = newFakeFileSystem(map[string]string{"b.txt": file.String()})
+	result, err = ApplyPatch(fs, patch.String())
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(result, "Done! (fuzz 1200)\n"), result)
+	s.NotContains(result, "similar")
+}
+
+// largeFile returns a Go file of n functions and a patch changing every 50th of them.
+func largeFile(n int) (string, string) {
+	var file, patch strings.Builder
+	patch.WriteString("*** Begin Patch\n*** Update File: big.go\n")
+	for i := range n {
+		fmt.Fprintf(&file, "func f%d(x int) int {\n\ty := x * %d\n\treturn y\n}\n\n", i, i)
+		if i%50 == 0 {
+			fmt.Fprintf(&patch, "@@\n func f%d(x int) int {\n-\ty := x * %d\n+\ty := x + %d\n \treturn y\n", i, i, i)
+		}
+	}
+	patch.WriteString("*** End Patch")
+	return file.String(), patch.String()
+}
+
+func BenchmarkApplyPatchLargeFile(b *testing.B) {
+	for _, n := range []int{1_000, 10_000} {
+		file, patch := largeFile(n)
+		for _, window := range []int{0, 200} {
+			b.Run(fmt.Sprintf("funcs=%d/window=%d", n, window), func(b *testing.B) {
+				for range b.N {
+					fs := newFakeFileSystem(map[string]string{"big.go": file})
+					if _, err := ApplyPatchWithOptions(fs, patch, Options{SearchWindow: window}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkFindContext(b *testing.B) {
+	file, _ := largeFile(10_000)
+	lines := strings.Split(file, "\n")
+	context := []string{"func f9999(x int) int {", "\ty := x * 9999", "\treturn y"}
+	b.Run("index", func(b *testing.B) {
+		idx := newLineIndex(lines)
+		b.ResetTimer()
+		for range b.N {
+			idx.findContext(context, 0, false, Options{})
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for range b.N {
+			scanContext(lines, context, 0)
+		}
+	})
+	b.Run("similar", func(b *testing.B) {
+		idx := newLineIndex(lines)
+		similar := []string{"func f9999(v int) int {", "\tw := v * 9999", "\treturn w"}
+		b.ResetTimer()
+		for range b.N {
+			if i, _ := idx.findContext(similar, 0, false, Options{MinSimilarity: 0.8}); i == -1 {
+				b.Fatal("no similar context")
+			}
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package axe
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/meguminnnnnnnnn/go-openai"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/internal/kinderr"
+)
+
+// Errors to branch on with errors.Is. The error that ended the execution of the agent is
+// RunResult.Err; Run returns the errors that kept the run from completing.
+var (
+	// ErrMaxSteps: the agent made MaxSteps model calls without finalizing the task.
+	ErrMaxSteps = errors.New("axe: max steps reached")
+	// ErrBudgetExceeded: a request did not fit in the context window of the model.
+	ErrBudgetExceeded = errors.New("axe: context window exceeded")
+	// ErrModelRejected: the model does not accept the configuration of the runner, or its
+	// provider rejected a request, e.g. for an invalid API key or an unknown model. Retrying the
+	// same run won't help.
+	ErrModelRejected = errors.New("axe: model rejected the request")
+
+	// ErrPatchContextNotFound: the context of an edit was not found in the file it edits.
+	ErrPatchContextNotFound = container.ErrPatchContextNotFound
+	// ErrMissingFile: an edit targets a file that is not in the code container.
+	ErrMissingFile = container.ErrMissingFile
+)
+
+// classifyAgentError adds the kind of an error of the agent's execution, if it has one.
+func classifyAgentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, compose.ErrExceedMaxSteps) {
+		return kinderr.New(ErrMaxSteps, err)
+	}
+
+	status, code := 0, ""
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+		if apiErr.Code != nil {
+			code = fmt.Sprint(apiErr.Code)
+		}
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		return err
+	}
+	switch {
+	case code == "context_length_exceeded":
+		return kinderr.New(ErrBudgetExceeded, err)
+	case status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests:
+		return kinderr.New(ErrModelRejected, err)
+	}
+	return err
+}
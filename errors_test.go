@@ -0,0 +1,114 @@
+package axe_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/meguminnnnnnnnn/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+)
+
+func TestRunnerErrorKinds(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: a.txt\n+a\n*** End Patch"),
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: b.txt\n+b\n*** End Patch"),
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: c.txt\n+c\n*** End Patch"),
+	)
+	code, err := cont.NewCodeContainerFromFS(dir, nil)
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"add files"}, code,
+		axe.WithChatModel(model),
+		axe.WithMaxSteps(2),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err, "running out of steps fails the task, not the run")
+	assert.ErrorIs(t, result.Err, axe.ErrMaxSteps)
+	assert.Equal(t, axe.RunStatusFailure, result.Status)
+	assert.Equal(t, "ran out of steps, remaining TODO: add files", result.TODO)
+
+	hist, err := history.ReadHistoryFromFile(filepath.Join(dir, "history.xml"))
+	require.NoError(t, err)
+	require.Len(t, hist.Changelogs, 1)
+	changelog := hist.Changelogs[0]
+	assert.True(t, changelog.OutOfSteps)
+	assert.True(t, changelog.Finalized)
+	assert.False(t, changelog.Success)
+	require.NotEmpty(t, changelog.Logs)
+	assert.Contains(t, changelog.Logs[0].Value, "ran out of steps after 1 model calls")
+	assert.Contains(t, changelog.Logs[0].Value, "files changed so far: a.txt (added)")
+
+	require.NoError(t, axe.RegisterModel("text-only", axe.ModelCapabilities{ContextWindow: 8_000}))
+	_, err = axe.NewRunner(dir, []string{"add files"}, cont.NewCodeContainer(map[string]string{}), axe.WithModel("text-only"))
+	assert.ErrorIs(t, err, axe.ErrModelRejected)
+	assert.ErrorContains(t, err, "axe: model text-only does not support tool calling")
+
+	code = cont.NewCodeContainer(map[string]string{"a.txt": "a\n"})
+	_, err = code.Apply(cont.CodeOutput{Patch: "*** Begin Patch\n*** Update File: b.txt\n@@\n-b\n+c\n*** End Patch"})
+	assert.ErrorIs(t, err, axe.ErrMissingFile)
+	_, err = code.ApplyFormat(cont.CodeOutput{Patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-x\n+y\n"}, cont.EditFormatUnified)
+	assert.ErrorIs(t, err, axe.ErrPatchContextNotFound)
+}
+
+// failingModel fails every request with err, like a provider rejecting them.
+type failingModel struct{ err error }
+
+func (m failingModel) Generate(context.Context, []*schema.Message, ...model.Option) (*schema.Message, error) {
+	return nil, m.err
+}
+
+func (m failingModel) Stream(context.Context, []*schema.Message, ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, m.err
+}
+
+func (m failingModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func TestRunnerProviderErrorKinds(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{&openai.APIError{HTTPStatusCode: 400, Code: "context_length_exceeded", Message: "too long"}, axe.ErrBudgetExceeded},
+		{&openai.APIError{HTTPStatusCode: 401, Message: "invalid api key"}, axe.ErrModelRejected},
+		{&openai.RequestError{HTTPStatusCode: 404, Err: errors.New("no such model")}, axe.ErrModelRejected},
+	}
+	for _, tc := range cases {
+		dir := t.TempDir()
+		runner, err := axe.NewRunner(dir, []string{"do it"}, cont.NewCodeContainer(map[string]string{}),
+			axe.WithChatModel(failingModel{fmt.Errorf("failed to create chat completion: %w", tc.err)}),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+		)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		assert.ErrorIs(t, err, tc.kind, tc.err.Error())
+	}
+
+	dir := t.TempDir()
+	runner, err := axe.NewRunner(dir, []string{"do it"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(failingModel{&openai.APIError{HTTPStatusCode: 429, Message: "slow down"}}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, axe.ErrModelRejected, "rate limits are worth retrying")
+}
@@ -0,0 +1,70 @@
+package axe
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+	"github.com/stumble/axe/tokens"
+)
+
+// PromptEstimate is the size of the first model request of a run, see EstimatePromptTokens.
+type PromptEstimate struct {
+	Tokens        int     // system prompt, first instruction with the code input, tool definitions
+	ToolTokens    int     // the part of Tokens spent on tool definitions
+	ContextWindow int     // of the model, 0 if unknown
+	CostUSD       float64 // of the input of the first request, 0 if the prices are unknown
+}
+
+// Fits reports whether the prompt leaves room in the context window, true when its size is unknown.
+func (e PromptEstimate) Fits() bool {
+	return e.ContextWindow == 0 || e.Tokens < e.ContextWindow
+}
+
+// EstimatePromptTokens builds the first request of a run without running it and estimates its
+// tokens with the tokens package, so callers can check that the code input fits the model and
+// what the run will at least cost. Every later request of the run resends this prompt.
+func (r *Runner) EstimatePromptTokens(ctx context.Context) (PromptEstimate, error) {
+	instructions, err := r.instructions(ctx)
+	if err != nil {
+		return PromptEstimate{}, err
+	}
+	instruction := r.turns(instructions)[0]
+	codeInput := r.State.Code.BuildCodeInputWithLimits(nil, r.codeInputLimits(ctx, instruction))
+	n, toolTokens, err := r.promptTokens(ctx, instruction, codeInput)
+	if err != nil {
+		return PromptEstimate{}, err
+	}
+	caps := r.Model.Capabilities()
+	return PromptEstimate{
+		Tokens:        n,
+		ToolTokens:    toolTokens,
+		ContextWindow: caps.ContextWindow,
+		CostUSD:       caps.Cost(TokenUsage{PromptTokens: n}),
+	}, nil
+}
+
+// promptTokens estimates the tokens of the first request of a run on instruction and codeInput,
+// and the part of them spent on tool definitions.
+func (r *Runner) promptTokens(ctx context.Context, instruction string, codeInput container.CodeInput) (total, tools int, err error) {
+	messages, err := buildInitialMessages(ctx, r, instruction, codeInput)
+	if err != nil {
+		return 0, 0, fmt.Errorf("axe: format prompt: %w", err)
+	}
+	var infos []*schema.ToolInfo
+	for _, t := range r.buildToolset(&history.Changelog{}) {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return 0, 0, fmt.Errorf("axe: tool info: %w", err)
+		}
+		infos = append(infos, info)
+	}
+	counter := tokens.ForModel(string(r.Model))
+	if tools, err = tokens.CountTools(counter, infos); err != nil {
+		return 0, 0, fmt.Errorf("axe: %w", err)
+	}
+	return tokens.CountMessages(counter, messages) + tools, tools, nil
+}
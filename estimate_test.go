@@ -0,0 +1,40 @@
+package axe_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerEstimatePromptTokens(t *testing.T) {
+	dir := t.TempDir()
+	small, err := axe.NewRunner(dir, []string{"add a test"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithModel(axe.ModelGPT4o),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+	)
+	require.NoError(t, err)
+	estimate, err := small.EstimatePromptTokens(context.Background())
+	require.NoError(t, err)
+	assert.Positive(t, estimate.ToolTokens)
+	assert.Greater(t, estimate.Tokens, estimate.ToolTokens)
+	assert.Equal(t, 128_000, estimate.ContextWindow)
+	assert.InDelta(t, float64(estimate.Tokens)*2.5/1e6, estimate.CostUSD, 1e-9)
+	assert.True(t, estimate.Fits())
+
+	big, err := axe.NewRunner(dir, []string{"add a test"}, cont.NewCodeContainer(map[string]string{"big.txt": strings.Repeat("lorem ipsum dolor ", 50_000)}),
+		axe.WithModel(axe.ModelGPT4o),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+	)
+	require.NoError(t, err)
+	estimate, err = big.EstimatePromptTokens(context.Background())
+	require.NoError(t, err)
+	assert.Greater(t, estimate.Tokens, 128_000)
+	assert.False(t, estimate.Fits())
+}
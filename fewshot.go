@@ -0,0 +1,105 @@
+package axe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/tools/code"
+	"github.com/stumble/axe/tools/finalize"
+)
+
+// FewShotMode is how worked examples of the edit format are shown to the model, see
+// WithFewShotExamples.
+type FewShotMode string
+
+const (
+	// FewShotSystem adds the examples to the system prompt.
+	FewShotSystem FewShotMode = "system"
+	// FewShotTurns prepends the examples to the conversation as prior tasks the agent completed by
+	// calling apply_edit and finalize_task, which small models imitate more reliably.
+	FewShotTurns FewShotMode = "turns"
+)
+
+// fewShotExamples returns the examples to show the model: none for read-only runs, which don't
+// edit, the curated ones of the edit format unless FewShotExamples is set.
+func (r *Runner) fewShotExamples() []code.EditExample {
+	if r.FewShot == "" || r.ReadOnly {
+		return nil
+	}
+	if len(r.FewShotExamples) > 0 {
+		return r.FewShotExamples
+	}
+	return code.EditExamples(r.EditFormat)
+}
+
+// fewShotSystem renders the examples for the system prompt.
+func fewShotSystem(examples []code.EditExample) (string, error) {
+	var b strings.Builder
+	for i, example := range examples {
+		input, err := container.BuildCodeInput(example.Files, nil).ToXML()
+		if err != nil {
+			return "", fmt.Errorf("axe: few-shot example %d: %w", i+1, err)
+		}
+		fmt.Fprintf(&b, "\nExample %d: %s\nCodeInput:\n%s\ncode_output argument of %s:\n%s\n", i+1, example.Instruction, input, code.ApplyEditToolName, example.CodeOutput)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// fewShotTurns renders the examples as prior turns of the conversation: the instruction with its
+// code, then the agent calling apply_edit and finalize_task and the responses of the tools.
+func fewShotTurns(ctx context.Context, format container.EditFormat, examples []code.EditExample) ([]*schema.Message, error) {
+	var messages []*schema.Message
+	for i, example := range examples {
+		_, summary, err := example.Apply(format)
+		if err != nil {
+			return nil, fmt.Errorf("axe: few-shot example %d: %w", i+1, err)
+		}
+		user, err := buildTurnMessage(ctx, example.Instruction, container.BuildCodeInput(example.Files, nil))
+		if err != nil {
+			return nil, err
+		}
+		edit, err := toolArguments(code.ApplyEditRequest{CodeOutput: example.CodeOutput})
+		if err != nil {
+			return nil, fmt.Errorf("axe: few-shot example %d: %w", i+1, err)
+		}
+		changelog := strings.TrimSuffix(example.Instruction, ".")
+		done, err := toolArguments(map[string]string{"status": finalize.StatusSuccess, "changelog": changelog})
+		if err != nil {
+			return nil, fmt.Errorf("axe: few-shot example %d: %w", i+1, err)
+		}
+		editID, doneID := fmt.Sprintf("example_%d_edit", i+1), fmt.Sprintf("example_%d_finalize", i+1)
+		messages = append(messages,
+			user,
+			fewShotCall(editID, code.ApplyEditToolName, edit),
+			schema.ToolMessage(summary, editID, schema.WithToolName(code.ApplyEditToolName)),
+			fewShotCall(doneID, finalize.FinalizeToolName, done),
+			schema.ToolMessage(changelog, doneID, schema.WithToolName(finalize.FinalizeToolName)),
+		)
+	}
+	return messages, nil
+}
+
+// toolArguments encodes the arguments of a tool call like models write them, without escaping the
+// XML of code_output.
+func toolArguments(v any) (string, error) {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func fewShotCall(id, name, arguments string) *schema.Message {
+	return schema.AssistantMessage("", []schema.ToolCall{{
+		ID:       id,
+		Type:     "function",
+		Function: schema.FunctionCall{Name: name, Arguments: arguments},
+	}})
+}
@@ -0,0 +1,56 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerFewShotExamples(t *testing.T) {
+	dir := t.TempDir()
+	run := func(opts ...axe.RunnerOption) []*schema.Message {
+		model := axetest.NewScriptedModel(axetest.ToolCall("finalize_task", map[string]string{"status": "success", "changelog": "done", "report": "done"}))
+		runner, err := axe.NewRunner(dir, []string{"Do the task."}, cont.NewCodeContainer(nil), append([]axe.RunnerOption{
+			axe.WithChatModel(model),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+		}, opts...)...)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		require.NoError(t, err)
+		return model.Requests()[0]
+	}
+
+	messages := run(axe.WithFewShotExamples(axe.FewShotSystem))
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0].Content, "Examples of correct apply_edit calls:")
+	assert.Contains(t, messages[0].Content, "Example 1: Fix Sub, which adds instead of subtracting")
+
+	messages = run(axe.WithFewShotExamples(axe.FewShotTurns), axe.WithEditFormat(cont.EditFormatUnified))
+	require.Len(t, messages, 2+2*5, "every example is a user message, two tool calls and their responses")
+	assert.NotContains(t, messages[0].Content, "Examples of correct")
+	assert.Equal(t, schema.User, messages[1].Role)
+	assert.Contains(t, messages[1].Content, `<File path="calc/calc.go" hash=`)
+	require.Len(t, messages[2].ToolCalls, 1)
+	assert.Equal(t, "apply_edit", messages[2].ToolCalls[0].Function.Name)
+	assert.Contains(t, messages[2].ToolCalls[0].Function.Arguments, "+++ calc/calc_test.go")
+	assert.Equal(t, messages[2].ToolCalls[0].ID, messages[3].ToolCallID)
+	assert.Contains(t, messages[3].Content, "apply_edit successfully applied edits")
+	assert.Equal(t, "finalize_task", messages[4].ToolCalls[0].Function.Name)
+	assert.Contains(t, messages[len(messages)-1].Content, "Do the task.")
+
+	messages = run(axe.WithFewShotExamples(axe.FewShotTurns), axe.WithReadOnly(""))
+	assert.Len(t, messages, 2, "read-only runs don't edit")
+
+	_, err := axe.NewRunner(dir, nil, cont.NewCodeContainer(nil), axe.WithFewShotExamples("inline"))
+	assert.Error(t, err)
+}
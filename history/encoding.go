@@ -0,0 +1,163 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Encoding controls how SaveHistoryToFile writes the log entries of the changelogs. The zero value
+// writes them whole. Either way, entries XML can't hold verbatim, e.g. tool output with terminal
+// escape codes, carriage returns or invalid UTF-8, are written base64 encoded so the history file
+// stays readable.
+type Encoding struct {
+	// MaxEntryBytes caps the run output, report and diff of every changelog with a LogLimit keeping
+	// their head and tail. Payloads and restore points are never cut. Zero doesn't cap.
+	MaxEntryBytes int
+	// CompressAbove, if > 0, writes the entries larger than this many bytes gzip-compressed and
+	// base64 encoded, restore points included.
+	CompressAbove int
+}
+
+// Values of the encoding attribute of a log entry; entries without one are CDATA.
+const (
+	encodingBase64     = "base64"
+	encodingGzipBase64 = "gzip+base64"
+)
+
+// base64 encoded entries are split in lines of this length, as in MIME.
+const base64LineLength = 76
+
+func (e Encoding) enabled() bool {
+	return e.MaxEntryBytes > 0 || e.CompressAbove > 0
+}
+
+// changelog returns a copy of c to write, with its entries capped and marked for compression.
+func (e Encoding) changelog(c Changelog) Changelog {
+	limit := LogLimit{MaxBytes: e.MaxEntryBytes}
+	entry := func(l *LogEntry, capped bool) *LogEntry {
+		if l == nil {
+			return nil
+		}
+		out := *l
+		if capped {
+			out.Value = limit.Apply(out.Value)
+		}
+		out.compress = e.CompressAbove > 0 && len(out.Value) > e.CompressAbove
+		return &out
+	}
+	logs := make([]LogEntry, len(c.Logs))
+	for i := range c.Logs {
+		logs[i] = *entry(&c.Logs[i], true)
+	}
+	c.Logs = logs
+	c.Report = entry(c.Report, true)
+	c.Diff = entry(c.Diff, true)
+	if c.Result != nil {
+		result := *c.Result
+		result.Payload = entry(result.Payload, false)
+		c.Result = &result
+	}
+	if c.Before != nil {
+		files := make([]FileState, len(c.Before.Files))
+		for i, f := range c.Before.Files {
+			f.Content = entry(f.Content, false)
+			files[i] = f
+		}
+		c.Before = &RestorePoint{Files: files}
+	}
+	return c
+}
+
+func (l LogEntry) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type cdataWrapper struct {
+		Text string `xml:",cdata"`
+	}
+	switch {
+	case l.compress:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(l.Value)); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		start.Attr = append(start.Attr,
+			xml.Attr{Name: xml.Name{Local: "encoding"}, Value: encodingGzipBase64},
+			xml.Attr{Name: xml.Name{Local: "size"}, Value: strconv.Itoa(len(l.Value))})
+		return e.EncodeElement(cdataWrapper{Text: base64Lines(buf.Bytes())}, start)
+	case !isXMLText(l.Value):
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "encoding"}, Value: encodingBase64})
+		return e.EncodeElement(cdataWrapper{Text: base64Lines([]byte(l.Value))}, start)
+	}
+	// the encoder splits "]]>" across two CDATA sections
+	return e.EncodeElement(cdataWrapper{Text: l.Value}, start)
+}
+
+func (l *LogEntry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Encoding string `xml:"encoding,attr"`
+		Text     string `xml:",chardata"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	switch raw.Encoding {
+	case "":
+		l.Value = raw.Text
+		return nil
+	case encodingBase64, encodingGzipBase64:
+	default:
+		return fmt.Errorf("history: %s: unknown encoding %q", start.Name.Local, raw.Encoding)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw.Text))
+	if err != nil {
+		return fmt.Errorf("history: %s: %w", start.Name.Local, err)
+	}
+	if raw.Encoding == encodingGzipBase64 {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("history: %s: %w", start.Name.Local, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("history: %s: %w", start.Name.Local, err)
+		}
+	}
+	l.Value = string(data)
+	return nil
+}
+
+// base64Lines encodes data in lines of base64LineLength, which the decoder skips.
+func base64Lines(data []byte) string {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(enc) > base64LineLength {
+		b.WriteString("\n" + enc[:base64LineLength])
+		enc = enc[base64LineLength:]
+	}
+	b.WriteString("\n" + enc + "\n")
+	return b.String()
+}
+
+// isXMLText reports whether s survives a CDATA section unchanged: valid UTF-8 of the characters
+// XML allows, without carriage returns, which parsers turn into newlines.
+func isXMLText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n':
+		case r < 0x20, r >= 0xD800 && r <= 0xDFFF, r == 0xFFFE, r == 0xFFFF:
+			return false
+		}
+	}
+	return true
+}
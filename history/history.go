@@ -9,21 +9,67 @@ import (
 )
 
 type Changelog struct {
-	Timestamp time.Time  `xml:"Timestamp"`
-	Success   bool       `xml:"Success"`
-	Logs      []LogEntry `xml:"Logs>Log"`
-	TODO      string     `xml:"TODO"`
+	// RunID is the id of the run that wrote the changelog, empty for changelogs of older versions.
+	RunID     string    `xml:"RunID,attr,omitempty"`
+	Timestamp time.Time `xml:"Timestamp"`
+	Success   bool      `xml:"Success"`
+	// Finalized is set when the agent finalized the task, successfully or not.
+	Finalized bool `xml:"Finalized,omitempty"`
+	// Interrupted is set when the run was cancelled before the agent finished.
+	Interrupted bool `xml:"Interrupted,omitempty"`
+	// OutOfSteps is set when the agent ran out of steps before finalizing the task, which the runner
+	// then finalized as a failure. Retrying with more steps or a smaller task may succeed.
+	OutOfSteps bool       `xml:"OutOfSteps,omitempty"`
+	Logs       []LogEntry `xml:"Logs>Log"`
+	TODO       string     `xml:"TODO"`
+	// Questions the agent asked the user during the run, with their answers.
+	Questions []Question `xml:"Questions>Question,omitempty"`
+	// Report is the deliverable of a read-only run, e.g. a code review or an audit.
+	Report *LogEntry `xml:"Report,omitempty"`
+	// Result holds the machine-readable results reported when the task was finalized.
+	Result *Result `xml:"Result,omitempty"`
+	// Trace is the path of the step-by-step trace of the run, if one was written.
+	Trace string `xml:"Trace,omitempty"`
+	// Diff is the unified diff of the files the run changed, if the runner stores it.
+	Diff *LogEntry `xml:"Diff,omitempty"`
+	// Before is the state of the files the run changed, if the runner stores it. See FilesBefore.
+	Before *RestorePoint `xml:"Before,omitempty"`
+	// PostMortem is the diagnosis of a failed run, if the runner asked for one.
+	PostMortem *PostMortem `xml:"PostMortem,omitempty"`
 }
 
+// PostMortem is a diagnosis of a failed run written by a model from its transcript, to help improve
+// the instructions and tools of the next runs.
+type PostMortem struct {
+	RootCause          string   `xml:"RootCause"`
+	InstructionChanges []string `xml:"InstructionChanges>Change,omitempty"`
+	MissingTools       []string `xml:"MissingTools>Tool,omitempty"`
+}
+
+// Result is the structured outcome of a task, for automation that should not parse changelogs.
+type Result struct {
+	ModifiedFiles []string `xml:"ModifiedFiles>File,omitempty"`
+	TestsRun      []string `xml:"TestsRun>Test,omitempty"`
+	Metrics       []Metric `xml:"Metrics>Metric,omitempty"`
+	// Payload is arbitrary JSON provided by the agent.
+	Payload *LogEntry `xml:"Payload,omitempty"`
+}
+
+type Metric struct {
+	Name  string  `xml:"name,attr"`
+	Value float64 `xml:",chardata"`
+}
+
+type Question struct {
+	Question string `xml:"Question"`
+	Answer   string `xml:"Answer"`
+}
+
+// LogEntry is a text of a changelog, written as CDATA or encoded, see Encoding.
 type LogEntry struct {
 	Value string `xml:",chardata"`
-}
 
-func (l LogEntry) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
-	type cdataWrapper struct {
-		Text string `xml:",cdata"`
-	}
-	return e.EncodeElement(cdataWrapper{Text: l.Value}, start)
+	compress bool // in the copies written by SaveHistoryToFile, see Encoding.CompressAbove
 }
 
 func (c *Changelog) AddLog(entry string) {
@@ -37,6 +83,8 @@ type History struct {
 	XMLName    xml.Name    `xml:"History"`
 	Changelogs []Changelog `xml:"Changelogs>Changelog"`
 	FilePath   string      `xml:"-"`
+	Retention  Retention   `xml:"-"`
+	Encoding   Encoding    `xml:"-"`
 }
 
 func (h *History) AppendChangelog(changelog Changelog) {
@@ -80,11 +128,20 @@ func (h *History) SaveHistoryToFile() error {
 			return err
 		}
 	}
-	buf, err := xml.MarshalIndent(h, "", "  ")
+	now := time.Now()
+	pruned, err := h.Prune(now)
+	if err != nil {
+		return err
+	}
+	if h.Retention.Archive {
+		if err := h.archive(pruned, now); err != nil {
+			return err
+		}
+	}
+	content, err := h.marshal()
 	if err != nil {
 		return err
 	}
-	content := append([]byte(xml.Header), buf...)
 	return os.WriteFile(path, content, 0o600)
 }
 
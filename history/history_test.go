@@ -1,11 +1,14 @@
 package history
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestChangelogAddLog(t *testing.T) {
@@ -65,3 +68,435 @@ func TestHistorySaveAndReadPreservesLogs(t *testing.T) {
 		t.Fatalf("expected log value %q, got %q", logText, logs[0].Value)
 	}
 }
+
+func TestHistorySaveAndReadPreservesRunID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+
+	hist := &History{FilePath: path}
+	hist.AppendChangelog(Changelog{RunID: "20240101T000000-abcd", Timestamp: time.Now()})
+	hist.AppendChangelog(Changelog{Timestamp: time.Now()})
+	if err := hist.SaveHistoryToFile(); err != nil {
+		t.Fatalf("SaveHistoryToFile() error = %v", err)
+	}
+
+	loaded, err := ReadHistoryFromFile(path)
+	if err != nil {
+		t.Fatalf("ReadHistoryFromFile() error = %v", err)
+	}
+	if len(loaded.Changelogs) != 2 {
+		t.Fatalf("expected 2 changelogs, got %d", len(loaded.Changelogs))
+	}
+	if got := loaded.Changelogs[0].RunID; got != "20240101T000000-abcd" {
+		t.Fatalf("expected run id to round-trip, got %q", got)
+	}
+	if got := loaded.Changelogs[1].RunID; got != "" {
+		t.Fatalf("expected empty run id, got %q", got)
+	}
+}
+
+func TestHistorySaveAndReadPreservesResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+
+	result := &Result{
+		ModifiedFiles: []string{"a.go", "b.go"},
+		TestsRun:      []string{"go test ./..."},
+		Metrics:       []Metric{{Name: "coverage", Value: 91.5}},
+		Payload:       &LogEntry{Value: `{"ok": true, "note": "<x> & y"}`},
+	}
+	hist := &History{FilePath: path}
+	hist.AppendChangelog(Changelog{Timestamp: time.Now(), Result: result})
+	hist.AppendChangelog(Changelog{Timestamp: time.Now()})
+	if err := hist.SaveHistoryToFile(); err != nil {
+		t.Fatalf("SaveHistoryToFile() error = %v", err)
+	}
+
+	loaded, err := ReadHistoryFromFile(path)
+	if err != nil {
+		t.Fatalf("ReadHistoryFromFile() error = %v", err)
+	}
+	got := loaded.Changelogs[0].Result
+	if got == nil || got.Payload == nil {
+		t.Fatalf("expected result with payload, got %+v", got)
+	}
+	if got.Payload.Value != result.Payload.Value {
+		t.Fatalf("expected payload %q, got %q", result.Payload.Value, got.Payload.Value)
+	}
+	if len(got.ModifiedFiles) != 2 || len(got.TestsRun) != 1 || len(got.Metrics) != 1 || got.Metrics[0] != result.Metrics[0] {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	if loaded.Changelogs[1].Result != nil {
+		t.Fatalf("expected no result, got %+v", loaded.Changelogs[1].Result)
+	}
+}
+
+func TestHistoryPruneByCountAndAge(t *testing.T) {
+	now := time.Now()
+	hist := &History{Retention: Retention{MaxChangelogs: 2, MaxAge: 48 * time.Hour}}
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-72 * time.Hour), TODO: "too old"})
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-3 * time.Hour), TODO: "a"})
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-2 * time.Hour), TODO: "b"})
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-1 * time.Hour), TODO: "c"})
+
+	pruned, err := hist.Prune(now)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(pruned) != 2 || pruned[0].TODO != "too old" || pruned[1].TODO != "a" {
+		t.Fatalf("unexpected pruned changelogs: %+v", pruned)
+	}
+	if len(hist.Changelogs) != 2 || hist.Changelogs[0].TODO != "b" || hist.Changelogs[1].TODO != "c" {
+		t.Fatalf("unexpected kept changelogs: %+v", hist.Changelogs)
+	}
+}
+
+func TestHistoryPruneFailuresOnly(t *testing.T) {
+	now := time.Now()
+	hist := &History{Retention: Retention{FailuresOnly: true, MaxAge: 48 * time.Hour}}
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-72 * time.Hour), TODO: "old failure"})
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-3 * time.Hour), TODO: "success", Success: true})
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-2 * time.Hour), TODO: "failure"})
+	hist.AppendChangelog(Changelog{Timestamp: now.Add(-1 * time.Hour), TODO: "latest", Success: true})
+
+	pruned, err := hist.Prune(now)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(pruned) != 2 || pruned[0].TODO != "old failure" || pruned[1].TODO != "success" {
+		t.Fatalf("unexpected pruned changelogs: %+v", pruned)
+	}
+	if len(hist.Changelogs) != 2 || hist.Changelogs[0].TODO != "failure" || hist.Changelogs[1].TODO != "latest" {
+		t.Fatalf("unexpected kept changelogs: %+v", hist.Changelogs)
+	}
+}
+
+func TestHistoryPruneByFileSizeKeepsLatest(t *testing.T) {
+	hist := &History{Retention: Retention{MaxFileSize: 1}}
+	for i := 0; i < 3; i++ {
+		c := Changelog{Timestamp: time.Now()}
+		c.AddLog(strings.Repeat("x", 100))
+		hist.AppendChangelog(c)
+	}
+	pruned, err := hist.Prune(time.Now())
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(pruned) != 2 || len(hist.Changelogs) != 1 {
+		t.Fatalf("expected 2 pruned and 1 kept, got %d and %d", len(pruned), len(hist.Changelogs))
+	}
+}
+
+func TestHistoryPruneByFileSizeFits(t *testing.T) {
+	for _, enc := range []Encoding{{}, {CompressAbove: 100}} {
+		hist := &History{Encoding: enc}
+		for i := 0; i < 5; i++ {
+			c := Changelog{Timestamp: time.Now(), TODO: fmt.Sprintf("run %d", i)}
+			c.AddLog(strings.Repeat(fmt.Sprint(i), 50*(i+1)))
+			hist.AppendChangelog(c)
+		}
+		sizes, total, err := hist.marshaledSizes()
+		if err != nil {
+			t.Fatalf("marshaledSizes() error = %v", err)
+		}
+		buf, err := hist.marshal()
+		if err != nil {
+			t.Fatalf("marshal() error = %v", err)
+		}
+		if total != int64(len(buf)) {
+			t.Fatalf("%+v: marshaledSizes() total = %d, marshal() wrote %d bytes", enc, total, len(buf))
+		}
+
+		// the last two changelogs fit exactly
+		hist.Retention.MaxFileSize = total - sizes[0] - sizes[1] - sizes[2]
+		pruned, err := hist.Prune(time.Now())
+		if err != nil {
+			t.Fatalf("Prune() error = %v", err)
+		}
+		if len(pruned) != 3 || pruned[0].TODO != "run 0" || len(hist.Changelogs) != 2 {
+			t.Fatalf("%+v: expected 3 pruned and 2 kept, got %d and %d", enc, len(pruned), len(hist.Changelogs))
+		}
+		if buf, err = hist.marshal(); err != nil || int64(len(buf)) != hist.Retention.MaxFileSize {
+			t.Fatalf("%+v: marshal() = %d bytes, %v; want %d", enc, len(buf), err, hist.Retention.MaxFileSize)
+		}
+	}
+}
+
+func TestHistorySaveArchivesPrunedChangelogs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.xml")
+	hist := &History{FilePath: path, Retention: Retention{MaxChangelogs: 1, Archive: true}}
+	hist.AppendChangelog(Changelog{Timestamp: time.Now(), TODO: "old"})
+	hist.AppendChangelog(Changelog{Timestamp: time.Now(), TODO: "new"})
+
+	if err := hist.SaveHistoryToFile(); err != nil {
+		t.Fatalf("SaveHistoryToFile() error = %v", err)
+	}
+	archives, err := filepath.Glob(path + ".*.xml.gz")
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	if len(archives) != 1 {
+		t.Fatalf("expected 1 archive file, got %v", archives)
+	}
+	loaded, err := ReadHistoryFromFile(path)
+	if err != nil {
+		t.Fatalf("ReadHistoryFromFile() error = %v", err)
+	}
+	if len(loaded.Changelogs) != 1 || loaded.Changelogs[0].TODO != "new" {
+		t.Fatalf("unexpected changelogs after save: %+v", loaded.Changelogs)
+	}
+}
+
+func TestAcquireLockExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+
+	lock, err := AcquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	if _, err := AcquireLock(path, 150*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	relock, err := AcquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() after unlock error = %v", err)
+	}
+	_ = relock.Unlock()
+}
+
+func TestAcquireLockReclaimsStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+	// a PID that cannot belong to a live process
+	if err := os.WriteFile(path+".lock", []byte("2147483646"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	lock, err := AcquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("AcquireLock() error = %v", err)
+	}
+	_ = lock.Unlock()
+}
+
+func TestHistoryQueries(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &History{Changelogs: []Changelog{
+		{RunID: "a", Timestamp: base, Success: true, Logs: []LogEntry{{Value: "Fixed the Parser"}}},
+		{RunID: "b", Timestamp: base.Add(time.Hour), Success: false, TODO: "parser tests still fail"},
+		{RunID: "c", Timestamp: base.Add(2 * time.Hour), Success: true, Report: &LogEntry{Value: "all good"}},
+	}}
+	ids := func(changelogs []Changelog) string {
+		var out []string
+		for _, c := range changelogs {
+			out = append(out, c.RunID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := ids(h.FindBySuccess(true)); got != "a,c" {
+		t.Fatalf("FindBySuccess(true) = %s", got)
+	}
+	if got := ids(h.FindSince(base.Add(time.Hour))); got != "b,c" {
+		t.Fatalf("FindSince() = %s", got)
+	}
+	if got := ids(h.SearchLogs("PARSER")); got != "a,b" {
+		t.Fatalf("SearchLogs() = %s", got)
+	}
+	if got := ids(h.Find(SuccessIs(true), Contains("good"))); got != "c" {
+		t.Fatalf("Find() = %s", got)
+	}
+	if c, ok := h.FindByRunID("b"); !ok || c.TODO != "parser tests still fail" {
+		t.Fatalf("FindByRunID() = %+v, %v", c, ok)
+	}
+	if _, ok := h.FindByRunID("missing"); ok {
+		t.Fatal("FindByRunID(missing) found a changelog")
+	}
+}
+
+func TestLogLimitApply(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		b.WriteString("line ")
+		b.WriteString(strings.Repeat("x", 5))
+		b.WriteString("\n")
+	}
+	log := b.String() // 100 lines of 11 bytes
+
+	if got := (LogLimit{}).Apply(log); got != log {
+		t.Fatalf("zero limit changed the log")
+	}
+	if got := (LogLimit{MaxBytes: len(log)}).Apply(log); got != log {
+		t.Fatalf("log within the limit was changed")
+	}
+
+	got := LogLimit{MaxBytes: 220}.Apply(log)
+	if !strings.HasPrefix(got, "line xxxxx\n") || !strings.HasSuffix(got, "line xxxxx\n") {
+		t.Fatalf("head and tail not kept on line boundaries: %q", got)
+	}
+	if !strings.Contains(got, "bytes omitted") || len(got) > 220+40 {
+		t.Fatalf("unexpected truncation: %q", got)
+	}
+
+	head := LogLimit{MaxBytes: 110, Keep: KeepHead}.Apply(log)
+	if !strings.HasPrefix(head, strings.Repeat("line xxxxx\n", 10)+"\n... [990 bytes omitted]") {
+		t.Fatalf("unexpected head: %q", head)
+	}
+	tail := LogLimit{MaxBytes: 110, Keep: KeepTail}.Apply(log)
+	if !strings.HasSuffix(tail, "omitted] ...\n"+strings.Repeat("line xxxxx\n", 10)) {
+		t.Fatalf("unexpected tail: %q", tail)
+	}
+
+	// cuts without a nearby newline stay on rune boundaries
+	runes := strings.Repeat("é", 100)
+	for _, keep := range []LogKeep{KeepHeadTail, KeepHead, KeepTail} {
+		if got := (LogLimit{MaxBytes: 51, Keep: keep}).Apply(runes); !utf8.ValidString(got) {
+			t.Fatalf("keep %d split a rune: %q", keep, got)
+		}
+	}
+}
+
+func TestHistoryFilesBefore(t *testing.T) {
+	h := &History{Changelogs: []Changelog{
+		{RunID: "a"},
+		{RunID: "b", Before: &RestorePoint{Files: []FileState{
+			{Path: "a.go", Content: &LogEntry{Value: "package a\n"}},
+			{Path: "new.go", Absent: true},
+		}}},
+		{RunID: "c", Before: &RestorePoint{Files: []FileState{
+			{Path: "a.go", Content: &LogEntry{Value: "package a // edited by b\n"}},
+			{Path: "c.go", Content: &LogEntry{Value: "package c\n"}},
+		}}},
+	}}
+	path := filepath.Join(t.TempDir(), "history.xml")
+	h.FilePath = path
+	if err := h.SaveHistoryToFile(); err != nil {
+		t.Fatalf("SaveHistoryToFile() error = %v", err)
+	}
+	h, err := ReadHistoryFromFile(path)
+	if err != nil {
+		t.Fatalf("ReadHistoryFromFile() error = %v", err)
+	}
+
+	files, err := h.FilesBefore("b")
+	if err != nil {
+		t.Fatalf("FilesBefore(b) error = %v", err)
+	}
+	var got []string
+	for _, f := range files {
+		content := ""
+		if f.Content != nil {
+			content = f.Content.Value
+		}
+		got = append(got, fmt.Sprintf("%s absent=%v %q", f.Path, f.Absent, content))
+	}
+	want := []string{`a.go absent=false "package a\n"`, `new.go absent=true ""`, `c.go absent=false "package c\n"`}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Fatalf("FilesBefore(b) = %v, want %v", got, want)
+	}
+	if _, err := h.FilesBefore("a"); err == nil || !strings.Contains(err.Error(), "run a has no restore point") {
+		t.Fatalf("FilesBefore(a) error = %v", err)
+	}
+	if _, err := h.FilesBefore("missing"); err == nil {
+		t.Fatal("FilesBefore(missing) succeeded")
+	}
+}
+
+func TestHistoryEncodingRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+	texts := []string{
+		"a ]]> b ]]]]> c",
+		"\x1b[31mFAIL\x1b[0m\r\n",
+		"invalid \xff utf-8",
+		"plain text",
+	}
+	big := strings.Repeat("ok  \tgithub.com/stumble/axe/history\t0.2s\n", 200)
+
+	hist := &History{FilePath: path, Encoding: Encoding{MaxEntryBytes: 2000, CompressAbove: 1000}}
+	changelog := Changelog{Timestamp: time.Now(), Success: true}
+	for _, text := range texts {
+		changelog.AddLog(text)
+	}
+	changelog.AddLog(big)
+	changelog.Before = &RestorePoint{Files: []FileState{{Path: "a.txt", Content: &LogEntry{Value: big}}}}
+	hist.AppendChangelog(changelog)
+	if err := hist.SaveHistoryToFile(); err != nil {
+		t.Fatalf("SaveHistoryToFile() error = %v", err)
+	}
+	if hist.Changelogs[0].Logs[4].Value != big {
+		t.Fatal("saving must not change the changelogs in memory")
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, want := range []string{`<Log encoding="base64">`, `<Log encoding="gzip+base64" size="`, `<Content encoding="gzip+base64" size="8200">`, "<![CDATA[plain text]]>"} {
+		if !strings.Contains(string(raw), want) {
+			t.Fatalf("expected %s in the history file, got %s", want, raw)
+		}
+	}
+
+	loaded, err := ReadHistoryFromFile(path)
+	if err != nil {
+		t.Fatalf("ReadHistoryFromFile() error = %v", err)
+	}
+	logs := loaded.Changelogs[0].Logs
+	for i, text := range texts {
+		if logs[i].Value != text {
+			t.Fatalf("log %d: expected %q, got %q", i, text, logs[i].Value)
+		}
+	}
+	if capped := logs[4].Value; len(capped) > 2000 || !strings.Contains(capped, "bytes omitted") {
+		t.Fatalf("expected the big log capped to 2000 bytes, got %d bytes", len(capped))
+	}
+	if got := loaded.Changelogs[0].Before.Files[0].Content.Value; got != big {
+		t.Fatalf("expected the restore point whole, got %d bytes", len(got))
+	}
+}
+
+func TestHistoryUnknownEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+	content := `<History><Changelogs><Changelog><Logs><Log encoding="rot13">nop</Log></Logs></Changelog></Changelogs></History>`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := ReadHistoryFromFile(path); err == nil || !strings.Contains(err.Error(), `unknown encoding "rot13"`) {
+		t.Fatalf("expected an unknown encoding error, got %v", err)
+	}
+}
+
+func TestAcquireLockConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.xml")
+	// a lock file left behind by a crashed run
+	if err := os.WriteFile(path+".lock", []byte("2147483646"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	const n = 8
+	locks := make(chan *FileLock, n)
+	start := make(chan struct{})
+	for range n {
+		go func() {
+			<-start
+			lock, err := AcquireLock(path, 0)
+			if err != nil && !errors.Is(err, ErrLocked) {
+				t.Errorf("AcquireLock() error = %v", err)
+			}
+			locks <- lock
+		}()
+	}
+	close(start)
+	held := 0
+	for range n {
+		if lock := <-locks; lock != nil {
+			held++
+			defer lock.Unlock()
+		}
+	}
+	if held != 1 {
+		t.Fatalf("expected exactly one run to hold the lock, got %d", held)
+	}
+	if pid, ok := readLockPID(path + ".lock"); !ok || pid != os.Getpid() {
+		t.Fatalf("expected the lock file to hold pid %d, got %d", os.Getpid(), pid)
+	}
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when the history file is locked by another run.
+var ErrLocked = errors.New("history: another run in progress")
+
+// errWouldBlock is returned by lockFile when another open file holds the lock.
+var errWouldBlock = errors.New("history: lock held")
+
+const lockPollInterval = 100 * time.Millisecond
+
+// FileLock is an advisory lock on a history file: an exclusive lock of the operating system on
+// "<path>.lock", which holds the owner's PID for information. The system releases the lock when
+// its owner exits, so a crashed run never leaves a stale lock behind. The file itself is left in
+// place, since removing it would let two runs lock different files of the same name.
+type FileLock struct {
+	f *os.File
+}
+
+// AcquireLock locks the history file at path. It retries until timeout elapses; a zero timeout
+// tries exactly once. The returned error wraps ErrLocked when another run holds the lock.
+func AcquireLock(path string, timeout time.Duration) (*FileLock, error) {
+	lockPath := strings.TrimSpace(path) + ".lock"
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLock(lockPath)
+		if err == nil {
+			return &FileLock{f: f}, nil
+		}
+		if !errors.Is(err, ErrLocked) || !time.Now().Before(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Unlock releases the lock. It is safe to call on a nil lock and more than once.
+func (l *FileLock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	f := l.f
+	l.f = nil
+	return errors.Join(unlockFile(f), f.Close())
+}
+
+func tryLock(lockPath string) (*os.File, error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		if errors.Is(err, errWouldBlock) {
+			pid, _ := readLockPID(lockPath)
+			return nil, fmt.Errorf("%w (lock %s held by pid %d)", ErrLocked, lockPath, pid)
+		}
+		return nil, err
+	}
+	if err := writePID(f); err != nil {
+		_ = unlockFile(f)
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+func readLockPID(lockPath string) (int, bool) {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
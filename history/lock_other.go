@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package history
+
+import "os"
+
+// lockFile is a no-op on platforms without file locks; runs sharing a history file are not
+// serialised there.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogKeep selects the part of an oversized log that LogLimit keeps.
+type LogKeep int
+
+const (
+	KeepHeadTail LogKeep = iota // the start and the end, where the task and its outcome are
+	KeepHead
+	KeepTail
+)
+
+// LogLimit bounds the size of the run output stored in a changelog, which otherwise grows the
+// history file by the full transcript of every run. The zero value keeps logs verbatim.
+type LogLimit struct {
+	MaxBytes int // logs longer than this are truncated to about this size
+	Keep     LogKeep
+}
+
+// Apply returns log truncated to the limit. The omitted part is replaced by a marker line, and
+// cuts are moved to line boundaries when one is close.
+func (l LogLimit) Apply(log string) string {
+	if l.MaxBytes <= 0 || len(log) <= l.MaxBytes {
+		return log
+	}
+	switch l.Keep {
+	case KeepHead:
+		head := cutHead(log, l.MaxBytes)
+		return head + omitted(len(log)-len(head))
+	case KeepTail:
+		tail := cutTail(log, l.MaxBytes)
+		return omitted(len(log)-len(tail)) + tail
+	default:
+		head := cutHead(log, l.MaxBytes/2)
+		tail := cutTail(log, l.MaxBytes-len(head))
+		return head + omitted(len(log)-len(head)-len(tail)) + tail
+	}
+}
+
+func omitted(n int) string {
+	return fmt.Sprintf("\n... [%d bytes omitted] ...\n", n)
+}
+
+// cutHead returns at most n bytes from the start of s, ending after a newline in the last quarter
+// if there is one, else on a rune boundary.
+func cutHead(s string, n int) string {
+	if i := strings.LastIndexByte(s[:n], '\n'); i >= n-n/4 {
+		return s[:i+1]
+	}
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// cutTail returns at most n bytes from the end of s, starting after a newline in the first quarter
+// if there is one, else on a rune boundary.
+func cutTail(s string, n int) string {
+	start := len(s) - n
+	// the newline may be the byte just before the cut, then the tail starts on a line already
+	if i := strings.IndexByte(s[start-1:], '\n'); i >= 0 && i <= n/4 {
+		return s[start+i:]
+	}
+	for start < len(s) && !isRuneStart(s[start]) {
+		start++
+	}
+	return s[start:]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
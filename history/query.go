@@ -0,0 +1,78 @@
+package history
+
+import (
+	"strings"
+	"time"
+)
+
+// Find returns the changelogs matching all filters, oldest first.
+func (h *History) Find(filters ...func(Changelog) bool) []Changelog {
+	if h == nil {
+		return nil
+	}
+	var out []Changelog
+next:
+	for _, c := range h.Changelogs {
+		for _, match := range filters {
+			if !match(c) {
+				continue next
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// FindBySuccess returns the changelogs of successful, or failed, runs.
+func (h *History) FindBySuccess(success bool) []Changelog {
+	return h.Find(SuccessIs(success))
+}
+
+// FindSince returns the changelogs written at or after t.
+func (h *History) FindSince(t time.Time) []Changelog {
+	return h.Find(Since(t))
+}
+
+// SearchLogs returns the changelogs whose logs, TODO or report contain keyword, ignoring case.
+func (h *History) SearchLogs(keyword string) []Changelog {
+	return h.Find(Contains(keyword))
+}
+
+// FindByRunID returns the changelog of the run with id.
+func (h *History) FindByRunID(id string) (Changelog, bool) {
+	found := h.Find(func(c Changelog) bool { return c.RunID == id })
+	if len(found) == 0 {
+		return Changelog{}, false
+	}
+	return found[len(found)-1], true
+}
+
+// SuccessIs matches changelogs by their Success flag.
+func SuccessIs(success bool) func(Changelog) bool {
+	return func(c Changelog) bool { return c.Success == success }
+}
+
+// Since matches changelogs written at or after t.
+func Since(t time.Time) func(Changelog) bool {
+	return func(c Changelog) bool { return !c.Timestamp.Before(t) }
+}
+
+// Contains matches changelogs whose logs, TODO or report contain keyword, ignoring case.
+func Contains(keyword string) func(Changelog) bool {
+	keyword = strings.ToLower(keyword)
+	return func(c Changelog) bool {
+		texts := []string{c.TODO}
+		for _, l := range c.Logs {
+			texts = append(texts, l.Value)
+		}
+		if c.Report != nil {
+			texts = append(texts, c.Report.Value)
+		}
+		for _, t := range texts {
+			if strings.Contains(strings.ToLower(t), keyword) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,45 @@
+package history
+
+import "fmt"
+
+// RestorePoint holds the files a run changed as they were before it, so the run can be undone.
+type RestorePoint struct {
+	Files []FileState `xml:"File"`
+}
+
+// FileState is the content of a file before a run changed it.
+type FileState struct {
+	Path string `xml:"Path,attr"`
+	// Absent is set for a file that did not exist, i.e. the run created it.
+	Absent  bool      `xml:"Absent,attr,omitempty"`
+	Content *LogEntry `xml:"Content,omitempty"`
+}
+
+// FilesBefore returns the files to write back to restore the workspace to its state before the
+// run with id: the files changed by that run and by every later one, as they were before the first
+// of these runs changed them. It fails if one of these runs has no restore point.
+func (h *History) FilesBefore(id string) ([]FileState, error) {
+	start := -1
+	for i, c := range h.Changelogs {
+		if c.RunID == id {
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("history: no run %s", id)
+	}
+	var files []FileState
+	seen := map[string]bool{}
+	for _, c := range h.Changelogs[start:] {
+		if c.Before == nil {
+			return nil, fmt.Errorf("history: run %s has no restore point", c.RunID)
+		}
+		for _, f := range c.Before.Files {
+			if !seen[f.Path] {
+				seen[f.Path] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
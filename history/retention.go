@@ -0,0 +1,155 @@
+package history
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Retention bounds how much history is kept in the history file. Zero values disable the
+// corresponding limit. Limits are enforced by Prune, which SaveHistoryToFile calls before writing.
+type Retention struct {
+	MaxChangelogs int           // keep at most this many of the most recent changelogs
+	MaxAge        time.Duration // drop changelogs older than this
+	MaxFileSize   int64         // drop the oldest changelogs until the serialized file fits, in bytes
+	// FailuresOnly drops the changelogs of runs that succeeded, except the most recent one, so the
+	// history is a record of what went wrong.
+	FailuresOnly bool
+	// Archive writes pruned changelogs to a gzip-compressed file next to the history file
+	// (<path>.<unix-timestamp>.xml.gz) instead of discarding them.
+	Archive bool
+}
+
+func (r Retention) enabled() bool {
+	return r.MaxChangelogs > 0 || r.MaxAge > 0 || r.MaxFileSize > 0 || r.FailuresOnly
+}
+
+// Prune applies the retention limits and returns the changelogs that were removed, oldest first.
+// The most recent changelog is never pruned by MaxFileSize so the last run is always recorded.
+func (h *History) Prune(now time.Time) ([]Changelog, error) {
+	if h == nil || !h.Retention.enabled() {
+		return nil, nil
+	}
+	var pruned []Changelog
+	if h.Retention.FailuresOnly && len(h.Changelogs) > 1 {
+		last := len(h.Changelogs) - 1
+		kept := h.Changelogs[:0:0]
+		for i, c := range h.Changelogs {
+			if c.Success && i != last {
+				pruned = append(pruned, c)
+				continue
+			}
+			kept = append(kept, c)
+		}
+		h.Changelogs = kept
+	}
+	if h.Retention.MaxAge > 0 {
+		cutoff := now.Add(-h.Retention.MaxAge)
+		kept := h.Changelogs[:0:0]
+		for _, c := range h.Changelogs {
+			if c.Timestamp.Before(cutoff) {
+				pruned = append(pruned, c)
+				continue
+			}
+			kept = append(kept, c)
+		}
+		h.Changelogs = kept
+	}
+	if n := h.Retention.MaxChangelogs; n > 0 && len(h.Changelogs) > n {
+		drop := len(h.Changelogs) - n
+		pruned = append(pruned, h.Changelogs[:drop]...)
+		h.Changelogs = h.Changelogs[drop:]
+	}
+	if h.Retention.MaxFileSize > 0 && len(h.Changelogs) > 1 {
+		sizes, total, err := h.marshaledSizes()
+		if err != nil {
+			return nil, err
+		}
+		drop := 0
+		for drop < len(h.Changelogs)-1 && total > h.Retention.MaxFileSize {
+			total -= sizes[drop]
+			drop++
+		}
+		pruned = append(pruned, h.Changelogs[:drop]...)
+		h.Changelogs = h.Changelogs[drop:]
+	}
+	// successes pruned first may be newer than failures pruned by the other limits
+	slices.SortStableFunc(pruned, func(a, b Changelog) int { return a.Timestamp.Compare(b.Timestamp) })
+	return pruned, nil
+}
+
+// archive writes the given changelogs to a gzip-compressed history file next to FilePath.
+func (h *History) archive(changelogs []Changelog, now time.Time) error {
+	if len(changelogs) == 0 || h.FilePath == "" {
+		return nil
+	}
+	archived := &History{Changelogs: changelogs, Encoding: h.Encoding}
+	buf, err := archived.marshal()
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("%s.%d.xml.gz", h.FilePath, now.UnixNano())
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// marshaledSizes returns the bytes each changelog adds to the output of marshal and the size of
+// that output, marshaling (and compressing) every changelog once.
+func (h *History) marshaledSizes() ([]int64, int64, error) {
+	size := func(c Changelog) (int64, error) {
+		// as indented by marshal, on its own line
+		buf, err := xml.MarshalIndent(c, "    ", "  ")
+		return int64(len(buf)) + 1, err
+	}
+	// the document around the changelogs
+	doc, err := (&History{Changelogs: []Changelog{{}}}).marshal()
+	if err != nil {
+		return nil, 0, err
+	}
+	empty, err := size(Changelog{})
+	if err != nil {
+		return nil, 0, err
+	}
+	total := int64(len(doc)) - empty
+	sizes := make([]int64, len(h.Changelogs))
+	for i, c := range h.Changelogs {
+		if h.Encoding.enabled() {
+			c = h.Encoding.changelog(c)
+		}
+		if sizes[i], err = size(c); err != nil {
+			return nil, 0, err
+		}
+		total += sizes[i]
+	}
+	return sizes, total, nil
+}
+
+func (h *History) marshal() ([]byte, error) {
+	out := h
+	if h.Encoding.enabled() {
+		out = &History{Changelogs: make([]Changelog, len(h.Changelogs))}
+		for i, c := range h.Changelogs {
+			out.Changelogs[i] = h.Encoding.changelog(c)
+		}
+	}
+	buf, err := xml.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), buf...), nil
+}
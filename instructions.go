@@ -0,0 +1,186 @@
+package axe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// InstructionSource is an instruction read when a run starts, e.g. a long task spec or the
+// guidelines of an organization kept in a file or served over HTTP. See WithInstructionSources.
+type InstructionSource interface {
+	Instruction(ctx context.Context) (string, error)
+	// String describes where the instruction is read from.
+	String() string
+}
+
+// InstructionFile returns the instruction in the file at path. The file is read again only when it
+// changes.
+func InstructionFile(path string) InstructionSource {
+	return &fileInstruction{path: path}
+}
+
+// InstructionFS returns the instruction in the file at path of fsys, e.g. an embed.FS. The file is
+// read once.
+func InstructionFS(fsys fs.FS, path string) InstructionSource {
+	return &fsInstruction{fsys: fsys, path: path}
+}
+
+// InstructionURL returns the instruction served at url. The response is reused for maxAge, then
+// revalidated with its ETag or Last-Modified header. A runner fetches it with the client of its
+// model requests, see WithHTTPClient and WithProxy.
+func InstructionURL(url string, maxAge time.Duration) InstructionSource {
+	return &urlInstruction{url: url, maxAge: maxAge}
+}
+
+// InstructionURLWithClient is InstructionURL fetching the instruction with client.
+func InstructionURLWithClient(url string, maxAge time.Duration, client *http.Client) InstructionSource {
+	return &urlInstruction{url: url, maxAge: maxAge, client: client}
+}
+
+// MaxInstructionBytes bounds the instruction read from a URL; a larger response is an error.
+const MaxInstructionBytes = 1 << 20
+
+type httpClientCtxKey struct{}
+
+type fileInstruction struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	content string
+}
+
+func (s *fileInstruction) String() string { return s.path }
+
+func (s *fileInstruction) Instruction(context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", err
+	}
+	if !s.modTime.IsZero() && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.content, nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", err
+	}
+	s.modTime, s.size, s.content = info.ModTime(), info.Size(), string(data)
+	return s.content, nil
+}
+
+type fsInstruction struct {
+	fsys fs.FS
+	path string
+
+	once    sync.Once
+	content string
+	err     error
+}
+
+func (s *fsInstruction) String() string { return s.path }
+
+func (s *fsInstruction) Instruction(context.Context) (string, error) {
+	s.once.Do(func() {
+		data, err := fs.ReadFile(s.fsys, s.path)
+		s.content, s.err = string(data), err
+	})
+	return s.content, s.err
+}
+
+type urlInstruction struct {
+	url    string
+	maxAge time.Duration
+	client *http.Client // the client of the runner, then http.DefaultClient, when nil
+
+	mu           sync.Mutex
+	fetched      time.Time
+	etag         string
+	lastModified string
+	content      string
+}
+
+func (s *urlInstruction) String() string { return s.url }
+
+func (s *urlInstruction) Instruction(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached := !s.fetched.IsZero()
+	if cached && time.Since(s.fetched) < s.maxAge {
+		return s.content, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return "", err
+	}
+	if cached && s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	if cached && s.lastModified != "" {
+		req.Header.Set("If-Modified-Since", s.lastModified)
+	}
+	client := s.client
+	if client == nil {
+		client, _ = ctx.Value(httpClientCtxKey{}).(*http.Client)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+	case resp.StatusCode == http.StatusOK:
+		data, err := io.ReadAll(io.LimitReader(resp.Body, MaxInstructionBytes+1))
+		if err != nil {
+			return "", err
+		}
+		if len(data) > MaxInstructionBytes {
+			return "", fmt.Errorf("instruction larger than %d bytes", MaxInstructionBytes)
+		}
+		s.content = string(data)
+		s.etag, s.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	default:
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	s.fetched = time.Now()
+	return s.content, nil
+}
+
+// instructions returns the instructions of a run: those of InstructionSources, read now and filled
+// with InstructionVars, followed by Instructions.
+func (r *Runner) instructions(ctx context.Context) ([]string, error) {
+	if len(r.InstructionSources) == 0 {
+		return r.Instructions, nil
+	}
+	if client, err := r.Endpoint.httpClient(); err == nil && client != nil {
+		ctx = context.WithValue(ctx, httpClientCtxKey{}, client)
+	}
+	var resolved []string
+	for _, source := range r.InstructionSources {
+		instruction, err := source.Instruction(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("axe: instruction source %s: %w", source, err)
+		}
+		resolved = append(resolved, instruction)
+	}
+	if r.InstructionVars != nil {
+		rendered, err := renderInstructions(resolved, r.InstructionVars)
+		if err != nil {
+			return nil, err
+		}
+		resolved = rendered
+	}
+	return append(resolved, r.Instructions...), nil
+}
@@ -0,0 +1,147 @@
+package axe_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerInstructionVariables(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "fixed"))
+	task := []string{"Fix bug {{ ticket }} in {{ package }}.{% if note is defined %} {{ note }}{% endif %}"}
+	runner, err := axe.NewRunner(dir, task, cont.NewCodeContainer(nil),
+		axe.WithChatModel(model),
+		axe.WithInstructionVariables(map[string]any{"ticket": "AXE-12"}),
+		axe.WithInstructionVariables(map[string]any{"package": "history"}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Contains(t, model.Requests()[0][1].Content, "# Instruction: \nFix bug AXE-12 in history.\n")
+	assert.Equal(t, []string{"Fix bug AXE-12 in history."}, result.Report.Instructions)
+
+	_, err = axe.NewRunner(dir, task, cont.NewCodeContainer(nil),
+		axe.WithInstructionVariables(map[string]any{"ticket": "AXE-12"}),
+	)
+	assert.ErrorContains(t, err, "package")
+}
+
+func TestRunnerInstructionSources(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.md")
+	require.NoError(t, os.WriteFile(spec, []byte("Spec of {{ ticket }}."), 0o644))
+	var fetches, revalidations int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetches++
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			revalidations++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "Org guidelines.")
+	}))
+	defer server.Close()
+
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "one"), axetest.Finalize("success", "two"))
+	runner, err := axe.NewRunner(dir, []string{"Do the task."}, cont.NewCodeContainer(nil),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithInstructionVariables(map[string]any{"ticket": "AXE-7"}),
+		axe.WithInstructionSources(
+			axe.InstructionURL(server.URL, 0),
+			axe.InstructionFile(spec),
+			axe.InstructionFS(fstest.MapFS{"style.md": {Data: []byte("Style guide.")}}, "style.md"),
+		),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Org guidelines.", "Spec of AXE-7.", "Style guide.", "Do the task."}, result.Report.Instructions)
+
+	require.NoError(t, os.WriteFile(spec, []byte("New spec, longer."), 0o644))
+	result, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Org guidelines.", "New spec, longer.", "Style guide.", "Do the task."}, result.Report.Instructions)
+	assert.Equal(t, 2, fetches)
+	assert.Equal(t, 1, revalidations, "the cached guidelines are revalidated")
+
+	runner, err = axe.NewRunner(dir, nil, cont.NewCodeContainer(nil),
+		axe.WithChatModel(axetest.NewScriptedModel()),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithInstructionSources(axe.InstructionFile(filepath.Join(dir, "missing.md"))),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	assert.ErrorContains(t, err, "missing.md")
+}
+
+// headerTransport sets a header on every request.
+type headerTransport struct{ key, value string }
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(h.key, h.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRunnerInstructionURL(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/large":
+			fmt.Fprint(w, strings.Repeat("x", axe.MaxInstructionBytes+1))
+		case req.Header.Get("X-Client") == "":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			fmt.Fprint(w, "Guidelines for "+req.Header.Get("X-Client")+".")
+		}
+	}))
+	defer server.Close()
+
+	run := func(source axe.InstructionSource) ([]string, error) {
+		runner, err := axe.NewRunner(dir, nil, cont.NewCodeContainer(nil),
+			axe.WithChatModel(axetest.NewScriptedModel(axetest.Finalize("success", "done"))),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+			axe.WithHTTPClient(&http.Client{Transport: headerTransport{"X-Client", "runner"}}),
+			axe.WithInstructionSources(source),
+		)
+		require.NoError(t, err)
+		result, err := runner.Run(context.Background(), false)
+		if err != nil {
+			return nil, err
+		}
+		return result.Report.Instructions, nil
+	}
+
+	instructions, err := run(axe.InstructionURL(server.URL, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Guidelines for runner."}, instructions, "fetched with the client of the runner")
+
+	instructions, err = run(axe.InstructionURLWithClient(server.URL, 0, &http.Client{Transport: headerTransport{"X-Client", "source"}}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Guidelines for source."}, instructions)
+
+	_, err = run(axe.InstructionURL(server.URL+"/large", 0))
+	assert.ErrorContains(t, err, "instruction larger than")
+}
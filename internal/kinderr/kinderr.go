@@ -0,0 +1,24 @@
+// Package kinderr classifies errors by kind, a sentinel error to branch on with errors.Is, for the
+// code packages and the runner.
+package kinderr
+
+import "fmt"
+
+// Error is an error of a kind. It keeps the message of the error it wraps and matches both.
+type Error struct {
+	Kind, Err error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// New returns err with the given kind.
+func New(kind, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf returns an error of the given kind formatted like fmt.Errorf.
+func Errorf(kind error, format string, a ...any) error {
+	return New(kind, fmt.Errorf(format, a...))
+}
@@ -0,0 +1,21 @@
+package kinderr
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	errMissing := errors.New("missing file")
+	err := Errorf(errMissing, "open %s: %w", "a.txt", fs.ErrNotExist)
+	assert.EqualError(t, err, "open a.txt: file does not exist", "the kind is not part of the message")
+	assert.ErrorIs(t, err, errMissing)
+	assert.ErrorIs(t, err, fs.ErrNotExist, "the wrapped error still matches")
+
+	var kindErr *Error
+	assert.ErrorAs(t, New(errMissing, err), &kindErr)
+	assert.Equal(t, errMissing, kindErr.Kind)
+}
@@ -0,0 +1,89 @@
+// Package linediff computes the line edits between two texts, for the diffs, merges and change
+// stats of the code packages.
+package linediff
+
+import "strings"
+
+// Edit replaces the lines [Start, End) of the old text with Lines.
+type Edit struct {
+	Start, End int
+	Lines      []string
+}
+
+// MaxCells bounds the LCS table of Diff; larger changes become a single edit.
+const MaxCells = 1 << 22
+
+// Diff returns the edits turning old into new, in order. Unchanged lines separate the edits, so
+// an edit is a block of deleted lines followed by the lines inserted in their place.
+func Diff(old, new []string) []Edit {
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+	o, n := old[prefix:len(old)-suffix], new[prefix:len(new)-suffix]
+	if len(o) == 0 && len(n) == 0 {
+		return nil
+	}
+	if (len(o)+1)*(len(n)+1) > MaxCells {
+		return []Edit{{Start: prefix, End: prefix + len(o), Lines: n}}
+	}
+
+	// lcs[x][y] is the length of the longest common subsequence of o[x:] and n[y:]
+	lcs := make([][]int32, len(o)+1)
+	for x := range lcs {
+		lcs[x] = make([]int32, len(n)+1)
+	}
+	for x := len(o) - 1; x >= 0; x-- {
+		for y := len(n) - 1; y >= 0; y-- {
+			if o[x] == n[y] {
+				lcs[x][y] = lcs[x+1][y+1] + 1
+			} else {
+				lcs[x][y] = max(lcs[x+1][y], lcs[x][y+1])
+			}
+		}
+	}
+
+	var edits []Edit
+	var cur *Edit
+	flush := func() {
+		if cur != nil {
+			edits = append(edits, *cur)
+			cur = nil
+		}
+	}
+	x, y := 0, 0
+	for x < len(o) || y < len(n) {
+		switch {
+		case x < len(o) && y < len(n) && o[x] == n[y]:
+			flush()
+			x, y = x+1, y+1
+		case y < len(n) && (x == len(o) || lcs[x][y+1] >= lcs[x+1][y]):
+			if cur == nil {
+				cur = &Edit{Start: prefix + x, End: prefix + x}
+			}
+			cur.Lines = append(cur.Lines, n[y])
+			y++
+		default:
+			if cur == nil {
+				cur = &Edit{Start: prefix + x, End: prefix + x}
+			}
+			cur.End++
+			x++
+		}
+	}
+	flush()
+	return edits
+}
+
+// Split splits s after every newline, so joining the lines gives back s.
+func Split(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,45 @@
+package linediff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := Split("a\nb\nc\nd\n")
+	cases := []struct {
+		new  string
+		want []Edit
+	}{
+		{"a\nb\nc\nd\n", nil},
+		{"a\nB\nc\nd\n", []Edit{{Start: 1, End: 2, Lines: []string{"B\n"}}}},
+		{"a\nc\nd\ne\n", []Edit{{Start: 1, End: 2}, {Start: 4, End: 4, Lines: []string{"e\n"}}}},
+		{"", []Edit{{Start: 0, End: 4}}},
+	}
+	for _, tc := range cases {
+		edits := Diff(old, Split(tc.new))
+		if !reflect.DeepEqual(edits, tc.want) {
+			t.Fatalf("Diff to %q = %+v, want %+v", tc.new, edits, tc.want)
+		}
+		// applying the edits gives back the new text
+		var out []string
+		pos := 0
+		for _, e := range edits {
+			out = append(append(out, old[pos:e.Start]...), e.Lines...)
+			pos = e.End
+		}
+		if got := strings.Join(append(out, old[pos:]...), ""); got != tc.new {
+			t.Fatalf("applied edits = %q, want %q", got, tc.new)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	if got := Split("a\nb"); !reflect.DeepEqual(got, []string{"a\n", "b"}) {
+		t.Fatalf("Split = %q", got)
+	}
+	if got := Split(""); len(got) != 0 {
+		t.Fatalf("Split of the empty string = %q", got)
+	}
+}
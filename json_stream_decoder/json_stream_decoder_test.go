@@ -105,3 +105,30 @@ func TestJSONStreamDecoderStreamsFromPipeBeforeClose(t *testing.T) {
 	err = <-doneCh
 	require.NoError(t, err)
 }
+
+func TestRepair(t *testing.T) {
+	for input, want := range map[string]string{
+		``:                                 `{}`,
+		`{"a":"b"}`:                        `{"a":"b"}`,
+		`{}{"a":"b"}`:                      `{"a":"b"}`,
+		`{"a":"b"}{"a":"b"}`:               `{"a":"b"}`,
+		`{"a":"b"} {"c":1}`:                `{"a":"b","c":1}`,
+		`{"a":"partial`:                    `{"a":"partial"}`,
+		`{"a":"ends with \`:                `{"a":"ends with "}`,
+		`{"a":["x","y"`:                    `{"a":["x","y"]}`,
+		`{"a":["x",`:                       `{"a":["x"]}`,
+		`{"a":{"b":1},`:                    `{"a":{"b":1}}`,
+		`{"a":`:                            `{"a":null}`,
+		`{"a":"b","c"`:                     `{"a":"b","c":null}`,
+		`{"code":"}{ not a brace\"","n":1`: `{"code":"}{ not a brace\"","n":1}`,
+	} {
+		got, err := Repair(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, got, input)
+	}
+
+	_, err := Repair(`{"a":tru`)
+	require.Error(t, err)
+	_, err = Repair(`{"a":1}["b"]`)
+	require.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package json_stream_decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Repair reconstructs the JSON object of tool call arguments streamed by providers that don't
+// always send valid JSON. It accepts:
+//   - an empty stream, which is an empty object;
+//   - concatenated objects, e.g. "{}" followed by the arguments, or the arguments sent twice,
+//     merged in order (later fields win);
+//   - a truncated stream, whose open strings, arrays and objects are closed, a dangling key or
+//     value being completed with null.
+//
+// Valid JSON is returned unchanged. Repair fails if the text can't be made into a JSON object.
+func Repair(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "{}", nil
+	}
+	if json.Valid([]byte(s)) {
+		return s, nil
+	}
+	values := splitValues(s)
+	if len(values) == 1 {
+		return closeValue(values[0])
+	}
+	merged := map[string]json.RawMessage{}
+	for _, v := range values {
+		closed, err := closeValue(v)
+		if err != nil {
+			return "", err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(closed), &fields); err != nil {
+			return "", errors.New("json_stream_decoder: concatenated values are not all objects")
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+	}
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// splitValues splits s into its top-level values, the last one possibly truncated. Text between
+// the values that can't start one is dropped.
+func splitValues(s string) []string {
+	var values []string
+	depth, start := 0, -1
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+			if start < 0 {
+				start = i
+			}
+		case '{', '[':
+			if start < 0 {
+				start = i
+			}
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 && start >= 0 {
+				values = append(values, s[start:i+1])
+				start = -1
+			}
+		}
+	}
+	if start >= 0 {
+		values = append(values, s[start:])
+	}
+	return values
+}
+
+// closeValue completes a truncated JSON value.
+func closeValue(s string) (string, error) {
+	if json.Valid([]byte(s)) {
+		return s, nil
+	}
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString(s)
+	if inString {
+		if escaped {
+			b.Truncate(b.Len() - 1)
+		}
+		b.WriteByte('"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		completeMember(&b, stack[i] == '}')
+		b.WriteByte(stack[i])
+	}
+	if !json.Valid(b.Bytes()) {
+		return "", errors.New("json_stream_decoder: can't repair the JSON value")
+	}
+	return b.String(), nil
+}
+
+// completeMember completes the last member of the object or array being closed: a trailing comma
+// is dropped, a key without value gets null.
+func completeMember(b *bytes.Buffer, object bool) {
+	trimmed := bytes.TrimRight(b.Bytes(), " \t\r\n")
+	b.Truncate(len(trimmed))
+	if len(trimmed) == 0 {
+		return
+	}
+	switch trimmed[len(trimmed)-1] {
+	case ',':
+		b.Truncate(len(trimmed) - 1)
+	case ':':
+		b.WriteString("null")
+	case '"':
+		if object && danglingKey(trimmed) {
+			b.WriteString(":null")
+		}
+	}
+}
+
+// danglingKey reports whether the string ending s is an object key without its colon: it follows
+// the opening brace or a comma.
+func danglingKey(s []byte) bool {
+	// find the opening quote of the string ending s
+	i := len(s) - 2
+	for ; i >= 0; i-- {
+		if s[i] == '"' && !escapedAt(s, i) {
+			break
+		}
+	}
+	prev := bytes.TrimRight(s[:max(i, 0)], " \t\r\n")
+	return len(prev) > 0 && (prev[len(prev)-1] == '{' || prev[len(prev)-1] == ',')
+}
+
+// escapedAt reports whether the byte at i is escaped by an odd number of backslashes.
+func escapedAt(s []byte, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
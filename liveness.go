@@ -0,0 +1,133 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cloudwego/eino/compose"
+
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// ToolLiveness describes a tool call that is currently executing.
+type ToolLiveness struct {
+	Tool          string
+	CallID        string // id of the call in the model response
+	StartedAt     time.Time
+	LastHeartbeat time.Time // zero until the first heartbeat
+	OutputBytes   int64     // stdout+stderr bytes produced so far, as of the last heartbeat
+}
+
+type livenessKey struct{}
+
+// Liveness returns the tool calls currently executing, oldest first. With WithToolHeartbeat set,
+// a hung command shows a stale LastHeartbeat or flat OutputBytes, while a slow one keeps advancing.
+func (r *Runner) Liveness() []ToolLiveness {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ToolLiveness, 0, len(r.activeTools))
+	for _, l := range r.activeTools {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+// trackTool registers a tool execution and returns a context identifying it plus a function
+// that unregisters it.
+func (r *Runner) trackTool(ctx context.Context, name string) (context.Context, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.activeTools == nil {
+		r.activeTools = make(map[int64]*ToolLiveness)
+	}
+	r.nextToolID++
+	id := r.nextToolID
+	r.activeTools[id] = &ToolLiveness{Tool: name, CallID: compose.GetToolCallID(ctx), StartedAt: time.Now()}
+	r.markActivity()
+	return context.WithValue(ctx, livenessKey{}, id), func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.activeTools, id)
+		r.markActivity()
+	}
+}
+
+// onToolHeartbeat records a heartbeat of a running CLI tool and reports it to the sinks.
+func (r *Runner) onToolHeartbeat(ctx context.Context, hb clitool.Heartbeat) {
+	name, callID := hb.Command, ""
+	if id, ok := ctx.Value(livenessKey{}).(int64); ok {
+		r.mu.Lock()
+		if l, ok := r.activeTools[id]; ok {
+			l.LastHeartbeat = time.Now()
+			if output := hb.StdoutBytes + hb.StderrBytes; output > l.OutputBytes {
+				// a command that is alive but silent is not active
+				r.markActivity()
+				l.OutputBytes = output
+			}
+			name, callID = l.Tool, l.CallID
+		}
+		r.mu.Unlock()
+	}
+	r.output.send(OutputChunk{Kind: OutputKindHeartbeat, Tool: name, CallID: callID, Text: fmt.Sprintf("[heartbeat] %s running for %s, %d bytes of output so far\n",
+		name, hb.Elapsed.Round(time.Second), hb.StdoutBytes+hb.StderrBytes)})
+}
+
+// ErrStalled is the cancellation cause of a run aborted by the stall watchdog, wrapped in the error
+// returned by the interrupted Run. See WithStallTimeout.
+var ErrStalled = errors.New("axe: run stalled")
+
+// StallPhase tells what a stalled run was waiting for.
+type StallPhase string
+
+const (
+	StallModel StallPhase = "model" // a model response: the provider hangs, or is very slow to answer
+	StallTool  StallPhase = "tool"  // a tool call that produces no output
+)
+
+// Stall describes a run without model tokens or tool activity for StallTimeout.
+type Stall struct {
+	RunID string
+	Phase StallPhase
+	Idle  time.Duration  // since the last activity
+	Tools []ToolLiveness // the tool calls executing, for StallTool
+}
+
+// markActivity records model or tool activity for the stall watchdog.
+func (r *Runner) markActivity() {
+	r.lastActivity.Store(time.Now().UnixNano())
+}
+
+// watchStalls checks the activity of the run until ctx is done. A run idle for StallTimeout is
+// reported to OnStall, then cancelled with ErrStalled unless OnStall returns false, in which case
+// it is reported again after another StallTimeout without activity.
+func (r *Runner) watchStalls(ctx context.Context, cancel context.CancelCauseFunc) {
+	r.markActivity()
+	ticker := time.NewTicker(max(r.StallTimeout/10, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		idle := time.Since(time.Unix(0, r.lastActivity.Load()))
+		if idle < r.StallTimeout {
+			continue
+		}
+		stall := Stall{RunID: r.RunID, Phase: StallModel, Idle: idle}
+		if tools := r.Liveness(); len(tools) > 0 {
+			stall.Phase, stall.Tools = StallTool, tools
+		}
+		r.log.Warn().Str("phase", string(stall.Phase)).Dur("idle", idle).Msg("axe: run stalled")
+		if r.OnStall != nil && !r.OnStall(ctx, stall) {
+			r.markActivity()
+			continue
+		}
+		cancel(fmt.Errorf("%w: no %s activity for %s", ErrStalled, stall.Phase, idle.Round(time.Millisecond)))
+		return
+	}
+}
@@ -0,0 +1,146 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// hangingModel never answers, like a provider that accepted the request and went silent.
+type hangingModel struct{ failingModel }
+
+func (hangingModel) Stream(ctx context.Context, _ []*schema.Message, _ ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m hangingModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+// silentTool runs until its context is done without producing anything.
+type silentTool struct{}
+
+func (silentTool) Info(context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "wait", Desc: "waits"}, nil
+}
+
+func (silentTool) InvokableRun(ctx context.Context, _ string, _ ...tool.Option) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestRunnerStallTimeout(t *testing.T) {
+	dir := t.TempDir()
+	var stalls []axe.Stall
+	runner, err := axe.NewRunner(dir, []string{"do it"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(hangingModel{}),
+		axe.WithStallTimeout(50*time.Millisecond),
+		axe.WithStallHandler(func(_ context.Context, stall axe.Stall) bool {
+			stalls = append(stalls, stall)
+			return len(stalls) == 2 // abort on the second report
+		}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.ErrorIs(t, err, axe.ErrStalled)
+	assert.ErrorContains(t, err, "no model activity")
+	require.NotNil(t, result, "a stalled run still saves its changelog")
+	assert.Equal(t, axe.RunStatusInterrupted, result.Status)
+	require.Len(t, stalls, 2)
+	assert.Equal(t, axe.StallModel, stalls[0].Phase)
+	assert.GreaterOrEqual(t, stalls[0].Idle, 50*time.Millisecond)
+
+	runner, err = axe.NewRunner(dir, []string{"wait"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(axetest.NewScriptedModel(axetest.ToolCall("wait", nil))),
+		axe.WithExtraTools(silentTool{}),
+		axe.WithStallTimeout(50*time.Millisecond),
+		axe.WithStallHandler(func(_ context.Context, stall axe.Stall) bool {
+			stalls = append(stalls, stall)
+			return true
+		}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.ErrorIs(t, err, axe.ErrStalled)
+	require.Len(t, stalls, 3)
+	assert.Equal(t, axe.StallTool, stalls[2].Phase)
+	require.Len(t, stalls[2].Tools, 1)
+	assert.Equal(t, "wait", stalls[2].Tools[0].Tool)
+}
+
+func TestRunnerLiveness(t *testing.T) {
+	dir := t.TempDir()
+	exec := &blockingExecutor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	sink := &chunkRecorder{}
+	runner, err := axe.NewRunner(dir, []string{"test a"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(axetest.NewScriptedModel(
+			axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./a"]`}),
+			axetest.Finalize("success", "tested"),
+		)),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithToolHeartbeat(10*time.Millisecond),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithNamedSinks(axe.NamedSink{Name: "chunks", Writer: sink}),
+	)
+	require.NoError(t, err)
+	assert.Empty(t, runner.Liveness())
+	runErr := make(chan error, 1)
+	go func() {
+		_, err := runner.Run(context.Background(), false)
+		runErr <- err
+	}()
+	<-exec.started
+
+	heartbeats := func() []axe.OutputChunk {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		var out []axe.OutputChunk
+		for _, chunk := range sink.chunks {
+			if chunk.Kind == axe.OutputKindHeartbeat {
+				out = append(out, chunk)
+			}
+		}
+		return out
+	}
+	require.Eventually(t, func() bool { return len(heartbeats()) >= 2 }, 5*time.Second, 5*time.Millisecond,
+		"heartbeats are sent while the tool runs")
+	hb := heartbeats()[0]
+	assert.Equal(t, "go_test", hb.Tool)
+	assert.NotEmpty(t, hb.CallID)
+	assert.Contains(t, hb.Text, "[heartbeat] go_test running for")
+
+	live := runner.Liveness()
+	require.Len(t, live, 1)
+	assert.Equal(t, "go_test", live[0].Tool)
+	assert.Equal(t, hb.CallID, live[0].CallID)
+	assert.False(t, live[0].StartedAt.IsZero())
+	assert.True(t, live[0].LastHeartbeat.After(live[0].StartedAt), "the last heartbeat tells when the tool was last seen alive")
+	assert.Zero(t, live[0].OutputBytes)
+
+	close(exec.release)
+	require.NoError(t, <-runErr)
+	assert.Empty(t, runner.Liveness())
+	sent := len(heartbeats())
+	time.Sleep(30 * time.Millisecond)
+	assert.Len(t, heartbeats(), sent, "heartbeats stop with the tool")
+}
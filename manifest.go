@@ -0,0 +1,163 @@
+package axe
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/code/container"
+)
+
+// Providers of a Manifest.
+const (
+	ProviderOpenAI = "openai" // an OpenAI-compatible API at BaseURL
+	ProviderCustom = "custom" // a model set with WithChatModel
+)
+
+// Manifest records the configuration a run depends on, in its report, to reproduce it: the model
+// and where it is served, the sampling parameters and seed, and hashes of the first prompt and of
+// the tool definitions. WithManifest runs again with the same configuration.
+type Manifest struct {
+	Model               ModelName            `json:"model"`
+	Provider            string               `json:"provider"`
+	BaseURL             string               `json:"base_url,omitempty"`
+	Temperature         *float32             `json:"temperature,omitempty"`
+	TopP                *float32             `json:"top_p,omitempty"`
+	MaxCompletionTokens *int                 `json:"max_completion_tokens,omitempty"`
+	ReasoningEffort     ReasoningEffort      `json:"reasoning_effort,omitempty"`
+	Seed                *int                 `json:"seed,omitempty"`
+	MaxSteps            int                  `json:"max_steps"`
+	EditFormat          container.EditFormat `json:"edit_format,omitempty"`
+	PromptHash          string               `json:"prompt_hash"` // sha256 of the first prompt: the instructions and code
+	Tools               []ToolManifest       `json:"tools"`
+}
+
+// ToolManifest identifies the definition of a tool given to the model.
+type ToolManifest struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"` // sha256 of the description and parameters
+}
+
+// ReadManifest returns the manifest of the run report at path, written by WithReport.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("axe: read report: %w", err)
+	}
+	var report RunReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("axe: read report %s: %w", path, err)
+	}
+	if report.Manifest == nil {
+		return nil, fmt.Errorf("axe: report %s has no manifest", path)
+	}
+	return report.Manifest, nil
+}
+
+// config returns the model configuration of the manifest.
+func (m *Manifest) config() ModelConfig {
+	return ModelConfig{
+		Temperature:         m.Temperature,
+		TopP:                m.TopP,
+		MaxCompletionTokens: m.MaxCompletionTokens,
+		ReasoningEffort:     m.ReasoningEffort,
+		Seed:                m.Seed,
+	}
+}
+
+// runConfig returns the model configuration of a run: ModelConfig, with a new seed with
+// RandomSeed.
+func (r *Runner) runConfig() ModelConfig {
+	cfg := r.ModelConfig
+	if r.RandomSeed {
+		var b [4]byte
+		_, _ = rand.Read(b[:])
+		seed := int(binary.BigEndian.Uint32(b[:]) >> 1)
+		cfg.Seed = &seed
+	}
+	return cfg
+}
+
+// buildManifest returns the manifest of a run with the model configuration cfg, its first prompt
+// and its tools.
+func (r *Runner) buildManifest(ctx context.Context, cfg ModelConfig, prompt []*schema.Message, tools []tool.BaseTool) (*Manifest, error) {
+	m := &Manifest{
+		Model:               r.Model,
+		Provider:            ProviderOpenAI,
+		Temperature:         cfg.Temperature,
+		TopP:                cfg.TopP,
+		MaxCompletionTokens: cfg.MaxCompletionTokens,
+		ReasoningEffort:     cfg.ReasoningEffort,
+		Seed:                cfg.Seed,
+		MaxSteps:            r.MaxSteps,
+		EditFormat:          r.EditFormat,
+	}
+	if r.ChatModel != nil {
+		m.Provider = ProviderCustom
+	} else {
+		m.BaseURL = r.Endpoint.baseURL()
+	}
+	h := sha256.New()
+	for _, msg := range prompt {
+		fmt.Fprintf(h, "%s\x00%s\x00", msg.Role, msg.Content)
+	}
+	m.PromptHash = hex.EncodeToString(h.Sum(nil))
+	for _, t := range tools {
+		info, err := t.Info(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("axe: manifest: %w", err)
+		}
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\x00", info.Desc)
+		if info.ParamsOneOf != nil {
+			s, err := info.ParamsOneOf.ToJSONSchema()
+			if err != nil {
+				return nil, fmt.Errorf("axe: manifest: tool %s: %w", info.Name, err)
+			}
+			params, err := canonicalJSON(s)
+			if err != nil {
+				return nil, fmt.Errorf("axe: manifest: tool %s: %w", info.Name, err)
+			}
+			if err := json.NewEncoder(h).Encode(params); err != nil {
+				return nil, fmt.Errorf("axe: manifest: tool %s: %w", info.Name, err)
+			}
+		}
+		m.Tools = append(m.Tools, ToolManifest{Name: info.Name, Hash: hex.EncodeToString(h.Sum(nil))})
+	}
+	slices.SortFunc(m.Tools, func(a, b ToolManifest) int { return cmp.Compare(a.Name, b.Name) })
+	return m, nil
+}
+
+// checkManifest reports how the run differs from the manifest it reproduces.
+func (r *Runner) checkManifest(run *Manifest) {
+	if r.Reproduce == nil {
+		return
+	}
+	for _, d := range r.Reproduce.diff(run) {
+		r.log.Warn().Msgf("axe: not reproducing the manifest exactly: %s", d)
+		r.outputRecorder.Write(OutputKindRunner, fmt.Sprintf("axe: not reproducing the manifest exactly: %s\n", d))
+	}
+}
+
+// diff returns how a run differs from the manifest it reproduces, nil if it doesn't: only the
+// prompt and the tools can, the rest is set by WithManifest.
+func (m *Manifest) diff(run *Manifest) []string {
+	var diffs []string
+	if m.PromptHash != run.PromptHash {
+		diffs = append(diffs, "the prompt (instructions or code) changed")
+	}
+	if !slices.Equal(m.Tools, run.Tools) {
+		diffs = append(diffs, "the tool definitions changed")
+	}
+	return diffs
+}
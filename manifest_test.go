@@ -0,0 +1,57 @@
+package axe_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerManifest(t *testing.T) {
+	dir := t.TempDir()
+	reportPath := filepath.Join(dir, "report.json")
+	run := func(instruction string, opts ...axe.RunnerOption) (*axe.RunResult, string) {
+		var out bytes.Buffer
+		runner, err := axe.NewRunner(dir, []string{instruction}, cont.NewCodeContainer(map[string]string{"a.txt": "a\n"}), append([]axe.RunnerOption{
+			axe.WithChatModel(axetest.NewScriptedModel(axetest.Finalize("success", "done"))),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(&out),
+		}, opts...)...)
+		require.NoError(t, err)
+		result, err := runner.Run(context.Background(), false)
+		require.NoError(t, err)
+		return result, out.String()
+	}
+
+	first, _ := run("Do the task.", axe.WithRandomSeed(), axe.WithMaxSteps(7), axe.WithReport(reportPath))
+	manifest, err := axe.ReadManifest(reportPath)
+	require.NoError(t, err)
+	assert.Equal(t, first.Report.Manifest, manifest)
+	assert.Equal(t, axe.ProviderCustom, manifest.Provider)
+	assert.Equal(t, 7, manifest.MaxSteps)
+	require.NotNil(t, manifest.Seed)
+	assert.Len(t, manifest.PromptHash, 64)
+	var names []string
+	for _, tool := range manifest.Tools {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"apply_edit", "finalize_task", "validate_patch"}, names)
+
+	again, out := run("Do the task.", axe.WithManifest(manifest))
+	assert.Equal(t, manifest.Seed, again.Report.Manifest.Seed)
+	assert.Equal(t, manifest.PromptHash, again.Report.Manifest.PromptHash)
+	assert.NotContains(t, out, "not reproducing")
+
+	_, out = run("Do another task.", axe.WithManifest(manifest))
+	assert.Contains(t, out, "not reproducing the manifest exactly: the prompt (instructions or code) changed")
+
+	_, err = axe.ReadManifest(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
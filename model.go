@@ -1,14 +1,21 @@
 package axe
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
 
 	einoopenai "github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/components/model"
+
+	"github.com/stumble/axe/internal/kinderr"
 )
 
 type ModelName string
@@ -18,11 +25,114 @@ const (
 	ModelGPT4o     ModelName = "gpt-4o"
 	ModelGPT4Dot1  ModelName = "gpt-4.1"
 	ModelGPT4oMini ModelName = "gpt-4o-mini"
+	ModelO1        ModelName = "o1"
+	ModelO3        ModelName = "o3"
+	ModelO3Mini    ModelName = "o3-mini"
+	ModelO4Mini    ModelName = "o4-mini"
 )
 
+// IsReasoning reports whether the model is a reasoning model (the o-series and gpt-5), see
+// ModelCapabilities. Reasoning models accept a reasoning effort but reject sampling parameters
+// such as temperature.
+func (m ModelName) IsReasoning() bool {
+	return m.Capabilities().Reasoning
+}
+
+// isReasoningName guesses from its name whether an unregistered model is a reasoning model.
+func isReasoningName(m ModelName) bool {
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if string(m) == prefix || strings.HasPrefix(string(m), prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
 const openAIDefaultBaseURL = "https://api.openai.com/v1"
 
-func newChatModel(ctx context.Context, desiredModel ModelName) (model.ToolCallingChatModel, error) {
+// ReasoningEffort controls how much reasoning a reasoning-capable model does before answering.
+type ReasoningEffort string
+
+const (
+	ReasoningEffortMinimal ReasoningEffort = "minimal" // gpt-5 only
+	ReasoningEffortLow     ReasoningEffort = "low"
+	ReasoningEffortMedium  ReasoningEffort = "medium"
+	ReasoningEffortHigh    ReasoningEffort = "high"
+)
+
+// ModelConfig holds optional generation parameters passed to the chat model.
+// Nil or empty fields keep the provider or axe defaults.
+type ModelConfig struct {
+	Temperature         *float32
+	TopP                *float32
+	MaxCompletionTokens *int
+	ReasoningEffort     ReasoningEffort
+	// Seed asks the provider for deterministic sampling, on a best-effort basis. Omitted from the
+	// response cache key when nil, so caches recorded before it existed still match.
+	Seed *int `json:",omitempty"`
+}
+
+// Endpoint configures how the OpenAI-compatible API is reached, so runners in one process can
+// target different gateways. Empty fields fall back to the OPENAI_BASE_URL environment variable and
+// the default HTTP transport (which honors HTTPS_PROXY).
+type Endpoint struct {
+	BaseURL    string
+	ProxyURL   string       // HTTP(S) proxy for model requests, e.g. "http://proxy.internal:3128"
+	HTTPClient *http.Client // custom client (TLS, timeouts); ProxyURL is ignored when set
+}
+
+// baseURL returns the base URL of model requests: BaseURL, OPENAI_BASE_URL or the OpenAI API.
+func (e Endpoint) baseURL() string {
+	baseURL := strings.TrimSpace(e.BaseURL)
+	if baseURL == "" {
+		baseURL = strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+	}
+	if baseURL == "" {
+		baseURL = openAIDefaultBaseURL
+	}
+	return baseURL
+}
+
+// httpClient returns the client for model requests, nil for the provider default.
+func (e Endpoint) httpClient() (*http.Client, error) {
+	if e.HTTPClient != nil {
+		return e.HTTPClient, nil
+	}
+	if e.ProxyURL == "" {
+		return nil, nil
+	}
+	proxy, err := parseHTTPURL(e.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("axe: proxy url: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+	return &http.Client{Transport: transport}, nil
+}
+
+func parseHTTPURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http(s) url", raw)
+	}
+	return u, nil
+}
+
+// Valid reports whether e is empty or a known effort.
+func (e ReasoningEffort) Valid() bool {
+	switch e {
+	case "", ReasoningEffortMinimal, ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+		return true
+	}
+	return false
+}
+
+// newChatModel creates the OpenAI chat model. onReasoningTokens, if set, is called with the
+// reasoning tokens of every response of a reasoning model, which eino's usage doesn't report.
+func newChatModel(ctx context.Context, desiredModel ModelName, cfg ModelConfig, endpoint Endpoint, onReasoningTokens func(int)) (model.ToolCallingChatModel, error) {
 	apiKey := strings.TrimSpace(os.Getenv("OAI_MY_KEY"))
 	if apiKey == "" {
 		apiKey = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
@@ -31,23 +141,169 @@ func newChatModel(ctx context.Context, desiredModel ModelName) (model.ToolCallin
 		return nil, errors.New("axe: missing OpenAI API key; set OAI_MY_KEY or OPENAI_API_KEY")
 	}
 
-	baseURL := strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
-	if baseURL == "" {
-		baseURL = openAIDefaultBaseURL
-	}
-	temp := float32(0)
-	if desiredModel == ModelGPT5 {
-		temp = 1.0
+	baseURL := endpoint.baseURL()
+	httpClient, err := endpoint.httpClient()
+	if err != nil {
+		return nil, err
 	}
 
-	chatModel, err := einoopenai.NewChatModel(ctx, &einoopenai.ChatModelConfig{
-		APIKey:      apiKey,
-		BaseURL:     baseURL,
-		Model:       string(desiredModel),
-		Temperature: &temp,
-	})
+	config := &einoopenai.ChatModelConfig{
+		APIKey:     apiKey,
+		BaseURL:    baseURL,
+		Model:      string(desiredModel),
+		HTTPClient: httpClient,
+		Seed:       cfg.Seed,
+	}
+	caps := desiredModel.Capabilities()
+	if caps.Temperature {
+		temp := float32(0)
+		if cfg.Temperature != nil {
+			temp = *cfg.Temperature
+		}
+		config.Temperature = &temp
+		config.TopP = cfg.TopP
+	} else if cfg.Temperature != nil || cfg.TopP != nil {
+		// reasoning models reject sampling parameters, even set to their defaults
+		return nil, kinderr.Errorf(ErrModelRejected, "axe: %s does not accept temperature or top_p", desiredModel)
+	}
+	if caps.Reasoning {
+		config.ReasoningEffort = einoopenai.ReasoningEffortLevel(cfg.ReasoningEffort)
+		if onReasoningTokens != nil {
+			config.HTTPClient = withReasoningUsage(httpClient, onReasoningTokens)
+		}
+	} else if cfg.ReasoningEffort != "" {
+		return nil, kinderr.Errorf(ErrModelRejected, "axe: %s is not a reasoning model and does not accept a reasoning effort", desiredModel)
+	}
+	if cfg.MaxCompletionTokens != nil {
+		// not part of eino's ChatModelConfig yet, so it is sent as an extra body field.
+		config.ExtraFields = map[string]any{"max_completion_tokens": *cfg.MaxCompletionTokens}
+	}
+	chatModel, err := einoopenai.NewChatModel(ctx, config)
 	if err != nil {
 		return nil, fmt.Errorf("axe: create chat model: %w", err)
 	}
 	return chatModel, nil
 }
+
+// withReasoningUsage returns a copy of client (nil for the default) whose responses report their
+// reasoning tokens.
+func withReasoningUsage(client *http.Client, onTokens func(int)) *http.Client {
+	c := &http.Client{}
+	if client != nil {
+		*c = *client
+	}
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = reasoningUsageTransport{base: base, onTokens: onTokens}
+	return c
+}
+
+type reasoningUsageTransport struct {
+	base     http.RoundTripper
+	onTokens func(int)
+}
+
+func (t reasoningUsageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	resp.Body = &reasoningUsageReader{ReadCloser: resp.Body, onTokens: t.onTokens, stream: stream}
+	return resp, nil
+}
+
+// usageChunk is the part of a chat completion response, or of the last chunk of a stream, holding
+// the reasoning tokens.
+type usageChunk struct {
+	Usage *struct {
+		CompletionTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
+	} `json:"usage"`
+}
+
+// reasoningUsageReader decodes the usage of a response as it is read: the whole JSON response, or
+// every "data:" line of an SSE stream, the last usage winning. The reasoning tokens are reported
+// once, when the body is done.
+type reasoningUsageReader struct {
+	io.ReadCloser
+	onTokens func(int)
+	stream   bool
+	buf      []byte // the JSON response, or the current line of the stream
+	overflow bool   // buf outgrew maxUsageBody and is ignored
+	tokens   int
+	done     bool
+}
+
+// maxUsageBody bounds the buffered JSON response or stream line; a larger one isn't decoded.
+const maxUsageBody = 16 << 20
+
+func (r *reasoningUsageReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	data := p[:n]
+	for r.stream && len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r.buffer(data[:i])
+		r.decodeLine()
+		data = data[i+1:]
+	}
+	r.buffer(data)
+	if err != nil {
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *reasoningUsageReader) Close() error {
+	r.finish()
+	return r.ReadCloser.Close()
+}
+
+func (r *reasoningUsageReader) buffer(data []byte) {
+	if len(r.buf)+len(data) > maxUsageBody {
+		r.buf, r.overflow = r.buf[:0], true
+		return
+	}
+	if !r.overflow {
+		r.buf = append(r.buf, data...)
+	}
+}
+
+// decodeLine decodes the usage of the current line of the stream.
+func (r *reasoningUsageReader) decodeLine() {
+	line := bytes.TrimSpace(r.buf)
+	if data, ok := bytes.CutPrefix(line, []byte("data:")); ok && !r.overflow {
+		r.decode(bytes.TrimSpace(data))
+	}
+	r.buf, r.overflow = r.buf[:0], false
+}
+
+func (r *reasoningUsageReader) decode(data []byte) {
+	var chunk usageChunk
+	if json.Unmarshal(data, &chunk) == nil && chunk.Usage != nil {
+		r.tokens = chunk.Usage.CompletionTokensDetails.ReasoningTokens
+	}
+}
+
+func (r *reasoningUsageReader) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	switch {
+	case r.stream:
+		r.decodeLine()
+	case !r.overflow:
+		r.decode(r.buf)
+	}
+	r.buf = nil
+	if r.tokens > 0 {
+		r.onTokens(r.tokens)
+	}
+}
@@ -0,0 +1,65 @@
+package axe
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReasoningUsageTransport(t *testing.T) {
+	cases := []struct {
+		name, contentType, body string
+		want                    []int
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body: `{
+  "choices": [{"message": {"role": "assistant", "content": "{\"reasoning_tokens\": 7}"}}],
+  "usage": {
+    "completion_tokens": 300,
+    "completion_tokens_details": {"reasoning_tokens": 256}
+  }
+}`,
+			want: []int{256},
+		},
+		{
+			name:        "stream",
+			contentType: "text/event-stream",
+			body: "data: {\"choices\":[{\"delta\":{\"content\":\"reasoning_tokens\"}}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"completion_tokens_details\":{\"reasoning_tokens\":64}}}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"completion_tokens_details\":{\"reasoning_tokens\":128}}}\n\n" +
+				"data: [DONE]\n\n",
+			want: []int{128},
+		},
+		{
+			name:        "no usage",
+			contentType: "application/json",
+			body:        `{"choices":[{"message":{"content":"hi"}}]}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				_, _ = io.WriteString(w, tc.body)
+			}))
+			defer srv.Close()
+
+			var got []int
+			client := withReasoningUsage(nil, func(tokens int) { got = append(got, tokens) })
+			resp, err := client.Get(srv.URL)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, tc.body, string(body), "the body is passed through unchanged")
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package axe
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModelCapabilities describes what a model supports and costs. The runner uses it to validate the
+// model configuration, to bound the code rendered into the prompt and to price runs.
+type ModelCapabilities struct {
+	ContextWindow   int  // tokens of input and output; 0 if unknown
+	MaxOutputTokens int  // 0 if unknown
+	ToolCalling     bool // the model can call tools, which axe requires
+	Temperature     bool // the model accepts sampling parameters (temperature, top_p)
+	Reasoning       bool // the model accepts a reasoning effort
+	// Prices in USD per million tokens, 0 if unknown.
+	InputCostPerMTok  float64
+	OutputCostPerMTok float64
+}
+
+// Cost returns the price in USD of usage, 0 when the prices are unknown.
+func (c ModelCapabilities) Cost(usage TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*c.InputCostPerMTok + float64(usage.CompletionTokens)*c.OutputCostPerMTok) / 1e6
+}
+
+// codeInputBudget returns the bytes of code that fit in three quarters of the context window,
+// assuming four bytes per token, leaving room for the instructions, tool calls and the answer.
+func (c ModelCapabilities) codeInputBudget() int {
+	return c.ContextWindow / 4 * 3 * 4
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   = map[ModelName]ModelCapabilities{
+		ModelGPT5:      {ContextWindow: 400_000, MaxOutputTokens: 128_000, ToolCalling: true, Reasoning: true, InputCostPerMTok: 1.25, OutputCostPerMTok: 10},
+		ModelGPT4o:     {ContextWindow: 128_000, MaxOutputTokens: 16_384, ToolCalling: true, Temperature: true, InputCostPerMTok: 2.5, OutputCostPerMTok: 10},
+		ModelGPT4oMini: {ContextWindow: 128_000, MaxOutputTokens: 16_384, ToolCalling: true, Temperature: true, InputCostPerMTok: 0.15, OutputCostPerMTok: 0.6},
+		ModelGPT4Dot1:  {ContextWindow: 1_047_576, MaxOutputTokens: 32_768, ToolCalling: true, Temperature: true, InputCostPerMTok: 2, OutputCostPerMTok: 8},
+		ModelO1:        {ContextWindow: 200_000, MaxOutputTokens: 100_000, ToolCalling: true, Reasoning: true, InputCostPerMTok: 15, OutputCostPerMTok: 60},
+		ModelO3:        {ContextWindow: 200_000, MaxOutputTokens: 100_000, ToolCalling: true, Reasoning: true, InputCostPerMTok: 2, OutputCostPerMTok: 8},
+		ModelO3Mini:    {ContextWindow: 200_000, MaxOutputTokens: 100_000, ToolCalling: true, Reasoning: true, InputCostPerMTok: 1.1, OutputCostPerMTok: 4.4},
+		ModelO4Mini:    {ContextWindow: 200_000, MaxOutputTokens: 100_000, ToolCalling: true, Reasoning: true, InputCostPerMTok: 1.1, OutputCostPerMTok: 4.4},
+	}
+)
+
+// RegisterModel adds or replaces the capabilities of a model, e.g. a fine-tuned model or one served
+// by a gateway, so the runner can validate and price it. It is safe for concurrent use.
+func RegisterModel(name ModelName, caps ModelCapabilities) error {
+	if strings.TrimSpace(string(name)) == "" {
+		return errors.New("axe: register model: empty name")
+	}
+	if caps.ContextWindow < 0 || caps.MaxOutputTokens < 0 || caps.InputCostPerMTok < 0 || caps.OutputCostPerMTok < 0 {
+		return fmt.Errorf("axe: register model %s: negative capability", name)
+	}
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models[name] = caps
+	return nil
+}
+
+// RegisteredModels returns the names of the registered models, sorted.
+func RegisteredModels() []ModelName {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	names := make([]ModelName, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// LookupModel returns the capabilities of a registered model. A dated snapshot such as
+// "gpt-4o-2024-08-06" resolves to the longest registered name it extends ("gpt-4o").
+func LookupModel(name ModelName) (ModelCapabilities, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	if caps, ok := models[name]; ok {
+		return caps, true
+	}
+	var best ModelName
+	for registered := range models {
+		if strings.HasPrefix(string(name), string(registered)+"-") && len(registered) > len(best) {
+			best = registered
+		}
+	}
+	if best == "" {
+		return ModelCapabilities{}, false
+	}
+	return models[best], true
+}
+
+// Capabilities returns the registered capabilities of the model, or for an unknown model the ones
+// guessed from its name: tool calling, and either sampling parameters or a reasoning effort.
+func (m ModelName) Capabilities() ModelCapabilities {
+	if caps, ok := LookupModel(m); ok {
+		return caps
+	}
+	reasoning := isReasoningName(m)
+	return ModelCapabilities{ToolCalling: true, Temperature: !reasoning, Reasoning: reasoning}
+}
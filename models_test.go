@@ -0,0 +1,45 @@
+package axe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterModel(t *testing.T) {
+	caps := ModelCapabilities{ContextWindow: 32_000, ToolCalling: true, InputCostPerMTok: 1, OutputCostPerMTok: 2}
+	require.NoError(t, RegisterModel("registry-test", caps))
+	got, ok := LookupModel("registry-test")
+	require.True(t, ok)
+	assert.Equal(t, caps, got)
+	assert.Contains(t, RegisteredModels(), ModelName("registry-test"))
+
+	assert.Error(t, RegisterModel(" ", caps))
+	assert.Error(t, RegisterModel("registry-test", ModelCapabilities{ContextWindow: -1}))
+	got, _ = LookupModel("registry-test")
+	assert.Equal(t, caps, got, "a rejected registration keeps the previous capabilities")
+}
+
+func TestLookupModel_Prefix(t *testing.T) {
+	got, ok := LookupModel("gpt-4o-2024-08-06")
+	require.True(t, ok)
+	assert.Equal(t, 128_000, got.ContextWindow)
+	assert.Equal(t, 2.5, got.InputCostPerMTok)
+
+	got, ok = LookupModel("gpt-4o-mini-2024-07-18")
+	require.True(t, ok)
+	assert.Equal(t, 0.15, got.InputCostPerMTok, "the longest registered prefix wins")
+
+	_, ok = LookupModel("gpt-4oo")
+	assert.False(t, ok, "a prefix must end at a dash")
+	caps := ModelName("my-o3-model").Capabilities()
+	assert.True(t, caps.ToolCalling)
+	assert.Zero(t, caps.ContextWindow)
+}
+
+func TestModelCapabilities_Cost(t *testing.T) {
+	caps := ModelCapabilities{InputCostPerMTok: 2.5, OutputCostPerMTok: 10}
+	assert.InDelta(t, 0.0035, caps.Cost(TokenUsage{PromptTokens: 1000, CompletionTokens: 100}), 1e-12)
+	assert.Zero(t, ModelCapabilities{}.Cost(TokenUsage{PromptTokens: 1000}))
+}
@@ -1,12 +1,31 @@
 package axe
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/flow/agent/react"
+	"github.com/rs/zerolog"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/repomap"
+	"github.com/stumble/axe/code/v4a"
 	"github.com/stumble/axe/history"
+	"github.com/stumble/axe/tools/ask"
 	clitool "github.com/stumble/axe/tools/cli"
+	"github.com/stumble/axe/tools/code"
+	"github.com/stumble/axe/tools/finalize"
 )
 
 type RunnerOption func(*Runner) error
@@ -18,6 +37,118 @@ func WithModel(model ModelName) RunnerOption {
 	}
 }
 
+// WithModelConfig sets the generation parameters (temperature, top-p, max completion tokens,
+// reasoning effort) passed to the chat model.
+func WithModelConfig(config ModelConfig) RunnerOption {
+	return func(r *Runner) error {
+		if !config.ReasoningEffort.Valid() {
+			return fmt.Errorf("axe: invalid reasoning effort %q", config.ReasoningEffort)
+		}
+		r.ModelConfig = config
+		return nil
+	}
+}
+
+// WithSeed asks the provider for deterministic sampling with seed. Providers only make a best
+// effort: the same seed and prompt usually, not always, give the same responses.
+func WithSeed(seed int) RunnerOption {
+	return func(r *Runner) error {
+		r.ModelConfig.Seed = &seed
+		r.RandomSeed = false
+		return nil
+	}
+}
+
+// WithRandomSeed draws a new seed for every run. The seed is recorded in the manifest of the run
+// report, so a run can be reproduced with WithManifest.
+func WithRandomSeed() RunnerOption {
+	return func(r *Runner) error {
+		r.RandomSeed = true
+		return nil
+	}
+}
+
+// WithManifest configures the runner like the run of m, e.g. from ReadManifest: the model, base
+// URL, sampling parameters, seed, step limit and edit format. A manifest of a custom provider keeps
+// the model of WithChatModel. The run is reported as not reproduced exactly if its prompt (the
+// instructions and code) or its tools differ from the manifest.
+func WithManifest(m *Manifest) RunnerOption {
+	return func(r *Runner) error {
+		if m == nil {
+			return errors.New("axe: nil manifest")
+		}
+		if !m.ReasoningEffort.Valid() {
+			return fmt.Errorf("axe: invalid reasoning effort %q", m.ReasoningEffort)
+		}
+		r.Model, r.ModelConfig, r.RandomSeed = m.Model, m.config(), false
+		if m.Provider == ProviderOpenAI && m.BaseURL != "" {
+			r.Endpoint.BaseURL = m.BaseURL
+		}
+		if m.MaxSteps > 0 {
+			r.MaxSteps = m.MaxSteps
+		}
+		r.EditFormat = m.EditFormat
+		r.Reproduce = m
+		return nil
+	}
+}
+
+// WithBaseURL sets the base URL of the OpenAI-compatible API, overriding OPENAI_BASE_URL.
+func WithBaseURL(baseURL string) RunnerOption {
+	return func(r *Runner) error {
+		if _, err := parseHTTPURL(baseURL); err != nil {
+			return fmt.Errorf("axe: base url: %w", err)
+		}
+		r.Endpoint.BaseURL = strings.TrimSpace(baseURL)
+		return nil
+	}
+}
+
+// WithProxy sends model requests, and the requests of InstructionURL sources, through the HTTP(S)
+// proxy at proxyURL.
+func WithProxy(proxyURL string) RunnerOption {
+	return func(r *Runner) error {
+		if _, err := parseHTTPURL(proxyURL); err != nil {
+			return fmt.Errorf("axe: proxy url: %w", err)
+		}
+		r.Endpoint.ProxyURL = strings.TrimSpace(proxyURL)
+		return nil
+	}
+}
+
+// WithHTTPClient sends model requests, and the requests of InstructionURL sources, with client,
+// e.g. for custom TLS settings or timeouts. It takes precedence over WithProxy.
+func WithHTTPClient(client *http.Client) RunnerOption {
+	return func(r *Runner) error {
+		if client == nil {
+			return errors.New("axe: nil http client")
+		}
+		r.Endpoint.HTTPClient = client
+		return nil
+	}
+}
+
+// WithTemperature overrides the sampling temperature, which defaults to 0. Reasoning models
+// (see ModelName.IsReasoning) reject it.
+func WithTemperature(temperature float32) RunnerOption {
+	return func(r *Runner) error {
+		r.ModelConfig.Temperature = &temperature
+		return nil
+	}
+}
+
+// WithReasoningEffort sets how much a reasoning model reasons before answering. Other models
+// reject it.
+func WithReasoningEffort(effort ReasoningEffort) RunnerOption {
+	return func(r *Runner) error {
+		if !effort.Valid() {
+			return fmt.Errorf("axe: invalid reasoning effort %q", effort)
+		}
+		r.ModelConfig.ReasoningEffort = effort
+		return nil
+	}
+}
+
 func WithMaxSteps(maxSteps int) RunnerOption {
 	return func(r *Runner) error {
 		r.MaxSteps = maxSteps
@@ -25,6 +156,19 @@ func WithMaxSteps(maxSteps int) RunnerOption {
 	}
 }
 
+// WithStepReminder tells the agent how many steps it has left, and to prioritize finalizing the
+// task, at each of its last steps before MaxSteps: once remaining or fewer are left. The reminder is
+// part of the request of the step only.
+func WithStepReminder(remaining int) RunnerOption {
+	return func(r *Runner) error {
+		if remaining < 0 {
+			return fmt.Errorf("axe: negative step reminder %d", remaining)
+		}
+		r.StepReminder = remaining
+		return nil
+	}
+}
+
 func WithTools(tools []clitool.Definition) RunnerOption {
 	return func(r *Runner) error {
 		r.Tools = tools
@@ -32,6 +176,206 @@ func WithTools(tools []clitool.Definition) RunnerOption {
 	}
 }
 
+// WithCodeInputLimits limits the size of the files rendered into the prompt. Oversized files are
+// skipped, excerpted or outlined according to limits.Strategy; with limits.OutlineGo all Go files
+// are outlined. The agent gets the fetch_function tool to read full declarations.
+func WithCodeInputLimits(limits container.InputLimits) RunnerOption {
+	return func(r *Runner) error {
+		if limits.MaxFileBytes < 0 || limits.MaxTotalBytes < 0 {
+			return errors.New("axe: code input limits must not be negative")
+		}
+		r.CodeInputLimits = limits
+		return nil
+	}
+}
+
+// WithContextBudget keeps reserve (e.g. 0.3) of the model's context window for the conversation
+// and tool outputs, and gives the code input what is left after the rest of the prompt. When the
+// files don't fit, those least relevant to the instruction (by the words they share with it) are
+// reduced first, according to the strategy of WithCodeInputLimits, whose MaxTotalBytes still caps
+// the code input. The window comes from the model's registered capabilities.
+func WithContextBudget(reserve float64) RunnerOption {
+	return func(r *Runner) error {
+		if reserve <= 0 || reserve >= 1 {
+			return errors.New("axe: context reserve must be between 0 and 1")
+		}
+		r.ContextReserve = reserve
+		return nil
+	}
+}
+
+// WithRepoMap adds a map of the repository to the prompt: every file of the code container's base
+// directory (the working directory without one), with the exported symbols of Go files, bounded by
+// opts.MaxBytes. The agent gets the open_files tool to load and edit the files it needs beyond the
+// ones in the container.
+func WithRepoMap(opts repomap.Options) RunnerOption {
+	return func(r *Runner) error {
+		r.RepoMap = &opts
+		return nil
+	}
+}
+
+// WithEditFormat sets the format of the agent's edits: the apply_edit documentation, the parser and
+// the prompt follow it. Smaller models that can't reliably produce v4a patches do better with
+// container.EditFormatWholeFile, at the cost of more output tokens.
+func WithEditFormat(format container.EditFormat) RunnerOption {
+	return func(r *Runner) error {
+		if !format.Valid() {
+			return fmt.Errorf("axe: unknown edit format %q", format)
+		}
+		r.EditFormat = format
+		return nil
+	}
+}
+
+// WithFewShotExamples shows the model worked examples of correct apply_edit calls in the edit
+// format, in the system prompt or as prior turns of the conversation (see FewShotMode), which
+// greatly improves how well small models follow the patch format. Without examples, the curated
+// ones of code.EditExamples are used. Read-only runs get no examples.
+func WithFewShotExamples(mode FewShotMode, examples ...code.EditExample) RunnerOption {
+	return func(r *Runner) error {
+		if mode != FewShotSystem && mode != FewShotTurns {
+			return fmt.Errorf("axe: unknown few-shot mode %q", mode)
+		}
+		r.FewShot, r.FewShotExamples = mode, examples
+		return nil
+	}
+}
+
+// WithExternalChangePolicy protects files edited on disk while the agent runs: instead of
+// overwriting them, applying the agent's edits fails, reloads the files or merges the changes.
+func WithExternalChangePolicy(policy container.ExternalChangePolicy) RunnerOption {
+	return func(r *Runner) error {
+		r.ExternalChangePolicy = policy
+		return nil
+	}
+}
+
+// WithCompileCheck runs argv, "go build ./..." when empty, in the base directory after every
+// apply_edit and reports the result in the tool response, so the model learns it broke the build
+// without spending a tool call.
+func WithCompileCheck(argv ...string) RunnerOption {
+	return func(r *Runner) error {
+		if len(argv) == 0 {
+			argv = []string{"go", "build", "./..."}
+		}
+		r.EditCheck = argv
+		return nil
+	}
+}
+
+// WithNewFilePolicy limits the files apply_edit may create: where, with which extensions, how large
+// and how many per run. Edits creating a file the policy rejects are not applied, and the model is
+// told why.
+func WithNewFilePolicy(policy code.NewFilePolicy) RunnerOption {
+	return func(r *Runner) error {
+		if policy.MaxBytes < 0 || policy.MaxFiles < 0 {
+			return errors.New("axe: new file policy limits must not be negative")
+		}
+		r.NewFilePolicy = &policy
+		return nil
+	}
+}
+
+// WithPatchOptions sets how apply_edit matches the context of v4a patches: SearchWindow prefers a
+// match near the previous chunk, MinSimilarity accepts contexts that are only similar to the file,
+// e.g. after a rename the model didn't see.
+func WithPatchOptions(opts v4a.Options) RunnerOption {
+	return func(r *Runner) error {
+		if opts.SearchWindow < 0 {
+			return errors.New("axe: patch search window must not be negative")
+		}
+		if opts.MinSimilarity < 0 || opts.MinSimilarity > 1 {
+			return errors.New("axe: patch minimum similarity must be between 0 and 1")
+		}
+		r.PatchOptions = opts
+		return nil
+	}
+}
+
+// WithQuota limits how much apply_edit may change in a run: the lines added and removed, and the
+// files deleted, counted from the files as they were before the first edit. Edits that would exceed
+// it are not applied, and the model is told by how much, which guards against patches deleting
+// most of the repository.
+func WithQuota(quota code.Quota) RunnerOption {
+	return func(r *Runner) error {
+		if quota.MaxChangedLines < 0 || quota.MaxDeletedFiles < 0 {
+			return errors.New("axe: quota limits must not be negative")
+		}
+		r.Quota = &quota
+		return nil
+	}
+}
+
+// WithProtectedPaths protects files from the agent, e.g. "go.mod", ".github/**" or "vendor/**":
+// apply_edit and the other tools editing the code container reject changes of them, and the git
+// commit and branch tools among the extra tools refuse to commit or check out changes of them. The
+// model is told which path is protected. Globs are relative to the base directory, see
+// container.MatchGlob.
+func WithProtectedPaths(globs []string) RunnerOption {
+	return func(r *Runner) error {
+		for _, g := range globs {
+			if _, err := path.Match(g, ""); err != nil {
+				return fmt.Errorf("axe: protected path %q: %w", g, err)
+			}
+		}
+		r.ProtectedPaths = append(r.ProtectedPaths, globs...)
+		return nil
+	}
+}
+
+// WithBaseEnvironment sets environment variables for every CLI tool and the compile check, e.g.
+// GOFLAGS=-mod=mod or CI=true, so they need not be repeated on each definition. The Env of a
+// definition takes precedence. Calls accumulate.
+func WithBaseEnvironment(env map[string]string) RunnerOption {
+	return func(r *Runner) error {
+		r.BaseEnv = clitool.MergeEnv(r.BaseEnv, env)
+		return nil
+	}
+}
+
+// WithExtraTools adds tools other than CLI definitions, such as the git suite from tools/git.
+// Tool names must not collide with the built-in or CLI tools.
+func WithExtraTools(tools ...tool.InvokableTool) RunnerOption {
+	return func(r *Runner) error {
+		r.ExtraTools = append(r.ExtraTools, tools...)
+		return nil
+	}
+}
+
+// WithParallelTools runs up to n CLI tool calls concurrently when the model makes several in one
+// response, e.g. running the tests of two packages. Tools that edit the code or the changelog still
+// run one at a time. Output chunks carry the CallID of the call they belong to.
+func WithParallelTools(n int) RunnerOption {
+	return func(r *Runner) error {
+		r.ParallelTools = n
+		return nil
+	}
+}
+
+// WithToolPolicy restricts which tools the agent may call (allow list, deny list, per-tool call
+// limits). Rejected calls are explained to the model instead of being executed.
+func WithToolPolicy(policy ToolPolicy) RunnerOption {
+	return func(r *Runner) error {
+		r.ToolPolicy = &policy
+		return nil
+	}
+}
+
+// WithRepeatLimit stops the agent from looping on the same tool call: after n identical calls in
+// a row (same tool, same arguments), further ones are not run and the model is told to change
+// strategy or finalize. With abort, an identical call after that message aborts the run with
+// ErrRepeatedToolCalls.
+func WithRepeatLimit(n int, abort bool) RunnerOption {
+	return func(r *Runner) error {
+		if n < 0 {
+			return errors.New("axe: repeat limit must not be negative")
+		}
+		r.RepeatLimit, r.AbortOnRepeat = n, abort
+		return nil
+	}
+}
+
 func WithHistory(historyFilePath string) RunnerOption {
 	return func(r *Runner) error {
 		var err error
@@ -43,6 +387,54 @@ func WithHistory(historyFilePath string) RunnerOption {
 	}
 }
 
+// WithInstructionTurns processes the instructions in order as separate turns of one conversation.
+// The agent finalizes every instruction before it gets the next one, with the code as it is then;
+// if it fails one, the run stops and the instructions left are added to the changelog TODO.
+func WithInstructionTurns(turns bool) RunnerOption {
+	return func(r *Runner) error {
+		r.InstructionTurns = turns
+		return nil
+	}
+}
+
+// WithInstructionSources adds instructions read when each run starts, before the instructions given
+// to NewRunner: files with InstructionFile, an embedded FS with InstructionFS, or URLs with
+// InstructionURL. Sources cache what they read, so runners reused across runs only read changes.
+func WithInstructionSources(sources ...InstructionSource) RunnerOption {
+	return func(r *Runner) error {
+		for _, source := range sources {
+			if source == nil {
+				return errors.New("axe: nil instruction source")
+			}
+		}
+		r.InstructionSources = append(r.InstructionSources, sources...)
+		return nil
+	}
+}
+
+// WithInstructionVariables makes the instructions Jinja2 templates, the engine of the prompts,
+// filled with vars: a task stored in a config as "Fix bug {{ ticket }} in {{ package }}" is run with
+// {"ticket": "AXE-12", "package": "history"}. A variable the templates use but vars lacks is an
+// error of NewRunner; test optional ones with "is defined". Calls accumulate variables.
+func WithInstructionVariables(vars map[string]any) RunnerOption {
+	return func(r *Runner) error {
+		if r.InstructionVars == nil {
+			r.InstructionVars = make(map[string]any, len(vars))
+		}
+		maps.Copy(r.InstructionVars, vars)
+		return nil
+	}
+}
+
+// WithCarryOverTODO prepends the TODO left by the last run, if any, to the instructions as
+// "Previously incomplete: ...", so successive runs continue unfinished work.
+func WithCarryOverTODO(carryOver bool) RunnerOption {
+	return func(r *Runner) error {
+		r.CarryOverTODO = carryOver
+		return nil
+	}
+}
+
 func WithMinInterval(minInterval time.Duration) RunnerOption {
 	return func(r *Runner) error {
 		r.MinInterval = minInterval
@@ -57,16 +449,420 @@ func WithSink(sink io.Writer) RunnerOption {
 	}
 }
 
+// WithSinks adds writers that receive the full run output, in addition to the one set by WithSink.
+func WithSinks(sinks ...io.Writer) RunnerOption {
+	return func(r *Runner) error {
+		for _, w := range sinks {
+			r.Sinks = append(r.Sinks, NamedSink{Name: fmt.Sprintf("sink-%d", len(r.Sinks)), Writer: w})
+		}
+		return nil
+	}
+}
+
+// WithNamedSinks adds sinks that may filter which kinds of output they receive, e.g. agent text
+// only on the console and the full transcript in a file:
+//
+//	axe.WithNamedSinks(axe.ConsoleSink(axe.OutputKindAgent), axe.FileSink("transcript.log"))
+func WithNamedSinks(sinks ...NamedSink) RunnerOption {
+	return func(r *Runner) error {
+		r.Sinks = append(r.Sinks, sinks...)
+		return nil
+	}
+}
+
 func WithOutputBufferSize(bufferSize int) RunnerOption {
 	return func(r *Runner) error {
-		r.Output = make(chan string, bufferSize)
+		r.Output = make(chan OutputChunk, bufferSize)
+		return nil
+	}
+}
+
+// WithOutputPolicy sets how sends on the Output channel behave when it is full (block, block with
+// timeout, drop oldest, spill to disk), so slow sinks can't stall the agent loop.
+func WithOutputPolicy(policy OutputPolicy) RunnerOption {
+	return func(r *Runner) error {
+		r.OutputPolicy = policy
 		return nil
 	}
 }
 
+// WithKeepHistory keeps the changelogs of previous runs in the history file when true; otherwise
+// each run replaces them with its own. Without other limits every changelog is kept.
 func WithKeepHistory(keepHistory bool) RunnerOption {
 	return func(r *Runner) error {
 		r.KeepHistory = keepHistory
 		return nil
 	}
 }
+
+// WithKeepLastRuns keeps the changelogs of the last n runs, n included.
+func WithKeepLastRuns(n int) RunnerOption {
+	return func(r *Runner) error {
+		if n <= 0 {
+			return errors.New("axe: number of runs to keep must be positive")
+		}
+		r.KeepHistory = true
+		r.HistoryRetention.MaxChangelogs = n
+		return nil
+	}
+}
+
+// WithKeepFailedRuns keeps the changelogs of runs that didn't succeed, and the last one whatever
+// its outcome. It combines with WithKeepLastRuns, which then counts the runs kept.
+func WithKeepFailedRuns() RunnerOption {
+	return func(r *Runner) error {
+		r.KeepHistory = true
+		r.HistoryRetention.FailuresOnly = true
+		return nil
+	}
+}
+
+// WithHistoryRetention bounds the history file when KeepHistory is set. Pruned changelogs are
+// dropped, or gzip-archived next to the history file when retention.Archive is true. It replaces
+// the limits set by WithKeepLastRuns and WithKeepFailedRuns.
+func WithHistoryRetention(retention history.Retention) RunnerOption {
+	return func(r *Runner) error {
+		r.HistoryRetention = retention
+		return nil
+	}
+}
+
+// WithHistoryEncoding caps the run output, report and diff of every changelog written to the
+// history file and stores the entries above encoding.CompressAbove bytes gzip-compressed and base64
+// encoded, so the history file stays small without losing restore points.
+func WithHistoryEncoding(encoding history.Encoding) RunnerOption {
+	return func(r *Runner) error {
+		if encoding.MaxEntryBytes < 0 || encoding.CompressAbove < 0 {
+			return errors.New("axe: history encoding limits must not be negative")
+		}
+		r.HistoryEncoding = encoding
+		return nil
+	}
+}
+
+// WithLogLimit truncates the run output stored in each changelog to limit.MaxBytes, keeping its
+// head and/or tail, so long transcripts don't balloon the history file.
+func WithLogLimit(limit history.LogLimit) RunnerOption {
+	return func(r *Runner) error {
+		if limit.MaxBytes < 0 {
+			return errors.New("axe: log limit must not be negative")
+		}
+		r.LogLimit = limit
+		return nil
+	}
+}
+
+// WithLogSummarizer stores the result of summarize instead of the run output in each changelog.
+// It runs after the agent finished, even when the run was interrupted.
+func WithLogSummarizer(summarize func(ctx context.Context, output string) (string, error)) RunnerOption {
+	return func(r *Runner) error {
+		r.LogSummarizer = summarize
+		return nil
+	}
+}
+
+// WithModelSummary makes a call to a cheap model (DefaultSummaryModel when model is empty) after
+// each run to summarize its output into a short changelog entry (what changed, why, follow-ups),
+// stored in the history instead of the raw output. It replaces any LogSummarizer.
+func WithModelSummary(model ModelName) RunnerOption {
+	return func(r *Runner) error {
+		r.SummaryModel = model
+		r.LogSummarizer = r.summarizeWithModel
+		return nil
+	}
+}
+
+// WithSummaryChatModel uses m for WithModelSummary instead of an OpenAI model, e.g. another
+// provider or a scripted model in tests.
+func WithSummaryChatModel(m model.BaseChatModel) RunnerOption {
+	return func(r *Runner) error {
+		r.SummaryChatModel = m
+		r.LogSummarizer = r.summarizeWithModel
+		return nil
+	}
+}
+
+// WithPostMortem asks a model, after each run that ends in failure or error, for a post-mortem of
+// its transcript: a guess at the root cause, changes to the instructions and missing tools. It is
+// saved in the changelog and the run report. m is the model to ask; when nil, the model of
+// WithModelSummary (DefaultSummaryModel unless set) is used.
+func WithPostMortem(m model.BaseChatModel) RunnerOption {
+	return func(r *Runner) error {
+		r.PostMortem = true
+		r.PostMortemModel = m
+		return nil
+	}
+}
+
+// WithLockTimeout sets how long Run waits for a concurrent run on the same history file to finish
+// before failing with history.ErrLocked. Zero fails immediately.
+func WithLockTimeout(timeout time.Duration) RunnerOption {
+	return func(r *Runner) error {
+		r.LockTimeout = timeout
+		return nil
+	}
+}
+
+// WithToolHeartbeat makes running CLI tools report elapsed time and output size to the sinks at the
+// given interval, so a hung command can be told apart from a slow one. See also Runner.Liveness.
+func WithToolHeartbeat(interval time.Duration) RunnerOption {
+	return func(r *Runner) error {
+		r.HeartbeatInterval = interval
+		return nil
+	}
+}
+
+// WithStallTimeout aborts a run with ErrStalled when neither model tokens nor tool activity are
+// observed for timeout, instead of hanging until the context times out. Combine it with
+// WithToolHeartbeat so the output of long-running commands keeps the run alive.
+func WithStallTimeout(timeout time.Duration) RunnerOption {
+	return func(r *Runner) error {
+		r.StallTimeout = timeout
+		return nil
+	}
+}
+
+// WithStallHandler calls onStall when the run stalls (see WithStallTimeout), e.g. to alert or to
+// look at Stall.Phase and Stall.Tools before deciding. The run is aborted if it returns true, and
+// reported again after another timeout without activity otherwise.
+func WithStallHandler(onStall func(ctx context.Context, stall Stall) (abort bool)) RunnerOption {
+	return func(r *Runner) error {
+		r.OnStall = onStall
+		return nil
+	}
+}
+
+// WithReport writes a JSON RunReport (run id, model, status, files touched, tool calls, token
+// usage, TODO) to path at the end of every run, for CI systems and other automation.
+func WithReport(path string) RunnerOption {
+	return func(r *Runner) error {
+		r.ReportPath = path
+		return nil
+	}
+}
+
+// WithDiffLimit clips the unified diff of the changes of a run, embedded in its report, to limit
+// bytes instead of DefaultDiffLimit. A negative limit leaves the diff out.
+func WithDiffLimit(limit int) RunnerOption {
+	return func(r *Runner) error {
+		r.DiffLimit = limit
+		return nil
+	}
+}
+
+// WithChangelogDiff also stores the diff of the changes of every run in its changelog, so the
+// history shows exactly what each run did. It is clipped like the diff of the report.
+func WithChangelogDiff() RunnerOption {
+	return func(r *Runner) error {
+		r.ChangelogDiff = true
+		return nil
+	}
+}
+
+// WithRestorePoints stores the previous content of the files every run changes in its
+// changelog, so Restore (or `axe restore`) can put them back when a run went wrong. Undoing a run
+// also undoes the runs after it, so keep the history (see WithKeepHistory).
+func WithRestorePoints() RunnerOption {
+	return func(r *Runner) error {
+		r.RestorePoints = true
+		return nil
+	}
+}
+
+// WithAuditLog appends every tool invocation (tool, arguments, working directory, exit code,
+// duration and a hash of the output returned to the model) to the JSONL file at path as an
+// AuditEntry, for compliance reviews of automated changes. Calls denied by the tool policy are
+// recorded too. Unlike the trace, one file holds the invocations of all runs.
+func WithAuditLog(path string) RunnerOption {
+	return func(r *Runner) error {
+		r.AuditLogPath = path
+		return nil
+	}
+}
+
+// WithVerbosity selects the output written to the sinks and recorded in the changelog logs:
+// VerbosityQuiet keeps only the final status, VerbosityNormal the agent's text and one line per
+// tool call and result, VerbosityVerbose (the default) everything.
+func WithVerbosity(v Verbosity) RunnerOption {
+	return func(r *Runner) error {
+		if !v.Valid() {
+			return fmt.Errorf("axe: invalid verbosity %d", v)
+		}
+		r.Verbosity = v
+		return nil
+	}
+}
+
+// WithProgress shows the run on out, normally os.Stdout, as a ProgressDisplay: the agent's text,
+// one line per tool call and a live status line. Use it instead of a raw console sink.
+func WithProgress(out io.Writer) RunnerOption {
+	return func(r *Runner) error {
+		d := NewProgressDisplay(out)
+		r.Sinks = append(r.Sinks, NamedSink{Name: "progress", Writer: d})
+		r.Callbacks = append(r.Callbacks, d.Handler())
+		return nil
+	}
+}
+
+// WithTrace writes every step of each run (prompt messages, model responses with their tool
+// calls, tool results) as JSON lines to <dir>/<run id>.jsonl, and records the path in the changelog.
+func WithTrace(dir string) RunnerOption {
+	return func(r *Runner) error {
+		r.TraceDir = dir
+		return nil
+	}
+}
+
+// WithEinoCallbacks attaches eino callback handlers to the agent execution, so existing eino
+// observability tooling can be used without touching react.AgentConfig.
+func WithEinoCallbacks(handlers ...callbacks.Handler) RunnerOption {
+	return func(r *Runner) error {
+		r.Callbacks = append(r.Callbacks, handlers...)
+		return nil
+	}
+}
+
+// WithAgentConfigMutator registers a function that may modify the react.AgentConfig built by the
+// runner (message modifiers, tool return policy, max steps, ...) before the agent is created.
+// Mutators run in registration order.
+func WithAgentConfigMutator(mutate func(*react.AgentConfig)) RunnerOption {
+	return func(r *Runner) error {
+		if mutate == nil {
+			return errors.New("axe: nil agent config mutator")
+		}
+		r.AgentConfigMutators = append(r.AgentConfigMutators, mutate)
+		return nil
+	}
+}
+
+// WithMessageModifier registers a transformation of the messages sent to the model at every step,
+// e.g. to append a reminder, trim old tool responses or add timestamps. The transformation only
+// applies to the request of the step: it returns a new slice, leaving the messages it is given,
+// and the conversation, unchanged. Modifiers run in registration order.
+func WithMessageModifier(modify react.MessageModifier) RunnerOption {
+	return func(r *Runner) error {
+		if modify == nil {
+			return errors.New("axe: nil message modifier")
+		}
+		r.MessageModifiers = append(r.MessageModifiers, modify)
+		return nil
+	}
+}
+
+// WithLogger routes the logs of the runner and its tools to logger instead of the global zerolog
+// logger. Every entry of a run carries a run_id field.
+func WithLogger(logger zerolog.Logger) RunnerOption {
+	return func(r *Runner) error {
+		r.Logger = &logger
+		return nil
+	}
+}
+
+// WithLogLevel sets the minimum level of this runner's logs, e.g. zerolog.InfoLevel to silence
+// debug output without changing the global level.
+func WithLogLevel(level zerolog.Level) RunnerOption {
+	return func(r *Runner) error {
+		r.LogLevel = &level
+		return nil
+	}
+}
+
+// WithRateLimit limits the runner's model requests to requestsPerMinute and the tokens they use to
+// tokensPerMinute (<= 0 means no limit), so batch jobs don't trip provider rate limits mid-run.
+// Use WithRateLimiter to share one limit between runners.
+func WithRateLimit(requestsPerMinute, tokensPerMinute int) RunnerOption {
+	return func(r *Runner) error {
+		if requestsPerMinute <= 0 && tokensPerMinute <= 0 {
+			return errors.New("axe: rate limit requires requests or tokens per minute")
+		}
+		r.RateLimiter = NewRateLimiter(requestsPerMinute, tokensPerMinute)
+		return nil
+	}
+}
+
+// WithRateLimiter makes the runner wait on limiter, which may be shared with other runners.
+func WithRateLimiter(limiter *RateLimiter) RunnerOption {
+	return func(r *Runner) error {
+		r.RateLimiter = limiter
+		return nil
+	}
+}
+
+// WithAskUser gives the agent an ask_user tool backed by fn, so it can ask for clarification
+// instead of guessing. Questions and answers are recorded in the changelog.
+func WithAskUser(fn ask.AskFunc) RunnerOption {
+	return func(r *Runner) error {
+		if fn == nil {
+			return errors.New("axe: nil ask function")
+		}
+		r.AskUser = fn
+		return nil
+	}
+}
+
+// WithAskUserStdin is WithAskUser asking on stdout and reading answers from stdin.
+func WithAskUserStdin() RunnerOption {
+	return WithAskUser(ask.StdinAsker(os.Stdin, os.Stdout))
+}
+
+// WithFinalizeValidators registers checks, e.g. finalize.GoBuildValidator, that run when the agent
+// finalizes the task with status success. On failure the agent gets the details and keeps working.
+func WithFinalizeValidators(validators ...finalize.Validator) RunnerOption {
+	return func(r *Runner) error {
+		for _, v := range validators {
+			if v.Check == nil {
+				return fmt.Errorf("axe: finalize validator %q has no check", v.Name)
+			}
+		}
+		r.FinalizeValidators = append(r.FinalizeValidators, validators...)
+		return nil
+	}
+}
+
+// WithReadOnly runs the agent without the apply_edit tool and asks it for an analysis (code review,
+// audit, architecture summary...) instead of code changes. The analysis is saved to the history,
+// the run report and, if outputPath is not empty, written to outputPath.
+func WithReadOnly(outputPath string) RunnerOption {
+	return func(r *Runner) error {
+		r.ReadOnly = true
+		r.AnalysisPath = outputPath
+		return nil
+	}
+}
+
+// WithResponseCache serves model requests from cache, keyed by model, generation parameters,
+// messages and tools. In CacheReadWrite mode new responses are stored; CacheReplay fails on a miss
+// and needs no API key, which makes runs deterministic, e.g. in integration tests with NewDirCache.
+func WithResponseCache(cache ResponseCache, mode CacheMode) RunnerOption {
+	return func(r *Runner) error {
+		if cache == nil {
+			return errors.New("axe: nil response cache")
+		}
+		r.ResponseCache = cache
+		r.CacheMode = mode
+		return nil
+	}
+}
+
+// WithChatModel makes the runner use m instead of an OpenAI model, e.g. another provider's eino
+// model or axetest.ScriptedModel in tests.
+func WithChatModel(m model.ToolCallingChatModel) RunnerOption {
+	return func(r *Runner) error {
+		if m == nil {
+			return errors.New("axe: nil chat model")
+		}
+		r.ChatModel = m
+		return nil
+	}
+}
+
+// WithExecutor runs the commands of CLI tools with e instead of subprocesses, e.g. a fake in tests.
+func WithExecutor(e clitool.Executor) RunnerOption {
+	return func(r *Runner) error {
+		if e == nil {
+			return errors.New("axe: nil executor")
+		}
+		r.Executor = e
+		return nil
+	}
+}
@@ -0,0 +1,237 @@
+package axe_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/flow/agent/react"
+	"github.com/cloudwego/eino/schema"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/v4a"
+	"github.com/stumble/axe/history"
+)
+
+func TestRunnerHistoryEncoding(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))
+	runner, err := axe.NewRunner(dir, []string{"do nothing"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithHistoryEncoding(history.Encoding{CompressAbove: 10}),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	raw, err := os.ReadFile(filepath.Join(dir, "history.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `encoding="gzip+base64"`)
+	saved, err := history.ReadHistoryFromFile(filepath.Join(dir, "history.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, runner.History.Changelogs[0].Logs, saved.Changelogs[0].Logs)
+
+	_, err = axe.NewRunner(dir, nil, nil, axe.WithHistoryEncoding(history.Encoding{CompressAbove: -1}))
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func TestRunnerPatchOptions(t *testing.T) {
+	dir := t.TempDir()
+	file := "func a() {\n\treturn 1  \n}\n\nfunc b() {\n\treturn 1\n}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), []byte(file), 0o644))
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Update File: a.go\n@@\n-\treturn 1\n+\treturn 2\n*** End Patch"),
+		axetest.Finalize("success", "a returns 2"),
+	)
+	code, err := cont.NewCodeContainerFromFS(dir, []string{"a.go"})
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"make a return 2"}, code,
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithPatchOptions(v4a.Options{SearchWindow: 3}),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	// the window prefers the return of a, which only matches ignoring whitespace, to the one of b
+	data, err := os.ReadFile(filepath.Join(dir, "a.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "func a() {\n\treturn 2\n}\n\nfunc b() {\n\treturn 1\n}\n", string(data))
+
+	_, err = axe.NewRunner(dir, []string{"x"}, code, axe.WithChatModel(model), axe.WithPatchOptions(v4a.Options{MinSimilarity: 2}))
+	assert.ErrorContains(t, err, "between 0 and 1")
+}
+
+func TestRunnerAgentConfigMutator(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: a.txt\n+a\n*** End Patch"),
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: b.txt\n+b\n*** End Patch"),
+		axetest.Finalize("success", "done"),
+	)
+	code, err := cont.NewCodeContainerInDir(dir, nil)
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"add files"}, code,
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithAgentConfigMutator(func(cfg *react.AgentConfig) {
+			modify := cfg.MessageModifier
+			cfg.MessageModifier = func(ctx context.Context, input []*schema.Message) []*schema.Message {
+				return append(modify(ctx, input), schema.UserMessage("Reminder: be brief."))
+			}
+		}),
+		axe.WithAgentConfigMutator(func(cfg *react.AgentConfig) {
+			assert.Equal(t, axe.DefaultMaxSteps, cfg.MaxStep, "mutators get the config built by the runner")
+			cfg.MaxStep = 2 // one model call and its tools
+		}),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.ErrorIs(t, result.Err, axe.ErrMaxSteps, "the mutated max steps end the run")
+
+	requests := model.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "Reminder: be brief.", requests[0][len(requests[0])-1].Content)
+	assert.Equal(t, 2, model.Remaining())
+
+	_, err = axe.NewRunner(dir, nil, code, axe.WithAgentConfigMutator(nil))
+	assert.Error(t, err)
+}
+
+func TestRunnerLogger(t *testing.T) {
+	// run returns the log entries of a run whose sink fails, which is logged as an error.
+	run := func(opts ...axe.RunnerOption) (string, []map[string]any) {
+		dir := t.TempDir()
+		var logs bytes.Buffer
+		code, err := cont.NewCodeContainerInDir(dir, nil)
+		require.NoError(t, err)
+		runner, err := axe.NewRunner(dir, []string{"add a.txt"}, code, append([]axe.RunnerOption{
+			axe.WithChatModel(axetest.NewScriptedModel(
+				axetest.ApplyEdit("*** Begin Patch\n*** Add File: a.txt\n+a\n*** End Patch"),
+				axetest.Finalize("success", "done"),
+			)),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+			axe.WithSinks(failingWriter{}),
+			axe.WithLogger(zerolog.New(&logs)),
+		}, opts...)...)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		require.NoError(t, err)
+
+		var entries []map[string]any
+		lines := bufio.NewScanner(&logs)
+		lines.Buffer(nil, 1<<20)
+		for lines.Scan() {
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(lines.Bytes(), &entry))
+			entries = append(entries, entry)
+		}
+		require.NoError(t, lines.Err())
+		return runner.RunID, entries
+	}
+	levels := func(entries []map[string]any) map[string]int {
+		counts := map[string]int{}
+		for _, entry := range entries {
+			counts[entry["level"].(string)]++
+		}
+		return counts
+	}
+
+	runID, entries := run()
+	require.NotEmpty(t, entries)
+	for _, entry := range entries {
+		assert.Equal(t, runID, entry["run_id"], entry["message"])
+	}
+	assert.Positive(t, levels(entries)["debug"])
+	assert.Positive(t, levels(entries)["error"])
+
+	_, entries = run(axe.WithLogLevel(zerolog.InfoLevel))
+	assert.Zero(t, levels(entries)["debug"], "entries below the level are dropped")
+	assert.Positive(t, levels(entries)["error"])
+}
+
+// finalizeCompletion answers chat completion requests with a finalize_task call, streamed or not.
+func finalizeCompletion(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Stream bool `json:"stream"`
+	}
+	_ = json.NewDecoder(req.Body).Decode(&body)
+	call := `{"id":"call_1","type":"function","function":{"name":"finalize_task","arguments":"{\"changelog\":\"done\",\"status\":\"success\"}"}}`
+	if !body.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","tool_calls":[`+call+`]},"finish_reason":"tool_calls"}]}`)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	_, _ = io.WriteString(w, `data: {"id":"1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,`+call[1:]+`]}}]}`+"\n\n")
+	_, _ = io.WriteString(w, `data: {"id":"1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`+"\n\n")
+	_, _ = io.WriteString(w, "data: [DONE]\n\n")
+}
+
+func TestRunnerEndpoint(t *testing.T) {
+	t.Setenv("OAI_MY_KEY", "test-key")
+	// run returns the URLs of the requests received by a server during a run with the options
+	// returned by opts for the server URL.
+	run := func(opts func(srvURL string) []axe.RunnerOption) []string {
+		var mu sync.Mutex
+		var urls []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			urls = append(urls, req.URL.String())
+			mu.Unlock()
+			finalizeCompletion(w, req)
+		}))
+		defer srv.Close()
+
+		dir := t.TempDir()
+		runner, err := axe.NewRunner(dir, []string{"do it"}, cont.NewCodeContainer(map[string]string{}), append([]axe.RunnerOption{
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+		}, opts(srv.URL)...)...)
+		require.NoError(t, err)
+		result, err := runner.Run(context.Background(), false)
+		require.NoError(t, err)
+		assert.True(t, result.Success())
+		mu.Lock()
+		defer mu.Unlock()
+		return urls
+	}
+
+	urls := run(func(srvURL string) []axe.RunnerOption {
+		return []axe.RunnerOption{axe.WithBaseURL(srvURL + "/v1")}
+	})
+	assert.Equal(t, []string{"/v1/chat/completions"}, urls)
+
+	// a proxy gets the absolute URL of the request
+	urls = run(func(srvURL string) []axe.RunnerOption {
+		return []axe.RunnerOption{axe.WithBaseURL("http://api.invalid/v1"), axe.WithProxy(srvURL)}
+	})
+	assert.Equal(t, []string{"http://api.invalid/v1/chat/completions"}, urls)
+
+	for _, bad := range []string{"", "api.openai.com/v1", "ftp://example.com", "http://", "http://a b"} {
+		_, err := axe.NewRunner(t.TempDir(), nil, nil, axe.WithBaseURL(bad))
+		assert.ErrorContains(t, err, "axe: base url", bad)
+		_, err = axe.NewRunner(t.TempDir(), nil, nil, axe.WithProxy(bad))
+		assert.ErrorContains(t, err, "axe: proxy url", bad)
+	}
+}
@@ -0,0 +1,190 @@
+package axe
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// OutputOverflow selects what happens when the Output channel is full because the sinks are slow.
+type OutputOverflow int
+
+const (
+	// OutputBlock blocks the sender until there is room. This is the default.
+	OutputBlock OutputOverflow = iota
+	// OutputBlockWithTimeout blocks up to OutputPolicy.Timeout, then drops the chunk.
+	OutputBlockWithTimeout
+	// OutputDropOldest discards the oldest buffered chunk to make room.
+	OutputDropOldest
+	// OutputSpillToDisk never blocks nor drops: chunks that don't fit are appended to a temporary
+	// file and replayed to the sinks in order.
+	OutputSpillToDisk
+)
+
+// DefaultOutputBlockTimeout is used by OutputBlockWithTimeout when OutputPolicy.Timeout is zero.
+const DefaultOutputBlockTimeout = time.Second
+
+// OutputPolicy configures backpressure handling on the Output channel.
+type OutputPolicy struct {
+	Overflow OutputOverflow
+	Timeout  time.Duration // for OutputBlockWithTimeout
+	SpillDir string        // for OutputSpillToDisk; defaults to os.TempDir()
+}
+
+// outputQueue applies an OutputPolicy to sends on the Output channel of a single run.
+type outputQueue struct {
+	ch     chan OutputChunk
+	policy OutputPolicy
+	log    zerolog.Logger
+
+	mu       sync.Mutex
+	dropped  int
+	spillW   *os.File
+	spillF   *os.File // the spill file opened for reading, read through spillR
+	spillR   *bufio.Reader
+	pending  int // chunks spilled to disk and not yet replayed
+	draining bool
+	drainWG  sync.WaitGroup
+}
+
+func newOutputQueue(ch chan OutputChunk, policy OutputPolicy, logger zerolog.Logger) *outputQueue {
+	return &outputQueue{ch: ch, policy: policy, log: logger}
+}
+
+func (q *outputQueue) send(chunk OutputChunk) {
+	switch q.policy.Overflow {
+	case OutputBlockWithTimeout:
+		timeout := q.policy.Timeout
+		if timeout <= 0 {
+			timeout = DefaultOutputBlockTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case q.ch <- chunk:
+		case <-timer.C:
+			q.drop()
+		}
+	case OutputDropOldest:
+		for {
+			select {
+			case q.ch <- chunk:
+				return
+			default:
+			}
+			select {
+			case <-q.ch:
+				q.drop()
+			default:
+			}
+		}
+	case OutputSpillToDisk:
+		q.spill(chunk)
+	default:
+		q.ch <- chunk
+	}
+}
+
+func (q *outputQueue) drop() {
+	q.mu.Lock()
+	q.dropped++
+	q.mu.Unlock()
+}
+
+// spill sends chunk directly when nothing is spilled and the channel has room; otherwise it is
+// appended to the spill file so ordering is preserved.
+func (q *outputQueue) spill(chunk OutputChunk) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == 0 {
+		select {
+		case q.ch <- chunk:
+			return
+		default:
+		}
+	}
+	if err := q.writeSpill(chunk); err != nil {
+		q.log.Error().Err(err).Msg("axe: spill output to disk, dropping chunk")
+		q.dropped++
+		return
+	}
+	q.pending++
+	if !q.draining {
+		q.draining = true
+		q.drainWG.Add(1)
+		go q.drain()
+	}
+}
+
+func (q *outputQueue) writeSpill(chunk OutputChunk) error {
+	if q.spillW == nil {
+		f, err := os.CreateTemp(q.policy.SpillDir, "axe-output-*.jsonl")
+		if err != nil {
+			return err
+		}
+		r, err := os.Open(f.Name())
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		q.spillW, q.spillF, q.spillR = f, r, bufio.NewReader(r)
+	}
+	line, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = q.spillW.Write(append(line, '\n'))
+	return err
+}
+
+// drain replays spilled chunks to the channel, blocking on the channel as needed.
+func (q *outputQueue) drain() {
+	defer q.drainWG.Done()
+	for {
+		q.mu.Lock()
+		if q.pending == 0 {
+			q.draining = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		var chunk OutputChunk
+		line, err := q.spillR.ReadBytes('\n')
+		if err == nil {
+			err = json.Unmarshal(line, &chunk)
+		}
+		if err != nil {
+			q.log.Error().Err(err).Msg("axe: read spilled output")
+		} else {
+			q.ch <- chunk
+		}
+
+		q.mu.Lock()
+		q.pending--
+		q.mu.Unlock()
+	}
+}
+
+// close waits for spilled output to be replayed, then closes the channel and removes the spill file.
+func (q *outputQueue) close() {
+	q.drainWG.Wait()
+	close(q.ch)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spillW != nil {
+		name := q.spillW.Name()
+		_ = q.spillW.Close()
+		_ = q.spillF.Close()
+		if err := os.Remove(name); err != nil {
+			q.log.Warn().Err(err).Msg("axe: remove output spill file")
+		}
+	}
+	if q.dropped > 0 {
+		q.log.Warn().Int("chunks", q.dropped).Msg("axe: output chunks dropped due to overflow policy")
+	}
+}
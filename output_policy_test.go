@@ -0,0 +1,70 @@
+package axe
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// texts returns the texts of the chunks left in the closed channel ch.
+func texts(ch chan OutputChunk) []string {
+	var out []string
+	for chunk := range ch {
+		out = append(out, chunk.Text)
+	}
+	return out
+}
+
+func TestOutputQueue_BlockWithTimeout(t *testing.T) {
+	ch := make(chan OutputChunk, 1)
+	q := newOutputQueue(ch, OutputPolicy{Overflow: OutputBlockWithTimeout, Timeout: 10 * time.Millisecond}, zerolog.Nop())
+	for _, text := range []string{"a", "b", "c"} {
+		q.send(OutputChunk{Text: text})
+	}
+	q.close()
+
+	assert.Equal(t, 2, q.dropped)
+	assert.Equal(t, []string{"a"}, texts(ch))
+}
+
+func TestOutputQueue_DropOldest(t *testing.T) {
+	ch := make(chan OutputChunk, 2)
+	q := newOutputQueue(ch, OutputPolicy{Overflow: OutputDropOldest}, zerolog.Nop())
+	for _, text := range []string{"a", "b", "c", "d"} {
+		q.send(OutputChunk{Text: text})
+	}
+	q.close()
+
+	assert.Equal(t, 2, q.dropped)
+	assert.Equal(t, []string{"c", "d"}, texts(ch))
+}
+
+func TestOutputQueue_SpillToDisk(t *testing.T) {
+	dir := t.TempDir()
+	ch := make(chan OutputChunk, 1)
+	q := newOutputQueue(ch, OutputPolicy{Overflow: OutputSpillToDisk, SpillDir: dir}, zerolog.Nop())
+	var want []string
+	for i := range 50 {
+		text := fmt.Sprintf("chunk %d", i)
+		want = append(want, text)
+		q.send(OutputChunk{Kind: OutputKindAgent, Text: text})
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "the chunks that don't fit are spilled")
+
+	got := make(chan []string)
+	go func() { got <- texts(ch) }()
+	q.close()
+
+	assert.Equal(t, want, <-got, "spilled chunks are replayed in order")
+	assert.Zero(t, q.dropped)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the spill file is removed")
+}
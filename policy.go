@@ -0,0 +1,35 @@
+package axe
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/stumble/axe/tools/finalize"
+)
+
+// ToolPolicy restricts which tools the agent may call during a run. Violations are not errors:
+// the tool call returns an explanation to the model instead of executing.
+// The finalize tool is always allowed so the agent can end the run.
+type ToolPolicy struct {
+	Allow          []string       // if non-empty, only these tools may be called
+	Deny           []string       // these tools may never be called; takes precedence over Allow
+	MaxInvocations map[string]int // maximum number of calls per tool within one run
+}
+
+// check returns a message explaining why the call is rejected, or "" when it is allowed.
+// calls is the number of times the tool was already called in this run.
+func (p *ToolPolicy) check(name string, calls int) string {
+	if p == nil || name == finalize.FinalizeToolName {
+		return ""
+	}
+	if slices.Contains(p.Deny, name) {
+		return fmt.Sprintf("axe: tool %q is not allowed in this run. Use a different tool or finalize the task.", name)
+	}
+	if len(p.Allow) > 0 && !slices.Contains(p.Allow, name) {
+		return fmt.Sprintf("axe: tool %q is not allowed in this run. Allowed tools: %v.", name, p.Allow)
+	}
+	if limit, ok := p.MaxInvocations[name]; ok && calls >= limit {
+		return fmt.Sprintf("axe: tool %q reached its limit of %d calls in this run. Do not call it again; continue with other tools or finalize the task.", name, limit)
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerProtectedPaths(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module m\n"), 0o644))
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Update File: go.mod\n-module m\n+module n\n*** End Patch"),
+		axetest.Finalize("failure", "go.mod is protected"),
+	)
+	code, err := cont.NewCodeContainerFromFS(dir, []string{"go.mod"})
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"rename the module"}, code,
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithProtectedPaths([]string{"go.mod", ".github/**"}),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	require.NoError(t, err)
+	assert.Equal(t, "module m\n", string(data))
+	assert.ErrorIs(t, code.Write("go.mod", "module n\n"), cont.ErrProtectedPath)
+
+	_, err = axe.NewRunner(dir, []string{"x"}, code, axe.WithChatModel(model), axe.WithProtectedPaths([]string{"[a"}))
+	assert.ErrorContains(t, err, `axe: protected path "[a"`)
+}
@@ -0,0 +1,93 @@
+package axe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/history"
+)
+
+const postMortemPrompt = `You diagnose failed runs of a coding agent, to help its user improve the setup of the next runs. You are given the instructions of the run, how it ended and its transcript: the agent's messages, its tool calls and their results.
+Answer with a JSON object, and nothing else, with these fields:
+"root_cause": your best guess of why the run failed, in one or two sentences.
+"instruction_changes": changes to the instructions that would have helped the agent, e.g. missing context or ambiguities to resolve. May be empty.
+"missing_tools": tools the agent needed but did not have, e.g. a command to run the tests. May be empty.
+Only state what the transcript supports.`
+
+// PostMortem is the diagnosis of a failed run, see WithPostMortem.
+type PostMortem struct {
+	RootCause          string   `json:"root_cause"`
+	InstructionChanges []string `json:"instruction_changes,omitempty"`
+	MissingTools       []string `json:"missing_tools,omitempty"`
+}
+
+func newPostMortem(pm *history.PostMortem) *PostMortem {
+	if pm == nil {
+		return nil
+	}
+	return &PostMortem{RootCause: pm.RootCause, InstructionChanges: pm.InstructionChanges, MissingTools: pm.MissingTools}
+}
+
+// postMortem asks the post-mortem model to diagnose a run that ended with status from its
+// instructions and output. It returns nil, without error, for runs that did not fail.
+func (r *Runner) postMortem(ctx context.Context, status RunStatus, agentErr error, instructions []string, output string) (*history.PostMortem, error) {
+	if !r.PostMortem || (status != RunStatusFailure && status != RunStatusError) {
+		return nil, nil
+	}
+	m, err := r.postMortemModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Instructions:\n%s\n\nOutcome: %s", strings.Join(instructions, "\n"), status)
+	if agentErr != nil {
+		fmt.Fprintf(&b, " (%v)", agentErr)
+	}
+	// the transcript must fit the model, its middle is the least useful part
+	name := r.SummaryModel
+	if name == "" {
+		name = DefaultSummaryModel
+	}
+	if caps, ok := LookupModel(name); ok && caps.ContextWindow > 0 && r.PostMortemModel == nil {
+		output = history.LogLimit{MaxBytes: caps.codeInputBudget()}.Apply(output)
+	}
+	fmt.Fprintf(&b, "\n\nTranscript:\n%s", output)
+	msg, err := m.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(postMortemPrompt),
+		schema.UserMessage(b.String()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("axe: post-mortem: %w", err)
+	}
+	var pm PostMortem
+	if err := json.Unmarshal([]byte(jsonObject(msg.Content)), &pm); err != nil {
+		return nil, fmt.Errorf("axe: post-mortem: %w", err)
+	}
+	if strings.TrimSpace(pm.RootCause) == "" {
+		return nil, errors.New("axe: post-mortem: no root cause")
+	}
+	return &history.PostMortem{RootCause: pm.RootCause, InstructionChanges: pm.InstructionChanges, MissingTools: pm.MissingTools}, nil
+}
+
+// postMortemModel returns PostMortemModel, or the model of WithModelSummary.
+func (r *Runner) postMortemModel(ctx context.Context) (model.BaseChatModel, error) {
+	if r.PostMortemModel != nil {
+		return withRateLimiter(toolCallingModel{r.PostMortemModel}, r.RateLimiter), nil
+	}
+	return r.summaryModel(ctx)
+}
+
+// jsonObject returns the JSON object of a model answer, which may be wrapped in a code fence.
+func jsonObject(s string) string {
+	start, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
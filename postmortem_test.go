@@ -0,0 +1,53 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+)
+
+func TestRunnerPostMortem(t *testing.T) {
+	dir := t.TempDir()
+	run := func(status string, diagnosis *axetest.ScriptedModel) *axe.RunResult {
+		runner, err := axe.NewRunner(dir, []string{"Fix the flaky test."}, cont.NewCodeContainer(map[string]string{}),
+			axe.WithChatModel(axetest.NewScriptedModel(axetest.Finalize(status, "could not reproduce the failure"))),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+			axe.WithPostMortem(diagnosis),
+		)
+		require.NoError(t, err)
+		res, err := runner.Run(context.Background(), false)
+		require.NoError(t, err)
+		return res
+	}
+
+	diagnosis := axetest.NewScriptedModel(axetest.Text("```json\n" + `{"root_cause": "The agent could not run the tests.", "instruction_changes": ["Name the flaky test."], "missing_tools": ["go test"]}` + "\n```"))
+	res := run("failure", diagnosis)
+	want := &history.PostMortem{RootCause: "The agent could not run the tests.", InstructionChanges: []string{"Name the flaky test."}, MissingTools: []string{"go test"}}
+	assert.Equal(t, want, res.Changelog.PostMortem)
+	assert.Equal(t, &axe.PostMortem{RootCause: want.RootCause, InstructionChanges: want.InstructionChanges, MissingTools: want.MissingTools}, res.Report.PostMortem)
+	saved, err := history.ReadHistoryFromFile(filepath.Join(dir, "history.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, want, saved.Changelogs[0].PostMortem)
+	requests := diagnosis.Requests()
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0][1].Content, "Instructions:\nFix the flaky test.\n\nOutcome: failure")
+	assert.Contains(t, requests[0][1].Content, "could not reproduce the failure")
+
+	diagnosis = axetest.NewScriptedModel()
+	res = run("success", diagnosis)
+	assert.Nil(t, res.Changelog.PostMortem)
+	assert.Empty(t, diagnosis.Requests(), "successful runs get no post-mortem")
+
+	res = run("failure", axetest.NewScriptedModel(axetest.Text("I don't know.")))
+	assert.Nil(t, res.Changelog.PostMortem, "an invalid post-mortem is not saved")
+}
@@ -0,0 +1,243 @@
+package axe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+)
+
+// progressTick is how often the status line is redrawn to advance the elapsed time.
+const progressTick = 250 * time.Millisecond
+
+// ProgressDisplay is a terminal sink that keeps a status line (step, active tool call with its
+// streamed arguments, elapsed time, token usage) at the bottom of the output, above which it prints
+// the agent's text and one line per finished tool call, instead of the raw interleaved output.
+// It uses ANSI escape codes, so out should be a terminal. Install it with WithProgress.
+type ProgressDisplay struct {
+	out   io.Writer
+	width int // columns of the status line
+
+	mu          sync.Mutex
+	started     time.Time // zero between runs
+	steps       int
+	tokens      int
+	tool        string    // tool call being streamed or executed
+	toolStarted time.Time // when its header arrived
+	args        string    // tail of its streamed arguments
+	midLine     bool      // the agent's text doesn't end with a newline, so no status is drawn
+	statusShown bool
+	stop        chan struct{}
+}
+
+// NewProgressDisplay returns a display writing to out, sized to $COLUMNS or 100 columns.
+func NewProgressDisplay(out io.Writer) *ProgressDisplay {
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width < 20 {
+		width = 100
+	}
+	return &ProgressDisplay{out: out, width: width}
+}
+
+// Write implements io.Writer for output without a kind, shown like runner status lines.
+func (p *ProgressDisplay) Write(b []byte) (int, error) {
+	return len(b), p.WriteChunk(OutputChunk{Kind: OutputKindRunner, Text: string(b)})
+}
+
+// WriteChunk implements ChunkWriter.
+func (p *ProgressDisplay) WriteChunk(chunk OutputChunk) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start()
+	p.clearStatus()
+	switch chunk.Kind {
+	case OutputKindAgent:
+		if chunk.Text == "" {
+			break
+		}
+		if !p.midLine && strings.TrimSpace(chunk.Text) == "" {
+			break // the newline ending every model response
+		}
+		fmt.Fprint(p.out, chunk.Text)
+		p.midLine = !strings.HasSuffix(chunk.Text, "\n")
+	case OutputKindToolCall:
+		if chunk.Tool != "" {
+			p.endLine()
+			p.tool, p.toolStarted, p.args = chunk.Tool, time.Now(), ""
+		} else if !strings.HasPrefix(chunk.Text, "Tool call ") {
+			p.args = tail(p.args+chunk.Text, p.width)
+		}
+	case OutputKindToolResult:
+		p.endLine()
+		name := chunk.Tool
+		if name == "" {
+			name = p.tool
+		}
+		elapsed := ""
+		if !p.toolStarted.IsZero() {
+			elapsed = " (" + time.Since(p.toolStarted).Round(100*time.Millisecond).String() + ")"
+		}
+		result := strings.TrimPrefix(chunk.Text, "Tool call response: ")
+		fmt.Fprintln(p.out, clip(fmt.Sprintf("  %s%s: %s", name, elapsed, firstLine(result)), p.width))
+		p.tool, p.toolStarted, p.args = "", time.Time{}, ""
+	case OutputKindHeartbeat, OutputKindPrompt:
+		// the status line already shows the running tool and the elapsed time
+	default:
+		if text := strings.TrimSpace(chunk.Text); text != "" {
+			p.endLine()
+			fmt.Fprintln(p.out, clip(text, p.width))
+		}
+	}
+	p.drawStatus()
+	return nil
+}
+
+// Handler returns the eino callback handler counting the steps and tokens of the run.
+func (p *ProgressDisplay) Handler() callbacks.Handler {
+	return NewModelCallbackHandler(p.onModelEvent)
+}
+
+func (p *ProgressDisplay) onModelEvent(_ context.Context, ev ModelEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started.IsZero() {
+		return // a stream drained after the run ended
+	}
+	p.steps++
+	if ev.TokenUsage != nil {
+		p.tokens += ev.TokenUsage.TotalTokens
+	}
+	p.clearStatus()
+	p.drawStatus()
+}
+
+// Flush ends the display of a run with a summary line. The runner calls it when the run ends.
+func (p *ProgressDisplay) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started.IsZero() {
+		return nil
+	}
+	close(p.stop)
+	p.clearStatus()
+	p.endLine()
+	_, err := fmt.Fprintf(p.out, "done in %s, %d steps, %s tokens\n", time.Since(p.started).Round(time.Second), p.steps, formatTokens(p.tokens))
+	p.started, p.steps, p.tokens = time.Time{}, 0, 0
+	p.tool, p.toolStarted, p.args = "", time.Time{}, ""
+	return err
+}
+
+// start starts the clock of a run on its first output.
+func (p *ProgressDisplay) start() {
+	if !p.started.IsZero() {
+		return
+	}
+	p.started = time.Now()
+	p.stop = make(chan struct{})
+	go p.tick(p.stop)
+}
+
+func (p *ProgressDisplay) tick(stop chan struct{}) {
+	t := time.NewTicker(progressTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			p.mu.Lock()
+			p.clearStatus()
+			p.drawStatus()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *ProgressDisplay) drawStatus() {
+	if p.midLine || p.started.IsZero() {
+		return
+	}
+	status := fmt.Sprintf("[step %d | %s | %s tokens]", p.steps, formatElapsed(time.Since(p.started)), formatTokens(p.tokens))
+	if p.tool != "" {
+		status += " " + p.tool
+		if args := strings.Join(strings.Fields(p.args), " "); args != "" {
+			status += ": " + args
+		}
+	} else {
+		status += " thinking"
+	}
+	fmt.Fprint(p.out, "\x1b[2m"+fitStatus(status, p.width-1)+"\x1b[0m")
+	p.statusShown = true
+}
+
+func (p *ProgressDisplay) clearStatus() {
+	if p.statusShown {
+		fmt.Fprint(p.out, "\r\x1b[K")
+		p.statusShown = false
+	}
+}
+
+// endLine terminates the agent's text so the next line starts at column 0.
+func (p *ProgressDisplay) endLine() {
+	if p.midLine {
+		fmt.Fprintln(p.out)
+		p.midLine = false
+	}
+}
+
+func formatElapsed(d time.Duration) string {
+	s := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+func formatTokens(n int) string {
+	if n < 1000 {
+		return strconv.Itoa(n)
+	}
+	return strconv.FormatFloat(float64(n)/1000, 'f', 1, 64) + "k"
+}
+
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	return s
+}
+
+// clip keeps the first n runes of s.
+func clip(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// tail keeps the last n bytes of s, on a rune boundary.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[len(s)-n:]
+	for len(s) > 0 && s[0]&0xC0 == 0x80 {
+		s = s[1:]
+	}
+	return s
+}
+
+// fitStatus shortens a status to n runes, keeping the counters and the end of the tool arguments,
+// their newest part.
+func fitStatus(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	head := strings.IndexByte(s, ']') + 1 // keep the counters
+	if hr := []rune(s[:head]); len(hr)+2 < n {
+		return string(hr) + " …" + string(r[len(r)-(n-len(hr)-2):])
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,94 @@
+package axe
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// screen returns what a terminal shows for out: erased lines are dropped, status styling removed.
+func screen(out string) string {
+	out = regexp.MustCompile(`[^\n]*\r\x1b\[K`).ReplaceAllString(out, "")
+	return strings.NewReplacer("\x1b[2m", "", "\x1b[0m", "").Replace(out)
+}
+
+func TestProgressDisplay(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("COLUMNS", "60")
+	p := NewProgressDisplay(&buf)
+
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindAgent, Text: "Let me look"}))
+	assert.Equal(t, "Let me look", buf.String(), "no status is drawn after a partial line")
+	p.mu.Lock()
+	p.started = p.started.Add(-90 * time.Second)
+	p.mu.Unlock()
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindToolCall, Tool: "go_test", CallID: "1"}))
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindToolCall, Text: `{"args":`}))
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindToolCall, Text: "\n  \"-run\"}"}))
+	assert.Equal(t, "Let me look\n[step 0 | 01:30 | 0 tokens] go_test: {\"args\": \"-run\"}", screen(buf.String()))
+	p.mu.Lock()
+	p.toolStarted = p.toolStarted.Add(-1500 * time.Millisecond)
+	p.mu.Unlock()
+
+	p.onModelEvent(context.Background(), ModelEvent{TokenUsage: &model.TokenUsage{TotalTokens: 1500}})
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindToolResult, Text: "Tool call response: ok\nPASS"}))
+	_, err := p.Write([]byte("retrying\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Let me look\n  go_test (1.5s): ok\nretrying\n[step 1 | 01:30 | 1.5k tokens] thinking", screen(buf.String()))
+
+	require.NoError(t, p.Flush())
+	assert.Equal(t, "Let me look\n  go_test (1.5s): ok\nretrying\ndone in 1m30s, 1 steps, 1.5k tokens\n", screen(buf.String()))
+
+	// the next run starts from zero
+	buf.Reset()
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindRunner, Text: "next\n"}))
+	require.NoError(t, p.Flush())
+	assert.Equal(t, "next\ndone in 0s, 0 steps, 0 tokens\n", screen(buf.String()))
+	require.NoError(t, p.Flush(), "flushing an idle display writes nothing")
+	assert.Equal(t, "next\ndone in 0s, 0 steps, 0 tokens\n", screen(buf.String()))
+}
+
+func TestProgressDisplay_Ticker(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProgressDisplay(&buf)
+	output := func() string {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return buf.String()
+	}
+	require.NoError(t, p.WriteChunk(OutputChunk{Kind: OutputKindRunner, Text: "start\n"}))
+	stop := p.stop
+	assert.Eventually(t, func() bool { return strings.Count(output(), "\r\x1b[K") >= 2 },
+		10*progressTick, progressTick/5, "the status line is redrawn while the run goes on")
+
+	require.NoError(t, p.Flush())
+	select {
+	case <-stop:
+	default:
+		t.Fatal("Flush doesn't stop the ticker")
+	}
+	flushed := output()
+	time.Sleep(3 * progressTick)
+	assert.Equal(t, flushed, output(), "nothing is drawn after Flush")
+}
+
+func TestProgressTruncation(t *testing.T) {
+	assert.Equal(t, "hé…", clip("héllo", 3))
+	assert.Equal(t, "héllo", clip("héllo", 5))
+
+	assert.Equal(t, "b", tail("aéb", 2), "a partial rune is dropped")
+	assert.Equal(t, "é", tail("éé", 3))
+	assert.Equal(t, "aéb", tail("aéb", 4))
+
+	status := "[1] tool: αβγδεζηθ"
+	assert.Equal(t, status, fitStatus(status, 18))
+	assert.Equal(t, "[1] …δεζηθ", fitStatus(status, 10), "the counters and the newest arguments are kept")
+	assert.Equal(t, "[1] ", fitStatus(status, 4))
+}
@@ -2,49 +2,200 @@ package axe
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/cloudwego/eino/components/prompt"
 	"github.com/cloudwego/eino/schema"
+	"github.com/nikolalohinski/gonja"
+	"github.com/nikolalohinski/gonja/config"
 
+	"github.com/stumble/axe/code/container"
 	"github.com/stumble/axe/tools/code"
 	"github.com/stumble/axe/tools/finalize"
 )
 
-func buildInitialMessages(ctx context.Context, r *Runner, codeInputXML string) ([]*schema.Message, error) {
+// userPrompt is the user message of every instruction.
+const userPrompt = `
+# Instruction: 
+{{ instruction }}
+
+# CodeInput: 
+{{ code_input }}
+{%- if repo_map %}
+
+# RepositoryMap:
+{{ repo_map }}
+{%- endif %}`
+
+func buildInitialMessages(ctx context.Context, r *Runner, instruction string, codeInput container.CodeInput) ([]*schema.Message, error) {
+	codeInputXML, err := codeInput.ToXML()
+	if err != nil {
+		return nil, fmt.Errorf("axe: build code input: %w", err)
+	}
+	repoMap, err := r.repositoryMap()
+	if err != nil {
+		return nil, fmt.Errorf("axe: build repository map: %w", err)
+	}
+	examples := r.fewShotExamples()
+	var systemExamples string
+	if r.FewShot == FewShotSystem && len(examples) > 0 {
+		if systemExamples, err = fewShotSystem(examples); err != nil {
+			return nil, err
+		}
+	}
+
 	sys := `You are Axe, a master-level principle software engineer. You read user's instruction and code, and you can use the available tools to follow the user's instruction exactly to achieve the goal. You always end with calling {finalize_tool} with proper arguments.
+{%- if read_only %}
+
+This is a read-only task: you cannot edit code. Study the code, use the tools to gather facts, and produce the analysis, review or report the user asks for.
+
+Fundamental Tools:
+1. To finish the task, use {{ finalize_tool }} and put your complete analysis, in Markdown, in its report argument. If you cannot complete the task, call it with status 'failure' and explain why.
+2. Additionally, you can call user-provided CLI tools when needed. Never use them to modify files.
+{%- if repo_map %}
+3. RepositoryMap lists all the files of the repository, with the exported symbols of Go files. To read files that are not in CodeInput, use {{ open_tool }}.
+{%- endif %}
+
+Rules:
+1. Reason about the plan before calling tools and cite file paths and line numbers explicitly.
+2. Base every statement on code you have read or tool output you have seen.
+{%- if partial_files %}
+3. Files in CodeInput with a mode attribute are not shown in full: "excerpt" omits the middle of the file, "outline" only lists declarations, "skipped" has no content. Use {{ fetch_tool }} to read the full source of Go functions, methods and types.
+{%- endif %}
+{%- else %}
 
 Fundamental Tools:
-1. To edit code, use {apply_tool}.
+1. To edit code, use {apply_tool}. To check a large or tricky patch first without applying it, use {{ validate_tool }}.
 2. To finish the task, use {finalize_tool}. If user's instruction is satisfied, call it with status 'success'. If you cannot complete the task, call it with status 'failure' and explain why.
 3. Additionally, you can call user-provided CLI tools when needed. Choose the appropriate tool at the right time.
+{%- if repo_map %}
+4. RepositoryMap lists all the files of the repository, with the exported symbols of Go files. To read or edit files that are not in CodeInput, open them first with {{ open_tool }}.
+{%- endif %}
 
 Rules:
 1. Reason about the plan before calling tools, cite file paths explicitly, follow CodeOutput XML schema strictly.
+{%- if edit_format == "whole_file" %}
+2. Every Rewrite element replaces the whole file: always write the complete content of the files you edit.
+{%- elif edit_format == "unified" %}
+2. Write unified diffs with a few lines of context around every change, copying context and removed lines exactly.
+{%- elif edit_format == "search_replace" %}
+2. Keep SEARCH/REPLACE blocks small, and copy the SEARCH lines exactly from the file.
+{%- else %}
 2. Prefer to use Add action instead of Update action to just completely rewrite the file. This is preferred. Unless your changes is very targeted and focused that only contains a few lines of code. (less than 20 lines of code).
+{%- endif %}
+{%- if partial_files %}
+3. Files in CodeInput with a mode attribute are not shown in full: "excerpt" omits the middle of the file, "outline" only lists declarations, "skipped" has no content. Never rewrite such a file with an Add action, only Update lines you have seen. Use {{ fetch_tool }} to read the full source of Go functions, methods and types before editing them.
+{%- endif %}
 
 CodeOutput XML schema:
 {{ code_output_xml_schema }}
-`
+{%- if examples %}
+Examples of correct {{ apply_tool }} calls:
 
-	usr := `
-# Instruction: 
-{{ instruction }}
-
-# CodeInput: 
-{{ code_input }}`
+{{ examples }}
+{%- endif %}
+{%- endif %}
+`
 
 	template := prompt.FromMessages(schema.Jinja2,
 		schema.SystemMessage(sys),
-		schema.UserMessage(usr),
+		schema.UserMessage(userPrompt),
 	)
-	instruction := strings.TrimSpace(strings.Join(r.Instructions, "\n"))
 	vars := map[string]any{
 		"apply_tool":             code.ApplyEditToolName,
-		"code_output_xml_schema": code.ApplyEditDoc,
+		"code_output_xml_schema": code.EditDoc(r.EditFormat),
+		"edit_format":            string(r.EditFormat),
+		"examples":               systemExamples,
 		"finalize_tool":          finalize.FinalizeToolName,
+		"fetch_tool":             code.FetchFunctionToolName,
+		"open_tool":              code.OpenFilesToolName,
+		"validate_tool":          code.ValidatePatchToolName,
 		"instruction":            instruction,
 		"code_input":             codeInputXML,
+		"partial_files":          hasPartialFiles(codeInput),
+		"read_only":              r.ReadOnly,
+		"repo_map":               strings.TrimRight(repoMap, "\n"),
+	}
+	messages, err := template.Format(ctx, vars)
+	if err != nil || r.FewShot != FewShotTurns || len(examples) == 0 {
+		return messages, err
+	}
+	turns, err := fewShotTurns(ctx, r.EditFormat, examples)
+	if err != nil {
+		return nil, err
+	}
+	// the examples come between the system prompt and the task
+	return slices.Concat(messages[:1], turns, messages[1:]), nil
+}
+
+// buildTurnMessage returns the user message of an instruction given in a later turn of the
+// conversation, with the code as it is now.
+func buildTurnMessage(ctx context.Context, instruction string, codeInput container.CodeInput) (*schema.Message, error) {
+	codeInputXML, err := codeInput.ToXML()
+	if err != nil {
+		return nil, fmt.Errorf("axe: build code input: %w", err)
+	}
+	msgs, err := prompt.FromMessages(schema.Jinja2, schema.UserMessage(userPrompt)).Format(ctx, map[string]any{
+		"instruction": instruction,
+		"code_input":  codeInputXML,
+		"repo_map":    "",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msgs[0], nil
+}
+
+// hasPartialFiles reports whether some files of the input were reduced by container.InputLimits.
+func hasPartialFiles(ci container.CodeInput) bool {
+	for _, f := range ci.Files {
+		if f.Mode != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// renderInstructions fills the instruction templates with vars. Undefined variables are errors
+// rather than empty strings, which would silently give the agent a different task.
+func renderInstructions(instructions []string, vars map[string]any) ([]string, error) {
+	cfg := config.NewConfig()
+	cfg.StrictUndefined = true
+	env := gonja.NewEnvironment(cfg, gonja.DefaultLoader)
+	rendered := make([]string, len(instructions))
+	for i, instruction := range instructions {
+		tpl, err := env.FromString(instruction)
+		if err != nil {
+			return nil, fmt.Errorf("axe: instruction %d: %w", i+1, err)
+		}
+		if rendered[i], err = tpl.Execute(vars); err != nil {
+			return nil, fmt.Errorf("axe: instruction %d: %w", i+1, err)
+		}
+	}
+	return rendered, nil
+}
+
+// turns returns the instruction of every turn of a run: the joined instructions, or each one with
+// InstructionTurns. The first is prefixed with the TODO of the last run when CarryOverTODO is set.
+func (r *Runner) turns(instructions []string) []string {
+	var turns []string
+	if r.InstructionTurns {
+		for _, instruction := range instructions {
+			if instruction = strings.TrimSpace(instruction); instruction != "" {
+				turns = append(turns, instruction)
+			}
+		}
+	}
+	if len(turns) == 0 {
+		turns = []string{strings.TrimSpace(strings.Join(instructions, "\n"))}
+	}
+	if !r.CarryOverTODO || r.History == nil || len(r.History.Changelogs) == 0 {
+		return turns
+	}
+	if todo := strings.TrimSpace(r.History.Changelogs[len(r.History.Changelogs)-1].TODO); todo != "" {
+		turns[0] = "Previously incomplete: " + todo + "\n\n" + turns[0]
 	}
-	return template.Format(ctx, vars)
+	return turns
 }
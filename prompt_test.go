@@ -0,0 +1,53 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+)
+
+func TestRunnerCarryOverTODO(t *testing.T) {
+	// firstPrompt runs "fix a" after a run which left todo and returns the first user message.
+	firstPrompt := func(t *testing.T, todo string, carryOver bool) string {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "history.xml")
+		hist := &history.History{FilePath: path}
+		hist.AppendChangelog(history.Changelog{Timestamp: time.Now(), Finalized: true, TODO: todo})
+		require.NoError(t, hist.SaveHistoryToFile())
+
+		model := axetest.NewScriptedModel(axetest.Finalize("success", "fixed"))
+		runner, err := axe.NewRunner(dir, []string{"fix a"}, cont.NewCodeContainer(map[string]string{}),
+			axe.WithChatModel(model),
+			axe.WithHistory(path),
+			axe.WithSink(io.Discard),
+			axe.WithCarryOverTODO(carryOver),
+		)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		require.NoError(t, err)
+
+		requests := model.Requests()
+		require.Len(t, requests, 1)
+		require.Len(t, requests[0], 2)
+		return requests[0][1].Content
+	}
+
+	assert.Contains(t, firstPrompt(t, "fix b", true), "# Instruction: \nPreviously incomplete: fix b\n\nfix a")
+	for name, prompt := range map[string]string{
+		"no TODO": firstPrompt(t, " ", true),
+		"off":     firstPrompt(t, "fix b", false),
+	} {
+		assert.Contains(t, prompt, "# Instruction: \nfix a", name)
+		assert.NotContains(t, prompt, "Previously incomplete", name)
+	}
+}
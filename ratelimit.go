@@ -0,0 +1,195 @@
+package axe
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// RateLimiter spaces out chat model requests and bounds the tokens they consume. One limiter can be
+// shared by several runners, e.g. through RunAll, so that together they stay under the provider's
+// limits.
+//
+// Requests are evenly spaced. Tokens are only known once a response arrives, so the usage it
+// reports is taken from a budget refilled continuously at tokensPerMinute; while the budget is
+// spent, requests wait. Waits are extended by a random jitter of up to 10% so that runners sharing
+// a limiter don't all fire at the same instant.
+//
+// A streamed response is charged the Usage.TotalTokens of every chunk carrying a usage. OpenAI
+// sends it once, in the last chunk; providers repeating the cumulative usage in every chunk are
+// overcounted, which only makes the limiter wait more than needed.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // between requests, 0 if unlimited
+	next     time.Time     // earliest time of the next request
+
+	tokensPerMinute int
+	tokens          float64   // available tokens, negative when overspent
+	refilledAt      time.Time // last time tokens was refilled
+}
+
+// NewRateLimiter returns a limiter allowing requestsPerMinute model requests and tokensPerMinute
+// total tokens per minute. A value <= 0 means no limit for that dimension.
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	l := &RateLimiter{}
+	if requestsPerMinute > 0 {
+		l.interval = time.Minute / time.Duration(requestsPerMinute)
+	}
+	if tokensPerMinute > 0 {
+		l.tokensPerMinute = tokensPerMinute
+		l.tokens = float64(tokensPerMinute)
+		l.refilledAt = time.Now()
+	}
+	return l
+}
+
+// Wait blocks until the next request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		wait, ok := l.reserve(time.Now())
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleepCtx(ctx, jitter(wait)); err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		// the token budget was spent, check again: other requests may have finished meanwhile
+	}
+}
+
+// reserve returns how long to wait before sending a request. ok reports whether the request slot
+// was taken; if not, the token budget is spent and the caller must wait and try again.
+func (l *RateLimiter) reserve(now time.Time) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokensPerMinute > 0 {
+		l.refill(now)
+		if l.tokens <= 0 {
+			perToken := time.Minute / time.Duration(l.tokensPerMinute)
+			return time.Duration(1-l.tokens) * perToken, false
+		}
+	}
+	if l.interval <= 0 {
+		return 0, true
+	}
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	return at.Sub(now), true
+}
+
+// refill adds the tokens earned since the last refill, capped at one minute worth of tokens.
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.refilledAt)
+	l.refilledAt = now
+	l.tokens = min(l.tokens+elapsed.Minutes()*float64(l.tokensPerMinute), float64(l.tokensPerMinute))
+}
+
+// Consume takes tokens used by a finished request from the budget.
+func (l *RateLimiter) Consume(tokens int) {
+	if l == nil || l.tokensPerMinute <= 0 || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.tokens -= float64(tokens)
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d + rand.N(d/10+1)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitedModel waits on the limiter before every request of the wrapped model.
+type rateLimitedModel struct {
+	inner   model.ToolCallingChatModel
+	limiter *RateLimiter
+}
+
+func withRateLimiter(m model.ToolCallingChatModel, limiter *RateLimiter) model.ToolCallingChatModel {
+	if limiter == nil {
+		return m
+	}
+	return &rateLimitedModel{inner: m, limiter: limiter}
+}
+
+func (m *rateLimitedModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if err := m.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("axe: wait for rate limiter: %w", err)
+	}
+	msg, err := m.inner.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.limiter.Consume(totalTokens(msg))
+	return msg, nil
+}
+
+func (m *rateLimitedModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if err := m.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("axe: wait for rate limiter: %w", err)
+	}
+	sr, err := m.inner.Stream(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// the usage arrives with the last chunks, charge it as soon as it is seen
+	return schema.StreamReaderWithConvert(sr, func(msg *schema.Message) (*schema.Message, error) {
+		m.limiter.Consume(totalTokens(msg))
+		return msg, nil
+	}), nil
+}
+
+func totalTokens(msg *schema.Message) int {
+	if msg == nil || msg.ResponseMeta == nil || msg.ResponseMeta.Usage == nil {
+		return 0
+	}
+	return msg.ResponseMeta.Usage.TotalTokens
+}
+
+func (m *rateLimitedModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	inner, err := m.inner.WithTools(tools)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedModel{inner: inner, limiter: m.limiter}, nil
+}
+
+// IsCallbacksEnabled and GetType forward to the wrapped model, so eino neither runs callbacks
+// twice nor loses the component type.
+func (m *rateLimitedModel) IsCallbacksEnabled() bool {
+	return components.IsCallbacksEnabled(m.inner)
+}
+
+func (m *rateLimitedModel) GetType() string {
+	typ, _ := components.GetType(m.inner)
+	return typ
+}
@@ -0,0 +1,53 @@
+package axe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_ReserveSpacing(t *testing.T) {
+	l := NewRateLimiter(60, 0)
+	t0 := time.Unix(1_000, 0)
+	for _, want := range []time.Duration{0, time.Second, 2 * time.Second} {
+		wait, ok := l.reserve(t0)
+		assert.True(t, ok)
+		assert.Equal(t, want, wait)
+	}
+	wait, ok := l.reserve(t0.Add(2500 * time.Millisecond))
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait, "the slot after the third request")
+	wait, _ = l.reserve(t0.Add(10 * time.Second))
+	assert.Zero(t, wait, "an idle limiter doesn't bank requests")
+	wait, _ = l.reserve(t0.Add(10 * time.Second))
+	assert.Equal(t, time.Second, wait)
+
+	wait, ok = NewRateLimiter(0, 0).reserve(t0)
+	assert.True(t, ok)
+	assert.Zero(t, wait)
+}
+
+func TestRateLimiter_ReserveTokens(t *testing.T) {
+	l := NewRateLimiter(0, 60) // a token per second
+	t0 := time.Unix(1_000, 0)
+	l.refilledAt = t0
+	l.tokens -= 100 // a response overspent the budget
+
+	wait, ok := l.reserve(t0)
+	assert.False(t, ok)
+	assert.Equal(t, 41*time.Second, wait, "until the budget is positive again")
+
+	wait, ok = l.reserve(t0.Add(15 * time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 26*time.Second, wait)
+	assert.Equal(t, -25.0, l.tokens)
+
+	wait, ok = l.reserve(t0.Add(45 * time.Second))
+	assert.True(t, ok)
+	assert.Zero(t, wait)
+	assert.Equal(t, 5.0, l.tokens)
+
+	l.reserve(t0.Add(time.Hour))
+	assert.Equal(t, 60.0, l.tokens, "the budget is capped at a minute of tokens")
+}
@@ -0,0 +1,54 @@
+package axe
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/tools/finalize"
+)
+
+// remainingSteps returns how many model calls of the agent execution whose messages are input,
+// this one included, can still call tools within maxSteps, and the tool calls made so far. eino
+// counts the model and the tools of every round as one step each, and the execution ends with a
+// model call after finalize_task. The execution started with the last user message.
+func remainingSteps(input []*schema.Message, maxSteps int) (steps, toolCalls int) {
+	start := 0
+	for i, msg := range slices.Backward(input) {
+		if msg.Role == schema.User {
+			start = i
+			break
+		}
+	}
+	rounds := 0
+	for _, msg := range input[start:] {
+		switch msg.Role {
+		case schema.Assistant:
+			rounds++
+		case schema.Tool:
+			toolCalls++
+		}
+	}
+	return max((maxSteps-1-2*rounds)/2, 0), toolCalls
+}
+
+// remindSteps appends a reminder to finalize the task to the messages of a model call when at most
+// StepReminder steps remain.
+func (r *Runner) remindSteps(input []*schema.Message, maxSteps int) []*schema.Message {
+	if r.StepReminder <= 0 {
+		return input
+	}
+	steps, toolCalls := remainingSteps(input, maxSteps)
+	if steps > r.StepReminder {
+		return input
+	}
+	unit := "steps"
+	if steps == 1 {
+		unit = "step"
+	}
+	r.log.Debug().Int("steps_remaining", steps).Msg("axe: step reminder")
+	reminder := fmt.Sprintf("Reminder: you have %d %s remaining (%d tool calls made so far). Prioritize finalizing: "+
+		"wrap up the work in progress and call %s, listing what is left in the todo.", steps, unit, toolCalls, finalize.FinalizeToolName)
+	return append(input, schema.UserMessage(reminder))
+}
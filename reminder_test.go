@@ -0,0 +1,49 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerStepReminder(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: a.txt\n+a\n*** End Patch"),
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: b.txt\n+b\n*** End Patch"),
+		axetest.Finalize("success", "done"),
+	)
+	code, err := cont.NewCodeContainerInDir(dir, nil)
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"Do the task."}, code,
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithMaxSteps(7),
+		axe.WithStepReminder(2),
+	)
+	require.NoError(t, err)
+	res, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.True(t, res.Success())
+
+	requests := model.Requests()
+	require.Len(t, requests, 3)
+	last := func(messages []*schema.Message) string { return messages[len(messages)-1].Content }
+	assert.NotContains(t, last(requests[0]), "Reminder:")
+	assert.Contains(t, last(requests[1]), "you have 2 steps remaining (1 tool calls made so far)")
+	assert.Contains(t, last(requests[2]), "you have 1 step remaining (2 tool calls made so far)")
+	assert.Len(t, requests[2], 2+4+1, "reminders are not kept in the conversation")
+
+	_, err = axe.NewRunner(dir, nil, cont.NewCodeContainer(nil), axe.WithStepReminder(-1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package axe
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/stumble/axe/tools/finalize"
+)
+
+// ErrRepeatedToolCalls is the cancellation cause of a run aborted because the agent kept repeating
+// the same tool call, wrapped in the error returned by the interrupted Run. See WithRepeatLimit.
+var ErrRepeatedToolCalls = errors.New("axe: repeated tool calls")
+
+// repeatTracker counts the consecutive calls of the agent to the same tool with the same arguments.
+type repeatTracker struct {
+	last    string
+	repeats int // calls identical to the last one, including it
+}
+
+// checkRepeat records a tool call and returns a message for the model instead of running it when
+// it repeats the previous call more than RepeatLimit times. With AbortOnRepeat, a call repeated
+// again after that message cancels the run.
+func (r *Runner) checkRepeat(name, argumentsInJSON string) string {
+	if r.RepeatLimit <= 0 || name == finalize.FinalizeToolName {
+		return ""
+	}
+	key := name + "\x00" + normalizeArguments(argumentsInJSON)
+	r.mu.Lock()
+	if r.repeats.last != key {
+		r.repeats = repeatTracker{last: key}
+	}
+	r.repeats.repeats++
+	n, cancel := r.repeats.repeats, r.cancelRun
+	r.mu.Unlock()
+	switch {
+	case n <= r.RepeatLimit:
+		return ""
+	case r.AbortOnRepeat && n > r.RepeatLimit+1 && cancel != nil:
+		r.log.Warn().Str("tool", name).Int("repeats", n).Msg("axe: aborting the run, the agent keeps repeating the same tool call")
+		cancel(fmt.Errorf("%w: %s called %d times in a row with the same arguments", ErrRepeatedToolCalls, name, n))
+		return "axe: the run is aborted because the same tool call was repeated. Stop now."
+	}
+	r.log.Warn().Str("tool", name).Int("repeats", n).Msg("axe: the agent repeats the same tool call")
+	return fmt.Sprintf("axe: you already called %q with these exact arguments %d times in a row; the result won't change. "+
+		"The call was not run. Change your strategy (other arguments, another tool, an edit) or finalize the task.", name, n-1)
+}
+
+// normalizeArguments returns arguments with their keys sorted and no insignificant spaces, so calls
+// differing only in formatting count as identical. Invalid JSON is returned as is.
+func normalizeArguments(argumentsInJSON string) string {
+	var v any
+	if err := json.Unmarshal([]byte(argumentsInJSON), &v); err != nil {
+		return argumentsInJSON
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return argumentsInJSON
+	}
+	return string(data)
+}
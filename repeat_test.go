@@ -0,0 +1,54 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+func TestRunnerRepeatLimit(t *testing.T) {
+	dir := t.TempDir()
+	call := axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./..."]`})
+	model := axetest.NewScriptedModel(call, call, call, axetest.Finalize("success", "tested"))
+	exec := axetest.NewFakeExecutor()
+	runner, err := axe.NewRunner(dir, []string{"test"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithRepeatLimit(2, false),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, axe.RunStatusSuccess, result.Status)
+	assert.Len(t, exec.Calls(), 2, "the third identical call is not run")
+	requests := model.Requests()
+	last := requests[len(requests)-1]
+	assert.Contains(t, last[len(last)-1].Content, "with these exact arguments 2 times in a row")
+
+	model = axetest.NewScriptedModel(call, call, call, axetest.Finalize("success", "tested"))
+	runner, err = axe.NewRunner(dir, []string{"test"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithExecutor(axetest.NewFakeExecutor()),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithRepeatLimit(1, true),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err = runner.Run(context.Background(), false)
+	require.ErrorIs(t, err, axe.ErrRepeatedToolCalls)
+	require.NotNil(t, result)
+	assert.Equal(t, axe.RunStatusInterrupted, result.Status)
+}
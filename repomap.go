@@ -0,0 +1,47 @@
+package axe
+
+import (
+	"maps"
+
+	"github.com/stumble/axe/code/repomap"
+)
+
+// repositoryMap returns the map of the repository for the prompt, "" without RepoMap. It is built
+// once per run: the files opened or added during the run are already listed.
+func (r *Runner) repositoryMap() (string, error) {
+	if r.RepoMap == nil {
+		return "", nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.repoMap != nil {
+		return *r.repoMap, nil
+	}
+	dir := r.State.Code.BaseDir()
+	if dir == "" {
+		dir = "."
+	}
+	m, err := repomap.Build(dir, *r.RepoMap)
+	if err != nil {
+		return "", err
+	}
+	r.repoMap = &m
+	return m, nil
+}
+
+// onFileOpened records the content of a file loaded by open_files, which the run didn't start with.
+func (r *Runner) onFileOpened(key, content string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.opened == nil {
+		r.opened = make(map[string]string)
+	}
+	r.opened[key] = content
+}
+
+// openedFiles returns the files loaded by open_files during the run, with their content on disk.
+func (r *Runner) openedFiles() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return maps.Clone(r.opened)
+}
@@ -0,0 +1,53 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/repomap"
+)
+
+func TestRunnerRepoMap(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "lib.go"), []byte("package lib\n\nfunc Helper() {}\n"), 0o644))
+	model := axetest.NewScriptedModel(
+		axetest.ToolCall("open_files", map[string]any{"paths": []string{"lib/lib.go", "missing.go"}}),
+		axetest.ApplyEdit("*** Begin Patch\n*** Update File: lib/lib.go\n package lib\n \n-func Helper() {}\n+func Helper() int { return 1 }\n*** End Patch"),
+		axetest.Finalize("success", "edited"),
+	)
+	code, err := cont.NewCodeContainerFromFS(dir, []string{"main.go"})
+	require.NoError(t, err)
+	runner, err := axe.NewRunner(dir, []string{"Make Helper return 1."}, code,
+		axe.WithChatModel(model),
+		axe.WithRepoMap(repomap.Options{Exclude: []string{"history.xml*"}}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	prompt := model.Requests()[0][1].Content
+	assert.Contains(t, prompt, "# RepositoryMap:\nlib/lib.go: func Helper\nmain.go")
+	assert.Contains(t, model.Requests()[0][0].Content, "open_files")
+	opened := model.Requests()[1]
+	response := opened[len(opened)-1].Content
+	assert.Contains(t, response, `<File path="lib/lib.go" hash=`)
+	assert.Contains(t, response, "missing.go")
+
+	assert.Equal(t, []axe.TouchedFile{{Path: "lib/lib.go", Action: "modified"}}, result.Report.FilesTouched)
+	data, err := os.ReadFile(filepath.Join(dir, "lib", "lib.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package lib\n\nfunc Helper() int { return 1 }\n", string(data))
+}
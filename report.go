@@ -0,0 +1,332 @@
+package axe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stumble/axe/code/render"
+	"github.com/stumble/axe/history"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// RunStatus is the final status of a run.
+type RunStatus string
+
+const (
+	RunStatusSuccess     RunStatus = "success"     // the agent finalized with status success
+	RunStatusFailure     RunStatus = "failure"     // the agent finalized with status failure, or ran out of steps
+	RunStatusError       RunStatus = "error"       // the agent execution failed
+	RunStatusIncomplete  RunStatus = "incomplete"  // the agent stopped without finalizing
+	RunStatusInterrupted RunStatus = "interrupted" // the run context was cancelled
+)
+
+// RunReport is the machine-readable summary of a run, written as JSON by WithReport.
+type RunReport struct {
+	RunID        string           `json:"run_id"`
+	Model        ModelName        `json:"model"`
+	Instructions []string         `json:"instructions"`
+	StartedAt    time.Time        `json:"started_at"`
+	FinishedAt   time.Time        `json:"finished_at"`
+	Status       RunStatus        `json:"status"`
+	Error        string           `json:"error,omitempty"`
+	TODO         string           `json:"todo,omitempty"`
+	FilesTouched []TouchedFile    `json:"files_touched"`
+	Steps        int              `json:"steps"` // model calls
+	ToolCalls    []ToolCallRecord `json:"tool_calls"`
+	TokenUsage   TokenUsage       `json:"token_usage"`
+	CostUSD      float64          `json:"cost_usd,omitempty"` // priced from the model's registered capabilities
+	Result       *TaskResult      `json:"result,omitempty"`
+	Analysis     string           `json:"analysis,omitempty"` // report of a read-only run
+	Diff         string           `json:"diff,omitempty"`     // unified diff of the changes, see Runner.DiffLimit
+	Manifest     *Manifest        `json:"manifest,omitempty"` // configuration to reproduce the run, see WithManifest
+	// PostMortem is the diagnosis of a failed run, see WithPostMortem.
+	PostMortem *PostMortem `json:"post_mortem,omitempty"`
+}
+
+// RunResult is the outcome of a run, returned by Run and Continue so callers can branch on it
+// without scraping the output.
+type RunResult struct {
+	RunID        string
+	Status       RunStatus
+	Changelog    history.Changelog // the changelog saved for the run
+	TODO         string            // what the agent left to do when finalizing
+	FilesChanged []TouchedFile
+	Steps        int // model calls
+	Duration     time.Duration
+	Usage        TokenUsage
+	Report       *RunReport // the full report, also returned by LastReport
+	// Err is the error that ended the execution of the agent, nil if it finished. Like the errors
+	// returned by Run, it wraps ErrMaxSteps, ErrBudgetExceeded or ErrModelRejected when it is one
+	// of them.
+	Err error
+}
+
+// Success reports whether the agent finalized the task with status success.
+func (res *RunResult) Success() bool {
+	return res != nil && res.Status == RunStatusSuccess
+}
+
+func newRunResult(report *RunReport, changelog history.Changelog, agentErr error) *RunResult {
+	return &RunResult{
+		RunID:        report.RunID,
+		Status:       report.Status,
+		Changelog:    changelog,
+		TODO:         report.TODO,
+		FilesChanged: report.FilesTouched,
+		Steps:        report.Steps,
+		Duration:     report.FinishedAt.Sub(report.StartedAt),
+		Usage:        report.TokenUsage,
+		Report:       report,
+		Err:          agentErr,
+	}
+}
+
+// TaskResult is the structured result the agent reported when finalizing the task.
+type TaskResult struct {
+	ModifiedFiles []string           `json:"modified_files,omitempty"`
+	TestsRun      []string           `json:"tests_run,omitempty"`
+	Metrics       map[string]float64 `json:"metrics,omitempty"`
+	Payload       json.RawMessage    `json:"payload,omitempty"`
+}
+
+func newTaskResult(res *history.Result) *TaskResult {
+	if res == nil {
+		return nil
+	}
+	out := &TaskResult{ModifiedFiles: res.ModifiedFiles, TestsRun: res.TestsRun}
+	if len(res.Metrics) > 0 {
+		out.Metrics = make(map[string]float64, len(res.Metrics))
+		for _, m := range res.Metrics {
+			out.Metrics[m.Name] = m.Value
+		}
+	}
+	if res.Payload != nil && json.Valid([]byte(res.Payload.Value)) {
+		out.Payload = json.RawMessage(res.Payload.Value)
+	}
+	return out
+}
+
+// TouchedFile is a file changed by the run.
+type TouchedFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // added, modified or deleted
+}
+
+// ToolCallRecord describes one tool invocation of the run.
+type ToolCallRecord struct {
+	Tool      string        `json:"tool"`
+	CallID    string        `json:"call_id,omitempty"` // id of the call in the model response
+	Arguments string        `json:"arguments"`
+	Workdir   string        `json:"workdir,omitempty"` // set for CLI tools
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration_ns"`
+	ExitCode  *int          `json:"exit_code,omitempty"` // set for CLI tools that ran
+	Error     string        `json:"error,omitempty"`
+}
+
+// TokenUsage accumulates the token usage reported by the model across all steps.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// ReasoningTokens is the part of CompletionTokens a reasoning model spent reasoning.
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+}
+
+// runStats collects what happens during a single run.
+type runStats struct {
+	mu        sync.Mutex
+	toolCalls []*ToolCallRecord
+	usage     TokenUsage
+	steps     int
+	streams   sync.WaitGroup // drains of streamed model outputs
+}
+
+type toolRecordKey struct{}
+
+func (s *runStats) startToolCall(ctx context.Context, name, callID, arguments string) (context.Context, *ToolCallRecord) {
+	rec := &ToolCallRecord{Tool: name, CallID: callID, Arguments: arguments, StartedAt: time.Now()}
+	s.mu.Lock()
+	s.toolCalls = append(s.toolCalls, rec)
+	s.mu.Unlock()
+	return context.WithValue(ctx, toolRecordKey{}, rec), rec
+}
+
+func (s *runStats) endToolCall(rec *ToolCallRecord, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec.Duration = time.Since(rec.StartedAt)
+	if err != nil {
+		rec.Error = err.Error()
+	}
+}
+
+// onToolOutcome attaches the exit code and working directory of a CLI tool to the record of the
+// current tool call.
+func (s *runStats) onToolOutcome(ctx context.Context, outcome clitool.Outcome) {
+	rec, ok := ctx.Value(toolRecordKey{}).(*ToolCallRecord)
+	if !ok || !outcome.Ran {
+		return
+	}
+	code := outcome.ExitCode
+	s.mu.Lock()
+	rec.ExitCode, rec.Workdir = &code, outcome.Workdir
+	s.mu.Unlock()
+}
+
+func (s *runStats) onModelEvent(_ context.Context, ev ModelEvent) {
+	if ev.TokenUsage == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage.PromptTokens += ev.TokenUsage.PromptTokens
+	s.usage.CompletionTokens += ev.TokenUsage.CompletionTokens
+	s.usage.TotalTokens += ev.TokenUsage.TotalTokens
+}
+
+func (s *runStats) addStep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps++
+}
+
+func (s *runStats) stepCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.steps
+}
+
+func (s *runStats) addReasoningTokens(tokens int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage.ReasoningTokens += tokens
+}
+
+func (s *runStats) snapshot() ([]ToolCallRecord, TokenUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]ToolCallRecord, 0, len(s.toolCalls))
+	for _, c := range s.toolCalls {
+		calls = append(calls, *c)
+	}
+	return calls, s.usage
+}
+
+func (s *runStats) countToolCalls(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.toolCalls {
+		if c.Tool == name {
+			n++
+		}
+	}
+	return n
+}
+
+// runStatus derives the final status from the agent error and the finalize outcome.
+func runStatus(agentErr error, interrupted, finalized, success bool) RunStatus {
+	switch {
+	case interrupted:
+		return RunStatusInterrupted
+	case agentErr != nil && !(finalized && errors.Is(agentErr, ErrMaxSteps)):
+		// an agent that ran out of steps is finalized as a failure by the runner
+		return RunStatusError
+	case !finalized:
+		return RunStatusIncomplete
+	case success:
+		return RunStatusSuccess
+	default:
+		return RunStatusFailure
+	}
+}
+
+// DefaultDiffLimit is the size in bytes the diff of a run is clipped to when Runner.DiffLimit is 0.
+const DefaultDiffLimit = 64 << 10
+
+// runDiff returns the unified diff of the files changed since the run started, clipped at a line
+// boundary to DiffLimit, or "" when disabled.
+func (r *Runner) runDiff(initialFiles map[string]string) string {
+	limit := r.DiffLimit
+	switch {
+	case limit < 0:
+		return ""
+	case limit == 0:
+		limit = DefaultDiffLimit
+	}
+	diff := render.Files(initialFiles, r.State.Code.Files(), render.Options{})
+	if len(diff) <= limit {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:limit], '\n') + 1
+	return diff[:cut] + fmt.Sprintf("... diff truncated, %d of %d bytes shown\n", cut, len(diff))
+}
+
+// diffFiles lists the files that differ between two container snapshots, sorted by path.
+func diffFiles(before, after map[string]string) []TouchedFile {
+	out := []TouchedFile{}
+	for p, content := range after {
+		old, ok := before[p]
+		switch {
+		case !ok:
+			out = append(out, TouchedFile{Path: p, Action: "added"})
+		case old != content:
+			out = append(out, TouchedFile{Path: p, Action: "modified"})
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			out = append(out, TouchedFile{Path: p, Action: "deleted"})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// WriteFile writes the report as indented JSON to path, creating parent directories.
+func (rep *RunReport) WriteFile(path string) error {
+	buf, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return fmt.Errorf("axe: marshal report: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("axe: create report dir: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, append(buf, '\n'), 0o600); err != nil {
+		return fmt.Errorf("axe: write report: %w", err)
+	}
+	return nil
+}
+
+// writeAnalysis writes the report of a read-only run to path, creating parent directories.
+func writeAnalysis(path, analysis string) error {
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("axe: create analysis dir: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(strings.TrimRight(analysis, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("axe: write analysis: %w", err)
+	}
+	return nil
+}
+
+// newRunID returns a sortable, unique identifier for a run.
+func newRunID() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b[:])
+}
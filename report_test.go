@@ -0,0 +1,54 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerReportDiff(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\n"), 0o644))
+	newRunner := func(opts ...axe.RunnerOption) *axe.Runner {
+		model := axetest.NewScriptedModel(
+			axetest.ApplyEdit("*** Begin Patch\n*** Update File: a.txt\n one\n-two\n+three\n*** Add File: b.txt\n+b\n*** End Patch"),
+			axetest.Finalize("success", "edited"),
+		)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\n"), 0o644))
+		_ = os.Remove(filepath.Join(dir, "b.txt"))
+		code, err := cont.NewCodeContainerFromFS(dir, []string{"a.txt"})
+		require.NoError(t, err)
+		runner, err := axe.NewRunner(dir, []string{"edit"}, code, append([]axe.RunnerOption{
+			axe.WithChatModel(model),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+		}, opts...)...)
+		require.NoError(t, err)
+		return runner
+	}
+
+	result, err := newRunner(axe.WithChangelogDiff()).Run(context.Background(), false)
+	require.NoError(t, err)
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n--- /dev/null\n+++ b/b.txt\n@@ -0,0 +1 @@\n+b\n\\ No newline at end of file\n"
+	assert.Equal(t, want, result.Report.Diff)
+	require.NotNil(t, result.Changelog.Diff)
+	assert.Equal(t, want, result.Changelog.Diff.Value)
+
+	result, err = newRunner(axe.WithDiffLimit(40)).Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n... diff truncated, 40 of 128 bytes shown\n", result.Report.Diff)
+	assert.Nil(t, result.Changelog.Diff, "the changelog only stores the diff with WithChangelogDiff")
+
+	result, err = newRunner(axe.WithDiffLimit(-1)).Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Empty(t, result.Report.Diff)
+}
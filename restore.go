@@ -0,0 +1,83 @@
+package axe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/stumble/axe/history"
+)
+
+// restorePoint returns the state before the run of the files it changed, for WithRestorePoints.
+func restorePoint(initialFiles, finalFiles map[string]string) *history.RestorePoint {
+	point := &history.RestorePoint{}
+	for _, f := range diffFiles(initialFiles, finalFiles) {
+		content, ok := initialFiles[f.Path]
+		state := history.FileState{Path: f.Path, Absent: !ok}
+		if ok {
+			state.Content = &history.LogEntry{Value: content}
+		}
+		point.Files = append(point.Files, state)
+	}
+	return point
+}
+
+// Restore undoes the run with id and every later run recorded in h by writing back the files they
+// changed as they were before, relative to baseDir. Runs must have been made with
+// WithRestorePoints. It returns the files it changed on disk; files already in their former state
+// are left alone. With dryRun, nothing is written.
+func Restore(baseDir string, h *history.History, runID string, dryRun bool) ([]TouchedFile, error) {
+	files, err := h.FilesBefore(runID)
+	if err != nil {
+		return nil, fmt.Errorf("axe: restore: %w", err)
+	}
+	out := []TouchedFile{}
+	for _, f := range files {
+		path := filepath.FromSlash(f.Path)
+		if baseDir != "" {
+			if !filepath.IsLocal(path) {
+				return out, fmt.Errorf("axe: restore: %s is outside the base dir %s", f.Path, baseDir)
+			}
+			path = filepath.Join(baseDir, path)
+		}
+		content := ""
+		if f.Content != nil {
+			content = f.Content.Value
+		}
+		current, err := os.ReadFile(path)
+		exists := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return out, fmt.Errorf("axe: restore: %w", err)
+		}
+		var action string
+		switch {
+		case f.Absent && exists:
+			action = "deleted"
+		case f.Absent:
+			continue
+		case !exists:
+			action = "added"
+		case string(current) == content:
+			continue
+		default:
+			action = "modified"
+		}
+		out = append(out, TouchedFile{Path: f.Path, Action: action})
+		if dryRun {
+			continue
+		}
+		if f.Absent {
+			err = os.Remove(path)
+		} else if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			// an existing file keeps its mode
+			err = os.WriteFile(path, []byte(content), 0o644)
+		}
+		if err != nil {
+			return out, fmt.Errorf("axe: restore: %w", err)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
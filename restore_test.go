@@ -0,0 +1,63 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+)
+
+func TestRunnerRestore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644))
+	historyPath := filepath.Join(dir, "history.xml")
+	run := func(patch string) string {
+		code, err := cont.NewCodeContainerFromFS(dir, []string{"a.txt"})
+		require.NoError(t, err)
+		runner, err := axe.NewRunner(dir, []string{"edit"}, code,
+			axe.WithChatModel(axetest.NewScriptedModel(axetest.ApplyEdit(patch), axetest.Finalize("success", "edited"))),
+			axe.WithRestorePoints(),
+			axe.WithHistory(historyPath),
+			axe.WithKeepHistory(true),
+			axe.WithSink(io.Discard),
+		)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		require.NoError(t, err)
+		return runner.RunID
+	}
+	first := run("*** Begin Patch\n*** Update File: a.txt\n-one\n+two\n*** Add File: b.txt\n+b\n*** End Patch")
+	second := run("*** Begin Patch\n*** Update File: a.txt\n-two\n+three\n*** End Patch")
+
+	h, err := history.ReadHistoryFromFile(historyPath)
+	require.NoError(t, err)
+	restored, err := axe.Restore(dir, h, second, true)
+	require.NoError(t, err)
+	assert.Equal(t, []axe.TouchedFile{{Path: "a.txt", Action: "modified"}}, restored)
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "three\n", string(data), "a dry run writes nothing")
+
+	restored, err = axe.Restore(dir, h, first, false)
+	require.NoError(t, err)
+	assert.Equal(t, []axe.TouchedFile{{Path: "a.txt", Action: "modified"}, {Path: "b.txt", Action: "deleted"}}, restored)
+	data, err = os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "one\n", string(data))
+	assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+
+	restored, err = axe.Restore(dir, h, first, false)
+	require.NoError(t, err)
+	assert.Empty(t, restored, "restoring twice changes nothing")
+	_, err = axe.Restore(dir, h, "missing", false)
+	assert.ErrorContains(t, err, "no run missing")
+}
@@ -0,0 +1,201 @@
+// Package retrieval selects the files of a repository relevant to an instruction with embeddings,
+// to populate a code container without a hand-curated list of paths. Any eino embedding.Embedder
+// provides the embeddings.
+//
+//	index, err := retrieval.Build(ctx, dir, embedder, retrieval.Options{Include: []string{"*.go"}})
+//	code, err := index.Container(ctx, instruction, 10)
+//	runner, err := axe.NewRunner(dir, []string{instruction}, code)
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/embedding"
+
+	"github.com/stumble/axe/code/container"
+)
+
+// Defaults of Options.
+const (
+	DefaultMaxFileBytes = 8 << 10
+	DefaultBatchSize    = 64
+)
+
+// DefaultExclude are directories never indexed, besides hidden ones.
+var DefaultExclude = []string{"vendor", "node_modules", "testdata"}
+
+// Options configure what Build indexes.
+type Options struct {
+	// Include, if set, only indexes files matching one of these globs, tried on the slash-separated
+	// path relative to the directory and on the base name, e.g. "*.go" or "cmd/**". See
+	// container.MatchAny.
+	Include []string
+	// Exclude skips files and directories matching one of these patterns, in addition to hidden
+	// ones and DefaultExclude.
+	Exclude []string
+	// MaxFileBytes is how much of a file is embedded, DefaultMaxFileBytes when 0. Larger files are
+	// represented by their head.
+	MaxFileBytes int
+	// BatchSize is the number of files per embedding request, DefaultBatchSize when 0.
+	BatchSize int
+}
+
+// Index holds the embeddings of the files of a directory.
+type Index struct {
+	dir      string
+	embedder embedding.Embedder
+	paths    []string // relative, slash-separated, sorted
+	vectors  [][]float64
+}
+
+// Match is a file found by Search.
+type Match struct {
+	Path  string  // relative to the directory of the index, slash-separated
+	Score float64 // cosine similarity to the query
+}
+
+// Build indexes the text files of dir. Binary files are skipped.
+func Build(ctx context.Context, dir string, embedder embedding.Embedder, opts Options) (*Index, error) {
+	if embedder == nil {
+		return nil, errors.New("retrieval: no embedder")
+	}
+	limit, batch := opts.MaxFileBytes, opts.BatchSize
+	if limit <= 0 {
+		limit = DefaultMaxFileBytes
+	}
+	if batch <= 0 {
+		batch = DefaultBatchSize
+	}
+	ix := &Index{dir: dir, embedder: embedder}
+	var texts []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name()[0] == '.' || slices.Contains(DefaultExclude, d.Name()) || container.MatchAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name()[0] == '.' || container.MatchAny(opts.Exclude, rel) {
+			return nil
+		}
+		if len(opts.Include) > 0 && !container.MatchAny(opts.Include, rel) {
+			return nil
+		}
+		text, ok, err := fileText(p, rel, limit)
+		if err != nil || !ok {
+			return err
+		}
+		ix.paths = append(ix.paths, rel)
+		texts = append(texts, text)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("retrieval: index %s: %w", dir, err)
+	}
+	for start := 0; start < len(texts); start += batch {
+		end := min(start+batch, len(texts))
+		vectors, err := embedder.EmbedStrings(ctx, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("retrieval: embed files: %w", err)
+		}
+		if len(vectors) != end-start {
+			return nil, fmt.Errorf("retrieval: embed files: got %d embeddings for %d files", len(vectors), end-start)
+		}
+		ix.vectors = append(ix.vectors, vectors...)
+	}
+	return ix, nil
+}
+
+// fileText returns the text embedded for a file, its path then the head of its content, and
+// false for a binary file.
+func fileText(p, rel string, limit int) (string, bool, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", false, err
+	}
+	if len(data) > limit {
+		data = data[:limit]
+		// don't split the last rune
+		for i := 0; i < utf8.UTFMax && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", false, nil
+	}
+	return rel + "\n\n" + string(data), true, nil
+}
+
+// Paths returns the indexed files, relative to the directory of the index.
+func (ix *Index) Paths() []string {
+	return slices.Clone(ix.paths)
+}
+
+// Search returns the k files most similar to query, most similar first.
+func (ix *Index) Search(ctx context.Context, query string, k int) ([]Match, error) {
+	if len(ix.paths) == 0 || k <= 0 {
+		return nil, nil
+	}
+	vectors, err := ix.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("retrieval: embed query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("retrieval: embed query: got %d embeddings", len(vectors))
+	}
+	matches := make([]Match, len(ix.paths))
+	for i, p := range ix.paths {
+		matches[i] = Match{Path: p, Score: cosine(vectors[0], ix.vectors[i])}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches[:min(k, len(matches))], nil
+}
+
+// Container returns a code container of dir holding the k files most relevant to instruction.
+func (ix *Index) Container(ctx context.Context, instruction string, k int) (*container.CodeContainer, error) {
+	matches, err := ix.Search(ctx, instruction, k)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(matches))
+	for i, m := range matches {
+		paths[i] = m.Path
+	}
+	return container.NewCodeContainerFromFS(ix.dir, paths)
+}
+
+// cosine returns the cosine similarity of a and b, 0 when one of them is null or their dimensions
+// differ.
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
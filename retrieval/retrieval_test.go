@@ -0,0 +1,86 @@
+package retrieval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wordsEmbedder embeds texts as the counts of a few words.
+type wordsEmbedder struct {
+	calls int
+}
+
+var vocabulary = []string{"parser", "token", "render", "html", "config"}
+
+func (e *wordsEmbedder) EmbedStrings(_ context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	e.calls++
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		out[i] = make([]float64, len(vocabulary))
+		for j, w := range vocabulary {
+			out[i][j] = float64(strings.Count(strings.ToLower(text), w))
+		}
+	}
+	return out, nil
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for p, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0o644))
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"parse/parser.go":        "package parse // the parser reads a token at a time\n",
+		"parse/lexer.go":         "package parse // token token\n",
+		"render/html.go":         "package render // render html\n",
+		"config.yaml":            "config: true\n",
+		"vendor/x/parser.go":     "package x // parser\n",
+		".git/HEAD":              "ref: parser\n",
+		"testdata/parser.golden": "parser\n",
+		"logo.png":               "\x89PNG\x00\x00parser",
+	})
+	embedder := &wordsEmbedder{}
+	ix, err := Build(context.Background(), dir, embedder, Options{BatchSize: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config.yaml", "parse/lexer.go", "parse/parser.go", "render/html.go"}, ix.Paths())
+	assert.Equal(t, 2, embedder.calls, "files are embedded in batches")
+
+	matches, err := ix.Search(context.Background(), "Fix the parser", 2)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "parse/parser.go", matches[0].Path)
+	assert.Greater(t, matches[0].Score, matches[1].Score)
+
+	code, err := ix.Container(context.Background(), "the html renderer", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"render/html.go"}, code.Paths())
+	assert.Equal(t, dir, code.BaseDir())
+
+	ix, err = Build(context.Background(), dir, embedder, Options{Include: []string{"*.go"}, Exclude: []string{"render"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"parse/lexer.go", "parse/parser.go"}, ix.Paths())
+
+	ix, err = Build(context.Background(), dir, embedder, Options{Include: []string{"**/html.go", "*.yaml"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config.yaml", "render/html.go"}, ix.Paths())
+}
+
+func TestCosine(t *testing.T) {
+	assert.InDelta(t, 1, cosine([]float64{1, 2}, []float64{2, 4}), 1e-9)
+	assert.InDelta(t, 0, cosine([]float64{1, 0}, []float64{0, 1}), 1e-9)
+	assert.Zero(t, cosine([]float64{0, 0}, []float64{1, 1}))
+	assert.Zero(t, cosine([]float64{1}, []float64{1, 1}))
+}
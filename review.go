@@ -0,0 +1,63 @@
+package axe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/tools/review"
+)
+
+const reviewInstruction = `Review the code below like a senior engineer reviewing a pull request. Look for bugs, security issues, race conditions, error handling mistakes, missing tests and unclear code.
+Record every finding with {tool}, on the narrowest line range that shows the problem, with a concrete fix. Do not comment on code that is fine, and do not repeat a finding.
+When done, finalize with a short overall summary of the review as the report.`
+
+// Reviewer is a read-only agent producing inline review comments over a diff or a set of files.
+type Reviewer struct {
+	Runner   *Runner
+	comments *review.Comments
+}
+
+// NewReviewer returns a reviewer of the files in code. If diff is not empty, the review focuses on
+// the changes it contains and the files provide the context. opts configure the underlying runner;
+// it always runs read-only.
+func NewReviewer(baseDir string, code *container.CodeContainer, diff string, opts ...RunnerOption) (*Reviewer, error) {
+	comments := &review.Comments{}
+	instructions := []string{strings.ReplaceAll(reviewInstruction, "{tool}", review.CommentToolName)}
+	if strings.TrimSpace(diff) != "" {
+		instructions = append(instructions, "Only review the changes of this diff; comment on lines of the new version of the files:\n```diff\n"+strings.TrimRight(diff, "\n")+"\n```")
+	}
+	// caller options come last, so e.g. WithReadOnly(path) can still set the summary file
+	opts = append([]RunnerOption{
+		WithReadOnly(""),
+		WithExtraTools(&review.CommentTool{Code: code, Comments: comments}),
+	}, opts...)
+	r, err := NewRunner(baseDir, instructions, code, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Reviewer{Runner: r, comments: comments}, nil
+}
+
+// Review runs the agent and returns its comments. The overall summary is the Analysis of the
+// runner's LastReport.
+func (rv *Reviewer) Review(ctx context.Context) ([]review.Comment, error) {
+	rv.comments.Reset()
+	if _, err := rv.Runner.Run(ctx, false); err != nil {
+		return rv.comments.List(), fmt.Errorf("axe: review: %w", err)
+	}
+	return rv.comments.List(), nil
+}
+
+// Comments returns the comments of the last review.
+func (rv *Reviewer) Comments() []review.Comment {
+	return rv.comments.List()
+}
+
+// WriteSARIF writes the comments of the last review as a SARIF 2.1.0 log, e.g. for upload to
+// GitHub code scanning.
+func (rv *Reviewer) WriteSARIF(w io.Writer) error {
+	return review.WriteSARIF(w, "axe", rv.Comments())
+}
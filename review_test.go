@@ -0,0 +1,103 @@
+package axe_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/tools/review"
+)
+
+func TestReviewer(t *testing.T) {
+	dir := t.TempDir()
+	code, err := cont.NewCodeContainerInDir(dir, map[string]string{"a.go": "package a\n\nfunc f() {\n\tpanic(1)\n}\n"})
+	require.NoError(t, err)
+	model := axetest.NewScriptedModel(
+		axetest.ToolCalls(
+			axetest.ToolCall(review.CommentToolName, map[string]any{
+				"path": "a.go", "start_line": 4, "severity": "error", "category": "bug", "message": "return an error instead of panicking",
+			}),
+			axetest.ToolCall(review.CommentToolName, map[string]any{
+				"path": "b.go", "start_line": 1, "severity": "info", "message": "not in the review",
+			}),
+		),
+		axetest.ToolCall("finalize_task", map[string]string{"status": "success", "changelog": "reviewed a.go", "report": "One bug."}),
+	)
+	diff := "--- a/a.go\n+++ b/a.go\n@@ -3,2 +3,3 @@\n func f() {\n+\tpanic(1)\n }\n"
+	rv, err := axe.NewReviewer(dir, code, diff,
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	comments, err := rv.Review(context.Background())
+	require.NoError(t, err)
+
+	want := review.Comment{Path: "a.go", StartLine: 4, EndLine: 4, Severity: review.SeverityError, Category: review.CategoryBug, Message: "return an error instead of panicking"}
+	assert.Equal(t, []review.Comment{want}, comments, "comments outside the code are rejected")
+	assert.Equal(t, comments, rv.Comments())
+	assert.Equal(t, "One bug.", rv.Runner.LastReport().Analysis)
+	assert.NotContains(t, model.ToolNames(), "apply_edit", "reviews are read-only")
+	requests := model.Requests()
+	require.NotEmpty(t, requests)
+	assert.Contains(t, requests[0][1].Content, "```diff\n"+diff+"```")
+
+	var out bytes.Buffer
+	require.NoError(t, review.WriteJSON(&out, rv.Comments()))
+	var decoded []review.Comment
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, []review.Comment{want}, decoded)
+
+	out.Reset()
+	require.NoError(t, rv.WriteSARIF(&out))
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name string `json:"name"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID  string `json:"ruleId"`
+				Level   string `json:"level"`
+				Message struct {
+					Text string `json:"text"`
+				} `json:"message"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+							EndLine   int `json:"endLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	assert.Equal(t, "axe", log.Runs[0].Tool.Driver.Name)
+	require.Len(t, log.Runs[0].Results, 1)
+	result := log.Runs[0].Results[0]
+	assert.Equal(t, "axe/bug", result.RuleID)
+	assert.Equal(t, "error", result.Level)
+	assert.Equal(t, want.Message, result.Message.Text)
+	require.Len(t, result.Locations, 1)
+	assert.Equal(t, "a.go", result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 4, result.Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Equal(t, 4, result.Locations[0].PhysicalLocation.Region.EndLine)
+}
@@ -0,0 +1,93 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BatchRun is the outcome of one runner of RunAll.
+type BatchRun struct {
+	BaseDir string
+	RunID   string
+	Result  *RunResult // nil when the run was skipped (see WithMinInterval) or failed before the agent started
+	Report  *RunReport // Result.Report
+	Err     error
+}
+
+// BatchReport aggregates the results of RunAll, in the order of the runners.
+type BatchReport struct {
+	Runs       []BatchRun
+	Statuses   map[RunStatus]int // number of runs per status, runs without a report are not counted
+	Failed     int               // number of runs that returned an error
+	TokenUsage TokenUsage        // summed over all runs
+	CostUSD    float64           // summed over all runs
+}
+
+// RunAll runs independent runners, e.g. one per module, with at most concurrency runs at a time
+// (all at once if concurrency <= 0). Runners without their own RateLimiter share limiter, so the
+// batch as a whole respects the provider's rate limits; their RateLimiter field is set to it for
+// the duration of their run, then reset to nil. The runners must not share a BaseDir or
+// history file. .env files are not loaded, the caller does it once beforehand if needed.
+//
+// RunAll waits for all started runs. Runners not yet started when ctx is done fail with ctx.Err().
+// The returned error joins the errors of all failed runs.
+func RunAll(ctx context.Context, runners []*Runner, concurrency int, limiter *RateLimiter) (*BatchReport, error) {
+	if concurrency <= 0 || concurrency > len(runners) {
+		concurrency = len(runners)
+	}
+	results := make([]BatchRun, len(runners))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, r := range runners {
+		if r == nil {
+			results[i].Err = errors.New("axe: nil runner")
+			continue
+		}
+		results[i].BaseDir = r.BaseDir
+		shared := r.RateLimiter == nil && limiter != nil
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if shared {
+				r.RateLimiter = limiter
+				defer func() { r.RateLimiter = nil }()
+			}
+			result, err := r.Run(ctx, false)
+			results[i].RunID = r.RunID
+			results[i].Result = result
+			if result != nil {
+				results[i].Report = result.Report
+			}
+			results[i].Err = err
+		}()
+	}
+	wg.Wait()
+
+	batch := &BatchReport{Runs: results, Statuses: map[RunStatus]int{}}
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			batch.Failed++
+			errs = append(errs, fmt.Errorf("axe: run in %s: %w", res.BaseDir, res.Err))
+		}
+		if res.Report == nil {
+			continue
+		}
+		batch.Statuses[res.Report.Status]++
+		batch.TokenUsage.PromptTokens += res.Report.TokenUsage.PromptTokens
+		batch.TokenUsage.CompletionTokens += res.Report.TokenUsage.CompletionTokens
+		batch.TokenUsage.TotalTokens += res.Report.TokenUsage.TotalTokens
+		batch.TokenUsage.ReasoningTokens += res.Report.TokenUsage.ReasoningTokens
+		batch.CostUSD += res.Report.CostUSD
+	}
+	return batch, errors.Join(errs...)
+}
@@ -0,0 +1,137 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+// usageModel is a scripted model reporting usage through eino callbacks, as provider models do,
+// and calling onCall before every reply.
+type usageModel struct {
+	*axetest.ScriptedModel
+	usage  *model.TokenUsage
+	onCall func()
+}
+
+func (m *usageModel) IsCallbacksEnabled() bool { return true }
+
+func (m *usageModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	_, err := m.ScriptedModel.WithTools(tools)
+	return m, err
+}
+
+func (m *usageModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if m.onCall != nil {
+		m.onCall()
+	}
+	ctx = callbacks.OnStart(ctx, &model.CallbackInput{Messages: input})
+	msg, err := m.ScriptedModel.Generate(ctx, input, opts...)
+	if err != nil {
+		callbacks.OnError(ctx, err)
+		return nil, err
+	}
+	_, out := callbacks.OnEndWithStreamOutput(ctx, schema.StreamReaderFromArray([]*model.CallbackOutput{{Message: msg, TokenUsage: m.usage}}))
+	return schema.StreamReaderWithConvert(out, func(o *model.CallbackOutput) (*schema.Message, error) { return o.Message, nil }), nil
+}
+
+func TestRunAll(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	both := make(chan struct{})
+	newRunner := func(m *axetest.ScriptedModel, opts ...axe.RunnerOption) *axe.Runner {
+		dir := t.TempDir()
+		um := &usageModel{ScriptedModel: m, usage: &model.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}}
+		um.onCall = func() {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			if running == 2 {
+				close(both)
+			}
+			mu.Unlock()
+			// the first two calls wait for each other, a third would raise the peak
+			select {
+			case <-both:
+			case <-time.After(200 * time.Millisecond):
+			}
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}
+		r, err := axe.NewRunner(dir, []string{"do the task"}, cont.NewCodeContainer(map[string]string{}), append([]axe.RunnerOption{
+			axe.WithChatModel(um),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+		}, opts...)...)
+		require.NoError(t, err)
+		return r
+	}
+	own := axe.NewRateLimiter(0, 0)
+	runners := []*axe.Runner{
+		newRunner(axetest.NewScriptedModel(axetest.Finalize("success", "one"))),
+		newRunner(axetest.NewScriptedModel(axetest.Finalize("failure", "two"))),
+		newRunner(axetest.NewScriptedModel(axetest.Finalize("success", "three")), axe.WithRateLimiter(own)),
+		newRunner(axetest.NewScriptedModel()), // fails, its script is empty
+		nil,
+	}
+	shared := axe.NewRateLimiter(6000, 0)
+	batch, err := axe.RunAll(context.Background(), runners, 2, shared)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, axetest.ErrScriptExhausted)
+	assert.ErrorContains(t, err, "axe: nil runner")
+
+	assert.Equal(t, 2, peak, "at most 2 runs at a time")
+	require.Len(t, batch.Runs, 5)
+	assert.Equal(t, map[axe.RunStatus]int{axe.RunStatusSuccess: 2, axe.RunStatusFailure: 1}, batch.Statuses)
+	assert.Equal(t, 2, batch.Failed)
+	assert.Equal(t, axe.TokenUsage{PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45}, batch.TokenUsage,
+		"the usage of the runs that finished is summed")
+	assert.Equal(t, runners[0].BaseDir, batch.Runs[0].BaseDir)
+	assert.NotEmpty(t, batch.Runs[0].RunID)
+
+	// the shared limiter is only set for the duration of the runs
+	assert.Nil(t, runners[0].RateLimiter)
+	assert.Same(t, own, runners[2].RateLimiter)
+}
+
+func TestRunAll_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var runners []*axe.Runner
+	for range 3 {
+		dir := t.TempDir()
+		m := &usageModel{ScriptedModel: axetest.NewScriptedModel(axetest.Finalize("success", "done")), onCall: cancel}
+		r, err := axe.NewRunner(dir, []string{"do the task"}, cont.NewCodeContainer(map[string]string{}),
+			axe.WithChatModel(m),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+		)
+		require.NoError(t, err)
+		runners = append(runners, r)
+	}
+
+	// the first run cancels ctx while the others wait for their turn
+	batch, err := axe.RunAll(ctx, runners, 1, nil)
+	require.Error(t, err)
+	require.Len(t, batch.Runs, 3)
+	assert.NotEmpty(t, batch.Runs[0].RunID, "the first run started")
+	for _, run := range batch.Runs[1:] {
+		assert.ErrorIs(t, run.Err, context.Canceled)
+		assert.Empty(t, run.RunID, "never started")
+		assert.Nil(t, run.Result)
+	}
+}
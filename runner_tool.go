@@ -0,0 +1,81 @@
+package axe
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+)
+
+// runnerTool wraps every tool handed to the agent so the runner can observe and gate tool calls.
+type runnerTool struct {
+	tool.InvokableTool
+	r        *Runner
+	parallel bool // may run concurrently with other parallel tools, see Runner.ParallelTools
+}
+
+func (r *Runner) wrapTool(t tool.InvokableTool) tool.BaseTool {
+	return &runnerTool{InvokableTool: t, r: r}
+}
+
+// wrapParallelTool wraps a tool that doesn't touch the code container or the changelog, so calls
+// to it may run concurrently.
+func (r *Runner) wrapParallelTool(t tool.InvokableTool) tool.BaseTool {
+	return &runnerTool{InvokableTool: t, r: r, parallel: true}
+}
+
+// acquire waits until the call may run and returns a function that releases it.
+func (t *runnerTool) acquire(ctx context.Context) (func(), error) {
+	if !t.parallel || t.r.toolSlots == nil {
+		t.r.toolGate.Lock()
+		return t.r.toolGate.Unlock, nil
+	}
+	select {
+	case t.r.toolSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	t.r.toolGate.RLock()
+	return func() {
+		t.r.toolGate.RUnlock()
+		<-t.r.toolSlots
+	}, nil
+}
+
+func (t *runnerTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	if !t.r.acquireToolSlot() {
+		return "axe: the run is shutting down, no further tool calls are accepted. Stop now.", nil
+	}
+	defer t.r.toolsInFlight.Done()
+	info, err := t.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	if violation := t.r.ToolPolicy.check(info.Name, t.r.stats.countToolCalls(info.Name)); violation != "" {
+		if t.r.audit != nil {
+			t.r.audit.record(AuditEntry{Time: time.Now(), RunID: t.r.RunID, Tool: info.Name, CallID: compose.GetToolCallID(ctx), Arguments: argumentsInJSON, Denied: violation}, violation)
+		}
+		return violation, nil
+	}
+	if nudge := t.r.checkRepeat(info.Name, argumentsInJSON); nudge != "" {
+		if t.r.audit != nil {
+			t.r.audit.record(AuditEntry{Time: time.Now(), RunID: t.r.RunID, Tool: info.Name, CallID: compose.GetToolCallID(ctx), Arguments: argumentsInJSON, Denied: nudge}, nudge)
+		}
+		return nudge, nil
+	}
+	release, err := t.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	ctx, untrack := t.r.trackTool(ctx, info.Name)
+	defer untrack()
+	ctx, rec := t.r.stats.startToolCall(ctx, info.Name, compose.GetToolCallID(ctx), argumentsInJSON)
+	out, err := t.InvokableTool.InvokableRun(ctx, argumentsInJSON, opts...)
+	t.r.stats.endToolCall(rec, err)
+	if t.r.audit != nil {
+		t.r.audit.record(t.r.auditEntry(rec), out)
+	}
+	return out, err
+}
@@ -0,0 +1,106 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// barrierExecutor holds every command until n of them run at once, or 200ms have passed.
+type barrierExecutor struct {
+	n       int
+	mu      sync.Mutex
+	running int
+	peak    int
+	all     chan struct{}
+}
+
+func (e *barrierExecutor) Execute(_ context.Context, argv []string, _ map[string]string, _ string) clitool.Outcome {
+	e.mu.Lock()
+	e.running++
+	e.peak = max(e.peak, e.running)
+	if e.running == e.n {
+		close(e.all)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.all:
+	case <-time.After(200 * time.Millisecond):
+	}
+	e.mu.Lock()
+	e.running--
+	e.mu.Unlock()
+	line := strings.Join(argv, " ")
+	return clitool.Outcome{Ran: true, Command: line, Stdout: "ok " + line}
+}
+
+func TestRunnerParallelTools(t *testing.T) {
+	dir := t.TempDir()
+	first := axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./a"]`})
+	second := axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./b"]`})
+	model := axetest.NewScriptedModel(
+		axetest.ToolCalls(first, second),
+		axetest.Finalize("success", "tested both"),
+	)
+	exec := &barrierExecutor{n: 2, all: make(chan struct{})}
+	sink := &chunkRecorder{}
+	runner, err := axe.NewRunner(dir, []string{"test a and b"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithParallelTools(2),
+		axe.WithSink(io.Discard),
+		axe.WithNamedSinks(axe.NamedSink{Name: "chunks", Writer: sink}),
+	)
+	require.NoError(t, err)
+	result, err := runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.True(t, result.Success())
+	assert.Equal(t, 2, exec.peak, "the calls ran concurrently")
+
+	responses := map[string]string{}
+	for _, chunk := range sink.chunks {
+		if chunk.Kind == axe.OutputKindToolResult {
+			responses[chunk.CallID] = chunk.Text
+		}
+	}
+	assert.Contains(t, responses[first.ToolCalls[0].ID], "ok go test ./a")
+	assert.Contains(t, responses[second.ToolCalls[0].ID], "ok go test ./b")
+
+	calls := map[string]string{}
+	for _, call := range result.Report.ToolCalls {
+		calls[call.CallID] = call.Arguments
+	}
+	assert.Contains(t, calls[first.ToolCalls[0].ID], "./a")
+	assert.Contains(t, calls[second.ToolCalls[0].ID], "./b")
+
+	// sequential by default
+	exec = &barrierExecutor{n: 2, all: make(chan struct{})}
+	runner, err = axe.NewRunner(dir, []string{"test a and b"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(axetest.NewScriptedModel(
+			axetest.ToolCalls(
+				axetest.ToolCall("go_test", map[string]any{"workdir": dir}),
+				axetest.ToolCall("go_test", map[string]any{"workdir": dir}),
+			),
+			axetest.Finalize("success", "tested both"),
+		)),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, exec.peak)
+}
@@ -0,0 +1,176 @@
+// Package sarif converts agent findings into SARIF 2.1.0 logs, the format accepted by GitHub code
+// scanning and most static analysis tooling.
+package sarif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	Version = "2.1.0"
+
+	// SrcRoot is the uriBaseId of all locations: paths are relative to the repository root.
+	SrcRoot = "%SRCROOT%"
+)
+
+// Level of a SARIF result.
+type Level string
+
+const (
+	LevelError   Level = "error"
+	LevelWarning Level = "warning"
+	LevelNote    Level = "note"
+)
+
+// Finding is a single result reported by an agent.
+type Finding struct {
+	RuleID    string // e.g. "axe/bug"; findings with the same rule are grouped by viewers
+	Level     Level
+	Message   string
+	Path      string // relative to the repository root, with forward slashes
+	StartLine int    // 1-based; 0 means the whole file
+	EndLine   int
+}
+
+// Tool describes the producer of the findings.
+type Tool struct {
+	Name           string
+	Version        string
+	InformationURI string
+	// RuleDescriptions optionally describes rule ids; rules without a description get their id.
+	RuleDescriptions map[string]string
+}
+
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+type Run struct {
+	Tool    RunTool  `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+type RunTool struct {
+	Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules"`
+}
+
+type Rule struct {
+	ID               string  `json:"id"`
+	ShortDescription Message `json:"shortDescription"`
+}
+
+type Result struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               Level             `json:"level"`
+	Message             Message           `json:"message"`
+	Locations           []Location        `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+}
+
+type Message struct {
+	Text string `json:"text"`
+}
+
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+type ArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type Region struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// Build converts findings into a SARIF log with a single run. Rules are derived from the rule ids
+// of the findings, in sorted order.
+func Build(tool Tool, findings []Finding) *Log {
+	ruleIndex := map[string]int{}
+	var ids []string
+	for _, f := range findings {
+		if _, ok := ruleIndex[f.RuleID]; !ok {
+			ruleIndex[f.RuleID] = 0
+			ids = append(ids, f.RuleID)
+		}
+	}
+	sort.Strings(ids)
+	rules := make([]Rule, 0, len(ids))
+	for i, id := range ids {
+		ruleIndex[id] = i
+		desc := tool.RuleDescriptions[id]
+		if desc == "" {
+			desc = id
+		}
+		rules = append(rules, Rule{ID: id, ShortDescription: Message{Text: desc}})
+	}
+
+	results := make([]Result, 0, len(findings))
+	for _, f := range findings {
+		loc := PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: f.Path, URIBaseID: SrcRoot}}
+		if f.StartLine > 0 {
+			loc.Region = &Region{StartLine: f.StartLine, EndLine: max(f.EndLine, f.StartLine)}
+		}
+		results = append(results, Result{
+			RuleID:              f.RuleID,
+			RuleIndex:           ruleIndex[f.RuleID],
+			Level:               f.Level,
+			Message:             Message{Text: f.Message},
+			Locations:           []Location{{PhysicalLocation: loc}},
+			PartialFingerprints: map[string]string{"axeFindingHash/v1": fingerprint(f)},
+		})
+	}
+	return &Log{
+		Schema:  Schema,
+		Version: Version,
+		Runs: []Run{{
+			Tool: RunTool{Driver: Driver{
+				Name:           tool.Name,
+				Version:        tool.Version,
+				InformationURI: tool.InformationURI,
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
+
+// Write writes the SARIF log of findings as indented JSON.
+func Write(w io.Writer, tool Tool, findings []Finding) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(Build(tool, findings)); err != nil {
+		return fmt.Errorf("sarif: encode: %w", err)
+	}
+	return nil
+}
+
+// fingerprint identifies a finding across uploads, so code scanning doesn't report it as new.
+// Line numbers are left out because they shift with unrelated edits.
+func fingerprint(f Finding) string {
+	sum := sha256.Sum256([]byte(f.RuleID + "\x00" + f.Path + "\x00" + f.Message))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,53 @@
+package sarif
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	log := Build(Tool{Name: "axe", RuleDescriptions: map[string]string{"axe/bug": "Bug"}}, []Finding{
+		{RuleID: "axe/style", Level: LevelNote, Message: "rename", Path: "a.go", StartLine: 3},
+		{RuleID: "axe/bug", Level: LevelError, Message: "nil deref", Path: "b.go", StartLine: 7, EndLine: 9},
+		{RuleID: "axe/bug", Level: LevelWarning, Message: "whole file", Path: "c.go"},
+	})
+
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	assert.Equal(t, []Rule{
+		{ID: "axe/bug", ShortDescription: Message{Text: "Bug"}},
+		{ID: "axe/style", ShortDescription: Message{Text: "axe/style"}},
+	}, run.Tool.Driver.Rules)
+
+	require.Len(t, run.Results, 3)
+	assert.Equal(t, 1, run.Results[0].RuleIndex)
+	assert.Equal(t, &Region{StartLine: 3, EndLine: 3}, run.Results[0].Locations[0].PhysicalLocation.Region)
+	assert.Equal(t, 0, run.Results[1].RuleIndex)
+	assert.Equal(t, &Region{StartLine: 7, EndLine: 9}, run.Results[1].Locations[0].PhysicalLocation.Region)
+	assert.Nil(t, run.Results[2].Locations[0].PhysicalLocation.Region)
+	assert.Equal(t, SrcRoot, run.Results[2].Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID)
+	assert.NotEqual(t, run.Results[1].PartialFingerprints, run.Results[2].PartialFingerprints)
+}
+
+func TestFingerprintIgnoresLines(t *testing.T) {
+	f := Finding{RuleID: "axe/bug", Message: "nil deref", Path: "b.go", StartLine: 7}
+	moved := f
+	moved.StartLine = 12
+	assert.Equal(t, fingerprint(f), fingerprint(moved))
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, Tool{Name: "axe"}, nil))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, Version, got["version"])
+	assert.Equal(t, Schema, got["$schema"])
+	run := got["runs"].([]any)[0].(map[string]any)
+	assert.Equal(t, []any{}, run["results"])
+}
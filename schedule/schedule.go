@@ -0,0 +1,175 @@
+// Package schedule runs an axe.Runner on a recurrence, e.g. a nightly maintenance task, with the
+// run history deciding when the first run is due after a restart.
+//
+//	s := schedule.New(runner, schedule.Every(6*time.Hour))
+//	if err := s.Start(ctx); err != nil { ... }
+//	defer s.Stop(context.Background())
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/stumble/axe"
+)
+
+// ErrStopped is the cancellation cause of a run interrupted by Stop.
+var ErrStopped = errors.New("schedule: stopped")
+
+// RunEvent describes a scheduled run, passed to Scheduler.OnRun.
+type RunEvent struct {
+	Scheduled time.Time      // time the run was due
+	Started   time.Time      // zero when the run was skipped
+	Err       error          // error returned by Run
+	Result    *axe.RunResult // nil when the runner skipped the run (see axe.WithMinInterval) or failed early
+	Report    *axe.RunReport // Result.Report
+	// Skipped is set when the run was due while the previous one was still running; it is not run.
+	Skipped bool
+}
+
+// Scheduler runs Runner at the times of Recurrence. Runs never overlap: a run due while the
+// previous one is still running is skipped. The runner's MinInterval and history lock apply to
+// every run as usual.
+type Scheduler struct {
+	Runner     *axe.Runner
+	Recurrence Recurrence
+	LoadDotEnv bool           // passed to Runner.Run
+	OnRun      func(RunEvent) // optional, called after every run, in the scheduler goroutine
+
+	mu      sync.Mutex
+	started bool
+	stop    chan struct{}
+	cancel  context.CancelCauseFunc
+	done    chan struct{}
+}
+
+func New(runner *axe.Runner, recurrence Recurrence) *Scheduler {
+	return &Scheduler{Runner: runner, Recurrence: recurrence}
+}
+
+// Start schedules the runs in a goroutine until Stop is called or ctx is done; a run in progress
+// when ctx is done is interrupted. The first run is due one recurrence after the last changelog
+// of the runner's history, or after now when the history is empty.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if s.Runner == nil || s.Recurrence == nil {
+		return errors.New("schedule: runner and recurrence are required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("schedule: already started")
+	}
+	s.started = true
+	ctx, s.cancel = context.WithCancelCause(ctx)
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go s.loop(ctx)
+	return nil
+}
+
+// Stop stops scheduling runs and waits for the run in progress, if any. If ctx is done first, the
+// run is interrupted with ErrStopped and Stop still waits for it to save its history.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	stop, cancel, done := s.stop, s.cancel, s.done
+	s.mu.Unlock()
+
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancel(ErrStopped)
+		<-done
+		return fmt.Errorf("schedule: stop: %w", ctx.Err())
+	}
+}
+
+// Done is closed when the scheduler goroutine has exited.
+func (s *Scheduler) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer close(s.done)
+	defer s.cancel(nil)
+	logger := s.logger()
+
+	next := s.first(time.Now())
+	for {
+		if next.IsZero() {
+			logger.Warn().Msg("schedule: recurrence has no next run time, stopping")
+			return
+		}
+		logger.Debug().Time("next", next).Msg("schedule: next run")
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		event := RunEvent{Scheduled: next, Started: time.Now()}
+		event.Result, event.Err = s.Runner.Run(ctx, s.LoadDotEnv)
+		if event.Result != nil {
+			event.Report = event.Result.Report
+		}
+		if event.Err != nil {
+			logger.Error().Err(event.Err).Msg("schedule: run failed")
+		}
+		s.notify(event)
+
+		// runs due while this one was running are skipped, not queued
+		next = s.Recurrence.Next(next)
+		for now := time.Now(); !next.IsZero() && next.Before(now); next = s.Recurrence.Next(next) {
+			logger.Info().Time("scheduled", next).Msg("schedule: skipping run due during the previous run")
+			s.notify(RunEvent{Scheduled: next, Skipped: true})
+		}
+	}
+}
+
+// first returns the first run time: one recurrence after the last recorded run, but not in the past.
+func (s *Scheduler) first(now time.Time) time.Time {
+	if s.Runner.History != nil {
+		if last, ok := s.Runner.History.LastChangelogTimestamp(); ok {
+			if next := s.Recurrence.Next(last); next.After(now) {
+				return next
+			} else if !next.IsZero() {
+				return now // overdue
+			}
+		}
+	}
+	return s.Recurrence.Next(now)
+}
+
+func (s *Scheduler) notify(event RunEvent) {
+	if s.OnRun != nil {
+		s.OnRun(event)
+	}
+}
+
+func (s *Scheduler) logger() zerolog.Logger {
+	if s.Runner.Logger != nil {
+		return *s.Runner.Logger
+	}
+	return log.Logger
+}
@@ -0,0 +1,85 @@
+package schedule_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/schedule"
+)
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return tm
+	}
+	cases := []struct {
+		expr, after, want string
+	}{
+		{"*/15 * * * *", "2025-03-10 10:07", "2025-03-10 10:15"},
+		{"0 2 * * *", "2025-03-10 10:07", "2025-03-11 02:00"},
+		{"@daily", "2025-12-31 23:59", "2026-01-01 00:00"},
+		{"30 9 * * mon-fri", "2025-03-08 12:00", "2025-03-10 09:30"}, // Saturday to Monday
+		{"0 0 1 jan,jul *", "2025-03-10 10:07", "2025-07-01 00:00"},
+		{"0 12 13 * 5", "2025-06-01 00:00", "2025-06-06 12:00"}, // day 13 or any Friday
+		{"0 0 * * 7", "2025-03-10 10:07", "2025-03-16 00:00"},   // 7 is Sunday
+	}
+	for _, c := range cases {
+		r, err := schedule.Cron(c.expr)
+		require.NoError(t, err, c.expr)
+		assert.Equal(t, at(c.want), r.Next(at(c.after)), c.expr)
+	}
+
+	r, err := schedule.Cron("@every 90m")
+	require.NoError(t, err)
+	assert.Equal(t, schedule.Every(90*time.Minute), r)
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "@every soon"} {
+		_, err := schedule.Cron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "first"), axetest.Finalize("success", "second"))
+	runner, err := axe.NewRunner(dir, []string{"keep it tidy"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+
+	events := make(chan schedule.RunEvent, 10)
+	s := schedule.New(runner, schedule.Every(20*time.Millisecond))
+	s.OnRun = func(e schedule.RunEvent) { events <- e }
+	require.NoError(t, s.Start(context.Background()))
+	require.Error(t, s.Start(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-events:
+			if e.Skipped {
+				i--
+				continue
+			}
+			require.NoError(t, e.Err)
+			require.NotNil(t, e.Report)
+			assert.Equal(t, axe.RunStatusSuccess, e.Report.Status)
+		case <-time.After(5 * time.Second):
+			t.Fatal("scheduled run did not happen")
+		}
+	}
+	require.NoError(t, s.Stop(context.Background()))
+	<-s.Done()
+	assert.Zero(t, model.Remaining())
+}
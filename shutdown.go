@@ -0,0 +1,72 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrShutdown is the cancellation cause of a run stopped by Runner.Shutdown, wrapped in the error
+// returned by the interrupted Run. It is also returned by Run when called on a runner that has been shut down.
+var ErrShutdown = errors.New("axe: runner shut down")
+
+// Shutdown gracefully stops an in-progress Run, e.g. when the embedding service receives SIGTERM.
+// New tool calls are rejected immediately, in-flight tool executions are awaited until ctx is done,
+// then the run is cancelled (killing child processes) and Shutdown waits for Run to flush the sinks
+// and save the history. The runner cannot be run again afterwards.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.shuttingDown = true
+	cancel, done := r.cancelRun, r.runDone
+	r.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	toolsDone := make(chan struct{})
+	go func() {
+		r.toolsInFlight.Wait()
+		close(toolsDone)
+	}()
+	select {
+	case <-toolsDone:
+	case <-ctx.Done():
+	}
+	cancel(ErrShutdown)
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("axe: shutdown: %w", ctx.Err())
+	}
+}
+
+// beginRun registers the cancel function of the current run so Shutdown can reach it.
+// The returned function must be called when Run returns.
+func (r *Runner) beginRun(cancel context.CancelCauseFunc) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shuttingDown {
+		return nil, ErrShutdown
+	}
+	done := make(chan struct{})
+	r.cancelRun, r.runDone = cancel, done
+	return func() {
+		r.mu.Lock()
+		r.cancelRun, r.runDone = nil, nil
+		r.mu.Unlock()
+		close(done)
+	}, nil
+}
+
+// acquireToolSlot marks a tool execution as in flight, unless the runner is shutting down.
+func (r *Runner) acquireToolSlot() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shuttingDown {
+		return false
+	}
+	r.toolsInFlight.Add(1)
+	return true
+}
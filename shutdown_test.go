@@ -0,0 +1,116 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// blockingExecutor runs commands until released, ignoring cancellation like a slow tool would.
+type blockingExecutor struct {
+	started chan struct{} // receives on every execution
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (e *blockingExecutor) Execute(_ context.Context, argv []string, _ map[string]string, _ string) clitool.Outcome {
+	e.calls.Add(1)
+	e.started <- struct{}{}
+	<-e.release
+	line := strings.Join(argv, " ")
+	return clitool.Outcome{Ran: true, Command: line, Stdout: "ok " + line}
+}
+
+// startBlockedRun starts a run whose first tool call blocks on the returned executor; the second
+// call of the same response comes after it.
+func startBlockedRun(t *testing.T) (*axe.Runner, *blockingExecutor, *chunkRecorder, <-chan error) {
+	t.Helper()
+	dir := t.TempDir()
+	exec := &blockingExecutor{started: make(chan struct{}, 2), release: make(chan struct{})}
+	sink := &chunkRecorder{}
+	runner, err := axe.NewRunner(dir, []string{"test a and b"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(axetest.NewScriptedModel(
+			axetest.ToolCalls(
+				axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./a"]`}),
+				axetest.ToolCall("go_test", map[string]any{"workdir": dir, "args": `["./b"]`}),
+			),
+			axetest.Finalize("success", "tested both"),
+		)),
+		axe.WithExecutor(exec),
+		axe.WithTools([]clitool.Definition{clitool.MustNewDefinition("go_test", "go test", "run tests", nil)}),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithNamedSinks(axe.NamedSink{Name: "chunks", Writer: sink}),
+	)
+	require.NoError(t, err)
+	runErr := make(chan error, 1)
+	go func() {
+		_, err := runner.Run(context.Background(), false)
+		runErr <- err
+	}()
+	<-exec.started
+	return runner, exec, sink, runErr
+}
+
+func TestRunnerShutdown(t *testing.T) {
+	runner, exec, sink, runErr := startBlockedRun(t)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- runner.Shutdown(ctx)
+	}()
+	assert.Never(t, func() bool { return len(shutdownErr) > 0 }, 50*time.Millisecond, 5*time.Millisecond,
+		"shutdown waits for the tool in flight")
+	close(exec.release)
+
+	require.NoError(t, <-shutdownErr)
+	err := <-runErr
+	assert.ErrorIs(t, err, axe.ErrShutdown)
+	assert.Equal(t, int32(1), exec.calls.Load(), "the call after shutdown is not executed")
+	var rejected bool
+	for _, chunk := range sink.chunks {
+		rejected = rejected || chunk.Kind == axe.OutputKindToolResult && strings.Contains(chunk.Text, "no further tool calls are accepted")
+	}
+	assert.True(t, rejected, "the call after shutdown is rejected")
+
+	_, err = runner.Run(context.Background(), false)
+	assert.ErrorIs(t, err, axe.ErrShutdown, "a shut down runner can't run again")
+}
+
+func TestRunnerShutdown_Idle(t *testing.T) {
+	runner, err := axe.NewRunner(t.TempDir(), []string{"do nothing"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+	require.NoError(t, runner.Shutdown(context.Background()))
+	_, err = runner.Run(context.Background(), false)
+	assert.ErrorIs(t, err, axe.ErrShutdown)
+}
+
+func TestRunnerShutdown_Expired(t *testing.T) {
+	runner, exec, _, runErr := startBlockedRun(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := runner.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the tool is still in flight")
+	assert.ErrorContains(t, err, "axe: shutdown")
+
+	close(exec.release)
+	assert.ErrorIs(t, <-runErr, axe.ErrShutdown, "the run was cancelled anyway")
+}
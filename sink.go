@@ -0,0 +1,181 @@
+package axe
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog"
+)
+
+// OutputKind classifies a chunk of runner output so sinks can filter what they receive.
+type OutputKind int
+
+const (
+	OutputKindRunner     OutputKind = iota // runner status lines
+	OutputKindAgent                        // text streamed by the model
+	OutputKindToolCall                     // tool call headers and streamed arguments
+	OutputKindToolResult                   // tool responses fed back to the model
+	OutputKindHeartbeat                    // progress reports of long-running tools
+	OutputKindPrompt                       // the initial prompt messages
+	OutputKindSummary                      // the final status of the run
+)
+
+// OutputChunk is a piece of runner output sent through Runner.Output.
+type OutputChunk struct {
+	Kind OutputKind
+	Text string
+	Tool string `json:",omitempty"` // tool name on the header of a tool call and on tool results
+	// CallID identifies the tool call of headers, results and heartbeats, which may interleave when
+	// tools run in parallel.
+	CallID string `json:",omitempty"`
+}
+
+// ChunkWriter is implemented by sink writers that want whole chunks with their kind instead of
+// the text only, e.g. ProgressDisplay.
+type ChunkWriter interface {
+	WriteChunk(chunk OutputChunk) error
+}
+
+// NamedSink is an output destination. Kinds restricts the chunks written to it; empty accepts all.
+type NamedSink struct {
+	Name   string
+	Writer io.Writer
+	Kinds  []OutputKind
+}
+
+func (s NamedSink) accepts(kind OutputKind) bool {
+	if len(s.Kinds) == 0 {
+		return true
+	}
+	for _, k := range s.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsoleSink writes to stdout.
+func ConsoleSink(kinds ...OutputKind) NamedSink {
+	return NamedSink{Name: "console", Writer: os.Stdout, Kinds: kinds}
+}
+
+// BufferSink writes to buf.
+func BufferSink(buf *bytes.Buffer, kinds ...OutputKind) NamedSink {
+	return NamedSink{Name: "buffer", Writer: buf, Kinds: kinds}
+}
+
+// FileSink appends to the file at path. The file is opened on the first write of a run and
+// closed when the run finishes.
+func FileSink(path string, kinds ...OutputKind) NamedSink {
+	return NamedSink{Name: "file:" + path, Writer: &fileSinkWriter{path: path}, Kinds: kinds}
+}
+
+type fileSinkWriter struct {
+	path string
+	f    *os.File
+}
+
+func (w *fileSinkWriter) Write(p []byte) (int, error) {
+	if w.f == nil {
+		f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return 0, err
+		}
+		w.f = f
+	}
+	return w.f.Write(p)
+}
+
+func (w *fileSinkWriter) Close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// outputRecorder is a helper to record the output and fan it out to the sinks.
+type outputRecorder struct {
+	log       zerolog.Logger
+	mu        sync.Mutex
+	buf       strings.Builder
+	sinks     []NamedSink
+	verbosity Verbosity
+}
+
+func (o *outputRecorder) Write(kind OutputKind, text string) {
+	o.WriteChunk(OutputChunk{Kind: kind, Text: text})
+}
+
+func (o *outputRecorder) WriteChunk(chunk OutputChunk) {
+	if o == nil {
+		return
+	}
+	chunk, ok := o.verbosity.filter(chunk)
+	if !ok {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf.WriteString(chunk.Text)
+	for _, sink := range o.sinks {
+		if sink.Writer == nil || !sink.accepts(chunk.Kind) {
+			continue
+		}
+		var err error
+		if cw, ok := sink.Writer.(ChunkWriter); ok {
+			err = cw.WriteChunk(chunk)
+		} else {
+			_, err = io.WriteString(sink.Writer, chunk.Text)
+		}
+		if err != nil {
+			o.log.Error().Err(err).Str("sink", sink.Name).Msg("axe: write to sink")
+		}
+	}
+}
+
+// flush flushes sinks that buffer writes (e.g. bufio.Writer or os.File) and closes file sinks.
+func (o *outputRecorder) flush() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, sink := range o.sinks {
+		var err error
+		switch w := sink.Writer.(type) {
+		case *fileSinkWriter:
+			err = w.Close()
+		case interface{ Flush() error }:
+			err = w.Flush()
+		case interface{ Sync() error }:
+			err = w.Sync()
+		}
+		if err != nil && !errors.Is(err, os.ErrInvalid) && !errors.Is(err, syscall.EINVAL) {
+			o.log.Error().Err(err).Str("sink", sink.Name).Msg("axe: flush sink")
+		}
+	}
+}
+
+func (o *outputRecorder) String() string {
+	if o == nil {
+		return ""
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// consume consumes the output from the agent and writes it to the outputRecorder. This function will exit when the out channel is closed.
+func (o *outputRecorder) consume(out chan OutputChunk) {
+	for chunk := range out {
+		o.WriteChunk(chunk)
+	}
+}
@@ -0,0 +1,94 @@
+package axe_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerSinks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "transcript.log")
+	var all, results bytes.Buffer
+	sinks := []axe.NamedSink{
+		axe.BufferSink(&all),
+		axe.BufferSink(&results, axe.OutputKindToolResult),
+		axe.FileSink(path, axe.OutputKindToolCall, axe.OutputKindToolResult),
+	}
+	run := func(file string) {
+		code, err := cont.NewCodeContainerInDir(dir, nil)
+		require.NoError(t, err)
+		runner, err := axe.NewRunner(dir, []string{"add " + file}, code,
+			axe.WithChatModel(axetest.NewScriptedModel(
+				axetest.ApplyEdit("*** Begin Patch\n*** Add File: "+file+"\n+x\n*** End Patch"),
+				axetest.Finalize("success", "added "+file),
+			)),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(io.Discard),
+			axe.WithNamedSinks(sinks...),
+		)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		require.NoError(t, err)
+	}
+
+	run("a.txt")
+	assert.Contains(t, all.String(), "# Instruction: \nadd a.txt")
+	assert.Contains(t, all.String(), "changelog:added a.txt")
+	assert.Contains(t, results.String(), "Done!")
+	assert.NotContains(t, results.String(), "Tool call id", "kinds filter the chunks")
+	first, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(first), "Tool call function name: apply_edit")
+	assert.Contains(t, string(first), "Done!")
+	assert.NotContains(t, string(first), "# Instruction")
+
+	// the file is closed when the run ends and opened again by the next one
+	require.NoError(t, os.Rename(path, path+".1"))
+	run("b.txt")
+	second, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(second), "Tool call function name: apply_edit")
+	moved, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, first, moved)
+
+	console := axe.ConsoleSink(axe.OutputKindAgent)
+	assert.Equal(t, axe.NamedSink{Name: "console", Writer: os.Stdout, Kinds: []axe.OutputKind{axe.OutputKindAgent}}, console)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestRunnerSinkNames(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	runner, err := axe.NewRunner(dir, []string{"do it"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(axetest.NewScriptedModel(axetest.Finalize("success", "done"))),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithSinks(io.Discard),
+		axe.WithSinks(failingWriter{}),
+		axe.WithLogger(zerolog.New(&logs)),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	assert.Contains(t, logs.String(), `"sink":"sink-1"`, "sinks are numbered across WithSinks calls")
+	assert.NotContains(t, logs.String(), `"sink":"sink-0"`)
+}
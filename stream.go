@@ -1,103 +1,73 @@
 package axe
 
 import (
-	"errors"
-	"fmt"
-	"io"
-	"strings"
-	"sync"
-
 	"github.com/cloudwego/eino/schema"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 
-	"github.com/stumble/axe/json_stream_decoder"
+	"github.com/stumble/axe/streamview"
 )
 
-var ErrDecoderFailed = errors.New("axe: decoder failed")
+// ErrDecoderFailed is the error of a call whose arguments could not be displayed.
+//
+// Deprecated: use streamview.ErrDecoderFailed.
+var ErrDecoderFailed = streamview.ErrDecoderFailed
 
+// ToolCallStreamer displays the arguments of one tool call as the model streams them.
+//
+// Deprecated: use streamview.View, which follows all the calls of a streamed message.
 type ToolCallStreamer struct {
-	ID            string
-	FnName        string
-	Arguments     strings.Builder
-	HasError      error
-	Reader        *io.PipeReader
-	Writer        *io.PipeWriter
-	Decoder       *json_stream_decoder.JSONStreamDecoder
-	Once          sync.Once
-	HeaderPrinted bool
+	ID       string
+	FnName   string
+	HasError error // set by Close if the arguments could not be displayed
+
+	Out    func(OutputChunk)
+	Logger *zerolog.Logger // the global zerolog logger when nil
 
-	Out chan<- string
+	view *streamview.View
 }
 
-func NewToolCallStreamer(id string, out chan<- string) *ToolCallStreamer {
-	pr, pw := io.Pipe()
-	s := &ToolCallStreamer{
-		ID:      id,
-		Reader:  pr,
-		Writer:  pw,
-		Decoder: json_stream_decoder.NewJSONStreamDecoder(pr),
-		Out:     out,
-	}
-	// This goroutine will be closed when the pipe is closed, which happens
-	// when the Close() method is called.
-	go func() {
-		err := s.Decoder.Stream(func(str string) error {
-			s.Out <- str
-			return nil
-		})
-		if err != nil {
-			s.HasError = fmt.Errorf("%w: because %w", ErrDecoderFailed, err)
-		}
-		// Close the reader to signal writer that no one is consuming the stream anymore.
-		if err != nil {
-			log.Error().Err(err).Msg("axe: decoder failed")
-			err = s.Reader.CloseWithError(err)
-			if err != nil {
-				log.Error().Err(err).Msg("axe: failed to close pipe.reader with error")
-			}
-		} else {
-			err = s.Reader.Close()
-			if err != nil {
-				log.Error().Err(err).Msg("axe: failed to close pipe.reader")
-			}
-		}
-	}()
+// NewToolCallStreamer returns a streamer of the call id sending its rendering to out.
+//
+// Deprecated: use streamview.NewView.
+func NewToolCallStreamer(id string, out func(OutputChunk)) *ToolCallStreamer {
+	s := &ToolCallStreamer{ID: id, Out: out}
+	s.view = streamview.NewView(func(c streamview.Chunk) {
+		s.Out(OutputChunk{Kind: OutputKindToolCall, Text: c.Text, Tool: c.Tool, CallID: c.CallID})
+	})
 	return s
 }
 
+// OnMsg adds a streamed fragment of the call. Display problems are not errors: it returns nil.
+func (s *ToolCallStreamer) OnMsg(call *schema.ToolCall) error {
+	s.FnName += call.Function.Name
+	delta := *call
+	delta.ID = s.ID
+	s.view.OnDelta(&delta)
+	return nil
+}
+
+// Close ends the argument stream and waits until everything is displayed.
 func (s *ToolCallStreamer) Close() error {
-	if s.HasError != nil {
-		log.Warn().Err(s.HasError).Str("arguments", s.Arguments.String()).Msg("axe: tool call streamer failed to print arguments. NOTE: this does not affect the tool call execution.")
+	s.view.Logger = s.Logger
+	s.view.Close()
+	if c := s.call(); c != nil {
+		s.HasError = c.Err
 	}
-
-	var err error
-	s.Once.Do(func() {
-		err = s.Writer.Close()
-	})
-	return err
+	return nil
 }
 
-func (s *ToolCallStreamer) OnMsg(call *schema.ToolCall) error {
-	if call.Function.Name != "" {
-		s.FnName += call.Function.Name
+// RepairedArguments returns the arguments streamed so far as one JSON object, see
+// streamview.Call.RepairedArguments.
+func (s *ToolCallStreamer) RepairedArguments() string {
+	if c := s.call(); c != nil {
+		return c.RepairedArguments()
 	}
-	if call.Function.Arguments != "" {
-		s.Arguments.WriteString(call.Function.Arguments)
-		if !s.HeaderPrinted {
-			s.HeaderPrinted = true
-			s.Out <- fmt.Sprintf("\nTool call id: %s\n", s.ID)
-			s.Out <- fmt.Sprintf("Tool call function name: %s\n", s.FnName)
-			s.Out <- "Tool call arguments:\n"
-		}
-		_, err := s.Writer.Write([]byte(call.Function.Arguments))
+	return ""
+}
 
-		if err != nil {
-			if !errors.Is(err, ErrDecoderFailed) {
-				// reader is already closed due decoder error, we just silently ignore the error
-				return nil
-			}
-		}
-		return err
+func (s *ToolCallStreamer) call() *streamview.Call {
+	if calls := s.view.Calls(); len(calls) > 0 {
+		return calls[0]
 	}
 	return nil
 }
@@ -0,0 +1,45 @@
+package axe_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+)
+
+func TestToolCallStreamerMalformedArguments(t *testing.T) {
+	stream := func(fragments ...string) (*axe.ToolCallStreamer, string) {
+		var mu sync.Mutex
+		var out strings.Builder
+		s := axe.NewToolCallStreamer("call_1", func(chunk axe.OutputChunk) {
+			mu.Lock()
+			defer mu.Unlock()
+			out.WriteString(chunk.Text)
+		})
+		for _, f := range fragments {
+			call := schema.ToolCall{ID: "call_1", Function: schema.FunctionCall{Name: "open_files", Arguments: f}}
+			require.NoError(t, s.OnMsg(&call))
+		}
+		require.NoError(t, s.Close())
+		mu.Lock()
+		defer mu.Unlock()
+		return s, out.String()
+	}
+
+	s, out := stream(`{"file":"a.go",`, `"names":["A"`, `,"B"]}`)
+	assert.Contains(t, out, "file:a.go")
+	assert.ErrorIs(t, s.HasError, axe.ErrDecoderFailed, "arrays are not displayed")
+	assert.Equal(t, `{"file":"a.go","names":["A","B"]}`, s.RepairedArguments())
+
+	s, _ = stream(`{}`, `{"status":"suc`, `cess"}`)
+	assert.NoError(t, s.HasError)
+	assert.Equal(t, `{"status":"success"}`, s.RepairedArguments())
+
+	s, _ = stream(`{"status":"success","changelog":"trunc`)
+	assert.Equal(t, `{"status":"success","changelog":"trunc"}`, s.RepairedArguments())
+}
@@ -0,0 +1,211 @@
+// Package streamview renders the arguments of tool calls live, as an eino chat model streams them:
+// a header per call, then the plain text of the argument values. Other eino-based applications can
+// feed it the tool calls of the streamed messages to show the same view as axe.
+package streamview
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/stumble/axe/json_stream_decoder"
+)
+
+// ErrDecoderFailed is the error of a call whose arguments could not be displayed.
+var ErrDecoderFailed = errors.New("streamview: decoder failed")
+
+// Chunk is a piece of the rendering of a tool call.
+type Chunk struct {
+	Text   string
+	Tool   string // the name of the tool, on the first chunk of a call
+	CallID string // the ID of the call, on the first chunk of a call
+}
+
+// View displays the arguments of the tool calls of a streamed message. Models stream their calls
+// one after the other, each starting with a delta holding its ID. Display is best effort: the
+// arguments are buffered so the stream never waits for it, and a malformed stream (fragments that
+// aren't one JSON object) only stops the display of the call.
+type View struct {
+	Logger *zerolog.Logger // the global zerolog logger when nil
+
+	out   func(Chunk)
+	calls []*Call
+}
+
+// NewView returns a view sending its rendering to out. out is called from the goroutine of
+// OnDelta and from a decoding goroutine, never after Close returns.
+func NewView(out func(Chunk)) *View {
+	return &View{out: out}
+}
+
+// OnDelta adds a streamed fragment of a tool call. A delta with a new ID ends the current call and
+// starts the next; deltas before the first ID are ignored.
+func (v *View) OnDelta(call *schema.ToolCall) {
+	cur := v.current()
+	if call.ID != "" && (cur == nil || call.ID != cur.ID) {
+		if cur != nil {
+			v.closeCall(cur)
+		}
+		cur = v.newCall(call.ID)
+		v.calls = append(v.calls, cur)
+	}
+	if cur == nil {
+		return
+	}
+	cur.Name += call.Function.Name
+	if call.Function.Arguments == "" {
+		return
+	}
+	cur.arguments.WriteString(call.Function.Arguments)
+	if !cur.headerPrinted {
+		cur.headerPrinted = true
+		v.out(Chunk{Text: fmt.Sprintf("\nTool call id: %s\n", cur.ID), Tool: cur.Name, CallID: cur.ID})
+		v.out(Chunk{Text: fmt.Sprintf("Tool call function name: %s\n", cur.Name)})
+		v.out(Chunk{Text: "Tool call arguments:\n"})
+	}
+	// once the decoder stopped, on a malformed stream, the arguments are only buffered
+	cur.buf.Write([]byte(call.Function.Arguments))
+}
+
+// Close ends the current call and waits until everything is displayed, so no output is sent after
+// the caller moves on (e.g. closes its output channel).
+func (v *View) Close() {
+	if cur := v.current(); cur != nil {
+		v.closeCall(cur)
+	}
+}
+
+// Calls returns the calls seen so far, in order.
+func (v *View) Calls() []*Call {
+	return v.calls
+}
+
+func (v *View) current() *Call {
+	if len(v.calls) == 0 {
+		return nil
+	}
+	return v.calls[len(v.calls)-1]
+}
+
+func (v *View) logger() *zerolog.Logger {
+	if v.Logger != nil {
+		return v.Logger
+	}
+	return &log.Logger
+}
+
+func (v *View) newCall(id string) *Call {
+	buf := newArgBuffer()
+	c := &Call{ID: id, buf: buf, done: make(chan struct{})}
+	decoder := json_stream_decoder.NewJSONStreamDecoder(buf)
+	// The decoder returns when the buffer is closed by closeCall, or on the first malformed fragment.
+	go func() {
+		defer close(c.done)
+		err := decoder.Stream(func(str string) error {
+			v.out(Chunk{Text: str})
+			return nil
+		})
+		if err != nil {
+			c.Err = fmt.Errorf("%w: because %w", ErrDecoderFailed, err)
+		}
+		// the rest of the stream is only kept in the arguments
+		buf.Close()
+	}()
+	return c
+}
+
+func (v *View) closeCall(c *Call) {
+	c.once.Do(func() {
+		c.buf.Close()
+		<-c.done
+		if c.Err != nil {
+			ev := v.logger().Warn().Err(c.Err).Str("arguments", c.RepairedArguments())
+			if raw := c.Arguments(); raw != c.RepairedArguments() {
+				ev = ev.Str("raw_arguments", raw)
+			}
+			ev.Msg("streamview: failed to display the tool call arguments. NOTE: this does not affect the tool call execution.")
+		}
+	})
+}
+
+// Call is a tool call seen by a View. Err is set, once the call is closed, if its arguments could
+// not be displayed.
+type Call struct {
+	ID   string
+	Name string
+	Err  error
+
+	arguments     strings.Builder
+	headerPrinted bool
+	buf           *argBuffer    // the arguments not read by the decoder yet
+	done          chan struct{} // closed when the decoder goroutine returns
+	once          sync.Once
+}
+
+// Arguments returns the arguments streamed so far.
+func (c *Call) Arguments() string {
+	return c.arguments.String()
+}
+
+// RepairedArguments returns the arguments streamed so far as one JSON object, reconstructed from
+// concatenated or truncated fragments (see json_stream_decoder.Repair), or as streamed if they
+// can't be.
+func (c *Call) RepairedArguments() string {
+	raw := c.arguments.String()
+	repaired, err := json_stream_decoder.Repair(raw)
+	if err != nil {
+		return raw
+	}
+	return repaired
+}
+
+// argBuffer is an unbounded pipe: writes never block, reads wait for data until it is closed.
+// Writes after Close are dropped.
+type argBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	data   []byte
+	closed bool
+}
+
+func newArgBuffer() *argBuffer {
+	b := &argBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *argBuffer) Write(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.data = append(b.data, p...)
+		b.cond.Signal()
+	}
+}
+
+func (b *argBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.data) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if len(b.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func (b *argBuffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.cond.Broadcast()
+}
@@ -0,0 +1,76 @@
+package streamview
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stream feeds the deltas to a view and returns its calls and rendering.
+func stream(deltas ...schema.ToolCall) ([]*Call, []Chunk) {
+	var mu sync.Mutex
+	var out []Chunk
+	v := NewView(func(c Chunk) {
+		mu.Lock()
+		defer mu.Unlock()
+		out = append(out, c)
+	})
+	for _, d := range deltas {
+		v.OnDelta(&d)
+	}
+	v.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	return v.Calls(), out
+}
+
+func delta(id, name, arguments string) schema.ToolCall {
+	return schema.ToolCall{ID: id, Function: schema.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+func text(chunks []Chunk) string {
+	var b strings.Builder
+	for _, c := range chunks {
+		b.WriteString(c.Text)
+	}
+	return b.String()
+}
+
+func TestViewRendersCalls(t *testing.T) {
+	calls, out := stream(
+		delta("", "ignored", `{"x":`),
+		delta("call_1", "apply_", ""),
+		delta("", "edit", `{"code_output":"<Code`),
+		delta("", "", `Output/>"}`),
+		delta("call_2", "finalize_task", `{"status":"success"}`),
+	)
+	require.Len(t, calls, 2)
+	assert.Equal(t, "apply_edit", calls[0].Name)
+	assert.Equal(t, `{"code_output":"<CodeOutput/>"}`, calls[0].Arguments())
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, "finalize_task", calls[1].Name)
+
+	assert.Equal(t, Chunk{Text: "\nTool call id: call_1\n", Tool: "apply_edit", CallID: "call_1"}, out[0])
+	assert.Equal(t, "\nTool call id: call_1\nTool call function name: apply_edit\nTool call arguments:\n"+
+		"code_output:<CodeOutput/>"+
+		"\nTool call id: call_2\nTool call function name: finalize_task\nTool call arguments:\n"+
+		"status:success", text(out))
+}
+
+func TestViewMalformedArguments(t *testing.T) {
+	calls, out := stream(delta("call_1", "open_files", `{"file":"a.go",`), delta("", "", `"names":["A"`), delta("", "", `,"B"]}`))
+	assert.Contains(t, text(out), "file:a.go")
+	assert.ErrorIs(t, calls[0].Err, ErrDecoderFailed, "arrays are not displayed")
+	assert.Equal(t, `{"file":"a.go","names":["A","B"]}`, calls[0].RepairedArguments())
+
+	calls, _ = stream(delta("call_1", "finalize_task", `{}`), delta("", "", `{"status":"suc`), delta("", "", `cess"}`))
+	assert.NoError(t, calls[0].Err)
+	assert.Equal(t, `{"status":"success"}`, calls[0].RepairedArguments())
+
+	calls, _ = stream(delta("call_1", "finalize_task", `{"status":"success","changelog":"trunc`))
+	assert.Equal(t, `{"status":"success","changelog":"trunc"}`, calls[0].RepairedArguments())
+}
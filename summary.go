@@ -0,0 +1,78 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/history"
+)
+
+// DefaultSummaryModel is the model WithModelSummary uses when none is given.
+const DefaultSummaryModel = ModelGPT4oMini
+
+const summaryPrompt = `You write changelog entries for runs of a coding agent. You are given the transcript of a run: the instructions, the agent's messages, its tool calls and their results.
+Summarize it in at most 15 lines of plain text with these sections:
+Changed: the files changed and what changed in them, or "nothing".
+Why: the reason for the changes and the outcome of the run (finished, failed, interrupted, with the error if any).
+Follow-ups: what is left to do, or "none".
+Only state what the transcript shows.`
+
+// summarizeWithModel is the LogSummarizer installed by WithModelSummary.
+func (r *Runner) summarizeWithModel(ctx context.Context, output string) (string, error) {
+	m, err := r.summaryModel(ctx)
+	if err != nil {
+		return "", err
+	}
+	name := r.SummaryModel
+	if name == "" {
+		name = DefaultSummaryModel
+	}
+	// the transcript must fit the summary model, its middle is the least useful part
+	if caps, ok := LookupModel(name); ok && caps.ContextWindow > 0 {
+		output = history.LogLimit{MaxBytes: caps.codeInputBudget()}.Apply(output)
+	}
+	msg, err := m.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(summaryPrompt),
+		schema.UserMessage(output),
+	})
+	if err != nil {
+		return "", fmt.Errorf("axe: summarize run: %w", err)
+	}
+	summary := strings.TrimSpace(msg.Content)
+	if summary == "" {
+		return "", errors.New("axe: summarize run: empty summary")
+	}
+	if meta := msg.ResponseMeta; meta != nil && meta.Usage != nil {
+		r.log.Debug().Int("prompt_tokens", meta.Usage.PromptTokens).Int("completion_tokens", meta.Usage.CompletionTokens).Msg("axe: summarized run output")
+	}
+	return summary + "\n", nil
+}
+
+func (r *Runner) summaryModel(ctx context.Context) (model.BaseChatModel, error) {
+	if r.SummaryChatModel != nil {
+		return withRateLimiter(toolCallingModel{r.SummaryChatModel}, r.RateLimiter), nil
+	}
+	name := r.SummaryModel
+	if name == "" {
+		name = DefaultSummaryModel
+	}
+	m, err := newChatModel(ctx, name, ModelConfig{}, r.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return withRateLimiter(m, r.RateLimiter), nil
+}
+
+// toolCallingModel adapts a chat model that is never given tools to the interface of withRateLimiter.
+type toolCallingModel struct {
+	model.BaseChatModel
+}
+
+func (m toolCallingModel) WithTools([]*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
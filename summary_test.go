@@ -0,0 +1,63 @@
+package axe_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/history"
+)
+
+func TestRunnerLogLimitAndSummarizer(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))
+	var summarized string
+	runner, err := axe.NewRunner(dir, []string{"do nothing"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithLogSummarizer(func(_ context.Context, output string) (string, error) {
+			summarized = output
+			return strings.Repeat("summary line\n", 100), nil
+		}),
+		axe.WithLogLimit(history.LogLimit{MaxBytes: 130, Keep: history.KeepHead}),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	assert.Contains(t, summarized, "Agent execution finished successfully.")
+	logs := runner.History.Changelogs[0].Logs
+	require.NotEmpty(t, logs)
+	assert.Equal(t, strings.Repeat("summary line\n", 10)+"\n... [1170 bytes omitted] ...\n", logs[len(logs)-1].Value)
+}
+
+func TestRunnerModelSummary(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(axetest.Finalize("success", "nothing to do"))
+	summarizer := axetest.NewScriptedModel(axetest.Text("Changed: nothing\nWhy: nothing to do\nFollow-ups: none"))
+	runner, err := axe.NewRunner(dir, []string{"do nothing"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithSummaryChatModel(summarizer),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	logs := runner.History.Changelogs[0].Logs
+	require.NotEmpty(t, logs)
+	assert.Equal(t, "Changed: nothing\nWhy: nothing to do\nFollow-ups: none\n", logs[len(logs)-1].Value)
+	requests := summarizer.Requests()
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0][1].Content, "Agent execution finished successfully.")
+}
@@ -0,0 +1,217 @@
+// Package tokens counts the tokens of prompts for the models axe supports, to check ahead of a run
+// that its prompt fits the context window and what it costs.
+//
+// Counts are estimates by default: text is split into pieces like tiktoken's pre-tokenizer does
+// (words with their leading space, runs of up to three digits, punctuation, whitespace) and each
+// piece is priced from its length, which lands within a few percent of o200k_base and cl100k_base
+// on English and source code. For exact counts, register a tiktoken implementation:
+//
+//	enc, _ := tiktoken.GetEncoding("o200k_base") // e.g. github.com/pkoukk/tiktoken-go
+//	tokens.Register(tokens.O200kBase, tokens.CounterFunc(func(s string) int { return len(enc.Encode(s, nil, nil)) }))
+package tokens
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Encoding names a tiktoken encoding.
+type Encoding string
+
+const (
+	O200kBase  Encoding = "o200k_base"  // gpt-4o, gpt-4.1, gpt-5 and the o-series
+	Cl100kBase Encoding = "cl100k_base" // gpt-4 and gpt-3.5
+)
+
+// Chat format overhead of OpenAI models, from the tiktoken cookbook.
+const (
+	tokensPerMessage = 3 // <|start|>role ... <|end|>
+	tokensPerName    = 1
+	tokensPerReply   = 3 // every reply is primed with <|start|>assistant<|message|>
+)
+
+// EncodingForModel returns the encoding of an OpenAI model, o200k_base for unknown models.
+func EncodingForModel(model string) Encoding {
+	if strings.HasPrefix(model, "gpt-4o") || strings.HasPrefix(model, "gpt-4.") {
+		return O200kBase
+	}
+	for _, prefix := range []string{"gpt-4", "gpt-3.5", "text-embedding-"} {
+		if strings.HasPrefix(model, prefix) {
+			return Cl100kBase
+		}
+	}
+	return O200kBase
+}
+
+// Counter counts the tokens of a text.
+type Counter interface {
+	Count(text string) int
+}
+
+// CounterFunc adapts a function to Counter.
+type CounterFunc func(text string) int
+
+func (f CounterFunc) Count(text string) int { return f(text) }
+
+var (
+	countersMu sync.RWMutex
+	counters   = map[Encoding]Counter{}
+)
+
+// Register makes c the counter of enc, e.g. an exact tiktoken implementation instead of the
+// estimate. It is safe for concurrent use.
+func Register(enc Encoding, c Counter) {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	counters[enc] = c
+}
+
+// ForEncoding returns the counter registered for enc, or the estimate.
+func ForEncoding(enc Encoding) Counter {
+	countersMu.RLock()
+	defer countersMu.RUnlock()
+	if c, ok := counters[enc]; ok {
+		return c
+	}
+	return CounterFunc(Estimate)
+}
+
+// ForModel returns the counter of the encoding of model.
+func ForModel(model string) Counter {
+	return ForEncoding(EncodingForModel(model))
+}
+
+// Count returns the tokens of text for model.
+func Count(model, text string) int {
+	return ForModel(model).Count(text)
+}
+
+// CountMessages returns the prompt tokens of a request made of messages, including the chat
+// format overhead: their content, names and tool calls.
+func CountMessages(c Counter, messages []*schema.Message) int {
+	n := tokensPerReply
+	for _, msg := range messages {
+		n += tokensPerMessage + c.Count(string(msg.Role)) + c.Count(msg.Content)
+		if msg.Name != "" {
+			n += tokensPerName + c.Count(msg.Name)
+		}
+		for _, call := range msg.ToolCalls {
+			n += c.Count(call.Function.Name) + c.Count(call.Function.Arguments)
+		}
+	}
+	return n
+}
+
+// CountTools returns the prompt tokens of the definitions of tools, counted on their JSON schema.
+func CountTools(c Counter, tools []*schema.ToolInfo) (int, error) {
+	n := 0
+	for _, info := range tools {
+		n += c.Count(info.Name) + c.Count(info.Desc)
+		if info.ParamsOneOf == nil {
+			continue
+		}
+		params, err := info.ParamsOneOf.ToJSONSchema()
+		if err != nil {
+			return 0, fmt.Errorf("tokens: tool %s: %w", info.Name, err)
+		}
+		data, err := json.Marshal(params)
+		if err != nil {
+			return 0, fmt.Errorf("tokens: tool %s: %w", info.Name, err)
+		}
+		n += c.Count(string(data))
+	}
+	return n, nil
+}
+
+// Estimate returns an estimate of the tokens of text, see the package documentation.
+func Estimate(text string) int {
+	n := 0
+	for len(text) > 0 {
+		piece, tokens := nextPiece(text)
+		text = text[len(piece):]
+		n += tokens
+	}
+	return n
+}
+
+// nextPiece returns the first pre-tokenizer piece of s, which is not empty, and its tokens.
+func nextPiece(s string) (string, int) {
+	r, size := utf8.DecodeRuneInString(s)
+	switch {
+	case r == '\n' || r == '\r':
+		// newlines, with the indentation of the next line
+		end := scan(s, 0, func(r rune) bool { return r == '\n' || r == '\r' })
+		end = scan(s, end, func(r rune) bool { return r == ' ' || r == '\t' })
+		return s[:end], 1 + (end-1)/8
+	case unicode.IsSpace(r):
+		end := scan(s, 0, func(r rune) bool { return unicode.IsSpace(r) && r != '\n' && r != '\r' })
+		if end < len(s) && end > 0 && (s[end] != '\n' && s[end] != '\r') {
+			// the last space belongs to the next word or punctuation
+			end--
+		}
+		if end == 0 {
+			piece, tokens := nextPiece(s[size:])
+			return s[:size+len(piece)], tokens
+		}
+		return s[:end], 1 + (end-1)/8
+	case unicode.IsLetter(r):
+		end := scan(s, 0, unicode.IsLetter)
+		return s[:end], wordTokens(s[:end])
+	case unicode.IsDigit(r):
+		end := scan(s, 0, unicode.IsDigit)
+		return s[:end], (utf8.RuneCountInString(s[:end]) + 2) / 3
+	}
+	// punctuation, with the letters right after a single punctuation rune (".go", "_test", "'s")
+	end := scan(s, 0, func(r rune) bool { return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if end == size && end < len(s) {
+		if next, _ := utf8.DecodeRuneInString(s[end:]); unicode.IsLetter(next) {
+			word := scan(s, end, unicode.IsLetter)
+			return s[:word], wordTokens(s[end:word])
+		}
+	}
+	return s[:end], (utf8.RuneCountInString(s[:end]) + 1) / 2
+}
+
+// wordTokens estimates the tokens of a run of letters: a token per part of a camelCase word, long
+// parts being split further, and a token per rune in scripts written without spaces.
+func wordTokens(word string) int {
+	n, part := 0, 0
+	prevLower := false
+	flush := func() {
+		if part > 0 {
+			n += 1 + (part-1)/7
+		}
+		part = 0
+	}
+	for _, r := range word {
+		switch {
+		case r >= 0x2E80 && !unicode.Is(unicode.Latin, r):
+			flush()
+			n++
+			prevLower = false
+			continue
+		case unicode.IsUpper(r) && prevLower:
+			flush()
+		}
+		part++
+		prevLower = unicode.IsLower(r)
+	}
+	flush()
+	return n
+}
+
+// scan returns the offset of the first rune of s from start not matching f.
+func scan(s string, start int, f func(rune) bool) int {
+	for i, r := range s[start:] {
+		if !f(r) {
+			return start + i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,70 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimate(t *testing.T) {
+	for text, want := range map[string]int{
+		"":              0,
+		"hello world":   2, // as o200k_base
+		"Hello, world!": 4, // as o200k_base
+		"  x":           2, // "  x" is " " and " x"
+		"1234567":       3, // digits go by three
+		"FinalizeTool":  3, // "Final" "ize" "Tool"
+		"a_test.go":     3, // "a" "_test" ".go"
+		"你好":            2,
+	} {
+		assert.Equal(t, want, Estimate(text), "%q", text)
+	}
+
+	src := "func (r *Runner) Fits(ctx context.Context) bool {\n\tif r == nil {\n\t\treturn false\n\t}\n\treturn true\n}\n"
+	n := Estimate(src)
+	assert.Greater(t, n, len(src)/6)
+	assert.Less(t, n, len(src)/2)
+}
+
+func TestEncodingForModel(t *testing.T) {
+	assert.Equal(t, O200kBase, EncodingForModel("gpt-4o-mini"))
+	assert.Equal(t, O200kBase, EncodingForModel("gpt-4.1"))
+	assert.Equal(t, O200kBase, EncodingForModel("o3"))
+	assert.Equal(t, O200kBase, EncodingForModel("unknown"))
+	assert.Equal(t, Cl100kBase, EncodingForModel("gpt-4-turbo"))
+	assert.Equal(t, Cl100kBase, EncodingForModel("gpt-3.5-turbo"))
+}
+
+func TestRegister(t *testing.T) {
+	runes := CounterFunc(func(s string) int { return len([]rune(s)) })
+	Register(Cl100kBase, runes)
+	defer Register(Cl100kBase, CounterFunc(Estimate))
+	assert.Equal(t, 11, Count("gpt-4", "hello world"))
+	assert.Equal(t, 2, Count("gpt-4o", "hello world"))
+}
+
+func TestCountMessagesAndTools(t *testing.T) {
+	one := CounterFunc(func(s string) int {
+		if s == "" {
+			return 0
+		}
+		return 1
+	})
+	msgs := []*schema.Message{
+		schema.SystemMessage("be brief"),
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{Function: schema.FunctionCall{Name: "go_test", Arguments: "{}"}}}},
+	}
+	// reply priming, then per message the overhead, the role and the content or the call
+	assert.Equal(t, 3+(3+1+1)+(3+1+2), CountMessages(one, msgs))
+
+	n, err := CountTools(one, []*schema.ToolInfo{
+		{Name: "go_test", Desc: "run tests", ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"workdir": {Type: schema.String, Required: true},
+		})},
+		{Name: "noop"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3+1, n)
+}
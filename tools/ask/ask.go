@@ -0,0 +1,140 @@
+package ask
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/history"
+	"github.com/stumble/axe/tools"
+)
+
+const (
+	AskUserToolName = "ask_user"
+)
+
+// AskFunc asks the user a question and returns the answer. choices may be empty for free-form
+// answers. It should return when ctx is done.
+type AskFunc func(ctx context.Context, question string, choices []string) (string, error)
+
+// AskUserTool lets the agent ask the user for clarification instead of guessing. Questions and
+// answers are recorded in the changelog.
+type AskUserTool struct {
+	Ask       AskFunc
+	Changelog *history.Changelog
+}
+
+type AskUserRequest struct {
+	Question string   `json:"question"`
+	Choices  []string `json:"choices,omitempty"`
+}
+
+func (t *AskUserTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: AskUserToolName,
+		Desc: "Ask the user a clarifying question when the instruction is ambiguous or missing information you cannot find in the code. Ask one precise question at a time; do not ask for things you can decide yourself.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"question": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "The question, with enough context to be answered without reading the code.",
+			},
+			"choices": {
+				Type:     schema.Array,
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+				Desc:     "Possible answers, if the question has a fixed set of them.",
+			},
+		}),
+	}, nil
+}
+
+func (t *AskUserTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Ask == nil {
+		return "", errors.New("ask_user: tool not initialized with an AskFunc")
+	}
+	var req AskUserRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("ask_user: invalid arguments: %v", err), nil
+	}
+	question := strings.TrimSpace(req.Question)
+	if question == "" {
+		return "ask_user: question is required", nil
+	}
+
+	tools.Logger(ctx).Debug().Str("question", question).Msg("ask_user: asking user")
+	answer, err := t.Ask(ctx, question, req.Choices)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("ask_user: %w", err)
+		}
+		// let the agent proceed on its own judgement
+		return fmt.Sprintf("ask_user: the user could not be asked: %v. Proceed with your best judgement and mention the assumption in the changelog.", err), nil
+	}
+	answer = strings.TrimSpace(answer)
+	if t.Changelog != nil {
+		t.Changelog.Questions = append(t.Changelog.Questions, history.Question{Question: question, Answer: answer})
+	}
+	if answer == "" {
+		return "The user gave no answer. Proceed with your best judgement and mention the assumption in the changelog.", nil
+	}
+	return "User answer: " + answer, nil
+}
+
+// StdinAsker returns an AskFunc that prints questions to out and reads one line answers from in,
+// e.g. os.Stdin and os.Stdout. A numeric answer selects the corresponding choice.
+func StdinAsker(in io.Reader, out io.Writer) AskFunc {
+	var mu sync.Mutex
+	lines := make(chan string)
+	var readErr error // set before lines is closed
+	var startReader sync.Once
+	return func(ctx context.Context, question string, choices []string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// a single reader goroutine survives cancelled questions, so no input line is lost
+		startReader.Do(func() {
+			go func() {
+				scanner := bufio.NewScanner(in)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+				readErr = scanner.Err()
+				if readErr == nil {
+					readErr = io.EOF
+				}
+				close(lines)
+			}()
+		})
+
+		fmt.Fprintf(out, "\n[axe] %s\n", question)
+		for i, c := range choices {
+			fmt.Fprintf(out, "  %d) %s\n", i+1, c)
+		}
+		fmt.Fprint(out, "> ")
+
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return "", readErr
+			}
+			return resolveChoice(strings.TrimSpace(line), choices), nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func resolveChoice(answer string, choices []string) string {
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+		return choices[n-1]
+	}
+	return answer
+}
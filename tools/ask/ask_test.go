@@ -0,0 +1,84 @@
+package ask
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe/history"
+)
+
+func TestAskUserTool_RecordsQuestionAndAnswer(t *testing.T) {
+	var changelog history.Changelog
+	tool := &AskUserTool{
+		Ask: func(_ context.Context, question string, choices []string) (string, error) {
+			assert.Equal(t, "Which package?", question)
+			assert.Equal(t, []string{"a", "b"}, choices)
+			return " b \n", nil
+		},
+		Changelog: &changelog,
+	}
+
+	out, err := tool.InvokableRun(context.Background(), `{"question":" Which package? ","choices":["a","b"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, "User answer: b", out)
+	assert.Equal(t, []history.Question{{Question: "Which package?", Answer: "b"}}, changelog.Questions)
+}
+
+func TestAskUserTool_InvalidArgumentsAndFailures(t *testing.T) {
+	failing := &AskUserTool{Ask: func(context.Context, string, []string) (string, error) {
+		return "", errors.New("no terminal")
+	}}
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"malformed json", `{`, "ask_user: invalid arguments"},
+		{"empty question", `{"question":"  "}`, "ask_user: question is required"},
+		{"ask fails", `{"question":"why?"}`, "the user could not be asked: no terminal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := failing.InvokableRun(context.Background(), tt.args)
+			require.NoError(t, err)
+			assert.Contains(t, out, tt.want)
+		})
+	}
+}
+
+func TestStdinAsker(t *testing.T) {
+	var out bytes.Buffer
+	asker := StdinAsker(strings.NewReader("2\nfree text\n"), &out)
+
+	answer, err := asker(context.Background(), "Pick one", []string{"red", "green"})
+	require.NoError(t, err)
+	assert.Equal(t, "green", answer)
+	assert.Contains(t, out.String(), "[axe] Pick one\n  1) red\n  2) green\n> ")
+
+	answer, err = asker(context.Background(), "Anything else?", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "free text", answer)
+
+	_, err = asker(context.Background(), "More?", nil)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestStdinAsker_Cancelled(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	asker := StdinAsker(r, io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := asker(ctx, "Still there?", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,18 @@
+package clitool
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiEscape matches CSI sequences (colors, cursor moves), OSC sequences (window titles,
+// hyperlinks) and the other two-character escapes.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripANSI removes the ANSI escape sequences of s.
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiEscape.ReplaceAllString(s, "")
+}
@@ -10,12 +10,14 @@ import (
 	"os/exec"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	"github.com/mattn/go-shellwords"
-	"github.com/rs/zerolog/log"
+
+	"github.com/stumble/axe/tools"
 )
 
 // Definition describes a CLI tool that can be exposed to the agent.
@@ -27,6 +29,31 @@ type Definition struct {
 	Desc    string
 	Args    []string          // parsed from command
 	Env     map[string]string // merged with envs from command, env map has higher precedence than envs from command.
+	// Shell runs Command with /bin/sh -c instead of parsing it, for pipelines, redirections and
+	// other shell features. The arguments of a call are passed as positional parameters ($1, $2,
+	// "$@"), never spliced into the script. See NewShellDefinition.
+	Shell bool
+	// TTY runs the command in a pseudo-terminal with a PTYExecutor, unless the tool has an Executor.
+	TTY bool
+	// Processors reduce the outcome before it is returned to the model. See WithProcessors.
+	Processors []OutputProcessor
+	// HintRules classify failed calls to add recovery hints to their response, DefaultHintRules
+	// when nil. See WithHintRules.
+	HintRules []HintRule
+	// Params, if set, replaces the generic "args" parameter with typed parameters rendered into argv.
+	Params []Param
+	// Workdir, if set, is the working directory of the command instead of one chosen by the model.
+	// See WithWorkdir.
+	Workdir string
+}
+
+// WithParams returns a copy of d exposing the given typed parameters instead of the generic "args" array.
+func (d Definition) WithParams(params ...Param) (Definition, error) {
+	if err := validateParams(params); err != nil {
+		return Definition{}, err
+	}
+	d.Params = params
+	return d, nil
 }
 
 func MustNewDefinition(name, command, desc string, env map[string]string) Definition {
@@ -56,16 +83,44 @@ func NewDefinition(name, command, desc string, env map[string]string) (Definitio
 	}, nil
 }
 
+// shellPath is the shell running the commands of definitions with Shell set.
+const shellPath = "/bin/sh"
+
+// NewShellDefinition returns a definition running script with /bin/sh -c, e.g.
+// `go vet "$@" 2>&1 | head -n 50`. The arguments of a call are the positional parameters of the
+// script, so quote them ("$@", "$1") like in any shell script.
+func NewShellDefinition(name, script, desc string, env map[string]string) Definition {
+	return Definition{
+		Name:    name,
+		Command: script,
+		Desc:    desc,
+		Env:     env,
+		Shell:   true,
+	}
+}
+
+// argv returns the command line of a call with the given arguments.
+func (d Definition) argv(args []string) []string {
+	if d.Shell {
+		// $0 is the tool name, for error messages of the shell
+		return append([]string{shellPath, "-c", d.Command, d.Name}, args...)
+	}
+	return append(append([]string{}, d.Args...), args...)
+}
+
 // Outcome describes the result of a subprocess execution.
 type Outcome struct {
 	Ran         bool
 	Command     string
+	Workdir     string // where the command ran, set by CliTool
 	ExitCode    int
 	Duration    time.Duration
 	Stdout      string
 	Stderr      string
 	StartedAt   time.Time
 	CompletedAt time.Time
+	// Hints explain how to recover from the failure, set by CliTool. See HintRule.
+	Hints []string
 }
 
 // String renders a human-readable summary of the subprocess outcome.
@@ -102,24 +157,85 @@ func (o Outcome) String() string {
 			b.WriteString("\n")
 		}
 	}
+	if len(o.Hints) > 0 {
+		b.WriteString("Hints:\n")
+		for _, hint := range o.Hints {
+			b.WriteString("- " + hint + "\n")
+		}
+	}
 	return b.String()
 }
 
+// Clipped returns o with its stdout and stderr clipped to limit runes each, keeping their head and
+// tail like the executors do; a limit <= 0 keeps them whole.
+func (o Outcome) Clipped(limit int) Outcome {
+	o.Stdout = justClipString(o.Stdout, limit)
+	o.Stderr = justClipString(o.Stderr, limit)
+	return o
+}
+
+// processWaitDelay bounds how long Execute waits for output pipes to close after the command
+// was killed on cancellation.
+const processWaitDelay = 5 * time.Second
+
+// Heartbeat reports the progress of a command that is still running.
+type Heartbeat struct {
+	Command     string
+	Elapsed     time.Duration
+	StdoutBytes int64
+	StderrBytes int64
+}
+
+// Executor runs a command and reports its outcome. SubprocessExecutor is the default; tests may
+// substitute a fake.
+type Executor interface {
+	Execute(ctx context.Context, argv []string, env map[string]string, workdir string) Outcome
+}
+
 // SubprocessExecutor runs commands using exec.CommandContext without a shell.
-type SubprocessExecutor struct{}
+// When HeartbeatInterval and OnHeartbeat are set, OnHeartbeat is called periodically while the
+// command runs.
+type SubprocessExecutor struct {
+	HeartbeatInterval time.Duration
+	OnHeartbeat       func(ctx context.Context, hb Heartbeat)
+	// OutputLimit clips stdout and stderr to this many runes (keeping head and tail).
+	// 0 uses DefaultOutputLimit, a negative value keeps the full output.
+	OutputLimit int
+	// KeepANSI keeps the ANSI escape sequences (colors, cursor moves) of the output, which are
+	// removed by default before clipping: they cost tokens and confuse models.
+	KeepANSI bool
+}
+
+// DefaultOutputLimit is the number of runes of stdout and stderr kept by default.
+const DefaultOutputLimit = 3000
 
 func (e *SubprocessExecutor) Execute(ctx context.Context, argv []string, env map[string]string, workdir string) Outcome {
-	// #nosec G204 - argv[0] originates from trusted Definition, not user input; no shell is used.
+	// #nosec G204 - argv[0] originates from trusted Definition, not user input; arguments are never
+	// parsed by a shell, shell definitions get them as positional parameters.
 	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Dir = workdir
 	cmd.Env = append(os.Environ(), flattenEnv(env)...)
+	configureProcessGroup(cmd)
+	// don't hang on pipes kept open by processes that escaped the group kill
+	cmd.WaitDelay = processWaitDelay
 
-	var stdoutBuf, stderrBuf bytes.Buffer
+	var stdoutBuf, stderrBuf countingBuffer
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
 	start := time.Now()
+	stopHeartbeat := e.startHeartbeat(ctx, strings.Join(argv, " "), start, &stdoutBuf, &stderrBuf)
 	err := cmd.Run()
+	stopHeartbeat()
+	stdout, stderr := stdoutBuf.String(), stderrBuf.String()
+	if e == nil || !e.KeepANSI {
+		stdout, stderr = stripANSI(stdout), stripANSI(stderr)
+	}
+	return newOutcome(ctx, argv, start, err, stdout, stderr, e.outputLimit())
+}
+
+// newOutcome returns the outcome of a command that started at start and returned err.
+func newOutcome(ctx context.Context, argv []string, start time.Time, err error, stdout, stderr string, limit int) Outcome {
 	duration := time.Since(start)
 
 	exitCode := 0
@@ -135,9 +251,6 @@ func (e *SubprocessExecutor) Execute(ctx context.Context, argv []string, env map
 		}
 	}
 
-	stdout := stdoutBuf.String()
-	stderr := stderrBuf.String()
-
 	if err != nil && exitErr == nil && !isTimedOut {
 		if stderr != "" && !strings.HasSuffix(stderr, "\n") {
 			stderr += "\n"
@@ -145,17 +258,92 @@ func (e *SubprocessExecutor) Execute(ctx context.Context, argv []string, env map
 		stderr += "command error: " + err.Error()
 	}
 
-	outcome := Outcome{
+	return Outcome{
 		Ran:         true,
 		Command:     strings.Join(argv, " "),
 		ExitCode:    exitCode,
 		Duration:    duration,
-		Stdout:      justClipString(stdout, 3000),
-		Stderr:      justClipString(stderr, 3000),
+		Stdout:      justClipString(stdout, limit),
+		Stderr:      justClipString(stderr, limit),
 		StartedAt:   start,
 		CompletedAt: start.Add(duration),
 	}
-	return outcome
+}
+
+func (e *SubprocessExecutor) outputLimit() int {
+	if e == nil {
+		return DefaultOutputLimit
+	}
+	return outputLimit(e.OutputLimit)
+}
+
+func outputLimit(limit int) int {
+	if limit == 0 {
+		return DefaultOutputLimit
+	}
+	return limit
+}
+
+func (e *SubprocessExecutor) startHeartbeat(ctx context.Context, command string, start time.Time, stdout, stderr *countingBuffer) func() {
+	if e == nil {
+		return func() {}
+	}
+	return startHeartbeat(ctx, e.HeartbeatInterval, e.OnHeartbeat, command, start, stdout, stderr)
+}
+
+// startHeartbeat emits heartbeats until the returned stop function is called.
+func startHeartbeat(ctx context.Context, interval time.Duration, onHeartbeat func(ctx context.Context, hb Heartbeat), command string, start time.Time, stdout, stderr *countingBuffer) func() {
+	if interval <= 0 || onHeartbeat == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				onHeartbeat(ctx, Heartbeat{
+					Command:     command,
+					Elapsed:     now.Sub(start),
+					StdoutBytes: stdout.Len(),
+					StderrBytes: stderr.Len(),
+				})
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// countingBuffer is a bytes.Buffer whose length can be read while the command is writing to it.
+type countingBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *countingBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *countingBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(b.buf.Len())
+}
+
+func (b *countingBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
 
 // ---------------------- Tool integration for LLM invocation ----------------------
@@ -166,6 +354,16 @@ func (e *SubprocessExecutor) Execute(ctx context.Context, argv []string, env map
 type CliTool struct {
 	// Def describes the base command configuration.
 	Def Definition
+	// HeartbeatInterval and OnHeartbeat are passed to the SubprocessExecutor. A custom Executor
+	// gets heartbeats too, which report no output since it is only known when the command ends.
+	HeartbeatInterval time.Duration
+	OnHeartbeat       func(ctx context.Context, hb Heartbeat)
+	// OnOutcome, if set, is called with the outcome of every execution.
+	OnOutcome func(ctx context.Context, outcome Outcome)
+	// Executor runs the command, a SubprocessExecutor when nil.
+	Executor Executor
+	// BaseDir is the directory relative Def.Workdir resolve against, the current directory when empty.
+	BaseDir string
 }
 
 type CliToolRequest struct {
@@ -176,26 +374,48 @@ type CliToolRequest struct {
 
 // Info describes the tool to the model.
 func (t *CliTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	params := map[string]*schema.ParameterInfo{
+		workdirParam: {
+			Type:     schema.String,
+			Required: true,
+			Desc:     "Working directory to execute the command in. Make sure to run the command in the correct working directory if the target was not specified by using the 'args' parameter.",
+		},
+	}
+	if t.Def.Workdir != "" {
+		if err := validateWorkdir(t.Def.Workdir, t.Def.Params); err != nil {
+			return nil, err
+		}
+		delete(params, workdirParam)
+	}
+	if len(t.Def.Params) > 0 {
+		if err := validateParams(t.Def.Params); err != nil {
+			return nil, err
+		}
+		if info, ok := params[workdirParam]; ok {
+			info.Desc = "Working directory to execute the command in."
+		}
+		for _, p := range t.Def.Params {
+			params[p.Name] = p.info()
+		}
+	} else {
+		params["args"] = &schema.ParameterInfo{
+			Type: schema.String,
+			Desc: "Arguments to append to the configured command. This MUST be a JSON string encoding an array of strings, representing the arguments to append to the command. For example, [\"arg1\", \"arg2\"]",
+		}
+		if t.Def.Shell {
+			params["args"].Desc = "Arguments passed to the command as positional parameters ($1, $2, ...). This MUST be a JSON string encoding an array of strings. For example, [\"arg1\", \"arg2\"]"
+		}
+	}
 	return &schema.ToolInfo{
-		Name: t.Def.Name,
-		Desc: t.Def.Desc,
-		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
-			"args": {
-				Type: schema.String,
-				Desc: "Arguments to append to the configured command. This MUST be a JSON string encoding an array of strings, representing the arguments to append to the command. For example, [\"arg1\", \"arg2\"]",
-			},
-			"workdir": {
-				Type:     schema.String,
-				Required: true,
-				Desc:     "Working directory to execute the command in. Make sure to run the command in the correct working directory if the target was not specified by using the 'args' parameter.",
-			},
-		}),
+		Name:        t.Def.Name,
+		Desc:        t.Def.Desc,
+		ParamsOneOf: schema.NewParamsOneOfByParams(params),
 	}, nil
 }
 
 // InvokableRun executes the configured command with request overrides and returns a JSON outcome.
 func (t *CliTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
-	log.Debug().Msgf("clitool: executing command: %s with arguments: %s", t.Def.Command, argumentsInJSON)
+	tools.Logger(ctx).Debug().Msgf("clitool: executing command: %s with arguments: %s", t.Def.Command, argumentsInJSON)
 	if strings.TrimSpace(argumentsInJSON) == "" {
 		argumentsInJSON = "{}"
 	}
@@ -205,25 +425,66 @@ func (t *CliTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ..
 		return fmt.Sprintf("clitool: invalid arguments: %v", err), nil
 	}
 
-	if req.Workdir == "" {
+	workdir := req.Workdir
+	if t.Def.Workdir != "" {
+		resolved, err := t.Def.resolveWorkdir(t.BaseDir, argumentsInJSON)
+		if err != nil {
+			return fmt.Sprintf("%s: %v", t.Def.Name, err), nil
+		}
+		workdir = resolved
+	} else if workdir == "" {
 		return fmt.Sprintf("%s: workdir is required", t.Def.Name), nil
 	}
 
-	if req.ArgsJSONString == "" {
-		// default to empty array
-		req.ArgsJSONString = "[]"
-	}
-
 	var argv []string
-	if err := json.Unmarshal([]byte(req.ArgsJSONString), &argv); err != nil {
-		return fmt.Sprintf("clitool: invalid arguments: %v", err), nil
+	if len(t.Def.Params) > 0 {
+		params := make([]Param, 0, len(t.Def.Params))
+		for _, p := range t.Def.Params {
+			if !t.Def.usesParam(p.Name) {
+				params = append(params, p)
+			}
+		}
+		rendered, err := renderParams(params, argumentsInJSON)
+		if err != nil {
+			return fmt.Sprintf("%s: %v", t.Def.Name, err), nil
+		}
+		argv = rendered
+	} else {
+		if req.ArgsJSONString == "" {
+			// default to empty array
+			req.ArgsJSONString = "[]"
+		}
+		if err := json.Unmarshal([]byte(req.ArgsJSONString), &argv); err != nil {
+			return fmt.Sprintf("clitool: invalid arguments: %v", err), nil
+		}
 	}
-	argv = append(append([]string{}, t.Def.Args...), argv...)
-	workdir := req.Workdir
+	argv = t.Def.argv(argv)
 
 	// Execute
-	exec := &SubprocessExecutor{}
+	limit := 0
+	if len(t.Def.Processors) > 0 {
+		// processors see the full output, the result is clipped
+		limit = -1
+	}
+	exec := t.Executor
+	stopHeartbeat := func() {}
+	switch {
+	case exec != nil:
+		stopHeartbeat = startHeartbeat(ctx, t.HeartbeatInterval, t.OnHeartbeat, strings.Join(argv, " "), time.Now(), &countingBuffer{}, &countingBuffer{})
+	case t.Def.TTY:
+		exec = &PTYExecutor{HeartbeatInterval: t.HeartbeatInterval, OnHeartbeat: t.OnHeartbeat, OutputLimit: limit}
+	default:
+		exec = &SubprocessExecutor{HeartbeatInterval: t.HeartbeatInterval, OnHeartbeat: t.OnHeartbeat, OutputLimit: limit}
+	}
 	outcome := exec.Execute(ctx, argv, t.Def.Env, workdir)
+	stopHeartbeat()
+	outcome.Workdir = workdir
+	// classify the full output, processors may drop what the rules look for
+	outcome.Hints = t.Def.hints(outcome)
+	if t.OnOutcome != nil {
+		t.OnOutcome(ctx, outcome)
+	}
+	outcome = t.Def.process(outcome)
 	// Return dedicated Output string instead of Outcome JSON for better readability.
 	return outcome.String(), nil
 }
@@ -3,9 +3,12 @@ package clitool
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,6 +47,31 @@ func TestSubprocessExecutor_Timeout(t *testing.T) {
 	assert.Equal(t, -1, out.ExitCode)
 }
 
+func TestSubprocessExecutor_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var beats []Heartbeat
+	exec := &SubprocessExecutor{
+		HeartbeatInterval: 50 * time.Millisecond,
+		OnHeartbeat: func(_ context.Context, hb Heartbeat) {
+			mu.Lock()
+			defer mu.Unlock()
+			beats = append(beats, hb)
+		},
+	}
+	argv := []string{"/bin/sh", "-c", "printf abc; sleep 0.3"}
+	out := exec.Execute(ctx, argv, nil, "")
+	assert.Equal(t, 0, out.ExitCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, beats)
+	last := beats[len(beats)-1]
+	assert.Equal(t, "/bin/sh -c printf abc; sleep 0.3", last.Command)
+	assert.Equal(t, int64(3), last.StdoutBytes)
+	assert.Greater(t, last.Elapsed, time.Duration(0))
+}
+
 func TestSubprocessExecutor_EnvPropagation(t *testing.T) {
 	ctx := context.Background()
 	exec := &SubprocessExecutor{}
@@ -206,6 +234,43 @@ func TestCliTool_InvokableRun_TimeoutExitCode(t *testing.T) {
 	assert.Contains(t, resp, "Result: timed out")
 }
 
+// slowExecutor succeeds after a delay without running anything.
+type slowExecutor struct{ delay time.Duration }
+
+func (e slowExecutor) Execute(_ context.Context, argv []string, _ map[string]string, _ string) Outcome {
+	time.Sleep(e.delay)
+	return Outcome{Ran: true, Command: strings.Join(argv, " ")}
+}
+
+func TestCliTool_InvokableRun_CustomExecutorHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	var beats []Heartbeat
+	tool := &CliTool{
+		Def:               MustNewDefinition("echo", "/bin/echo", "", nil),
+		Executor:          slowExecutor{delay: 200 * time.Millisecond},
+		HeartbeatInterval: 20 * time.Millisecond,
+		OnHeartbeat: func(_ context.Context, hb Heartbeat) {
+			mu.Lock()
+			defer mu.Unlock()
+			beats = append(beats, hb)
+		},
+	}
+	data, _ := json.Marshal(map[string]any{"workdir": t.TempDir(), "args": `["hi"]`})
+	_, err := tool.InvokableRun(context.Background(), string(data))
+	require.NoError(t, err)
+
+	mu.Lock()
+	n := len(beats)
+	require.NotZero(t, n)
+	assert.Equal(t, "/bin/echo hi", beats[0].Command)
+	assert.Zero(t, beats[0].StdoutBytes, "the output of a custom executor is only known at the end")
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, beats, n, "heartbeats stop when the command ends")
+}
+
 func TestCliTool_InvokableRun_WorkdirUsed(t *testing.T) {
 	ctx := context.Background()
 	dir := t.TempDir()
@@ -328,3 +393,260 @@ func TestOutcome_String_Timeout(t *testing.T) {
 	s := out.String()
 	assert.Contains(t, s, "Result: timed out")
 }
+
+func TestOutcome_Clipped(t *testing.T) {
+	out := Outcome{Stdout: "abcdefghij", Stderr: "shor"}.Clipped(4)
+	assert.Equal(t, "ab"+truncatedMarker+"ij", out.Stdout)
+	assert.Equal(t, "shor", out.Stderr)
+	assert.Equal(t, "abcdefghij", Outcome{Stdout: "abcdefghij"}.Clipped(0).Stdout)
+}
+
+func TestCliTool_Params_InfoAndArgv(t *testing.T) {
+	def, err := MustNewDefinition("gotest", `/bin/sh -c 'printf "%s|" "$@"' sh`, "", nil).WithParams(
+		Param{Name: "package", Type: schema.String, Required: true},
+		Param{Name: "run", Type: schema.String, Flag: "-run"},
+		Param{Name: "count", Type: schema.Integer, Template: "-count={value}"},
+		Param{Name: "verbose", Type: schema.Boolean, Flag: "-v"},
+		Param{Name: "tags", Type: schema.Array, Flag: "-tags"},
+		Param{Name: "mode", Type: schema.String, Enum: []string{"set", "atomic"}, Flag: "-covermode"},
+	)
+	require.NoError(t, err)
+	tool := &CliTool{Def: def}
+
+	info, err := tool.Info(context.Background())
+	require.NoError(t, err)
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	_, hasArgs := js.Properties.Get("args")
+	assert.False(t, hasArgs)
+	assert.ElementsMatch(t, []string{"package", "workdir"}, js.Required)
+
+	args, _ := json.Marshal(map[string]any{
+		"workdir": t.TempDir(),
+		"package": "./...",
+		"run":     "Test Foo",
+		"count":   1,
+		"verbose": true,
+		"tags":    []string{"a", "b"},
+	})
+	resp, err := tool.InvokableRun(context.Background(), string(args))
+	require.NoError(t, err)
+	assert.Contains(t, resp, "./...|-run|Test Foo|-count=1|-v|-tags|a|-tags|b|")
+}
+
+func TestCliTool_Params_InvalidValues(t *testing.T) {
+	def, err := MustNewDefinition("echo", "/bin/echo", "", nil).WithParams(
+		Param{Name: "package", Type: schema.String, Required: true},
+		Param{Name: "mode", Type: schema.String, Enum: []string{"set", "atomic"}},
+		Param{Name: "count", Type: schema.Integer},
+	)
+	require.NoError(t, err)
+	tool := &CliTool{Def: def}
+	dir := t.TempDir()
+
+	cases := map[string]string{
+		`{"workdir":"` + dir + `"}`:                              "parameter package is required",
+		`{"workdir":"` + dir + `","package":"x","mode":"count"}`: `value "count" is not one of set, atomic`,
+		`{"workdir":"` + dir + `","package":"x","count":1.5}`:    "expected an integer",
+		`{"workdir":"` + dir + `","package":true}`:               "expected a string",
+	}
+	for in, want := range cases {
+		resp, err := tool.InvokableRun(context.Background(), in)
+		require.NoError(t, err)
+		assert.Contains(t, resp, want, in)
+	}
+}
+
+func TestDefinition_WithParams_Validation(t *testing.T) {
+	base := MustNewDefinition("echo", "/bin/echo", "", nil)
+	_, err := base.WithParams(Param{Name: "workdir", Type: schema.String})
+	assert.ErrorContains(t, err, "reserved")
+	_, err = base.WithParams(Param{Name: "a", Type: schema.String}, Param{Name: "a", Type: schema.String})
+	assert.ErrorContains(t, err, "duplicate")
+	_, err = base.WithParams(Param{Name: "a", Type: schema.Integer, Enum: []string{"1"}})
+	assert.ErrorContains(t, err, "enum")
+	_, err = base.WithParams(Param{Name: "a", Type: schema.String, Template: "{flag}", Flag: "-a"})
+	assert.ErrorContains(t, err, "placeholder")
+}
+
+func TestCliTool_Workdir_Default(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(base, "sub"), 0o755))
+	def, err := MustNewDefinition("pwd", "/bin/sh -c pwd", "", nil).WithWorkdir("sub")
+	require.NoError(t, err)
+	tool := &CliTool{Def: def, BaseDir: base}
+
+	info, err := tool.Info(context.Background())
+	require.NoError(t, err)
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	_, hasWorkdir := js.Properties.Get("workdir")
+	assert.False(t, hasWorkdir, "the model doesn't choose the directory")
+
+	resp, err := tool.InvokableRun(context.Background(), `{"workdir":"/"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Result: succeeded")
+	assert.Contains(t, resp, filepath.Join(filepath.Base(base), "sub"))
+}
+
+func TestCliTool_Workdir_Template(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "pkg", "a"), 0o755))
+	def, err := MustNewDefinition("gotest", `/bin/sh -c 'pwd; printf "%s|" "$@"' sh`, "", nil).WithParams(
+		Param{Name: "package", Type: schema.String, Required: true},
+		Param{Name: "run", Type: schema.String, Flag: "-run"},
+	)
+	require.NoError(t, err)
+	def, err = def.WithWorkdir("{baseDir}/pkg/{package}")
+	require.NoError(t, err)
+	tool := &CliTool{Def: def, BaseDir: base}
+
+	resp, err := tool.InvokableRun(context.Background(), `{"package":"a","run":"TestA"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, filepath.Join("pkg", "a")+"\n")
+	assert.Contains(t, resp, "-run|TestA|")
+	assert.NotContains(t, resp, "a|", "the package is not rendered into argv")
+
+	for in, want := range map[string]string{
+		`{}`:                    "parameter package is required",
+		`{"package":"../.."}`:   "must be a relative path inside the base directory",
+		`{"package":"/etc"}`:    "must be a relative path inside the base directory",
+		`{"package":["a"]}`:     "expected a string",
+		`{"package":"missing"}`: "command error",
+	} {
+		resp, err := tool.InvokableRun(context.Background(), in)
+		require.NoError(t, err)
+		assert.Contains(t, resp, want, in)
+	}
+}
+
+func TestDefinition_WithWorkdir_Validation(t *testing.T) {
+	def, err := MustNewDefinition("echo", "/bin/echo", "", nil).WithParams(
+		Param{Name: "package", Type: schema.String},
+		Param{Name: "count", Type: schema.Integer},
+	)
+	require.NoError(t, err)
+	_, err = def.WithWorkdir("{baseDir}/{pkg}")
+	assert.ErrorContains(t, err, "unknown parameter {pkg}")
+	_, err = def.WithWorkdir("{count}")
+	assert.ErrorContains(t, err, "parameter count is not a string")
+	_, err = def.WithWorkdir("{baseDir}/{package}")
+	assert.NoError(t, err)
+}
+
+func TestCliTool_Shell(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\nthree\n"), 0o644))
+	tool := &CliTool{Def: NewShellDefinition("grep_head", `grep -n "$1" a.txt 2>&1 | head -n 1; echo "args: $#"`, "", nil)}
+
+	info, err := tool.Info(context.Background())
+	require.NoError(t, err)
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	args, ok := js.Properties.Get("args")
+	require.True(t, ok)
+	assert.Contains(t, args.Description, "positional parameters")
+
+	resp, err := tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`","args":"[\"t\"]"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Stdout:\n2:two\nargs: 1\n")
+
+	// arguments are data, not shell code
+	resp, err = tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`","args":"[\"x; echo injected\", \"$(echo injected)\"]"}`)
+	require.NoError(t, err)
+	assert.NotContains(t, resp, "\ninjected")
+	assert.Contains(t, resp, "args: 2\n")
+}
+
+func TestHelpers_cleanTerminalOutput(t *testing.T) {
+	assert.Equal(t, "ok\ndone 100%\nbye", cleanTerminalOutput("\x1b[1;32mok\x1b[0m\r\ndone  10%\rdone 100%\r\n\x1b]0;title\x07bye"))
+	assert.Equal(t, "plain\n", cleanTerminalOutput("plain\n"))
+}
+
+func TestCliTool_Processors(t *testing.T) {
+	var lines strings.Builder
+	for i := range 2000 {
+		fmt.Fprintf(&lines, "=== RUN TestN%d\n--- PASS: TestN%d (0.00s)\n", i, i)
+	}
+	lines.WriteString("--- FAIL: TestBroken (0.01s)\n    broken_test.go:7: want 1, got 2\nFAIL\n")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "out.txt"), []byte(lines.String()), 0o644))
+
+	failures, err := RegexpExtract(`(?m)^(?:--- FAIL|\s+\w+_test\.go:\d+).*$`)
+	require.NoError(t, err)
+	tool := &CliTool{Def: MustNewDefinition("test", "/bin/cat out.txt", "", nil).WithProcessors(failures)}
+	resp, err := tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Stdout:\n--- FAIL: TestBroken (0.01s)\n    broken_test.go:7: want 1, got 2\n", "the failure at the end survives clipping")
+	assert.NotContains(t, resp, "PASS")
+
+	upper := Stdout(strings.ToUpper)
+	tool = &CliTool{Def: MustNewDefinition("echo", "/bin/echo ok", "", nil).WithProcessors(upper)}
+	resp, err = tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Stdout:\nOK\n")
+
+	none, err := RegexpExtract(`panic: (.*)`)
+	require.NoError(t, err)
+	assert.Equal(t, "(no match for panic: (.*) in 3 bytes of output)\n", none(Outcome{Stdout: "ok\n"}).Stdout)
+	_, err = RegexpExtract(`(`)
+	assert.Error(t, err)
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := `{"Issues":[{"Text":"unused x","Pos":{"Line":3}}],"Report":{"ok":true}}`
+	for path, want := range map[string]string{
+		"Issues.0.Text":     "unused x",
+		"Issues[0].Pos":     "{\n  \"Line\": 3\n}\n",
+		"Report.ok":         "true\n",
+		"Issues.1":          "(Issues.1: no index \"Issues.1\")\n",
+		"Report.ok.missing": "(Report.ok.missing: no value at Report.ok.missing)\n",
+	} {
+		p, err := JSONPath(path)
+		require.NoError(t, err)
+		assert.Equal(t, want, p(Outcome{Stdout: doc}).Stdout, path)
+	}
+	p, err := JSONPath("Issues")
+	require.NoError(t, err)
+	assert.Equal(t, "not json", p(Outcome{Stdout: "not json"}).Stdout)
+	_, err = JSONPath("a..b")
+	assert.ErrorContains(t, err, "invalid JSON path")
+}
+
+func TestSubprocessExecutor_StripsANSI(t *testing.T) {
+	argv := []string{"/bin/sh", "-c", `printf '\033[1;31mFAIL\033[0m x\n'; printf '\033]8;;http://x\033\\link\033]8;;\033\\\n' >&2`}
+	out := (&SubprocessExecutor{}).Execute(context.Background(), argv, nil, "")
+	assert.Equal(t, "FAIL x\n", out.Stdout)
+	assert.Equal(t, "link\n", out.Stderr)
+
+	out = (&SubprocessExecutor{KeepANSI: true}).Execute(context.Background(), argv, nil, "")
+	assert.Equal(t, "\x1b[1;31mFAIL\x1b[0m x\n", out.Stdout)
+}
+
+func TestCliTool_Hints(t *testing.T) {
+	dir := t.TempDir()
+	script := `printf '%s\n' './main.go:3:2: undefined: foo' '--- FAIL: TestFoo (0.00s)' >&2; exit 2`
+	tool := &CliTool{Def: NewShellDefinition("build", script, "", nil)}
+	resp, err := tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Hints:\n- The code does not compile.")
+	assert.Contains(t, resp, "- Test TestFoo fails.")
+	assert.NotContains(t, resp, "Python")
+
+	// successful calls get no hints, even when their output matches
+	tool = &CliTool{Def: NewShellDefinition("ok", `echo 'permission denied'`, "", nil)}
+	resp, err = tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`"}`)
+	require.NoError(t, err)
+	assert.NotContains(t, resp, "Hints:")
+
+	custom := HintRule{Name: "lint", Pattern: regexp.MustCompile(`(\d+) issues`), Hint: "Fix the $1 lint issues."}
+	tool = &CliTool{Def: NewShellDefinition("lint", `echo '3 issues'; exit 1`, "", nil).WithHintRules(custom)}
+	resp, err = tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`"}`)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Hints:\n- Fix the 3 lint issues.\n")
+
+	tool = &CliTool{Def: NewShellDefinition("cat", `cat missing.txt`, "", nil).WithHintRules()}
+	resp, err = tool.InvokableRun(context.Background(), `{"workdir":"`+dir+`"}`)
+	require.NoError(t, err)
+	assert.NotContains(t, resp, "Hints:", "hints are disabled")
+}
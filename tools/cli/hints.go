@@ -0,0 +1,95 @@
+package clitool
+
+import (
+	"regexp"
+	"strings"
+)
+
+// HintRule recognizes a class of failures in the output of a command and explains to the model
+// how to recover from it.
+type HintRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Hint is appended to the response of a failed call whose output matches Pattern. $1, ${name}
+	// and so on are replaced by the submatches of the first match, like in regexp.Expand.
+	Hint string
+}
+
+// DefaultHintRules classify the common failures of build and test tools: compile errors, failing
+// tests, missing dependencies and programs, permission and path errors.
+var DefaultHintRules = []HintRule{
+	{
+		Name:    "compile-error",
+		Pattern: regexp.MustCompile(`(?m)^\S+\.go:\d+:\d+: `),
+		Hint:    "The code does not compile. Fix the errors at the file:line:column positions above before running tests again.",
+	},
+	{
+		Name:    "test-failure",
+		Pattern: regexp.MustCompile(`(?m)^\s*--- FAIL: (\S+)`),
+		Hint:    "Test $1 fails. Read its output above, fix the code, then rerun only the failing tests (e.g. with -run) before the full suite.",
+	},
+	{
+		Name:    "missing-go-module",
+		Pattern: regexp.MustCompile(`no required module provides package (\S+?);?\s`),
+		Hint:    "No module in go.mod provides $1. Fix the import path, or add the module to go.mod if a new dependency is acceptable.",
+	},
+	{
+		Name:    "missing-go-sum",
+		Pattern: regexp.MustCompile(`missing go\.sum entry for module providing package (\S+)`),
+		Hint:    "go.sum has no entry for the module of $1. Running `go mod tidy` in the module fixes it; editing the code won't.",
+	},
+	{
+		Name:    "missing-python-module",
+		Pattern: regexp.MustCompile(`ModuleNotFoundError: No module named '([^']+)'`),
+		Hint:    "Python module $1 is not installed or not on the path. Check the import, or whether the command runs in the right environment.",
+	},
+	{
+		Name:    "missing-node-module",
+		Pattern: regexp.MustCompile(`Cannot find module '([^']+)'`),
+		Hint:    "Node module $1 cannot be resolved. Check the import path, or whether dependencies are installed.",
+	},
+	{
+		Name:    "command-not-found",
+		Pattern: regexp.MustCompile(`command not found|executable file not found in \$PATH`),
+		Hint:    "A program the command needs is not installed in this environment. Retrying won't help: use another tool, or finalize the task explaining what is missing.",
+	},
+	{
+		Name:    "permission-denied",
+		Pattern: regexp.MustCompile(`(?i)permission denied|operation not permitted|\bEACCES\b`),
+		Hint:    "The command lacks the permissions it needs. Retrying won't help: check that the paths are inside the working directory, or use another tool.",
+	},
+	{
+		Name:    "no-such-file",
+		Pattern: regexp.MustCompile(`(?i)no such file or directory|\bENOENT\b`),
+		Hint:    "A path does not exist. Check the working directory and the paths in the arguments, they are relative to the working directory.",
+	},
+}
+
+// WithHintRules returns a copy of d whose failed calls are classified with rules instead of
+// DefaultHintRules. Without rules, no hints are added.
+func (d Definition) WithHintRules(rules ...HintRule) Definition {
+	d.HintRules = append([]HintRule{}, rules...)
+	return d
+}
+
+// hints returns the hints of the rules of the definition matching a failed outcome.
+func (d Definition) hints(outcome Outcome) []string {
+	if !outcome.Ran || outcome.ExitCode == 0 {
+		return nil
+	}
+	rules := d.HintRules
+	if rules == nil {
+		rules = DefaultHintRules
+	}
+	output := outcome.Stdout + "\n" + outcome.Stderr
+	var hints []string
+	for _, rule := range rules {
+		m := rule.Pattern.FindStringSubmatchIndex(output)
+		if m == nil {
+			continue
+		}
+		hint := string(rule.Pattern.ExpandString(nil, rule.Hint, output, m))
+		hints = append(hints, strings.TrimSpace(hint))
+	}
+	return hints
+}
@@ -0,0 +1,188 @@
+package clitool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Param describes a typed parameter of a CLI tool. When a Definition has Params, the model fills
+// them in explicitly instead of passing a free-form "args" array, and each provided value is
+// rendered into argv via Template.
+type Param struct {
+	Name     string
+	Type     schema.DataType // schema.String, Integer, Number, Boolean or Array (of strings)
+	Desc     string
+	Required bool
+	Enum     []string // allowed values, only for schema.String
+	// Flag is substituted for {flag} in Template, e.g. "-run" or "--count".
+	Flag string
+	// Template renders the parameter into argv tokens. {flag} and {value} are substituted per
+	// whitespace-separated token, so values containing spaces stay a single argument.
+	// Defaults to "{flag} {value}" when Flag is set, "{value}" otherwise, and "{flag}" for booleans,
+	// which are only rendered when true. Arrays render the template once per element.
+	Template string
+}
+
+// workdirParam is the parameter name shared by all CLI tools.
+const workdirParam = "workdir"
+
+func (p Param) template() string {
+	switch {
+	case p.Template != "":
+		return p.Template
+	case p.Type == schema.Boolean:
+		return "{flag}"
+	case p.Flag != "":
+		return "{flag} {value}"
+	default:
+		return "{value}"
+	}
+}
+
+func (p Param) validate() error {
+	if p.Name == "" {
+		return errors.New("clitool: parameter name is required")
+	}
+	if p.Name == workdirParam || p.Name == "args" {
+		return fmt.Errorf("clitool: parameter name %q is reserved", p.Name)
+	}
+	switch p.Type {
+	case schema.String, schema.Integer, schema.Number, schema.Array:
+		if !strings.Contains(p.template(), "{value}") {
+			return fmt.Errorf("clitool: parameter %s: template %q has no {value} placeholder", p.Name, p.template())
+		}
+	case schema.Boolean:
+	default:
+		return fmt.Errorf("clitool: parameter %s: unsupported type %q", p.Name, p.Type)
+	}
+	if len(p.Enum) > 0 && p.Type != schema.String {
+		return fmt.Errorf("clitool: parameter %s: enum is only supported for strings", p.Name)
+	}
+	return nil
+}
+
+func validateParams(params []Param) error {
+	seen := make(map[string]struct{}, len(params))
+	for _, p := range params {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if _, ok := seen[p.Name]; ok {
+			return fmt.Errorf("clitool: duplicate parameter %s", p.Name)
+		}
+		seen[p.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (p Param) info() *schema.ParameterInfo {
+	info := &schema.ParameterInfo{
+		Type:     p.Type,
+		Desc:     p.Desc,
+		Required: p.Required,
+		Enum:     p.Enum,
+	}
+	if p.Type == schema.Array {
+		info.ElemInfo = &schema.ParameterInfo{Type: schema.String}
+	}
+	return info
+}
+
+// renderParams validates the model-provided values and maps them to argv, in the order of params.
+// Errors are meant to be returned to the model.
+func renderParams(params []Param, argumentsInJSON string) ([]string, error) {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &values); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+	var argv []string
+	for _, p := range params {
+		raw, ok := values[p.Name]
+		if !ok || string(raw) == "null" {
+			if p.Required {
+				return nil, fmt.Errorf("parameter %s is required", p.Name)
+			}
+			continue
+		}
+		rendered, err := p.render(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		argv = append(argv, rendered...)
+	}
+	return argv, nil
+}
+
+func (p Param) render(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case schema.Boolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a boolean, got %s", raw)
+		}
+		if !b {
+			return nil, nil
+		}
+		return p.expand(""), nil
+	case schema.Array:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an array of strings, got %s", raw)
+		}
+		var out []string
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected an array of strings, got %s", raw)
+			}
+			out = append(out, p.expand(s)...)
+		}
+		return out, nil
+	case schema.Integer, schema.Number:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected a %s, got %s", p.Type, raw)
+		}
+		if p.Type == schema.Integer {
+			if _, err := n.Int64(); err != nil {
+				return nil, fmt.Errorf("expected an integer, got %s", raw)
+			}
+		}
+		return p.expand(n.String()), nil
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %s", raw)
+		}
+		if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+			return nil, fmt.Errorf("value %q is not one of %s", s, strings.Join(p.Enum, ", "))
+		}
+		return p.expand(s), nil
+	}
+}
+
+func (p Param) expand(value string) []string {
+	tokens := strings.Fields(p.template())
+	out := make([]string, 0, len(tokens))
+	for _, tok := range tokens {
+		tok = strings.ReplaceAll(tok, "{flag}", p.Flag)
+		tok = strings.ReplaceAll(tok, "{value}", value)
+		if tok != "" {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
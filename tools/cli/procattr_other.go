@@ -0,0 +1,9 @@
+//go:build !unix
+
+package clitool
+
+import "os/exec"
+
+// configureProcessGroup is a no-op on platforms without POSIX process groups; cancellation
+// falls back to killing the direct child only.
+func configureProcessGroup(cmd *exec.Cmd) {}
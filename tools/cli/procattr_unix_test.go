@@ -0,0 +1,24 @@
+//go:build unix
+
+package clitool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubprocessExecutor_TimeoutKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	exec := &SubprocessExecutor{}
+	// The backgrounded sleep is a grandchild that keeps stdout open. Unless the whole group is
+	// killed, Execute blocks until processWaitDelay expires.
+	argv := []string{"/bin/sh", "-c", "sleep 30 & wait"}
+	start := time.Now()
+	out := exec.Execute(ctx, argv, nil, "")
+	assert.Less(t, time.Since(start), processWaitDelay/2)
+	assert.Equal(t, -1, out.ExitCode)
+}
@@ -0,0 +1,130 @@
+package clitool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OutputProcessor reduces the outcome of a command to what the model needs, e.g. the failing
+// tests of a verbose test run, before it is returned to the model. See Definition.WithProcessors.
+type OutputProcessor func(outcome Outcome) Outcome
+
+// WithProcessors returns a copy of d whose outcomes go through processors, in order. The default
+// executors then keep the full output, which is clipped after processing.
+func (d Definition) WithProcessors(processors ...OutputProcessor) Definition {
+	d.Processors = append(append([]OutputProcessor{}, d.Processors...), processors...)
+	return d
+}
+
+// process applies the processors of the definition to an outcome and clips the result.
+func (d Definition) process(outcome Outcome) Outcome {
+	if len(d.Processors) == 0 {
+		return outcome
+	}
+	for _, p := range d.Processors {
+		outcome = p(outcome)
+	}
+	return outcome.Clipped(DefaultOutputLimit)
+}
+
+// Stdout returns a processor applying f to the standard output. Stderr, which usually holds the
+// errors the model needs, is kept as is.
+func Stdout(f func(stdout string) string) OutputProcessor {
+	return func(outcome Outcome) Outcome {
+		outcome.Stdout = f(outcome.Stdout)
+		return outcome
+	}
+}
+
+// RegexpExtract returns a processor keeping the matches of pattern in the standard output, one per
+// line: the first capturing group if pattern has one, else the whole match. Use (?m) to match
+// whole lines, e.g. `(?m)^(?:--- FAIL|FAIL|panic:).*$`.
+func RegexpExtract(pattern string) (OutputProcessor, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("clitool: output processor: %w", err)
+	}
+	return Stdout(func(stdout string) string {
+		if stdout == "" {
+			return ""
+		}
+		var b strings.Builder
+		for _, m := range re.FindAllStringSubmatch(stdout, -1) {
+			match := m[0]
+			if len(m) > 1 {
+				match = m[1]
+			}
+			b.WriteString(match)
+			b.WriteByte('\n')
+		}
+		if b.Len() == 0 {
+			return fmt.Sprintf("(no match for %s in %d bytes of output)\n", pattern, len(stdout))
+		}
+		return b.String()
+	}), nil
+}
+
+// JSONPath returns a processor replacing standard output holding a JSON document by the value at
+// path: keys and array indexes separated by dots, e.g. "Issues.0.Text" or "items[2].name".
+// Output that isn't JSON is kept as is.
+func JSONPath(path string) (OutputProcessor, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return Stdout(func(stdout string) string {
+		var doc any
+		if err := json.Unmarshal([]byte(stdout), &doc); err != nil {
+			return stdout
+		}
+		value, err := lookupJSONPath(doc, steps)
+		if err != nil {
+			return fmt.Sprintf("(%s: %v)\n", path, err)
+		}
+		if s, ok := value.(string); ok {
+			return s
+		}
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return stdout
+		}
+		return string(data) + "\n"
+	}), nil
+}
+
+func parseJSONPath(path string) ([]string, error) {
+	path = strings.ReplaceAll(strings.ReplaceAll(path, "[", "."), "]", "")
+	steps := strings.Split(strings.TrimPrefix(path, "."), ".")
+	for _, s := range steps {
+		if s == "" {
+			return nil, fmt.Errorf("clitool: output processor: invalid JSON path %q", path)
+		}
+	}
+	return steps, nil
+}
+
+func lookupJSONPath(value any, steps []string) (any, error) {
+	for i, step := range steps {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[step]
+			if !ok {
+				return nil, fmt.Errorf("no key %q", strings.Join(steps[:i+1], "."))
+			}
+			value = next
+		case []any:
+			n, err := strconv.Atoi(step)
+			if err != nil || n < 0 || n >= len(v) {
+				return nil, fmt.Errorf("no index %q", strings.Join(steps[:i+1], "."))
+			}
+			value = v[n]
+		default:
+			return nil, errors.New("no value at " + strings.Join(steps[:i+1], "."))
+		}
+	}
+	return value, nil
+}
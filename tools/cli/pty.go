@@ -0,0 +1,97 @@
+package clitool
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Default size of the terminal of a PTYExecutor, wide so lines are rarely wrapped.
+const (
+	DefaultPTYRows = 50
+	DefaultPTYCols = 200
+)
+
+// ptyDrainTimeout bounds how long Execute keeps reading the terminal after the command exited,
+// for output still buffered or written by background processes holding the terminal.
+const ptyDrainTimeout = 100 * time.Millisecond
+
+// PTYExecutor runs commands in a pseudo-terminal, for tools that behave differently without a TTY
+// (interactive CLIs, watch-mode test runners). The terminal merges stdout and stderr, so the
+// outcome has the output in Stdout, with ANSI escape sequences and carriage-return redraws
+// removed. Nothing is written to the command's input. PTYs are only supported on Linux; elsewhere
+// Execute fails with a command error.
+type PTYExecutor struct {
+	HeartbeatInterval time.Duration
+	OnHeartbeat       func(ctx context.Context, hb Heartbeat)
+	// OutputLimit clips the output like SubprocessExecutor.OutputLimit.
+	OutputLimit int
+	// Rows and Cols set the size of the terminal, DefaultPTYRows and DefaultPTYCols when 0.
+	Rows, Cols uint16
+}
+
+func (e *PTYExecutor) Execute(ctx context.Context, argv []string, env map[string]string, workdir string) Outcome {
+	start := time.Now()
+	rows, cols := e.Rows, e.Cols
+	if rows == 0 {
+		rows = DefaultPTYRows
+	}
+	if cols == 0 {
+		cols = DefaultPTYCols
+	}
+	terminal, tty, err := openPTY(rows, cols)
+	if err != nil {
+		return newOutcome(ctx, argv, start, err, "", "", outputLimit(e.OutputLimit))
+	}
+	defer terminal.Close()
+
+	// #nosec G204 - argv[0] originates from trusted Definition, not user input.
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = workdir
+	// TERM first, so the definition's env may override it
+	cmd.Env = append(append(os.Environ(), "TERM=xterm-256color"), flattenEnv(env)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	configureTerminalSession(cmd)
+
+	var output countingBuffer
+	err = cmd.Start()
+	tty.Close() // the command holds its own copy
+	if err != nil {
+		return newOutcome(ctx, argv, start, err, "", "", outputLimit(e.OutputLimit))
+	}
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		// ends with EIO once every process closed the terminal, or with os.ErrDeadlineExceeded when
+		// a background process still holds it after ptyDrainTimeout: the output read so far is kept
+		_, _ = io.Copy(&output, terminal)
+	}()
+	stopHeartbeat := startHeartbeat(ctx, e.HeartbeatInterval, e.OnHeartbeat, strings.Join(argv, " "), start, &output, &countingBuffer{})
+	err = cmd.Wait()
+	if deadlineErr := terminal.SetReadDeadline(time.Now().Add(ptyDrainTimeout)); deadlineErr != nil {
+		terminal.Close()
+	}
+	<-copied
+	stopHeartbeat()
+	return newOutcome(ctx, argv, start, err, cleanTerminalOutput(output.String()), "", outputLimit(e.OutputLimit))
+}
+
+// cleanTerminalOutput returns the text of terminal output: escape sequences are removed, CRLF line
+// endings become LF, and a line redrawn after carriage returns (progress bars, spinners) keeps its
+// last version.
+func cleanTerminalOutput(s string) string {
+	s = stripANSI(s)
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if j := strings.LastIndexByte(line, '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package clitool
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a pseudo-terminal of the given size and returns its controlling side and the
+// terminal to hand to the command.
+func openPTY(rows, cols uint16) (terminal, tty *os.File, err error) {
+	terminal, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	conn, err := terminal.SyscallConn()
+	if err != nil {
+		terminal.Close()
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	var n int
+	ctlErr := conn.Control(func(fd uintptr) {
+		if err = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); err != nil {
+			return
+		}
+		if n, err = unix.IoctlGetInt(int(fd), unix.TIOCGPTN); err != nil {
+			return
+		}
+		err = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	})
+	if ctlErr != nil {
+		err = ctlErr
+	}
+	if err != nil {
+		terminal.Close()
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		terminal.Close()
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	return terminal, tty, nil
+}
+
+// configureTerminalSession starts the command in a new session controlled by its terminal, its
+// stdin, and makes cancellation kill the whole session.
+func configureTerminalSession(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	cmd.Cancel = func() error {
+		// the session leader also leads its process group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package clitool
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPTYExecutor_Terminal(t *testing.T) {
+	exec := &PTYExecutor{Cols: 123}
+	argv := []string{"/bin/sh", "-c", `if [ -t 1 ]; then printf '\033[32mtty\033[0m\n'; fi; stty size; printf 'err\n' >&2; exit 3`}
+	out := exec.Execute(context.Background(), argv, nil, t.TempDir())
+	assert.True(t, out.Ran)
+	assert.Equal(t, 3, out.ExitCode)
+	assert.Equal(t, "tty\n50 123\nerr\n", out.Stdout)
+	assert.Empty(t, out.Stderr)
+}
+
+func TestPTYExecutor_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	exec := &PTYExecutor{}
+	start := time.Now()
+	out := exec.Execute(ctx, []string{"/bin/sh", "-c", "sleep 30 & wait"}, nil, "")
+	assert.Less(t, time.Since(start), processWaitDelay/2)
+	assert.Equal(t, -1, out.ExitCode)
+}
+
+func TestPTYExecutor_BackgroundProcess(t *testing.T) {
+	exec := &PTYExecutor{}
+	start := time.Now()
+	out := exec.Execute(context.Background(), []string{"/bin/sh", "-c", "trap '' HUP; sleep 2 & echo started"}, nil, "")
+	assert.Less(t, time.Since(start), time.Second, "the drain doesn't wait for processes holding the terminal")
+	assert.Equal(t, 0, out.ExitCode)
+	assert.Equal(t, "started\n", out.Stdout)
+	assert.Empty(t, out.Stderr)
+}
+
+func TestCliTool_TTY(t *testing.T) {
+	def := MustNewDefinition("is_tty", `/bin/sh -c 'test -t 0 && echo "tty $TERM"'`, "", nil)
+	def.TTY = true
+	tool := &CliTool{Def: def}
+	args, _ := json.Marshal(map[string]any{"workdir": t.TempDir()})
+	resp, err := tool.InvokableRun(context.Background(), string(args))
+	require.NoError(t, err)
+	assert.Contains(t, resp, "Result: succeeded")
+	assert.Contains(t, resp, "tty xterm-256color\n")
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package clitool
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+func openPTY(rows, cols uint16) (terminal, tty *os.File, err error) {
+	return nil, nil, fmt.Errorf("open pty: not supported on %s", runtime.GOOS)
+}
+
+func configureTerminalSession(cmd *exec.Cmd) {}
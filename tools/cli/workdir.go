@@ -0,0 +1,103 @@
+package clitool
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// baseDirPlaceholder is substituted with CliTool.BaseDir in workdir templates.
+const baseDirPlaceholder = "baseDir"
+
+var workdirPlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// WithWorkdir returns a copy of d running in workdir instead of a directory chosen by the model,
+// which is then not asked for one. workdir is relative to the base directory of the tool unless
+// absolute, and may be a template: {baseDir} is the base directory and {name} the value of the
+// string parameter name, e.g. "{baseDir}/{package}". Parameters used in the template are not
+// rendered into argv, and their values must be local paths. Set the parameters first.
+func (d Definition) WithWorkdir(workdir string) (Definition, error) {
+	if err := validateWorkdir(workdir, d.Params); err != nil {
+		return Definition{}, err
+	}
+	d.Workdir = workdir
+	return d, nil
+}
+
+func validateWorkdir(workdir string, params []Param) error {
+	for _, name := range workdirParams(workdir) {
+		if name == baseDirPlaceholder {
+			continue
+		}
+		i := paramIndex(params, name)
+		if i < 0 {
+			return fmt.Errorf("clitool: workdir %q: unknown parameter {%s}", workdir, name)
+		}
+		if params[i].Type != schema.String {
+			return fmt.Errorf("clitool: workdir %q: parameter %s is not a string", workdir, name)
+		}
+	}
+	return nil
+}
+
+// workdirParams returns the names of the placeholders of a workdir template.
+func workdirParams(workdir string) []string {
+	var names []string
+	for _, m := range workdirPlaceholder.FindAllStringSubmatch(workdir, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+func paramIndex(params []Param, name string) int {
+	for i, p := range params {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveWorkdir renders the workdir template of the definition with the model-provided values.
+// Errors are meant to be returned to the model.
+func (d Definition) resolveWorkdir(baseDir, argumentsInJSON string) (string, error) {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &values); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	var err error
+	workdir := workdirPlaceholder.ReplaceAllStringFunc(d.Workdir, func(m string) string {
+		name := m[1 : len(m)-1]
+		if name == baseDirPlaceholder {
+			return baseDir
+		}
+		var value string
+		if raw, ok := values[name]; ok && string(raw) != "null" {
+			if jsonErr := json.Unmarshal(raw, &value); jsonErr != nil && err == nil {
+				err = fmt.Errorf("parameter %s: expected a string, got %s", name, raw)
+			}
+		} else if p := d.Params[paramIndex(d.Params, name)]; p.Required && err == nil {
+			err = fmt.Errorf("parameter %s is required", name)
+		}
+		if value != "" && !filepath.IsLocal(value) && err == nil {
+			err = fmt.Errorf("parameter %s: %q must be a relative path inside the base directory", name, value)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(workdir) && baseDir != "" {
+		workdir = filepath.Join(baseDir, workdir)
+	}
+	return filepath.Clean(workdir), nil
+}
+
+// usesParam reports whether the workdir template of the definition uses the parameter name.
+func (d Definition) usesParam(name string) bool {
+	return d.Workdir != "" && strings.Contains(d.Workdir, "{"+name+"}")
+}
@@ -6,13 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
-	"github.com/rs/zerolog/log"
 
 	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/v4a"
+	"github.com/stumble/axe/tools"
 )
 
 const (
@@ -23,6 +26,41 @@ const (
 //go:embed apply_edit.md
 var ApplyEditDoc string
 
+//go:embed apply_edit_unified.md
+var applyEditUnifiedDoc string
+
+//go:embed apply_edit_whole_file.md
+var applyEditWholeFileDoc string
+
+//go:embed apply_edit_search_replace.md
+var applyEditSearchReplaceDoc string
+
+// EditDoc returns the documentation of apply_edit for the edit format, shown in the system prompt.
+func EditDoc(format cont.EditFormat) string {
+	switch format {
+	case cont.EditFormatUnified:
+		return applyEditUnifiedDoc
+	case cont.EditFormatWholeFile:
+		return applyEditWholeFileDoc
+	case cont.EditFormatSearchReplace:
+		return applyEditSearchReplaceDoc
+	}
+	return ApplyEditDoc
+}
+
+// codeOutputDesc describes the code_output argument in the edit format.
+func codeOutputDesc(format cont.EditFormat) string {
+	switch format {
+	case cont.EditFormatUnified:
+		return "CodeOutput XML wrapping a unified diff of the edits"
+	case cont.EditFormatWholeFile:
+		return "CodeOutput XML with a Rewrite element holding the complete new content of every edited file"
+	case cont.EditFormatSearchReplace:
+		return "CodeOutput XML wrapping SEARCH/REPLACE blocks of the edits"
+	}
+	return "v4a diff text format string of CodeOutput edits"
+}
+
 // ApplyEditTool applies a CodeOutput XML to an in-memory CodeContainer and persists changes to disk.
 //
 // The tool expects JSON arguments with a single required field:
@@ -30,7 +68,19 @@ var ApplyEditDoc string
 //
 // It returns a short summary string indicating which files were written.
 type ApplyEditTool struct {
-	Code *cont.CodeContainer
+	Code   *cont.CodeContainer
+	Format cont.EditFormat // format of the edits, v4a when empty
+	// PatchOptions tune how the context of v4a patches is matched.
+	PatchOptions v4a.Options
+	// Check, if set, runs after the edits are written; its result is part of the response.
+	Check *EditCheck
+	// NewFiles, if set, limits the files the edits may create.
+	NewFiles *NewFilePolicy
+	// Quota, if set, limits how much the edits may change in total.
+	Quota *Quota
+
+	created int               // files created so far, for NewFiles.MaxFiles
+	start   map[string]string // files at the first call, for Quota
 }
 
 type ApplyEditRequest struct {
@@ -46,7 +96,7 @@ func (t *ApplyEditTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 			"code_output": {
 				Type:     schema.String,
 				Required: true,
-				Desc:     "v4a diff text format string of CodeOutput edits to apply.",
+				Desc:     codeOutputDesc(t.Format) + " to apply.",
 			},
 		}),
 	}, nil
@@ -56,7 +106,7 @@ func (t *ApplyEditTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 // Invokable don't return error unless it is unrecoverable. It just returns the error as message to the model and let
 // the model to handle it.
 func (t *ApplyEditTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
-	log.Debug().Msgf("apply_edit: applying edits: %s", argumentsInJSON)
+	tools.Logger(ctx).Debug().Msgf("apply_edit: applying edits: %s", argumentsInJSON)
 	if strings.TrimSpace(argumentsInJSON) == "" {
 		return "apply_edit: missing arguments, empty string", nil
 	}
@@ -80,17 +130,97 @@ func (t *ApplyEditTool) InvokableRun(ctx context.Context, argumentsInJSON string
 		return fmt.Sprintf("apply_edit: failed to parse CodeOutput XML: %v", err), nil
 	}
 
-	msg, err := t.Code.Apply(co)
+	if t.Quota != nil && t.start == nil {
+		t.start = t.Code.Files()
+	}
+
+	// Edits are all-or-nothing: a patch failing half-way must not leave the container partially edited.
+	snapshot := t.Code.Snapshot()
+	msg, err := t.Code.ApplyFormatWithOptions(co, t.Format, t.PatchOptions)
 	if err != nil {
+		t.Code.Restore(snapshot)
+		var stale *cont.StaleContentError
+		if errors.As(err, &stale) {
+			return t.staleResponse(stale), nil
+		}
 		return fmt.Sprintf("apply_edit: failed to apply edits: %v", err), nil
 	}
 
+	// Files created by this patch are removed again if writing fails; existing files are never removed.
+	var created []string
+	for path := range t.Code.Files() {
+		if snapshot.Has(path) {
+			continue
+		}
+		if _, statErr := os.Stat(t.Code.DiskPath(path)); errors.Is(statErr, os.ErrNotExist) {
+			created = append(created, path)
+		}
+	}
+	if t.NewFiles != nil {
+		sort.Strings(created)
+		for i, path := range created {
+			content, _ := t.Code.Open(path)
+			if reason := t.NewFiles.check(path, len(content), t.created+i); reason != "" {
+				t.Code.Restore(snapshot)
+				return "apply_edit: edits not applied, the new file policy rejects " + reason, nil
+			}
+		}
+	}
+	if t.Quota != nil {
+		if reason := t.Quota.check(cont.Stat(t.start, t.Code.Files())); reason != "" {
+			t.Code.Restore(snapshot)
+			return "apply_edit: edits not applied, they exceed the quota of the run: " + reason + ". Make smaller, targeted edits instead.", nil
+		}
+	}
+	t.created += len(created)
+
 	// Persist only the changed files. Empty baseDir writes paths as-is (absolute or relative).
 	err = t.Code.WriteToFiles()
 	if err != nil {
+		// roll back the container and the files that were already written
+		t.Code.Restore(snapshot)
+		for _, path := range created {
+			if rmErr := os.Remove(t.Code.DiskPath(path)); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+				tools.Logger(ctx).Error().Err(rmErr).Str("path", path).Msg("apply_edit: roll back added file")
+			}
+		}
+		if rollbackErr := t.Code.WriteToFiles(); rollbackErr != nil {
+			tools.Logger(ctx).Error().Err(rollbackErr).Msg("apply_edit: roll back partially written files")
+		}
 		return fmt.Sprintf("failed to write files: %v", err), nil
 	}
 
 	// Build a concise summary
-	return fmt.Sprintf("apply_edit successfully applied edits: %s", msg), nil
+	summary := fmt.Sprintf("apply_edit successfully applied edits: %s", msg)
+	for _, change := range t.Code.TakeExternalChanges() {
+		switch change.Action {
+		case "reloaded":
+			content, _ := t.Code.Open(change.Path)
+			t.Code.MarkShown(change.Path)
+			summary += fmt.Sprintf("\nNote: %s was changed on disk by someone else, your edits to it were dropped. Its current content:\n%s", change.Path, content)
+		default:
+			summary += fmt.Sprintf("\nNote: %s was changed on disk by someone else, the changes were %s with your edits.", change.Path, change.Action)
+		}
+	}
+	if t.Check != nil && len(t.Check.Argv) > 0 {
+		summary += "\n" + t.Check.run(ctx)
+	}
+	return summary, nil
+}
+
+// staleResponse tells the model its patch was not applied and gives it the current content of the
+// stale files, which it has now seen.
+func (t *ApplyEditTool) staleResponse(stale *cont.StaleContentError) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "apply_edit: edits not applied: %v", stale)
+	for _, path := range stale.Paths {
+		if !t.Code.Has(path) {
+			fmt.Fprintf(&b, "\n%s no longer exists.", path)
+			continue
+		}
+		content, _ := t.Code.Open(path)
+		fmt.Fprintf(&b, "\nCurrent content of %s (hash %s):\n%s", path, cont.ContentHash(content), content)
+	}
+	t.Code.MarkShown(stale.Paths...)
+	return b.String()
 }
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
 
 	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/v4a"
 )
 
 type ApplyEditToolSuite struct {
@@ -164,3 +166,206 @@ context6`, string(dataBar))
 	s.Equal(`foo_test
 bar_test`, string(dataFooTest))
 }
+
+func (s *ApplyEditToolSuite) Test_WriteFailure_RollsBack() {
+	dir := s.T().TempDir()
+	foo := filepath.Join(dir, "foo.txt")
+	blocker := filepath.Join(dir, "blocker")
+	s.Require().NoError(os.WriteFile(foo, []byte("original"), 0o644))
+	// a regular file where the patch expects a directory makes the write fail
+	s.Require().NoError(os.WriteFile(blocker, []byte("file"), 0o644))
+
+	cc := cont.NewCodeContainer(map[string]string{foo: "original"})
+	patch := fmt.Sprintf(`*** Begin Patch
+*** Update File: %s
+-original
++changed
+*** Add File: %s
++new
+*** End Patch`, foo, filepath.Join(blocker, "new.txt"))
+
+	result, err := s.runToolWithPatch(cc, patch)
+	s.Require().NoError(err)
+	s.Contains(result, "failed to write files")
+
+	s.Equal(map[string]string{foo: "original"}, cc.Files())
+	data, err := os.ReadFile(foo)
+	s.Require().NoError(err)
+	s.Equal("original", string(data))
+}
+
+func (s *ApplyEditToolSuite) Test_FetchFunction() {
+	cc := cont.NewCodeContainer(map[string]string{
+		"demo.go": "package demo\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() {}\n",
+	})
+	tool := &FetchFunctionTool{Code: cc}
+
+	out, err := tool.InvokableRun(context.TODO(), `{"file":"demo.go","names":["A","C"]}`)
+	s.Require().NoError(err)
+	s.Equal("// demo.go lines 3-5\nfunc A() int {\n\treturn 1\n}\n\n// C: code/container: demo.go has no function, method or type C\n", out)
+
+	out, err = tool.InvokableRun(context.TODO(), `{"file":"other.go","names":["A"]}`)
+	s.Require().NoError(err)
+	s.Contains(out, "known files: demo.go")
+}
+
+func (s *ApplyEditToolSuite) Test_ValidatePatch() {
+	cc := cont.NewCodeContainer(map[string]string{"bar.txt": "one\ntwo\nthree"})
+	tool := &ValidatePatchTool{Code: cc}
+	run := func(patch string) string {
+		args, err := json.Marshal(ApplyEditRequest{CodeOutput: "<CodeOutput><![CDATA[\n" + patch + "\n]]></CodeOutput>"})
+		s.Require().NoError(err)
+		out, err := tool.InvokableRun(context.TODO(), string(args))
+		s.Require().NoError(err)
+		return out
+	}
+
+	out := run("*** Begin Patch\n*** Update File: bar.txt\n one\n-two\n+2\n three\n*** Add File: new.txt\n+new\n*** End Patch")
+	s.Equal("validate_patch: patch is valid, apply_edit would add new.txt, update bar.txt. Nothing was applied.", out)
+	s.Equal(map[string]string{"bar.txt": "one\ntwo\nthree"}, cc.Files())
+
+	out = run("*** Begin Patch\n*** Update File: bar.txt\n one\n-four\n+4\n*** End Patch")
+	s.Contains(out, "validate_patch: patch is invalid: ")
+	s.Contains(out, "Invalid context")
+
+	out = run("*** Update File: bar.txt\n*** End Patch")
+	s.Contains(out, "must start with *** Begin Patch")
+}
+
+func (s *ApplyEditToolSuite) Test_EditCheck() {
+	dir := s.T().TempDir()
+	foo := filepath.Join(dir, "foo.txt")
+	cc := cont.NewCodeContainer(map[string]string{})
+	patch := fmt.Sprintf("*** Begin Patch\n*** Add File: %s\n+foo\n*** End Patch", foo)
+
+	tool := &ApplyEditTool{Code: cc, Check: &EditCheck{Argv: []string{"true"}, Dir: dir}}
+	args, err := json.Marshal(ApplyEditRequest{CodeOutput: "<CodeOutput><![CDATA[" + patch + "]]></CodeOutput>"})
+	s.Require().NoError(err)
+	out, err := tool.InvokableRun(context.TODO(), string(args))
+	s.Require().NoError(err)
+	s.Contains(out, "apply_edit successfully applied edits")
+	s.Contains(out, "Check `true` passed.")
+
+	cc = cont.NewCodeContainer(map[string]string{})
+	s.Require().NoError(os.Remove(foo))
+	tool = &ApplyEditTool{Code: cc, Check: &EditCheck{Argv: []string{"sh", "-c", "echo broken; exit 2"}, Dir: dir}}
+	out, err = tool.InvokableRun(context.TODO(), string(args))
+	s.Require().NoError(err)
+	s.Contains(out, "Check `sh -c echo broken; exit 2` FAILED after the edits were applied")
+	s.Contains(out, "exited with code 2")
+	s.Contains(out, "broken")
+}
+
+func (s *ApplyEditToolSuite) Test_StaleContent() {
+	dir := s.T().TempDir()
+	cc, err := cont.NewCodeContainerInDir(dir, map[string]string{"a.txt": "one\ntwo\n"})
+	s.Require().NoError(err)
+	cc.MarkShown("a.txt")
+	s.Require().NoError(cc.Write("a.txt", "one\ntwo\nthree\n"))
+
+	patch := "*** Begin Patch\n*** Update File: a.txt\n@@\n one\n-two\n+2\n*** End Patch"
+	out, err := s.runToolWithPatch(cc, patch)
+	s.Require().NoError(err)
+	s.Contains(out, "edits not applied")
+	s.Contains(out, "Current content of a.txt (hash "+cont.ContentHash("one\ntwo\nthree\n")+"):\none\ntwo\nthree\n")
+
+	// the response showed the current content, the patch can be retried
+	out, err = s.runToolWithPatch(cc, patch)
+	s.Require().NoError(err)
+	s.Contains(out, "apply_edit successfully applied edits")
+}
+
+func (s *ApplyEditToolSuite) Test_FuzzyMatchIsReported() {
+	dir := s.T().TempDir()
+	calc := filepath.Join(dir, "calc.go")
+	cc := cont.NewCodeContainer(map[string]string{calc: "func Sub(a, b int) int {\n\treturn a + b\n}\n"})
+
+	// the context lost its indentation
+	result, err := s.runToolWithPatch(cc, fmt.Sprintf("*** Begin Patch\n*** Update File: %s\n func Sub(a, b int) int {\n-return a + b\n+return a - b\n }\n*** End Patch", calc))
+	s.Require().NoError(err)
+	s.Contains(result, "Done! (fuzz 100)")
+	s.Contains(result, "Warning: the patch did not match exactly")
+	s.Contains(result, calc+" line 1, context matched ignoring indentation:\n     1| func Sub(a, b int) int {\n     2| \treturn a + b\n     3| }")
+}
+
+func (s *ApplyEditToolSuite) Test_NewFilePolicy() {
+	dir := s.T().TempDir()
+	cc, err := cont.NewCodeContainerInDir(dir, map[string]string{"pkg/a.go": "package pkg\n"})
+	s.Require().NoError(err)
+	tool := &ApplyEditTool{Code: cc, NewFiles: &NewFilePolicy{Dirs: []string{"pkg"}, Extensions: []string{".go"}, MaxBytes: 20, MaxFiles: 1}}
+	run := func(patch string) string {
+		data, err := json.Marshal(ApplyEditRequest{CodeOutput: "<CodeOutput><![CDATA[\n" + patch + "\n]]></CodeOutput>"})
+		s.Require().NoError(err)
+		out, err := tool.InvokableRun(context.TODO(), string(data))
+		s.Require().NoError(err)
+		return out
+	}
+	add := func(path, line string) string {
+		return "*** Begin Patch\n*** Add File: " + path + "\n+" + line + "\n*** End Patch"
+	}
+
+	s.Equal("apply_edit: edits not applied, the new file policy rejects junk/b.go: new files must be in pkg", run(add("junk/b.go", "package junk")))
+	s.Equal(`apply_edit: edits not applied, the new file policy rejects pkg/notes.md: new files must have one of the extensions [".go"]`, run(add("pkg/notes.md", "notes")))
+	s.Equal("apply_edit: edits not applied, the new file policy rejects pkg/b.go: new files may have at most 20 bytes, it has 29", run(add("pkg/b.go", "package pkg // a long comment")))
+	s.False(cc.Has("junk/b.go"))
+	s.NoFileExists(filepath.Join(dir, "junk/b.go"))
+
+	// edits to existing files are not limited
+	s.Contains(run("*** Begin Patch\n*** Update File: pkg/a.go\n-package pkg\n+package pkg2\n*** End Patch"), "successfully")
+	s.Contains(run(add("pkg/b.go", "package pkg")), "successfully")
+	s.Equal("apply_edit: edits not applied, the new file policy rejects pkg/c.go: at most 1 new files may be created in this run", run(add("pkg/c.go", "package pkg")))
+}
+
+func (s *ApplyEditToolSuite) Test_Quota() {
+	dir := s.T().TempDir()
+	cc, err := cont.NewCodeContainerInDir(dir, map[string]string{"a.go": "package a\n", "b.go": "package b\n", "c.go": "package c\n"})
+	s.Require().NoError(err)
+	s.Require().NoError(cc.WriteToFiles())
+	tool := &ApplyEditTool{Code: cc, Quota: &Quota{MaxChangedLines: 4, MaxDeletedFiles: 1}}
+	run := func(patch string) string {
+		data, err := json.Marshal(ApplyEditRequest{CodeOutput: "<CodeOutput><![CDATA[\n" + patch + "\n]]></CodeOutput>"})
+		s.Require().NoError(err)
+		out, err := tool.InvokableRun(context.TODO(), string(data))
+		s.Require().NoError(err)
+		return out
+	}
+
+	s.Contains(run("*** Begin Patch\n*** Delete File: a.go\n*** End Patch"), "successfully")
+	s.Equal("apply_edit: edits not applied, they exceed the quota of the run: the run would delete 2 files, at most 1 may be deleted. Make smaller, targeted edits instead.",
+		run("*** Begin Patch\n*** Delete File: b.go\n*** End Patch"))
+	s.FileExists(filepath.Join(dir, "b.go"))
+
+	// the quota counts from the first call, the deletion of a.go took one line
+	s.Contains(run("*** Begin Patch\n*** Update File: b.go\n-package b\n+package bb\n*** End Patch"), "successfully")
+	s.Equal("apply_edit: edits not applied, they exceed the quota of the run: the run would change 5 lines (2 added, 3 removed; 22 bytes written, 30 deleted), at most 4 may change. Make smaller, targeted edits instead.",
+		run("*** Begin Patch\n*** Update File: c.go\n-package c\n+package cc\n*** End Patch"))
+	content, _ := cc.Open("c.go")
+	s.Equal("package c\n", content)
+}
+
+func (s *ApplyEditToolSuite) Test_PatchOptions() {
+	// written against the file before sum was renamed to acc
+	file := "func total(items []int) int {\n\tacc := 0\n\tfor _, item := range items {\n\t\tacc += item\n\t}\n\treturn acc\n}\n"
+	patch := "*** Begin Patch\n*** Update File: total.go\n@@\n \tfor _, item := range items {\n-\t\tsum += item\n+\t\tsum += item * 2\n \t}\n*** End Patch"
+	run := func(tool *ApplyEditTool) string {
+		data, err := json.Marshal(ApplyEditRequest{CodeOutput: "<CodeOutput><![CDATA[\n" + patch + "\n]]></CodeOutput>"})
+		s.Require().NoError(err)
+		out, err := tool.InvokableRun(context.TODO(), string(data))
+		s.Require().NoError(err)
+		return out
+	}
+
+	cc := cont.NewCodeContainer(map[string]string{"total.go": file})
+	s.Contains(run(&ApplyEditTool{Code: cc}), "Invalid context")
+	content, _ := cc.Open("total.go")
+	s.Equal(file, content)
+
+	dir := s.T().TempDir()
+	cc, err := cont.NewCodeContainerInDir(dir, map[string]string{"total.go": file})
+	s.Require().NoError(err)
+	s.Require().NoError(cc.WriteToFiles())
+	out := run(&ApplyEditTool{Code: cc, PatchOptions: v4a.Options{MinSimilarity: 0.8}})
+	s.Contains(out, "context matched only similar lines")
+	content, _ = cc.Open("total.go")
+	s.Equal(strings.Replace(file, "\t\tacc += item\n", "\t\tsum += item * 2\n", 1), content)
+}
@@ -0,0 +1,37 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// EditCheck is a command run after every successful apply_edit, e.g. "go build ./...". Its result
+// is appended to the tool response, so the model learns at once when an edit broke the build.
+type EditCheck struct {
+	Argv     []string
+	Dir      string
+	Env      map[string]string // added to the environment of the command
+	Executor clitool.Executor  // a subprocess executor when nil
+}
+
+// GoBuildCheck runs "go build ./..." in dir.
+func GoBuildCheck(dir string) *EditCheck {
+	return &EditCheck{Argv: []string{"go", "build", "./..."}, Dir: dir}
+}
+
+// run returns the report of the check for the tool response.
+func (c *EditCheck) run(ctx context.Context) string {
+	executor := c.Executor
+	if executor == nil {
+		executor = &clitool.SubprocessExecutor{}
+	}
+	command := strings.Join(c.Argv, " ")
+	outcome := executor.Execute(ctx, c.Argv, c.Env, c.Dir)
+	if outcome.Ran && outcome.ExitCode == 0 {
+		return fmt.Sprintf("Check `%s` passed.", command)
+	}
+	return fmt.Sprintf("Check `%s` FAILED after the edits were applied, fix it:\n%s", command, strings.TrimRight(outcome.String(), "\n"))
+}
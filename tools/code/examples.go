@@ -0,0 +1,282 @@
+package code
+
+import (
+	"fmt"
+	"maps"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+// EditExample is a worked apply_edit call for few-shot prompting: an instruction, the files it is
+// given, the code_output argument of a correct call and the files it results in.
+type EditExample struct {
+	Instruction string
+	Files       map[string]string
+	CodeOutput  string
+	After       map[string]string
+}
+
+// Apply applies the example to an in-memory container, without writing files, and returns the
+// resulting files and the response apply_edit gives.
+func (e EditExample) Apply(format cont.EditFormat) (map[string]string, string, error) {
+	co, err := cont.ParseCodeOutput(e.CodeOutput)
+	if err != nil {
+		return nil, "", fmt.Errorf("apply_edit: example: %w", err)
+	}
+	code := cont.NewCodeContainer(maps.Clone(e.Files))
+	msg, err := code.ApplyFormat(co, format)
+	if err != nil {
+		return nil, "", fmt.Errorf("apply_edit: example: %w", err)
+	}
+	return code.Files(), fmt.Sprintf("apply_edit successfully applied edits: %s", msg), nil
+}
+
+// EditExamples returns the curated examples of the edit format: a fix with a new test file, and a
+// rename across two files.
+func EditExamples(format cont.EditFormat) []EditExample {
+	fix := EditExample{
+		Instruction: "Fix Sub, which adds instead of subtracting, and add a test for it.",
+		Files:       map[string]string{"calc/calc.go": calcBefore},
+		After:       map[string]string{"calc/calc.go": calcAfter, "calc/calc_test.go": calcTest},
+	}
+	rename := EditExample{
+		Instruction: "Rename greet.Greeting to greet.Hello.",
+		Files:       map[string]string{"greet/greet.go": greetBefore, "main.go": mainBefore},
+		After:       map[string]string{"greet/greet.go": greetAfter, "main.go": mainAfter},
+	}
+	switch format {
+	case cont.EditFormatUnified:
+		fix.CodeOutput, rename.CodeOutput = fixUnified, renameUnified
+	case cont.EditFormatSearchReplace:
+		fix.CodeOutput, rename.CodeOutput = fixSearchReplace, renameSearchReplace
+	case cont.EditFormatWholeFile:
+		fix.CodeOutput = "<CodeOutput>\n" +
+			`  <Rewrite path="calc/calc.go"><![CDATA[` + calcAfter + "]]></Rewrite>\n" +
+			`  <Add path="calc/calc_test.go"><![CDATA[` + calcTest + "]]></Add>\n" +
+			"</CodeOutput>"
+		rename.CodeOutput = "<CodeOutput>\n" +
+			`  <Rewrite path="greet/greet.go"><![CDATA[` + greetAfter + "]]></Rewrite>\n" +
+			`  <Rewrite path="main.go"><![CDATA[` + mainAfter + "]]></Rewrite>\n" +
+			"</CodeOutput>"
+	default:
+		fix.CodeOutput, rename.CodeOutput = fixV4A, renameV4A
+		// an added file ends with its last + line
+		fix.After["calc/calc_test.go"] = calcTest[:len(calcTest)-1]
+	}
+	return []EditExample{fix, rename}
+}
+
+const calcBefore = `package calc
+
+// Add returns the sum of a and b.
+func Add(a, b int) int {
+	return a + b
+}
+
+// Sub returns the difference of a and b.
+func Sub(a, b int) int {
+	return a + b
+}
+`
+
+const calcAfter = `package calc
+
+// Add returns the sum of a and b.
+func Add(a, b int) int {
+	return a + b
+}
+
+// Sub returns the difference of a and b.
+func Sub(a, b int) int {
+	return a - b
+}
+`
+
+const calcTest = `package calc
+
+import "testing"
+
+func TestSub(t *testing.T) {
+	if got := Sub(5, 3); got != 2 {
+		t.Fatalf("Sub(5, 3) = %d, want 2", got)
+	}
+}
+`
+
+const greetBefore = `package greet
+
+import "fmt"
+
+// Greeting returns the greeting of name.
+func Greeting(name string) string {
+	return fmt.Sprintf("Hello, %s!", name)
+}
+`
+
+const greetAfter = `package greet
+
+import "fmt"
+
+// Hello returns the greeting of name.
+func Hello(name string) string {
+	return fmt.Sprintf("Hello, %s!", name)
+}
+`
+
+const mainBefore = `package main
+
+import (
+	"fmt"
+
+	"example.com/app/greet"
+)
+
+func main() {
+	fmt.Println(greet.Greeting("world"))
+}
+`
+
+const mainAfter = `package main
+
+import (
+	"fmt"
+
+	"example.com/app/greet"
+)
+
+func main() {
+	fmt.Println(greet.Hello("world"))
+}
+`
+
+const fixV4A = `<CodeOutput><![CDATA[
+*** Begin Patch
+*** Update File: calc/calc.go
+
+ // Sub returns the difference of a and b.
+ func Sub(a, b int) int {
+-	return a + b
++	return a - b
+ }
+*** Add File: calc/calc_test.go
++package calc
++
++import "testing"
++
++func TestSub(t *testing.T) {
++	if got := Sub(5, 3); got != 2 {
++		t.Fatalf("Sub(5, 3) = %d, want 2", got)
++	}
++}
+*** End Patch
+]]></CodeOutput>`
+
+const renameV4A = `<CodeOutput><![CDATA[
+*** Begin Patch
+*** Update File: greet/greet.go
+ import "fmt"
+
+-// Greeting returns the greeting of name.
+-func Greeting(name string) string {
++// Hello returns the greeting of name.
++func Hello(name string) string {
+ 	return fmt.Sprintf("Hello, %s!", name)
+ }
+*** Update File: main.go
+ )
+
+ func main() {
+-	fmt.Println(greet.Greeting("world"))
++	fmt.Println(greet.Hello("world"))
+ }
+*** End Patch
+]]></CodeOutput>`
+
+const fixUnified = `<CodeOutput><![CDATA[
+--- calc/calc.go
++++ calc/calc.go
+@@ -8,5 +8,5 @@
+
+ // Sub returns the difference of a and b.
+ func Sub(a, b int) int {
+-	return a + b
++	return a - b
+ }
+--- /dev/null
++++ calc/calc_test.go
+@@ -0,0 +1,9 @@
++package calc
++
++import "testing"
++
++func TestSub(t *testing.T) {
++	if got := Sub(5, 3); got != 2 {
++		t.Fatalf("Sub(5, 3) = %d, want 2", got)
++	}
++}
+]]></CodeOutput>`
+
+const renameUnified = `<CodeOutput><![CDATA[
+--- greet/greet.go
++++ greet/greet.go
+@@ -2,7 +2,7 @@
+
+ import "fmt"
+
+-// Greeting returns the greeting of name.
+-func Greeting(name string) string {
++// Hello returns the greeting of name.
++func Hello(name string) string {
+ 	return fmt.Sprintf("Hello, %s!", name)
+ }
+--- main.go
++++ main.go
+@@ -7,5 +7,5 @@
+ )
+
+ func main() {
+-	fmt.Println(greet.Greeting("world"))
++	fmt.Println(greet.Hello("world"))
+ }
+]]></CodeOutput>`
+
+const fixSearchReplace = `<CodeOutput><![CDATA[
+calc/calc.go
+<<<<<<< SEARCH
+func Sub(a, b int) int {
+	return a + b
+=======
+func Sub(a, b int) int {
+	return a - b
+>>>>>>> REPLACE
+calc/calc_test.go
+<<<<<<< SEARCH
+=======
+package calc
+
+import "testing"
+
+func TestSub(t *testing.T) {
+	if got := Sub(5, 3); got != 2 {
+		t.Fatalf("Sub(5, 3) = %d, want 2", got)
+	}
+}
+>>>>>>> REPLACE
+]]></CodeOutput>`
+
+const renameSearchReplace = `<CodeOutput><![CDATA[
+greet/greet.go
+<<<<<<< SEARCH
+// Greeting returns the greeting of name.
+func Greeting(name string) string {
+=======
+// Hello returns the greeting of name.
+func Hello(name string) string {
+>>>>>>> REPLACE
+main.go
+<<<<<<< SEARCH
+	fmt.Println(greet.Greeting("world"))
+=======
+	fmt.Println(greet.Hello("world"))
+>>>>>>> REPLACE
+]]></CodeOutput>`
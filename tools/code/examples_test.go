@@ -0,0 +1,21 @@
+package code
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestEditExamples(t *testing.T) {
+	for _, format := range []cont.EditFormat{cont.EditFormatV4A, cont.EditFormatUnified, cont.EditFormatWholeFile, cont.EditFormatSearchReplace} {
+		for _, example := range EditExamples(format) {
+			files, summary, err := example.Apply(format)
+			require.NoError(t, err, "%s: %s", format, example.Instruction)
+			assert.Equal(t, example.After, files, "%s: %s", format, example.Instruction)
+			assert.Contains(t, summary, "apply_edit successfully applied edits")
+		}
+	}
+}
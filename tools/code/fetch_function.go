@@ -0,0 +1,90 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+const (
+	// FetchFunctionToolName is the public name of the tool returning full Go declarations.
+	FetchFunctionToolName = "fetch_function"
+)
+
+// FetchFunctionTool returns the full source of a function, method or type from a Go file in the
+// CodeContainer. It complements outlined CodeInput files, which only show signatures.
+type FetchFunctionTool struct {
+	Code *cont.CodeContainer
+}
+
+type FetchFunctionRequest struct {
+	File  string   `json:"file"`
+	Names []string `json:"names"`
+}
+
+// Info implements the tool metadata for exposure to the agent runtime.
+func (t *FetchFunctionTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: FetchFunctionToolName,
+		Desc: "Get the full source, including the body, of functions, methods or types of a Go file in CodeInput. Use it before editing declarations that CodeInput only shows as an outline.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"file": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Path of the Go file, exactly as in the CodeInput path attribute.",
+			},
+			"names": {
+				Type:     schema.Array,
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+				Required: true,
+				Desc:     "Declarations to fetch: function or type names, and methods as \"Type.Method\".",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun returns the requested declarations, each prefixed by its line range.
+func (t *FetchFunctionTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Code == nil {
+		return "", errors.New("fetch_function: tool not initialized with a CodeContainer")
+	}
+	var req FetchFunctionRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("fetch_function: invalid arguments: %v", err), nil
+	}
+	if req.File == "" || len(req.Names) == 0 {
+		return "fetch_function: file and names are required", nil
+	}
+	files := t.Code.Files()
+	if key, err := t.Code.Normalize(req.File); err == nil {
+		req.File = key
+	}
+	src, ok := files[req.File]
+	if !ok {
+		known := make([]string, 0, len(files))
+		for p := range files {
+			known = append(known, p)
+		}
+		sort.Strings(known)
+		return fmt.Sprintf("fetch_function: file %s is not in CodeInput, known files: %s", req.File, strings.Join(known, ", ")), nil
+	}
+
+	var b strings.Builder
+	for _, name := range req.Names {
+		decl, err := cont.GoDeclaration(req.File, src, name)
+		if err != nil {
+			fmt.Fprintf(&b, "// %s: %v\n\n", name, err)
+			continue
+		}
+		fmt.Fprintf(&b, "// %s lines %d-%d\n%s\n\n", req.File, decl.StartLine, decl.EndLine, decl.Source)
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
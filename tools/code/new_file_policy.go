@@ -0,0 +1,44 @@
+package code
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// NewFilePolicy limits the files apply_edit may create, so a runaway agent can't scatter files
+// across the repository. Files that exist on disk are not new, even if the container did not load
+// them. Zero fields don't limit.
+type NewFilePolicy struct {
+	// Dirs are the directories new files must be in, at any depth, as container paths, e.g.
+	// "internal/parser".
+	Dirs []string
+	// Extensions are the allowed extensions of new files, e.g. ".go"; "" allows files without one.
+	Extensions []string
+	MaxBytes   int // of a new file
+	MaxFiles   int // created by one run
+}
+
+// check returns why the policy rejects creating file with size bytes, "" if it allows it.
+// created is the number of files created earlier in the run.
+func (p *NewFilePolicy) check(file string, size, created int) string {
+	if p.MaxFiles > 0 && created >= p.MaxFiles {
+		return fmt.Sprintf("%s: at most %d new files may be created in this run", file, p.MaxFiles)
+	}
+	if len(p.Dirs) > 0 && !slices.ContainsFunc(p.Dirs, func(dir string) bool { return inDir(file, dir) }) {
+		return fmt.Sprintf("%s: new files must be in %s", file, strings.Join(p.Dirs, ", "))
+	}
+	if len(p.Extensions) > 0 && !slices.ContainsFunc(p.Extensions, func(ext string) bool { return strings.EqualFold(path.Ext(file), ext) }) {
+		return fmt.Sprintf("%s: new files must have one of the extensions %q", file, p.Extensions)
+	}
+	if p.MaxBytes > 0 && size > p.MaxBytes {
+		return fmt.Sprintf("%s: new files may have at most %d bytes, it has %d", file, p.MaxBytes, size)
+	}
+	return ""
+}
+
+func inDir(file, dir string) bool {
+	dir = path.Clean(dir)
+	return dir == "." || strings.HasPrefix(file, dir+"/")
+}
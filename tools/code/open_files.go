@@ -0,0 +1,94 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+const (
+	// OpenFilesToolName is the public name of the tool loading files from disk into the container.
+	OpenFilesToolName = "open_files"
+)
+
+// OpenFilesTool loads files of the repository that are not in CodeInput into the CodeContainer and
+// returns their content, so the agent can read and edit files it finds in the repository map.
+type OpenFilesTool struct {
+	Code *cont.CodeContainer
+	// OnLoad, if set, is called with the key and the content of every file read from disk.
+	OnLoad func(key, content string)
+}
+
+type OpenFilesRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// Info implements the tool metadata for exposure to the agent runtime.
+func (t *OpenFilesTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: OpenFilesToolName,
+		Desc: "Open files of the repository that are not in CodeInput, e.g. from RepositoryMap. Returns their content as CodeInput; once opened, they can be edited.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"paths": {
+				Type:     schema.Array,
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+				Required: true,
+				Desc:     "Paths of the files, relative to the repository root as in RepositoryMap.",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun loads the requested files and returns them as CodeInput XML, followed by the paths
+// that could not be opened.
+func (t *OpenFilesTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Code == nil {
+		return "", errors.New("open_files: tool not initialized with a CodeContainer")
+	}
+	var req OpenFilesRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("open_files: invalid arguments: %v", err), nil
+	}
+	if len(req.Paths) == 0 {
+		return "open_files: paths are required", nil
+	}
+	files := make(map[string]string, len(req.Paths))
+	var failed []string
+	for _, p := range req.Paths {
+		key, err := t.Code.Normalize(p)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("- %s: %v", p, err))
+			continue
+		}
+		had := t.Code.Has(key)
+		content, err := t.Code.Load(key)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("- %s: %v", p, err))
+			continue
+		}
+		if !had && t.OnLoad != nil {
+			t.OnLoad(key, content)
+		}
+		files[key] = content
+	}
+	var b strings.Builder
+	if len(files) > 0 {
+		xml, err := cont.BuildCodeInput(files, nil).ToXML()
+		if err != nil {
+			return "", fmt.Errorf("open_files: %w", err)
+		}
+		b.WriteString(xml)
+		b.WriteString("\n")
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&b, "open_files: could not open:\n%s\n", strings.Join(failed, "\n"))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,27 @@
+package code
+
+import (
+	"fmt"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+// Quota bounds how much the edits of a run may change, counted from the files as they were at the
+// first apply_edit call, so a runaway patch can't rewrite or wipe out the repository. Zero fields
+// don't limit.
+type Quota struct {
+	MaxChangedLines int // added plus removed lines, over all files
+	MaxDeletedFiles int
+}
+
+// check returns why the quota rejects the change stat, "" if it allows it.
+func (q *Quota) check(stat cont.DiffStat) string {
+	if q.MaxDeletedFiles > 0 && stat.Deleted > q.MaxDeletedFiles {
+		return fmt.Sprintf("the run would delete %d files, at most %d may be deleted", stat.Deleted, q.MaxDeletedFiles)
+	}
+	if q.MaxChangedLines > 0 && stat.Changed() > q.MaxChangedLines {
+		return fmt.Sprintf("the run would change %d lines (%d added, %d removed; %d bytes written, %d deleted), at most %d may change",
+			stat.Changed(), stat.Added, stat.Removed, stat.AddedBytes, stat.RemovedBytes, q.MaxChangedLines)
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/code/v4a"
+)
+
+const (
+	// ValidatePatchToolName is the public name of the tool checking a patch without applying it.
+	ValidatePatchToolName = "validate_patch"
+)
+
+// ValidatePatchTool parses a CodeOutput and applies it to a copy of the CodeContainer, reporting
+// parse and context errors. Nothing is written, so the model can iterate on a malformed patch
+// cheaply before calling apply_edit.
+type ValidatePatchTool struct {
+	Code   *cont.CodeContainer
+	Format cont.EditFormat // format of the edits, v4a when empty
+	// PatchOptions tune how the context of v4a patches is matched, as for apply_edit.
+	PatchOptions v4a.Options
+}
+
+// Info implements the tool metadata for exposure to the agent runtime.
+func (t *ValidatePatchTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: ValidatePatchToolName,
+		Desc: "Check a <CodeOutput> XML patch without applying it. Takes the same arguments as " + ApplyEditToolName + " and reports parse or context errors, or the files the patch would change.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"code_output": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     codeOutputDesc(t.Format) + " to check.",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun dry-runs the patch on a clone of the container.
+func (t *ValidatePatchTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Code == nil {
+		return "", errors.New("validate_patch: tool not initialized with a CodeContainer")
+	}
+	var req ApplyEditRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("validate_patch: failed to parse arguments: %v", err), nil
+	}
+	xmlPayload := strings.TrimSpace(req.CodeOutput)
+	if xmlPayload == "" {
+		return "validate_patch: xml payload is empty", nil
+	}
+	co, err := cont.ParseCodeOutput(xmlPayload)
+	if err != nil {
+		return fmt.Sprintf("validate_patch: invalid CodeOutput XML: %v", err), nil
+	}
+
+	before := t.Code.Files()
+	dry := t.Code.Clone()
+	if _, err := dry.ApplyFormatWithOptions(co, t.Format, t.PatchOptions); err != nil {
+		return fmt.Sprintf("validate_patch: patch is invalid: %v", err), nil
+	}
+	after := dry.Files()
+
+	var changes []string
+	for path, content := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, "add "+path)
+		case old != content:
+			changes = append(changes, "update "+path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, "delete "+path)
+		}
+	}
+	if len(changes) == 0 {
+		return "validate_patch: patch is valid but changes nothing", nil
+	}
+	sort.Strings(changes)
+	return fmt.Sprintf("validate_patch: patch is valid, %s would %s. Nothing was applied.", ApplyEditToolName, strings.Join(changes, ", ")), nil
+}
@@ -5,14 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/flow/agent/react"
 	"github.com/cloudwego/eino/schema"
-	"github.com/rs/zerolog/log"
 
 	"github.com/stumble/axe/history"
+	"github.com/stumble/axe/tools"
 )
 
 const (
@@ -26,39 +27,102 @@ const (
 
 type FinalizeTool struct {
 	Changelog *history.Changelog
+	// Validators run when the task is finalized with status success. If any fails, the failures are
+	// returned to the model and the run continues.
+	Validators []Validator
+	// RequireReport adds a required report argument, the deliverable of read-only runs. It is saved
+	// in Changelog.Report.
+	RequireReport bool
 }
 
 type FinalizeRequest struct {
 	Status    string `json:"status"`
 	Changelog string `json:"changelog,omitempty"`
 	TODO      string `json:"todo,omitempty"`
+	Report    string `json:"report,omitempty"`
+
+	// machine-readable results, persisted in the changelog
+	ModifiedFiles []string           `json:"modified_files,omitempty"`
+	TestsRun      []string           `json:"tests_run,omitempty"`
+	Metrics       map[string]float64 `json:"metrics,omitempty"`
+	Payload       json.RawMessage    `json:"payload,omitempty"`
+}
+
+// result converts the structured fields of the request, nil if none is set.
+func (req FinalizeRequest) result() *history.Result {
+	payload := strings.TrimSpace(string(req.Payload))
+	if payload == "null" {
+		payload = ""
+	}
+	if len(req.ModifiedFiles) == 0 && len(req.TestsRun) == 0 && len(req.Metrics) == 0 && payload == "" {
+		return nil
+	}
+	res := &history.Result{ModifiedFiles: req.ModifiedFiles, TestsRun: req.TestsRun}
+	names := make([]string, 0, len(req.Metrics))
+	for name := range req.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res.Metrics = append(res.Metrics, history.Metric{Name: name, Value: req.Metrics[name]})
+	}
+	if payload != "" {
+		res.Payload = &history.LogEntry{Value: payload}
+	}
+	return res
 }
 
 func (t *FinalizeTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	params := map[string]*schema.ParameterInfo{
+		"status": {
+			Type:     schema.String,
+			Required: true,
+			Desc:     "Set to `success` or `failure`.",
+			Enum:     []string{"success", "failure"},
+		},
+		"changelog": {
+			Type: schema.String,
+			Desc: "A detailed changelog of the task, covering all the changes made to the code, tests.",
+		},
+		"todo": {
+			Type: schema.String,
+			Desc: "Tasks that are not yet implemented, comparing to the original instruction. Make sure to cover all the remaining tasks.",
+		},
+		"modified_files": {
+			Type:     schema.Array,
+			ElemInfo: &schema.ParameterInfo{Type: schema.String},
+			Desc:     "Paths of the files you created, modified or deleted.",
+		},
+		"tests_run": {
+			Type:     schema.Array,
+			ElemInfo: &schema.ParameterInfo{Type: schema.String},
+			Desc:     "Test commands or test names you ran to verify the change.",
+		},
+		"metrics": {
+			Type: schema.Object,
+			Desc: "Numeric results keyed by name, e.g. {\"coverage_percent\": 91.5}.",
+		},
+		"payload": {
+			Type: schema.Object,
+			Desc: "Any other machine-readable result the instruction asks for, as a JSON object.",
+		},
+	}
+	if t.RequireReport {
+		params["report"] = &schema.ParameterInfo{
+			Type:     schema.String,
+			Required: true,
+			Desc:     "The complete analysis, review or report asked for by the instruction, in Markdown.",
+		}
+	}
 	return &schema.ToolInfo{
-		Name: FinalizeToolName,
-		Desc: "Mark the task as complete. Use status `success` only when the instruction is satisfied.",
-		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
-			"status": {
-				Type:     schema.String,
-				Required: true,
-				Desc:     "Set to `success` or `failure`.",
-				Enum:     []string{"success", "failure"},
-			},
-			"changelog": {
-				Type: schema.String,
-				Desc: "A detailed changelog of the task, covering all the changes made to the code, tests.",
-			},
-			"todo": {
-				Type: schema.String,
-				Desc: "Tasks that are not yet implemented, comparing to the original instruction. Make sure to cover all the remaining tasks.",
-			},
-		}),
+		Name:        FinalizeToolName,
+		Desc:        "Mark the task as complete. Use status `success` only when the instruction is satisfied.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(params),
 	}, nil
 }
 
 func (t *FinalizeTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
-	log.Debug().Msgf("finalize_task: finalizing task: %s", argumentsInJSON)
+	tools.Logger(ctx).Debug().Msgf("finalize_task: finalizing task: %s", argumentsInJSON)
 	if strings.TrimSpace(argumentsInJSON) == "" {
 		return "", errors.New("finalize_task: missing arguments")
 	}
@@ -72,6 +136,17 @@ func (t *FinalizeTool) InvokableRun(ctx context.Context, argumentsInJSON string,
 		return "", errors.New("finalize_task: status must be \"success\" or \"failure\"")
 	}
 
+	report := strings.TrimSpace(req.Report)
+	if t.RequireReport && report == "" && status == StatusSuccess {
+		return fmt.Sprintf("%s: report is required, put your complete analysis in it", FinalizeToolName), nil
+	}
+	if status == StatusSuccess {
+		if failures := validate(ctx, t.Validators); failures != "" {
+			tools.Logger(ctx).Debug().Msg("finalize_task: validation failed")
+			return failures, nil
+		}
+	}
+
 	summary := strings.TrimSpace(req.Changelog)
 	if summary == "" {
 		if status == StatusSuccess {
@@ -83,9 +158,14 @@ func (t *FinalizeTool) InvokableRun(ctx context.Context, argumentsInJSON string,
 
 	// update changelog
 	if t.Changelog != nil {
+		t.Changelog.Finalized = true
 		t.Changelog.Success = status == StatusSuccess
 		t.Changelog.AddLog(summary)
 		t.Changelog.TODO = req.TODO
+		t.Changelog.Result = req.result()
+		if report != "" {
+			t.Changelog.Report = &history.LogEntry{Value: report}
+		}
 	}
 
 	if err := react.SetReturnDirectly(ctx); err != nil {
@@ -0,0 +1,47 @@
+package finalize
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe/history"
+)
+
+func TestFinalizeRequest_Result(t *testing.T) {
+	var req FinalizeRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"status": "success",
+		"modified_files": ["a.go"],
+		"tests_run": ["go test ./..."],
+		"metrics": {"coverage": 91.5, "bugs": 2},
+		"payload": {"answer": 42}
+	}`), &req))
+
+	assert.Equal(t, &history.Result{
+		ModifiedFiles: []string{"a.go"},
+		TestsRun:      []string{"go test ./..."},
+		Metrics:       []history.Metric{{Name: "bugs", Value: 2}, {Name: "coverage", Value: 91.5}},
+		Payload:       &history.LogEntry{Value: `{"answer": 42}`},
+	}, req.result())
+
+	assert.Nil(t, FinalizeRequest{Status: "success", Payload: json.RawMessage("null")}.result())
+}
+
+func TestFinalizeTool_RequireReport(t *testing.T) {
+	tool := &FinalizeTool{Changelog: &history.Changelog{}, RequireReport: true}
+
+	info, err := tool.Info(context.Background())
+	require.NoError(t, err)
+	schema, err := info.ParamsOneOf.ToJSONSchema()
+	require.NoError(t, err)
+	assert.Contains(t, schema.Required, "report")
+
+	out, err := tool.InvokableRun(context.Background(), `{"status":"success","report":"  "}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "report is required")
+	assert.False(t, tool.Changelog.Finalized)
+}
@@ -0,0 +1,62 @@
+package finalize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+// Validator checks the work before the task may be finalized with status success.
+// Check returns an error describing what is wrong; it is shown to the model.
+type Validator struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// CommandValidator passes when argv exits with code 0 in dir. On failure, the error contains the
+// (clipped) command output.
+func CommandValidator(name, dir string, argv ...string) Validator {
+	return Validator{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			if len(argv) == 0 {
+				return errors.New("no command")
+			}
+			outcome := (&clitool.SubprocessExecutor{}).Execute(ctx, argv, nil, dir)
+			if !outcome.Ran || outcome.ExitCode != 0 {
+				return errors.New(outcome.String())
+			}
+			return nil
+		},
+	}
+}
+
+// GoBuildValidator requires "go build ./..." to pass in dir.
+func GoBuildValidator(dir string) Validator {
+	return CommandValidator("go build must pass", dir, "go", "build", "./...")
+}
+
+// GoTestValidator requires "go test ./..." to pass in dir.
+func GoTestValidator(dir string) Validator {
+	return CommandValidator("all tests must pass", dir, "go", "test", "./...")
+}
+
+// validate runs all validators and returns the failure report, or "" when all passed.
+func validate(ctx context.Context, validators []Validator) string {
+	var b strings.Builder
+	for _, v := range validators {
+		if v.Check == nil {
+			continue
+		}
+		if err := v.Check(ctx); err != nil {
+			fmt.Fprintf(&b, "- %s: %s\n", v.Name, strings.TrimSpace(err.Error()))
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: the task cannot be finalized as success, these checks failed:\n%sFix the problems and call %s again.", FinalizeToolName, b.String(), FinalizeToolName)
+}
@@ -0,0 +1,45 @@
+package finalize
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe/history"
+)
+
+func TestFinalizeTool_ValidatorFailureKeepsRunning(t *testing.T) {
+	var changelog history.Changelog
+	tool := &FinalizeTool{
+		Changelog: &changelog,
+		Validators: []Validator{
+			{Name: "ok", Check: func(context.Context) error { return nil }},
+			{Name: "tests green", Check: func(context.Context) error { return errors.New("TestAdd failed") }},
+		},
+	}
+
+	out, err := tool.InvokableRun(context.Background(), `{"status":"success","changelog":"done"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "- tests green: TestAdd failed\n")
+	assert.NotContains(t, out, "- ok")
+	assert.False(t, changelog.Finalized)
+	assert.Empty(t, changelog.Logs)
+}
+
+func TestCommandValidator(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	ctx := context.Background()
+	assert.NoError(t, CommandValidator("true", t.TempDir(), "sh", "-c", "exit 0").Check(ctx))
+
+	err := CommandValidator("false", t.TempDir(), "sh", "-c", "echo broken; exit 3").Check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+
+	assert.Error(t, CommandValidator("empty", t.TempDir()).Check(ctx))
+}
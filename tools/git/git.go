@@ -0,0 +1,339 @@
+package gittool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/tools"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+const (
+	StatusToolName         = "git_status"
+	DiffToolName           = "git_diff"
+	LogToolName            = "git_log"
+	CommitToolName         = "git_commit"
+	CheckoutBranchToolName = "git_checkout_branch"
+)
+
+const (
+	defaultLogCount = 10
+	maxLogCount     = 100
+)
+
+// NewTools returns the git tool suite operating on the repository at dir.
+// The tools never accept free-form git arguments: every parameter is validated and
+// passed after the subcommand, paths after "--". The tools refuse to commit or check out
+// changes of the paths matching one of the protected globs, see container.MatchGlob.
+func NewTools(dir string, protected ...string) []tool.InvokableTool {
+	return []tool.InvokableTool{
+		&StatusTool{Dir: dir},
+		&DiffTool{Dir: dir},
+		&LogTool{Dir: dir},
+		&CommitTool{Dir: dir, Protected: protected},
+		&CheckoutBranchTool{Dir: dir, Protected: protected},
+	}
+}
+
+// StatusTool shows the working tree status.
+type StatusTool struct {
+	Dir string
+}
+
+func (t *StatusTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        StatusToolName,
+		Desc:        "Show the current branch and the changed, staged and untracked files of the repository.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{}),
+	}, nil
+}
+
+func (t *StatusTool) InvokableRun(ctx context.Context, _ string, _ ...tool.Option) (string, error) {
+	return runGit(ctx, t.Dir, "status", "--porcelain=v1", "--branch"), nil
+}
+
+// DiffTool shows changes of the working tree, the index, or against a ref.
+type DiffTool struct {
+	Dir string
+}
+
+type DiffRequest struct {
+	Staged bool     `json:"staged,omitempty"`
+	Ref    string   `json:"ref,omitempty"`
+	Paths  []string `json:"paths,omitempty"`
+}
+
+func (t *DiffTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: DiffToolName,
+		Desc: "Show the diff of uncommitted changes. Output is truncated for large diffs, pass paths to narrow it down.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"staged": {Type: schema.Boolean, Desc: "Show staged changes instead of unstaged ones."},
+			"ref":    {Type: schema.String, Desc: "Compare the working tree against this commit, branch or tag instead."},
+			"paths":  {Type: schema.Array, ElemInfo: &schema.ParameterInfo{Type: schema.String}, Desc: "Limit the diff to these paths."},
+		}),
+	}, nil
+}
+
+func (t *DiffTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req DiffRequest
+	if err := parseArgs(argumentsInJSON, &req); err != nil {
+		return fmt.Sprintf("%s: %v", DiffToolName, err), nil
+	}
+	args := []string{"diff"}
+	if req.Staged {
+		args = append(args, "--cached")
+	}
+	if req.Ref != "" {
+		if err := validateRef(req.Ref); err != nil {
+			return fmt.Sprintf("%s: %v", DiffToolName, err), nil
+		}
+		args = append(args, req.Ref)
+	}
+	paths, err := cleanPaths(t.Dir, req.Paths)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", DiffToolName, err), nil
+	}
+	args = append(append(args, "--"), paths...)
+	return runGit(ctx, t.Dir, args...), nil
+}
+
+// LogTool shows recent commits.
+type LogTool struct {
+	Dir string
+}
+
+type LogRequest struct {
+	MaxCount int    `json:"max_count,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+func (t *LogTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: LogToolName,
+		Desc: "Show recent commits, one per line: short hash, date, author and subject.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"max_count": {Type: schema.Integer, Desc: fmt.Sprintf("Number of commits to show, default %d, at most %d.", defaultLogCount, maxLogCount)},
+			"path":      {Type: schema.String, Desc: "Only show commits touching this path."},
+		}),
+	}, nil
+}
+
+func (t *LogTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req LogRequest
+	if err := parseArgs(argumentsInJSON, &req); err != nil {
+		return fmt.Sprintf("%s: %v", LogToolName, err), nil
+	}
+	count := req.MaxCount
+	if count <= 0 {
+		count = defaultLogCount
+	}
+	count = min(count, maxLogCount)
+	args := []string{"log", fmt.Sprintf("--max-count=%d", count), "--date=short", "--format=%h %ad %an %s", "--"}
+	if req.Path != "" {
+		paths, err := cleanPaths(t.Dir, []string{req.Path})
+		if err != nil {
+			return fmt.Sprintf("%s: %v", LogToolName, err), nil
+		}
+		args = append(args, paths...)
+	}
+	return runGit(ctx, t.Dir, args...), nil
+}
+
+// CommitTool stages and commits changes.
+type CommitTool struct {
+	Dir       string
+	Protected []string // globs of the paths it must not commit, relative to Dir
+}
+
+type CommitRequest struct {
+	Message string   `json:"message"`
+	Paths   []string `json:"paths,omitempty"`
+}
+
+func (t *CommitTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: CommitToolName,
+		Desc: "Stage and commit changes. Without paths, all changes including untracked files are committed.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"message": {Type: schema.String, Required: true, Desc: "Commit message describing the change."},
+			"paths":   {Type: schema.Array, ElemInfo: &schema.ParameterInfo{Type: schema.String}, Desc: "Only stage and commit these paths."},
+		}),
+	}, nil
+}
+
+func (t *CommitTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req CommitRequest
+	if err := parseArgs(argumentsInJSON, &req); err != nil {
+		return fmt.Sprintf("%s: %v", CommitToolName, err), nil
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		return fmt.Sprintf("%s: message is required", CommitToolName), nil
+	}
+	paths, err := cleanPaths(t.Dir, req.Paths)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", CommitToolName, err), nil
+	}
+
+	add := []string{"add", "--all", "--"}
+	if len(paths) > 0 {
+		add = append(add, paths...)
+	}
+	if out, ok := runGitOutcome(ctx, t.Dir, add...); !ok {
+		return out, nil
+	}
+	if len(t.Protected) > 0 {
+		protected, err := protectedPaths(ctx, t.Dir, t.Protected, "diff", "--cached", "--name-only", "--relative", "-z")
+		if err != nil {
+			return fmt.Sprintf("%s: %v", CommitToolName, err), nil
+		}
+		if len(protected) > 0 {
+			runGit(ctx, t.Dir, append([]string{"reset", "--quiet", "--"}, protected...)...)
+			return fmt.Sprintf("%s: nothing committed, these paths are protected and must not be committed: %s. They were unstaged; commit with paths that leave them out.",
+				CommitToolName, strings.Join(protected, ", ")), nil
+		}
+	}
+	return runGit(ctx, t.Dir, "commit", "--message", req.Message), nil
+}
+
+// CheckoutBranchTool switches to a branch, optionally creating it.
+type CheckoutBranchTool struct {
+	Dir       string
+	Protected []string // globs of the paths it must not change by switching, relative to Dir
+}
+
+type CheckoutBranchRequest struct {
+	Branch string `json:"branch"`
+	Create bool   `json:"create,omitempty"`
+}
+
+func (t *CheckoutBranchTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: CheckoutBranchToolName,
+		Desc: "Switch to a branch. Uncommitted changes are carried over; the switch fails if they conflict.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"branch": {Type: schema.String, Required: true, Desc: "Name of the branch."},
+			"create": {Type: schema.Boolean, Desc: "Create the branch from the current HEAD."},
+		}),
+	}, nil
+}
+
+func (t *CheckoutBranchTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req CheckoutBranchRequest
+	if err := parseArgs(argumentsInJSON, &req); err != nil {
+		return fmt.Sprintf("%s: %v", CheckoutBranchToolName, err), nil
+	}
+	if err := validateRef(req.Branch); err != nil {
+		return fmt.Sprintf("%s: %v", CheckoutBranchToolName, err), nil
+	}
+	if out, ok := runGitOutcome(ctx, t.Dir, "check-ref-format", "--branch", req.Branch); !ok {
+		return fmt.Sprintf("%s: invalid branch name %q\n%s", CheckoutBranchToolName, req.Branch, out), nil
+	}
+	if req.Create {
+		return runGit(ctx, t.Dir, "switch", "--create", req.Branch), nil
+	}
+	if len(t.Protected) > 0 {
+		protected, err := protectedPaths(ctx, t.Dir, t.Protected, "diff", "--name-only", "--relative", "-z", "HEAD", req.Branch, "--")
+		if err != nil {
+			return fmt.Sprintf("%s: %v", CheckoutBranchToolName, err), nil
+		}
+		if len(protected) > 0 {
+			return fmt.Sprintf("%s: not switching to %s, it would change these protected paths: %s",
+				CheckoutBranchToolName, req.Branch, strings.Join(protected, ", ")), nil
+		}
+	}
+	return runGit(ctx, t.Dir, "switch", req.Branch), nil
+}
+
+func parseArgs(argumentsInJSON string, v any) error {
+	if strings.TrimSpace(argumentsInJSON) == "" {
+		argumentsInJSON = "{}"
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// refPattern is deliberately stricter than git's own rules; check-ref-format does the rest.
+var refPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/~^@{}-]*$`)
+
+func validateRef(ref string) error {
+	if ref == "" {
+		return errors.New("ref is required")
+	}
+	if !refPattern.MatchString(ref) {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	return nil
+}
+
+// cleanPaths converts paths to paths relative to dir and rejects paths outside of it.
+func cleanPaths(dir string, paths []string) ([]string, error) {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		rel := filepath.Clean(p)
+		if filepath.IsAbs(rel) {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, err
+			}
+			if rel, err = filepath.Rel(absDir, rel); err != nil {
+				return nil, fmt.Errorf("path %q is outside of the repository", p)
+			}
+		}
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("path %q is outside of the repository", p)
+		}
+		out = append(out, rel)
+	}
+	return out, nil
+}
+
+// protectedPaths runs git with args, which list paths separated by NUL, and returns those matching
+// one of globs.
+func protectedPaths(ctx context.Context, dir string, globs []string, args ...string) ([]string, error) {
+	outcome := execGit(ctx, dir, args...)
+	if outcome.ExitCode != 0 {
+		return nil, fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(outcome.Stderr))
+	}
+	var out []string
+	for _, p := range strings.Split(outcome.Stdout, "\x00") {
+		if p != "" && slices.ContainsFunc(globs, func(g string) bool { return container.MatchGlob(g, p) }) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func runGit(ctx context.Context, dir string, args ...string) string {
+	out, _ := runGitOutcome(ctx, dir, args...)
+	return out
+}
+
+// runGitOutcome runs git and reports whether it exited successfully.
+func runGitOutcome(ctx context.Context, dir string, args ...string) (string, bool) {
+	outcome := execGit(ctx, dir, args...)
+	return outcome.String(), outcome.ExitCode == 0
+}
+
+func execGit(ctx context.Context, dir string, args ...string) clitool.Outcome {
+	tools.Logger(ctx).Debug().Strs("args", args).Msg("gittool: running git")
+	argv := append([]string{"git"}, args...)
+	// never block on an editor or credential prompt
+	env := map[string]string{"GIT_TERMINAL_PROMPT": "0", "GIT_EDITOR": "true"}
+	return (&clitool.SubprocessExecutor{}).Execute(ctx, argv, env, dir)
+}
@@ -0,0 +1,126 @@
+package gittool
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--initial-branch=main"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgsign", "false"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return dir
+}
+
+func TestGitTools_CommitStatusDiffLog(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644))
+
+	out, err := (&StatusTool{Dir: dir}).InvokableRun(ctx, "{}")
+	require.NoError(t, err)
+	assert.Contains(t, out, "?? a.txt")
+
+	out, err = (&CommitTool{Dir: dir}).InvokableRun(ctx, `{"message":"add a"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Result: succeeded")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("two\n"), 0o644))
+	out, err = (&DiffTool{Dir: dir}).InvokableRun(ctx, `{"paths":["a.txt"]}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "+two")
+
+	out, err = (&LogTool{Dir: dir}).InvokableRun(ctx, `{"max_count":1}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Test add a")
+}
+
+func TestGitTools_CheckoutBranch(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644))
+	_, err := (&CommitTool{Dir: dir}).InvokableRun(ctx, `{"message":"init"}`)
+	require.NoError(t, err)
+
+	out, err := (&CheckoutBranchTool{Dir: dir}).InvokableRun(ctx, `{"branch":"feature/x","create":true}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Result: succeeded")
+
+	out, err = (&StatusTool{Dir: dir}).InvokableRun(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, out, "## feature/x")
+}
+
+func TestGitTools_Validation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	out, err := (&CommitTool{Dir: dir}).InvokableRun(ctx, `{"message":"  "}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "message is required")
+
+	out, err = (&CheckoutBranchTool{Dir: dir}).InvokableRun(ctx, `{"branch":"--orphan"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "invalid ref")
+
+	out, err = (&DiffTool{Dir: dir}).InvokableRun(ctx, `{"ref":"-p"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "invalid ref")
+
+	out, err = (&DiffTool{Dir: dir}).InvokableRun(ctx, `{"paths":["../outside"]}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "outside of the repository")
+
+	out, err = (&LogTool{Dir: dir}).InvokableRun(ctx, `{"path":"/etc/passwd"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "outside of the repository")
+}
+
+func TestGitTools_ProtectedPaths(t *testing.T) {
+	ctx := context.Background()
+	dir := newRepo(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module m\n"), 0o644))
+	_, err := (&CommitTool{Dir: dir}).InvokableRun(ctx, `{"message":"init"}`)
+	require.NoError(t, err)
+	_, err = (&CheckoutBranchTool{Dir: dir}).InvokableRun(ctx, `{"branch":"other","create":true}`)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module other\n"), 0o644))
+	_, err = (&CommitTool{Dir: dir}).InvokableRun(ctx, `{"message":"other"}`)
+	require.NoError(t, err)
+
+	tools := NewTools(dir, "go.mod")
+	commit, checkout := tools[3], tools[4]
+	out, err := checkout.InvokableRun(ctx, `{"branch":"main"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "git_checkout_branch: not switching to main, it would change these protected paths: go.mod", out)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module changed\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0o644))
+	out, err = commit.InvokableRun(ctx, `{"message":"change"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "git_commit: nothing committed, these paths are protected and must not be committed: go.mod. They were unstaged; commit with paths that leave them out.", out)
+
+	out, err = commit.InvokableRun(ctx, `{"message":"add a","paths":["a.txt"]}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "Result: succeeded")
+	out, err = (&StatusTool{Dir: dir}).InvokableRun(ctx, "")
+	require.NoError(t, err)
+	assert.Contains(t, out, " M go.mod", "go.mod is left unstaged")
+}
@@ -0,0 +1,170 @@
+package gocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+// AddImportTool adds an import to a Go file, in the group of the standard library or of the other
+// packages, creating the import declaration if needed.
+type AddImportTool struct {
+	Code *cont.CodeContainer
+}
+
+type AddImportRequest struct {
+	File string `json:"file"`
+	Path string `json:"path"`
+	Name string `json:"name,omitempty"`
+}
+
+// Info implements the tool metadata for exposure to the agent runtime.
+func (t *AddImportTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: AddImportToolName,
+		Desc: "Add an import to a Go file of CodeInput. Does nothing if the package is already imported.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"file": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Path of the Go file, exactly as in the CodeInput path attribute.",
+			},
+			"path": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Import path, e.g. \"net/http\".",
+			},
+			"name": {
+				Type: schema.String,
+				Desc: "Optional package name of the import, e.g. \"_\" or an alias.",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun adds the import and writes the file.
+func (t *AddImportTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Code == nil {
+		return "", fmt.Errorf("%s: tool not initialized with a CodeContainer", AddImportToolName)
+	}
+	var req AddImportRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("add_import: invalid arguments: %v", err), nil
+	}
+	req.Path = strings.Trim(strings.TrimSpace(req.Path), `"`)
+	if req.Path == "" || strings.ContainsAny(req.Path, "\"`\\ \n") {
+		return "add_import: path must be an import path", nil
+	}
+	if req.Name != "" && req.Name != "." && req.Name != "_" && !token.IsIdentifier(req.Name) {
+		return "add_import: name must be a Go identifier, \".\" or \"_\"", nil
+	}
+	file, src, msg := goFile(t.Code, req.File)
+	if msg != "" {
+		return "add_import: " + msg, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return fmt.Sprintf("add_import: %s does not parse: %v", file, err), nil
+	}
+	for _, spec := range f.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p != req.Path {
+			continue
+		}
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == req.Name {
+			return fmt.Sprintf("add_import: %s already imports %q", file, req.Path), nil
+		}
+		if name != "_" && req.Name != "_" {
+			return fmt.Sprintf("add_import: %s already imports %q under another name", file, req.Path), nil
+		}
+	}
+
+	content, err := applyEdits(src, importEdits(fset, f, src, req.Name, req.Path))
+	if err != nil {
+		return fmt.Sprintf("add_import: %v", err), nil
+	}
+	if err := write(ctx, t.Code, AddImportToolName, map[string]string{file: content}); err != nil {
+		return fmt.Sprintf("add_import: failed to write files: %v", err), nil
+	}
+	return fmt.Sprintf("add_import added %q to %s", req.Path, file), nil
+}
+
+// isStd reports whether the import path is of the standard library, whose first element has no dot.
+func isStd(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// importEdits returns the edit adding the import to f: after the last import of its group in the
+// first import declaration, which becomes a block if needed, or in a new declaration after the
+// package clause.
+func importEdits(fset *token.FileSet, f *ast.File, src, name, importPath string) []edit {
+	spec := strconv.Quote(importPath)
+	if name != "" {
+		spec = name + " " + spec
+	}
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+
+	var decl *ast.GenDecl
+	for _, d := range f.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			decl = d
+			break
+		}
+	}
+	if decl == nil {
+		end := offset(f.Name.End())
+		return []edit{{start: end, end: end, text: "\n\nimport " + spec}}
+	}
+
+	std := isStd(importPath)
+	var last ast.Spec
+	for _, s := range decl.Specs {
+		if p, _ := strconv.Unquote(s.(*ast.ImportSpec).Path.Value); isStd(p) == std {
+			last = s
+		}
+	}
+	if !decl.Lparen.IsValid() {
+		// import "x" becomes a block
+		existing := src[offset(decl.Specs[0].Pos()):offset(decl.Specs[0].End())]
+		separator := "\n\t"
+		if last == nil {
+			separator = "\n\n\t"
+		}
+		specs := existing + separator + spec
+		if last == nil && std {
+			specs = spec + separator + existing
+		}
+		return []edit{{start: offset(decl.Pos()), end: offset(decl.End()), text: "import (\n\t" + specs + "\n)"}}
+	}
+	switch {
+	case last != nil:
+		// after the comment ending the line, if any
+		end := offset(last.End())
+		if i := strings.IndexByte(src[end:], '\n'); i >= 0 {
+			end += i
+		}
+		return []edit{{start: end, end: end, text: "\n\t" + spec}}
+	case std:
+		start := offset(decl.Lparen) + 1
+		return []edit{{start: start, end: start, text: "\n\t" + spec + "\n"}}
+	default:
+		end := offset(decl.Rparen)
+		return []edit{{start: end, end: end, text: "\n\t" + spec + "\n"}}
+	}
+}
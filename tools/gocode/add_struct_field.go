@@ -0,0 +1,199 @@
+package gocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+// AddStructFieldTool appends a field to a struct type declared in a Go file.
+type AddStructFieldTool struct {
+	Code *cont.CodeContainer
+}
+
+type AddStructFieldRequest struct {
+	File    string `json:"file"`
+	Struct  string `json:"struct"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Tag     string `json:"tag,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Info implements the tool metadata for exposure to the agent runtime.
+func (t *AddStructFieldTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: AddStructFieldToolName,
+		Desc: "Add a field at the end of a struct type declared in a Go file of CodeInput.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"file": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Path of the Go file, exactly as in the CodeInput path attribute.",
+			},
+			"struct": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Name of the struct type.",
+			},
+			"name": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Name of the field.",
+			},
+			"type": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Go type of the field, e.g. \"map[string]int\".",
+			},
+			"tag": {
+				Type: schema.String,
+				Desc: "Optional struct tag, e.g. json:\"name,omitempty\".",
+			},
+			"comment": {
+				Type: schema.String,
+				Desc: "Optional comment of the field, without the leading //.",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun adds the field and writes the file.
+func (t *AddStructFieldTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Code == nil {
+		return "", fmt.Errorf("%s: tool not initialized with a CodeContainer", AddStructFieldToolName)
+	}
+	var req AddStructFieldRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("add_struct_field: invalid arguments: %v", err), nil
+	}
+	if !token.IsIdentifier(req.Name) {
+		return "add_struct_field: name must be a Go identifier", nil
+	}
+	if _, err := parser.ParseExpr(req.Type); err != nil || strings.ContainsAny(req.Type, "\n;") {
+		return fmt.Sprintf("add_struct_field: type %q is not a Go type", req.Type), nil
+	}
+	tag, msg := structTag(req.Tag)
+	if msg != "" {
+		return "add_struct_field: " + msg, nil
+	}
+	if strings.Contains(req.Comment, "\n") {
+		return "add_struct_field: comment must be a single line", nil
+	}
+	file, src, msg := goFile(t.Code, req.File)
+	if msg != "" {
+		return "add_struct_field: " + msg, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return fmt.Sprintf("add_struct_field: %s does not parse: %v", file, err), nil
+	}
+	st := findStruct(f, req.Struct)
+	if st == nil {
+		return fmt.Sprintf("add_struct_field: %s declares no struct type %s", file, req.Struct), nil
+	}
+	for _, field := range st.Fields.List {
+		for _, name := range fieldNames(field) {
+			if name == req.Name {
+				return fmt.Sprintf("add_struct_field: %s already has a field %s", req.Struct, req.Name), nil
+			}
+		}
+	}
+
+	line := req.Name + " " + strings.TrimSpace(req.Type)
+	if tag != "" {
+		line += " " + tag
+	}
+	if c := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(req.Comment), "//")); c != "" {
+		line += " // " + c
+	}
+	// the closing brace goes on its own line
+	closing := fset.Position(st.Fields.Closing).Offset
+	text := line + "\n"
+	if before := strings.TrimRight(src[:closing], " \t"); !strings.HasSuffix(before, "\n") {
+		text = "\n" + text
+	}
+	content, err := applyEdits(src, []edit{{start: closing, end: closing, text: text}})
+	if err != nil {
+		return fmt.Sprintf("add_struct_field: %v", err), nil
+	}
+	if err := write(ctx, t.Code, AddStructFieldToolName, map[string]string{file: content}); err != nil {
+		return fmt.Sprintf("add_struct_field: failed to write files: %v", err), nil
+	}
+	return fmt.Sprintf("add_struct_field added %s.%s to %s", req.Struct, req.Name, file), nil
+}
+
+// structTag returns tag as a raw string literal, or a message for the model.
+func structTag(tag string) (string, string) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", ""
+	}
+	if strings.HasPrefix(tag, "`") || strings.HasPrefix(tag, `"`) {
+		if _, err := strconv.Unquote(tag); err != nil {
+			return "", fmt.Sprintf("tag %s is not a string literal", tag)
+		}
+		return tag, ""
+	}
+	if strings.ContainsAny(tag, "`\n") {
+		return "", fmt.Sprintf("tag %q can't be a raw string literal", tag)
+	}
+	return "`" + tag + "`", ""
+}
+
+// findStruct returns the struct type name declared at the top level of f.
+func findStruct(f *ast.File, name string) *ast.StructType {
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+				st, _ := ts.Type.(*ast.StructType)
+				return st
+			}
+		}
+	}
+	return nil
+}
+
+// fieldNames returns the names of a field, the type name for an embedded field.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		return []string{embeddedName(field.Type)}
+	}
+	names := make([]string, len(field.Names))
+	for i, n := range field.Names {
+		names[i] = n.Name
+	}
+	return names
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(e.X)
+	case *ast.IndexListExpr:
+		return embeddedName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
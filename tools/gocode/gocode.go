@@ -0,0 +1,134 @@
+// Package gocode provides structured refactoring tools for Go files: rename_symbol, add_import and
+// add_struct_field. They locate what to change with go/ast and format the result with go/format, so
+// common mechanical edits don't depend on text patches matching the file.
+package gocode
+
+import (
+	"context"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/tools"
+)
+
+const (
+	RenameSymbolToolName   = "rename_symbol"
+	AddImportToolName      = "add_import"
+	AddStructFieldToolName = "add_struct_field"
+)
+
+// NewTools returns the refactoring tools, editing the Go files of code and writing them to disk like
+// apply_edit.
+func NewTools(code *cont.CodeContainer) []tool.InvokableTool {
+	return []tool.InvokableTool{
+		&RenameSymbolTool{Code: code},
+		&AddImportTool{Code: code},
+		&AddStructFieldTool{Code: code},
+	}
+}
+
+// goFile returns the key and content of the Go file of code at file, or a message for the model.
+func goFile(code *cont.CodeContainer, file string) (string, string, string) {
+	if !strings.HasSuffix(file, ".go") {
+		return "", "", fmt.Sprintf("%s is not a Go file", file)
+	}
+	if key, err := code.Normalize(file); err == nil {
+		file = key
+	}
+	if !code.Has(file) {
+		return "", "", fmt.Sprintf("file %s is not in CodeInput, known files: %s", file, strings.Join(code.Paths(), ", "))
+	}
+	src, err := code.Open(file)
+	if err != nil {
+		return "", "", err.Error()
+	}
+	return file, src, ""
+}
+
+// edit replaces the bytes [start, end) of a file with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits applies non-overlapping edits to src and formats the result.
+func applyEdits(src string, edits []edit) (string, error) {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		src = src[:e.start] + e.text + src[e.end:]
+	}
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+// write stores the changed files in code and writes them to disk, all or nothing.
+func write(ctx context.Context, code *cont.CodeContainer, name string, changed map[string]string) error {
+	snapshot := code.Snapshot()
+	for p, content := range changed {
+		if err := code.Write(p, content); err != nil {
+			code.Restore(snapshot)
+			return err
+		}
+	}
+	if err := code.WriteToFiles(); err != nil {
+		code.Restore(snapshot)
+		if rollbackErr := code.WriteToFiles(); rollbackErr != nil {
+			tools.Logger(ctx).Error().Err(rollbackErr).Msgf("%s: roll back partially written files", name)
+		}
+		return err
+	}
+	return nil
+}
+
+// importPath returns the import path of the package in dir, a directory of code, from the go.mod
+// of its module, found in code or on disk. It returns "" outside a module.
+func importPath(code *cont.CodeContainer, dir string) string {
+	// go.mod files of the container first, they may not be written yet
+	for d, rel := dir, ""; ; {
+		if gomod := path.Join(d, "go.mod"); code.Has(gomod) {
+			content, _ := code.Open(gomod)
+			return joinModule(content, rel)
+		}
+		if d == "." || d == "/" || d == "" {
+			break
+		}
+		rel = path.Join(path.Base(d), rel)
+		d = path.Dir(d)
+	}
+	abs, err := filepath.Abs(filepath.Dir(code.DiskPath(path.Join(dir, "x.go"))))
+	if err != nil {
+		return ""
+	}
+	for d, rel := abs, ""; ; {
+		if data, err := os.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			return joinModule(string(data), rel)
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return ""
+		}
+		rel = path.Join(filepath.Base(d), rel)
+		d = parent
+	}
+}
+
+// joinModule returns the import path of the directory rel of the module of go.mod content gomod.
+func joinModule(gomod, rel string) string {
+	for _, line := range strings.Split(gomod, "\n") {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return path.Join(strings.Trim(strings.TrimSpace(module), `"`), rel)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,215 @@
+package gocode
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+// newModule writes files to a temporary module example.com/m and returns a container of the Go files.
+func newModule(t *testing.T, files map[string]string) *cont.CodeContainer {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.24\n"), 0o644))
+	var paths []string
+	for p, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, p)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, p), []byte(content), 0o644))
+		paths = append(paths, p)
+	}
+	code, err := cont.NewCodeContainerFromFS(dir, paths)
+	require.NoError(t, err)
+	return code
+}
+
+func invoke(t *testing.T, code *cont.CodeContainer, name string, args any) string {
+	t.Helper()
+	data, err := json.Marshal(args)
+	require.NoError(t, err)
+	for _, tl := range NewTools(code) {
+		info, err := tl.Info(context.Background())
+		require.NoError(t, err)
+		if info.Name == name {
+			out, err := tl.InvokableRun(context.Background(), string(data))
+			require.NoError(t, err)
+			return out
+		}
+	}
+	t.Fatalf("no tool %s", name)
+	return ""
+}
+
+// disk returns the content of the file at key, as written to disk.
+func disk(t *testing.T, code *cont.CodeContainer, key string) string {
+	t.Helper()
+	data, err := os.ReadFile(code.DiskPath(key))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRenameSymbol(t *testing.T) {
+	code := newModule(t, map[string]string{
+		"calc/calc.go": `package calc
+
+// Total sums values.
+func Total(values ...int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+type Report struct {
+	Total int
+}
+
+func (r Report) Total2() int { return Total(r.Total) }
+`,
+		"calc/other.go": `package calc
+
+var grand = Total(1, 2)
+
+func shadow() int {
+	Total := 3
+	return Total
+}
+`,
+		"calc/calc_test.go": `package calc_test
+
+import (
+	"testing"
+
+	"example.com/m/calc"
+)
+
+func TestTotal(t *testing.T) {
+	_ = calc.Total(1)
+	_ = calc.Report{Total: 1}
+}
+`,
+		"main.go": `package main
+
+import c "example.com/m/calc"
+
+func main() { println(c.Total()) }
+`,
+	})
+
+	out := invoke(t, code, RenameSymbolToolName, RenameSymbolRequest{File: "calc/calc.go", Name: "Total", NewName: "Sum"})
+	assert.Equal(t, "rename_symbol renamed Total to Sum in calc/calc.go (2), calc/calc_test.go (1), calc/other.go (1), main.go (1)", out)
+
+	calc := disk(t, code, "calc/calc.go")
+	assert.Contains(t, calc, "func Sum(values ...int) int {")
+	assert.Contains(t, calc, "\tTotal int\n", "the field is left alone")
+	assert.Contains(t, calc, "return Sum(r.Total)")
+	other := disk(t, code, "calc/other.go")
+	assert.Contains(t, other, "var grand = Sum(1, 2)")
+	assert.Contains(t, other, "Total := 3\n\treturn Total", "the local variable is left alone")
+	test := disk(t, code, "calc/calc_test.go")
+	assert.Contains(t, test, "_ = calc.Sum(1)")
+	assert.Contains(t, test, "calc.Report{Total: 1}")
+	assert.Contains(t, disk(t, code, "main.go"), "println(c.Sum())")
+}
+
+func TestRenameSymbol_Rejected(t *testing.T) {
+	code := newModule(t, map[string]string{
+		"calc/calc.go":  "package calc\n\nfunc Total() int { return 0 }\n",
+		"calc/other.go": "package calc\n\nvar Sum = 1\n",
+	})
+	assert.Equal(t, "rename_symbol: calc/other.go already declares Sum",
+		invoke(t, code, RenameSymbolToolName, RenameSymbolRequest{File: "calc/calc.go", Name: "Total", NewName: "Sum"}))
+	assert.Equal(t, "rename_symbol: calc/calc.go declares no package-level Missing",
+		invoke(t, code, RenameSymbolToolName, RenameSymbolRequest{File: "calc/calc.go", Name: "Missing", NewName: "Other"}))
+	assert.Equal(t, "rename_symbol: name and new_name must be Go identifiers",
+		invoke(t, code, RenameSymbolToolName, RenameSymbolRequest{File: "calc/calc.go", Name: "Total", NewName: "a-b"}))
+	assert.Equal(t, "package calc\n\nfunc Total() int { return 0 }\n", disk(t, code, "calc/calc.go"))
+}
+
+func TestAddImport(t *testing.T) {
+	code := newModule(t, map[string]string{
+		"block.go": `package m
+
+import (
+	"fmt" // printing
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _ = fmt.Sprint
+var _ = assert.True
+`,
+		"single.go": "package m\n\nimport \"github.com/stretchr/testify/assert\"\n\nvar _ = assert.True\n",
+		"none.go":   "// Package m.\npackage m\n\nvar x = 1\n",
+	})
+
+	assert.Equal(t, `add_import added "strings" to block.go`,
+		invoke(t, code, AddImportToolName, AddImportRequest{File: "block.go", Path: "strings"}))
+	assert.Equal(t, `add_import added "github.com/stretchr/testify/require" to block.go`,
+		invoke(t, code, AddImportToolName, AddImportRequest{File: "block.go", Path: "github.com/stretchr/testify/require"}))
+	assert.Equal(t, `package m
+
+import (
+	"fmt" // printing
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ = fmt.Sprint
+var _ = assert.True
+`, disk(t, code, "block.go"))
+	assert.Equal(t, `add_import: block.go already imports "strings"`,
+		invoke(t, code, AddImportToolName, AddImportRequest{File: "block.go", Path: "strings"}))
+
+	invoke(t, code, AddImportToolName, AddImportRequest{File: "single.go", Path: "os"})
+	assert.Equal(t, "package m\n\nimport (\n\t\"os\"\n\n\t\"github.com/stretchr/testify/assert\"\n)\n\nvar _ = assert.True\n", disk(t, code, "single.go"))
+
+	invoke(t, code, AddImportToolName, AddImportRequest{File: "none.go", Path: "net/http", Name: "_"})
+	assert.Equal(t, "// Package m.\npackage m\n\nimport _ \"net/http\"\n\nvar x = 1\n", disk(t, code, "none.go"))
+}
+
+func TestAddStructField(t *testing.T) {
+	code := newModule(t, map[string]string{
+		"config.go": `package m
+
+// Config configures.
+type Config struct {
+	Name string ` + "`json:\"name\"`" + `
+}
+
+type Empty struct{}
+`,
+	})
+
+	assert.Equal(t, "add_struct_field added Config.Retries to config.go", invoke(t, code, AddStructFieldToolName,
+		AddStructFieldRequest{File: "config.go", Struct: "Config", Name: "Retries", Type: "int", Tag: `json:"retries,omitempty"`, Comment: "retries on failure"}))
+	invoke(t, code, AddStructFieldToolName, AddStructFieldRequest{File: "config.go", Struct: "Empty", Name: "m", Type: "map[string]int"})
+	assert.Equal(t, `package m
+
+// Config configures.
+type Config struct {
+	Name    string `+"`json:\"name\"`"+`
+	Retries int    `+"`json:\"retries,omitempty\"`"+` // retries on failure
+}
+
+type Empty struct {
+	m map[string]int
+}
+`, disk(t, code, "config.go"))
+
+	assert.Equal(t, "add_struct_field: Config already has a field Name",
+		invoke(t, code, AddStructFieldToolName, AddStructFieldRequest{File: "config.go", Struct: "Config", Name: "Name", Type: "int"}))
+	assert.Equal(t, `add_struct_field: type "int {" is not a Go type`,
+		invoke(t, code, AddStructFieldToolName, AddStructFieldRequest{File: "config.go", Struct: "Config", Name: "Other", Type: "int {"}))
+	assert.Equal(t, "add_struct_field: config.go declares no struct type Missing",
+		invoke(t, code, AddStructFieldToolName, AddStructFieldRequest{File: "config.go", Struct: "Missing", Name: "Other", Type: "int"}))
+}
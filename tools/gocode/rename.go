@@ -0,0 +1,251 @@
+package gocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+// RenameSymbolTool renames a package-level declaration (function, type, variable or constant) of a
+// Go file, with its uses in the files of its package and, for exported names, in the files importing
+// it. Only the files of the CodeContainer are edited; identifiers are matched by scope, not by text,
+// so fields, methods and local variables of the same name are left alone.
+type RenameSymbolTool struct {
+	Code *cont.CodeContainer
+}
+
+type RenameSymbolRequest struct {
+	File    string `json:"file"`
+	Name    string `json:"name"`
+	NewName string `json:"new_name"`
+}
+
+// Info implements the tool metadata for exposure to the agent runtime.
+func (t *RenameSymbolTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: RenameSymbolToolName,
+		Desc: "Rename a package-level function, type, variable or constant declared in a Go file of CodeInput, and update its uses in the CodeInput files of the package and of the packages importing it. Prefer it to apply_edit for renames. Methods and struct fields are not supported.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"file": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Path of the Go file declaring the symbol, exactly as in the CodeInput path attribute.",
+			},
+			"name": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Current name of the symbol.",
+			},
+			"new_name": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "New name of the symbol.",
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun renames the symbol and reports the number of identifiers renamed per file.
+func (t *RenameSymbolTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Code == nil {
+		return "", fmt.Errorf("%s: tool not initialized with a CodeContainer", RenameSymbolToolName)
+	}
+	var req RenameSymbolRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return fmt.Sprintf("rename_symbol: invalid arguments: %v", err), nil
+	}
+	if !token.IsIdentifier(req.Name) || !token.IsIdentifier(req.NewName) || req.NewName == "_" {
+		return "rename_symbol: name and new_name must be Go identifiers", nil
+	}
+	if req.Name == req.NewName {
+		return "rename_symbol: name and new_name are the same", nil
+	}
+	file, _, msg := goFile(t.Code, req.File)
+	if msg != "" {
+		return "rename_symbol: " + msg, nil
+	}
+
+	pkg, msg := parsePackage(t.Code, file)
+	if msg != "" {
+		return "rename_symbol: " + msg, nil
+	}
+	if obj := pkg.files[file].Scope.Lookup(req.Name); obj == nil {
+		return fmt.Sprintf("rename_symbol: %s declares no package-level %s", file, req.Name), nil
+	}
+	for p, f := range pkg.files {
+		if f.Scope.Lookup(req.NewName) != nil {
+			return fmt.Sprintf("rename_symbol: %s already declares %s", p, req.NewName), nil
+		}
+	}
+
+	counts := map[string]int{}
+	changed := map[string]string{}
+	for p, f := range pkg.files {
+		positions := packageUses(f, req.Name)
+		if len(positions) == 0 {
+			continue
+		}
+		content, err := renameAt(pkg.fset, pkg.srcs[p], positions, req.Name, req.NewName)
+		if err != nil {
+			return fmt.Sprintf("rename_symbol: %s: %v", p, err), nil
+		}
+		counts[p], changed[p] = len(positions), content
+	}
+	var note string
+	if ast.IsExported(req.Name) {
+		imported := importPath(t.Code, path.Dir(file))
+		if imported == "" {
+			note = "\nNote: no go.mod found, packages importing " + pkg.name + " were not updated."
+		}
+		for _, p := range t.Code.Paths() {
+			if imported == "" || !strings.HasSuffix(p, ".go") || pkg.files[p] != nil {
+				continue
+			}
+			src, _ := t.Code.Open(p)
+			f, err := parser.ParseFile(pkg.fset, p, src, 0)
+			if err != nil {
+				continue
+			}
+			positions := importedUses(f, imported, pkg.name, req.Name)
+			if len(positions) == 0 {
+				continue
+			}
+			content, err := renameAt(pkg.fset, src, positions, req.Name, req.NewName)
+			if err != nil {
+				return fmt.Sprintf("rename_symbol: %s: %v", p, err), nil
+			}
+			counts[p], changed[p] = len(positions), content
+		}
+	}
+
+	if err := write(ctx, t.Code, RenameSymbolToolName, changed); err != nil {
+		return fmt.Sprintf("rename_symbol: failed to write files: %v", err), nil
+	}
+	paths := make([]string, 0, len(counts))
+	for p := range counts {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for i, p := range paths {
+		paths[i] = fmt.Sprintf("%s (%d)", p, counts[p])
+	}
+	return fmt.Sprintf("rename_symbol renamed %s to %s in %s%s", req.Name, req.NewName, strings.Join(paths, ", "), note), nil
+}
+
+// goPackage is the files of a package in the CodeContainer.
+type goPackage struct {
+	name  string
+	fset  *token.FileSet
+	files map[string]*ast.File
+	srcs  map[string]string
+}
+
+// parsePackage parses the files of the container in the directory and package of file. External
+// test packages (package x_test) are importers of the package, not part of it.
+func parsePackage(code *cont.CodeContainer, file string) (*goPackage, string) {
+	pkg := &goPackage{fset: token.NewFileSet(), files: map[string]*ast.File{}, srcs: map[string]string{}}
+	src, _ := code.Open(file)
+	f, err := parser.ParseFile(pkg.fset, file, src, 0)
+	if err != nil {
+		return nil, fmt.Sprintf("%s does not parse: %v", file, err)
+	}
+	pkg.name = f.Name.Name
+	pkg.files[file], pkg.srcs[file] = f, src
+	for _, p := range code.Paths() {
+		if p == file || !strings.HasSuffix(p, ".go") || path.Dir(p) != path.Dir(file) {
+			continue
+		}
+		src, _ := code.Open(p)
+		f, err := parser.ParseFile(pkg.fset, p, src, 0)
+		if err != nil {
+			return nil, fmt.Sprintf("%s does not parse: %v", p, err)
+		}
+		if f.Name.Name == pkg.name {
+			pkg.files[p], pkg.srcs[p] = f, src
+		}
+	}
+	return pkg, ""
+}
+
+// packageUses returns the positions of the identifiers of f referring to the package-level name: its
+// declaration, the uses resolved to it and, for declarations in other files, the unresolved ones.
+// Selectors, method names and composite literal keys that are not resolved are fields or methods.
+func packageUses(f *ast.File, name string) []token.Pos {
+	declared := f.Scope.Lookup(name)
+	unresolved := map[*ast.Ident]bool{}
+	for _, id := range f.Unresolved {
+		unresolved[id] = true
+	}
+	skip := map[*ast.Ident]bool{}
+	var uses []token.Pos
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				skip[n.Name] = true
+			}
+		case *ast.Ident:
+			if n.Name != name || skip[n] {
+				return true
+			}
+			if (declared != nil && n.Obj == declared) || (declared == nil && unresolved[n]) {
+				uses = append(uses, n.Pos())
+			}
+		}
+		return true
+	})
+	return uses
+}
+
+// importedUses returns the positions of the selectors of name on the imports of importPath, a
+// package named pkgName, in f.
+func importedUses(f *ast.File, importPath, pkgName, name string) []token.Pos {
+	imported := map[string]bool{}
+	for _, spec := range f.Imports {
+		if p, err := strconv.Unquote(spec.Path.Value); err != nil || p != importPath {
+			continue
+		}
+		if spec.Name != nil {
+			imported[spec.Name.Name] = true
+		} else {
+			imported[pkgName] = true
+		}
+	}
+	var uses []token.Pos
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != name {
+			return true
+		}
+		// an identifier resolved in the file is a local variable shadowing the import
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && imported[x.Name] {
+			uses = append(uses, sel.Sel.Pos())
+		}
+		return true
+	})
+	return uses
+}
+
+// renameAt replaces the identifiers name at positions of the file src with newName.
+func renameAt(fset *token.FileSet, src string, positions []token.Pos, name, newName string) (string, error) {
+	edits := make([]edit, 0, len(positions))
+	for _, pos := range positions {
+		offset := fset.Position(pos).Offset
+		edits = append(edits, edit{start: offset, end: offset + len(name), text: newName})
+	}
+	return applyEdits(src, edits)
+}
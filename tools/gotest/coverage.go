@@ -0,0 +1,301 @@
+package gotest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+const (
+	CoverageToolName = "go_coverage"
+)
+
+// ProfileBlock is a line of a Go coverage profile.
+type ProfileBlock struct {
+	File      string // import path of the file, e.g. example.com/m/pkg/x.go
+	StartLine int
+	EndLine   int
+	NumStmt   int
+	Count     int
+}
+
+// ParseProfile reads a coverage profile written by `go test -coverprofile`.
+// Blocks of the same range reported by several test binaries are merged.
+func ParseProfile(r io.Reader) ([]ProfileBlock, error) {
+	type key struct {
+		file string
+		pos  string
+	}
+	merged := map[key]int{}
+	var blocks []ProfileBlock
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// file.go:startLine.startCol,endLine.endCol numStmt count
+		colon := strings.LastIndex(line, ":")
+		fields := strings.Fields(line[colon+1:])
+		if colon < 0 || len(fields) != 3 {
+			return nil, fmt.Errorf("gotest: malformed profile line %q", line)
+		}
+		start, end, ok := strings.Cut(fields[0], ",")
+		if !ok {
+			return nil, fmt.Errorf("gotest: malformed profile line %q", line)
+		}
+		b := ProfileBlock{File: line[:colon]}
+		var err error
+		if b.StartLine, err = profileLine(start); err == nil {
+			if b.EndLine, err = profileLine(end); err == nil {
+				if b.NumStmt, err = strconv.Atoi(fields[1]); err == nil {
+					b.Count, err = strconv.Atoi(fields[2])
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gotest: malformed profile line %q: %w", line, err)
+		}
+		k := key{b.File, fields[0]}
+		if i, ok := merged[k]; ok {
+			blocks[i].Count += b.Count
+			continue
+		}
+		merged[k] = len(blocks)
+		blocks = append(blocks, b)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("gotest: read profile: %w", err)
+	}
+	return blocks, nil
+}
+
+func profileLine(pos string) (int, error) {
+	line, _, _ := strings.Cut(pos, ".")
+	return strconv.Atoi(line)
+}
+
+// FileCoverage is the coverage of a single file.
+type FileCoverage struct {
+	Path           string   `json:"path"`
+	Percent        float64  `json:"percent"`
+	UncoveredLines []string `json:"uncovered_lines,omitempty"` // line ranges such as "12-14" or "20"
+}
+
+// CoverageReport is returned to the model as JSON.
+type CoverageReport struct {
+	TotalPercent float64        `json:"total_percent"` // over all tested packages
+	Files        []FileCoverage `json:"files"`
+}
+
+// BuildCoverageReport computes the coverage of the given blocks. resolve maps the import path of a
+// profile file to the path reported to the model; files it rejects are only counted in the total.
+func BuildCoverageReport(blocks []ProfileBlock, resolve func(importPath string) (string, bool)) CoverageReport {
+	type acc struct {
+		total, covered int
+		uncovered      map[int]bool
+	}
+	var total, covered int
+	files := map[string]*acc{}
+	for _, b := range blocks {
+		total += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+		p, ok := resolve(b.File)
+		if !ok {
+			continue
+		}
+		a := files[p]
+		if a == nil {
+			a = &acc{uncovered: map[int]bool{}}
+			files[p] = a
+		}
+		a.total += b.NumStmt
+		if b.Count > 0 {
+			a.covered += b.NumStmt
+			continue
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			a.uncovered[l] = true
+		}
+	}
+
+	report := CoverageReport{TotalPercent: percent(covered, total), Files: []FileCoverage{}}
+	for p, a := range files {
+		report.Files = append(report.Files, FileCoverage{
+			Path:           p,
+			Percent:        percent(a.covered, a.total),
+			UncoveredLines: lineRanges(a.uncovered),
+		})
+	}
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	return report
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return math.Round(float64(covered)*1000/float64(total)) / 10
+}
+
+func lineRanges(lines map[int]bool) []string {
+	sorted := make([]int, 0, len(lines))
+	for l := range lines {
+		sorted = append(sorted, l)
+	}
+	sort.Ints(sorted)
+	var out []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if i == j {
+			out = append(out, strconv.Itoa(sorted[i]))
+		} else {
+			out = append(out, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return out
+}
+
+// CoverageTool runs the tests with a coverage profile and reports the uncovered lines of the files in
+// Code, so the agent can target missing tests. When Code is nil, all files of the profile are reported.
+type CoverageTool struct {
+	Dir  string
+	Code *cont.CodeContainer
+	// Env is added to the environment of `go test`.
+	Env map[string]string
+}
+
+type CoverageRequest struct {
+	Packages []string `json:"packages,omitempty"`
+}
+
+func (t *CoverageTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: CoverageToolName,
+		Desc: "Run Go tests with coverage and get a JSON report: total statement coverage in percent, and per file the coverage and the uncovered line ranges. Failed tests are summarized before the report.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"packages": {
+				Type:     schema.Array,
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+				Desc:     "Package patterns to test, relative to the module, e.g. [\"./pkg/...\"]. Defaults to [\"./...\"].",
+			},
+		}),
+	}, nil
+}
+
+func (t *CoverageTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req CoverageRequest
+	if err := parseArgs(argumentsInJSON, &req); err != nil {
+		return fmt.Sprintf("%s: %v", CoverageToolName, err), nil
+	}
+	packages, err := testArgs(req.Packages, "", "")
+	if err != nil {
+		return fmt.Sprintf("%s: %v", CoverageToolName, err), nil
+	}
+
+	profile, err := os.CreateTemp("", "axe-cover-*.out")
+	if err != nil {
+		return fmt.Sprintf("%s: create profile: %v", CoverageToolName, err), nil
+	}
+	_ = profile.Close()
+	defer os.Remove(profile.Name())
+
+	argv := append([]string{"go", "test", "-json", "-coverprofile=" + profile.Name()}, packages...)
+	outcome := runGo(ctx, t.Dir, t.Env, argv)
+	sum, err := ParseTestJSON(strings.NewReader(outcome.Stdout))
+	if err != nil {
+		return fmt.Sprintf("%s: %v", CoverageToolName, err), nil
+	}
+
+	f, err := os.Open(profile.Name())
+	if err != nil {
+		return fmt.Sprintf("%s: read profile: %v", CoverageToolName, err), nil
+	}
+	defer f.Close()
+	blocks, err := ParseProfile(f)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", CoverageToolName, err), nil
+	}
+	if len(blocks) == 0 && outcome.ExitCode != 0 {
+		return outcome.Clipped(clitool.DefaultOutputLimit).String(), nil
+	}
+
+	resolve, err := t.resolver(ctx, packages)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", CoverageToolName, err), nil
+	}
+	data, err := json.MarshalIndent(BuildCoverageReport(blocks, resolve), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%s: %v", CoverageToolName, err), nil
+	}
+
+	var b strings.Builder
+	if !sum.OK() {
+		b.WriteString(sum.String())
+	}
+	b.WriteString("<Coverage><![CDATA[\n")
+	b.Write(data)
+	b.WriteString("\n]]></Coverage>\n")
+	return b.String(), nil
+}
+
+// resolver maps profile import paths to the paths used by the container (or absolute paths when
+// Code is nil), using `go list` to find the package directories.
+func (t *CoverageTool) resolver(ctx context.Context, packages []string) (func(string) (string, bool), error) {
+	argv := append([]string{"go", "list", "-f", "{{.ImportPath}}\t{{.Dir}}"}, packages...)
+	outcome := runGo(ctx, t.Dir, t.Env, argv)
+	if outcome.ExitCode != 0 {
+		return nil, fmt.Errorf("go list failed: %s", strings.TrimSpace(outcome.Stderr))
+	}
+	dirs := map[string]string{}
+	for _, line := range strings.Split(outcome.Stdout, "\n") {
+		if importPath, dir, ok := strings.Cut(line, "\t"); ok {
+			dirs[importPath] = dir
+		}
+	}
+
+	var known map[string]string // absolute path -> container path
+	if t.Code != nil {
+		known = map[string]string{}
+		for p := range t.Code.Files() {
+			abs, err := filepath.Abs(t.Code.DiskPath(p))
+			if err != nil {
+				continue
+			}
+			known[abs] = p
+		}
+	}
+	return func(importPath string) (string, bool) {
+		dir, ok := dirs[path.Dir(importPath)]
+		if !ok {
+			return "", false
+		}
+		abs := filepath.Join(dir, path.Base(importPath))
+		if known == nil {
+			return abs, true
+		}
+		p, ok := known[abs]
+		return p, ok
+	}, nil
+}
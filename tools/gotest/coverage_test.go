@@ -0,0 +1,77 @@
+package gotest
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestParseProfile_AndReport(t *testing.T) {
+	profile := `mode: set
+example.com/m/a.go:3.20,5.2 2 1
+example.com/m/a.go:7.20,9.2 1 0
+example.com/m/a.go:10.20,10.30 1 0
+example.com/m/b.go:3.20,5.2 4 0
+example.com/m/a.go:7.20,9.2 1 0
+`
+	blocks, err := ParseProfile(strings.NewReader(profile))
+	require.NoError(t, err)
+	require.Len(t, blocks, 4)
+
+	report := BuildCoverageReport(blocks, func(importPath string) (string, bool) {
+		return strings.TrimPrefix(importPath, "example.com/m/"), importPath != "example.com/m/b.go"
+	})
+	assert.Equal(t, 25.0, report.TotalPercent)
+	require.Len(t, report.Files, 1)
+	assert.Equal(t, FileCoverage{Path: "a.go", Percent: 50, UncoveredLines: []string{"7-10"}}, report.Files[0])
+
+	_, err = ParseProfile(strings.NewReader("example.com/m/a.go:3.20 2"))
+	assert.Error(t, err)
+}
+
+func TestCoverageTool(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not installed")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.21\n",
+		"m.go": `package m
+
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+`,
+		"m_test.go": `package m
+
+import "testing"
+
+func TestAbs(t *testing.T) {
+	if Abs(2) != 2 {
+		t.Fatal("abs")
+	}
+}
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	code := cont.MustNewCodeContainerFromFS(dir, []string{"m.go"})
+
+	out, err := (&CoverageTool{Dir: dir, Code: code}).InvokableRun(context.Background(), `{}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, `"total_percent": 66.7`)
+	assert.Contains(t, out, `"path": "m.go"`) // relative to the container base dir
+	assert.Contains(t, out, `"4-6"`)
+}
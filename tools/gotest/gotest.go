@@ -0,0 +1,318 @@
+package gotest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/stumble/axe/tools"
+	clitool "github.com/stumble/axe/tools/cli"
+)
+
+const (
+	RunGoTestsToolName = "run_go_tests"
+)
+
+const (
+	// maxFailureLines bounds the output kept per failed test; the tail is kept since
+	// that is where assertion messages and panics end up.
+	maxFailureLines = 30
+	// maxFailures bounds the number of failed tests reported in detail.
+	maxFailures = 20
+)
+
+// TestEvent is a line of `go test -json` output, see `go doc test2json`.
+type TestEvent struct {
+	Time       time.Time `json:"Time"`
+	Action     string    `json:"Action"`
+	Package    string    `json:"Package"`
+	ImportPath string    `json:"ImportPath"` // set on build-output and build-fail events
+	Test       string    `json:"Test"`
+	Elapsed    float64   `json:"Elapsed"`
+	Output     string    `json:"Output"`
+}
+
+// TestResult is the final result of a single test, or of a package when Test is empty.
+type TestResult struct {
+	Package string
+	Test    string
+	Action  string // pass, fail or skip
+	Elapsed time.Duration
+	Panic   bool
+	Output  []string
+}
+
+// Summary aggregates the results of a `go test -json` run.
+type Summary struct {
+	Passed   int
+	Failed   int
+	Skipped  int
+	Elapsed  time.Duration
+	Failures []TestResult // failed tests, and failed packages without failed tests (e.g. build errors)
+	// BuildOutput holds compiler output and any other non-JSON lines.
+	BuildOutput []string
+}
+
+// ParseTestJSON reads `go test -json` output. Lines that are not test events are kept as build output.
+func ParseTestJSON(r io.Reader) (*Summary, error) {
+	results := map[string]*TestResult{}
+	var order []string
+	get := func(pkg, test string) *TestResult {
+		key := pkg + "\x00" + test
+		res, ok := results[key]
+		if !ok {
+			res = &TestResult{Package: pkg, Test: test}
+			results[key] = res
+			order = append(order, key)
+		}
+		return res
+	}
+
+	sum := &Summary{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		var ev TestEvent
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &ev) != nil {
+			if strings.TrimSpace(line) != "" {
+				sum.BuildOutput = append(sum.BuildOutput, line)
+			}
+			continue
+		}
+		switch ev.Action {
+		case "build-output":
+			sum.BuildOutput = append(sum.BuildOutput, strings.TrimRight(ev.Output, "\n"))
+			continue
+		case "build-fail":
+			continue
+		}
+		res := get(ev.Package, ev.Test)
+		switch ev.Action {
+		case "output":
+			out := strings.TrimRight(ev.Output, "\n")
+			if strings.HasPrefix(out, "panic: ") {
+				res.Panic = true
+			}
+			if !isNoise(out) {
+				res.Output = append(res.Output, out)
+			}
+		case "pass", "fail", "skip":
+			res.Action = ev.Action
+			res.Elapsed = time.Duration(ev.Elapsed * float64(time.Second))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("gotest: read test output: %w", err)
+	}
+
+	failedTests := map[string]bool{}
+	for _, key := range order {
+		res := results[key]
+		if res.Test == "" {
+			continue
+		}
+		switch res.Action {
+		case "pass":
+			sum.Passed++
+		case "skip":
+			sum.Skipped++
+		case "fail":
+			sum.Failed++
+			failedTests[res.Package] = true
+			sum.Failures = append(sum.Failures, *res)
+		default:
+			// a test without a final action was interrupted, usually by a panic or timeout
+			// of its package; the package result carries the details
+		}
+	}
+	for _, key := range order {
+		res := results[key]
+		if res.Test != "" {
+			continue
+		}
+		sum.Elapsed += res.Elapsed
+		if res.Action == "fail" && !failedTests[res.Package] {
+			sum.Failures = append(sum.Failures, *res)
+		}
+	}
+	return sum, nil
+}
+
+// isNoise reports framework lines that carry no information beyond the test result.
+func isNoise(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "--- PASS", "--- SKIP", "PASS", "ok  \t"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return trimmed == ""
+}
+
+// OK reports whether nothing failed.
+func (s *Summary) OK() bool {
+	return len(s.Failures) == 0 && s.Failed == 0
+}
+
+// String renders a compact report: counts, then failed tests with the tail of their output.
+func (s *Summary) String() string {
+	var b strings.Builder
+	status := "ok"
+	if !s.OK() {
+		status = "FAIL"
+	}
+	fmt.Fprintf(&b, "go test: %s (%d passed, %d failed, %d skipped) in %s\n",
+		status, s.Passed, s.Failed, s.Skipped, s.Elapsed.Round(time.Millisecond))
+	if !s.OK() && len(s.BuildOutput) > 0 {
+		b.WriteString("Build output:\n")
+		for _, line := range tail(s.BuildOutput, maxFailureLines) {
+			b.WriteString(line + "\n")
+		}
+	}
+	for i, f := range s.Failures {
+		if i == maxFailures {
+			fmt.Fprintf(&b, "... %d more failures omitted\n", len(s.Failures)-maxFailures)
+			break
+		}
+		name := f.Package
+		if f.Test != "" {
+			name += " " + f.Test
+		}
+		kind := "FAIL"
+		if f.Panic {
+			kind = "PANIC"
+		}
+		fmt.Fprintf(&b, "--- %s: %s (%s)\n", kind, name, f.Elapsed.Round(time.Millisecond))
+		for _, line := range tail(f.Output, maxFailureLines) {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func tail(lines []string, n int) []string {
+	if len(lines) <= n {
+		return lines
+	}
+	out := []string{fmt.Sprintf("... %d lines omitted", len(lines)-n)}
+	return append(out, lines[len(lines)-n:]...)
+}
+
+// RunGoTestsTool runs `go test -json` in Dir and returns a compact summary of the failures.
+type RunGoTestsTool struct {
+	Dir string
+	// Env is added to the environment of `go test`, e.g. build tags via GOFLAGS.
+	Env map[string]string
+}
+
+type RunGoTestsRequest struct {
+	Packages []string `json:"packages,omitempty"`
+	Run      string   `json:"run,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
+}
+
+func (t *RunGoTestsTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: RunGoTestsToolName,
+		Desc: "Run Go tests and get a summary: pass/fail counts and, for each failed test, the end of its output. Passing tests are not listed.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"packages": {
+				Type:     schema.Array,
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+				Desc:     "Package patterns to test, relative to the module, e.g. [\"./pkg/...\"]. Defaults to [\"./...\"].",
+			},
+			"run": {Type: schema.String, Desc: "Only run tests matching this regular expression (go test -run)."},
+			"timeout": {
+				Type: schema.String,
+				Desc: "Test binary timeout as a Go duration, e.g. \"2m\" (go test -timeout).",
+			},
+		}),
+	}, nil
+}
+
+func (t *RunGoTestsTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req RunGoTestsRequest
+	if err := parseArgs(argumentsInJSON, &req); err != nil {
+		return fmt.Sprintf("%s: %v", RunGoTestsToolName, err), nil
+	}
+	args, err := testArgs(req.Packages, req.Run, req.Timeout)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", RunGoTestsToolName, err), nil
+	}
+	argv := append([]string{"go", "test", "-json"}, args...)
+
+	outcome := runGo(ctx, t.Dir, t.Env, argv)
+	sum, err := ParseTestJSON(strings.NewReader(outcome.Stdout))
+	if err != nil {
+		return fmt.Sprintf("%s: %v", RunGoTestsToolName, err), nil
+	}
+	if stderr := strings.TrimSpace(outcome.Stderr); stderr != "" {
+		// older toolchains print build errors to stderr instead of build-output events
+		sum.BuildOutput = append(sum.BuildOutput, strings.Split(stderr, "\n")...)
+	}
+	if outcome.ExitCode != 0 && sum.OK() {
+		// go test failed before running anything, e.g. a bad package pattern
+		return outcome.Clipped(clitool.DefaultOutputLimit).String(), nil
+	}
+	return sum.String(), nil
+}
+
+var packagePattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// testArgs validates the request and returns the go test flags and packages.
+func testArgs(packages []string, run, timeout string) ([]string, error) {
+	var args []string
+	if run != "" {
+		if _, err := regexp.Compile(run); err != nil {
+			return nil, fmt.Errorf("invalid run pattern: %w", err)
+		}
+		args = append(args, "-run", run)
+	}
+	if timeout != "" {
+		if _, err := time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		args = append(args, "-timeout", timeout)
+	}
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	for _, pkg := range packages {
+		if strings.HasPrefix(pkg, "-") || !packagePattern.MatchString(pkg) {
+			return nil, fmt.Errorf("invalid package pattern %q", pkg)
+		}
+		// the packages must be those of the workdir, not of its parents
+		clean := path.Clean(pkg)
+		if path.IsAbs(clean) || slices.Contains(strings.Split(clean, "/"), "..") {
+			return nil, fmt.Errorf("invalid package pattern %q: it must not leave the workdir", pkg)
+		}
+	}
+	return append(args, packages...), nil
+}
+
+func runGo(ctx context.Context, dir string, env map[string]string, argv []string) clitool.Outcome {
+	tools.Logger(ctx).Debug().Strs("argv", argv).Str("dir", dir).Msg("gotest: running")
+	exec := &clitool.SubprocessExecutor{OutputLimit: -1}
+	return exec.Execute(ctx, argv, env, dir)
+}
+
+func parseArgs(argumentsInJSON string, v any) error {
+	if strings.TrimSpace(argumentsInJSON) == "" {
+		argumentsInJSON = "{}"
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package gotest
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestJSON(t *testing.T) {
+	f, err := os.Open("testdata/fail.jsonl")
+	require.NoError(t, err)
+	defer f.Close()
+
+	sum, err := ParseTestJSON(f)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sum.Passed)
+	assert.Equal(t, 2, sum.Failed)
+	assert.Equal(t, 1, sum.Skipped)
+	assert.Equal(t, 700*time.Millisecond, sum.Elapsed)
+	assert.False(t, sum.OK())
+
+	require.Len(t, sum.Failures, 3)
+	assert.Equal(t, "TestBad", sum.Failures[0].Test)
+	assert.Equal(t, []string{"    m_test.go:12: got 1, want 2", "--- FAIL: TestBad (0.01s)"}, sum.Failures[0].Output)
+	assert.Equal(t, "TestPanic", sum.Failures[1].Test)
+	assert.True(t, sum.Failures[1].Panic)
+	// the build failure is reported on the package
+	assert.Equal(t, "example.com/m/q", sum.Failures[2].Package)
+	assert.Empty(t, sum.Failures[2].Test)
+	assert.Contains(t, sum.BuildOutput, "q/q.go:3:1: syntax error: non-declaration statement outside function body")
+
+	out := sum.String()
+	assert.Contains(t, out, "go test: FAIL (1 passed, 2 failed, 1 skipped)")
+	assert.Contains(t, out, "--- FAIL: example.com/m TestBad")
+	assert.Contains(t, out, "--- PANIC: example.com/m/p TestPanic")
+	assert.NotContains(t, out, "TestOK")
+}
+
+func TestTestArgs_Validation(t *testing.T) {
+	args, err := testArgs(nil, "TestFoo/bar", "1m")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-run", "TestFoo/bar", "-timeout", "1m", "./..."}, args)
+
+	_, err = testArgs([]string{"-exec=rm"}, "", "")
+	assert.ErrorContains(t, err, "invalid package pattern")
+	for _, pkg := range []string{"../..", "./../other/...", "a/../../b", "/etc/..."} {
+		_, err = testArgs([]string{pkg}, "", "")
+		assert.ErrorContains(t, err, "must not leave the workdir", pkg)
+	}
+	args, err = testArgs([]string{"./a/../b/...", "example.com/m/..."}, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./a/../b/...", "example.com/m/..."}, args)
+	_, err = testArgs(nil, "(", "")
+	assert.ErrorContains(t, err, "invalid run pattern")
+	_, err = testArgs(nil, "", "soon")
+	assert.ErrorContains(t, err, "invalid timeout")
+}
+
+func TestRunGoTestsTool(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not installed")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.21\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "m_test.go"), []byte(`package m
+
+import "testing"
+
+func TestOK(t *testing.T) {}
+
+func TestBad(t *testing.T) { t.Fatal("boom") }
+`), 0o644))
+
+	out, err := (&RunGoTestsTool{Dir: dir}).InvokableRun(context.Background(), `{}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "1 passed, 1 failed")
+	assert.Contains(t, out, "boom")
+}
@@ -0,0 +1,431 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/stumble/axe/tools"
+)
+
+// ErrClosed is returned by requests on a closed client.
+var ErrClosed = errors.New("lsp: client closed")
+
+// Client is a minimal JSON-RPC client for a language server speaking LSP over stdio.
+// Files are synced from disk before every query, so edits made by other tools are visible.
+type Client struct {
+	rootDir string
+	conn    io.WriteCloser
+	cmd     *exec.Cmd
+	log     *zerolog.Logger
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   int64
+	pending  map[int64]chan *message
+	versions map[string]int // uri -> version of opened documents
+	diags    map[string]fileDiagnostics
+	diagsCh  chan struct{} // closed and replaced whenever diagnostics arrive
+	closed   bool
+	readErr  error
+	done     chan struct{} // closed when the read loop exits
+}
+
+type fileDiagnostics struct {
+	seq         int
+	diagnostics []Diagnostic
+}
+
+// Start launches the language server command (e.g. "gopls") in rootDir and initializes it. The
+// client logs with the logger of ctx, see tools.Logger.
+func Start(ctx context.Context, rootDir string, command ...string) (*Client, error) {
+	if len(command) == 0 {
+		return nil, errors.New("lsp: command is required")
+	}
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("lsp: resolve root dir: %w", err)
+	}
+	// #nosec G204 - the command is configured by the embedder, not the model.
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("lsp: stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("lsp: stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("lsp: start %s: %w", command[0], err)
+	}
+	c := newClient(rootDir, stdin, stdout, tools.Logger(ctx))
+	c.cmd = cmd
+	if err := c.initialize(ctx); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(rootDir string, w io.WriteCloser, r io.Reader, logger *zerolog.Logger) *Client {
+	c := &Client{
+		rootDir:  rootDir,
+		conn:     w,
+		log:      logger,
+		pending:  map[int64]chan *message{},
+		versions: map[string]int{},
+		diags:    map[string]fileDiagnostics{},
+		diagsCh:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(r))
+	return c
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   pathToURI(c.rootDir),
+		"workspaceFolders": []map[string]string{
+			{"uri": pathToURI(c.rootDir), "name": filepath.Base(c.rootDir)},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"publishDiagnostics": map[string]any{"versionSupport": true},
+			},
+		},
+	}
+	if err := c.call(ctx, "initialize", params, nil); err != nil {
+		return fmt.Errorf("lsp: initialize: %w", err)
+	}
+	return c.notify("initialized", struct{}{})
+}
+
+// Close shuts the server down and waits for it to exit.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.call(ctx, "shutdown", nil, nil); err != nil {
+		c.log.Debug().Err(err).Msg("lsp: shutdown")
+	}
+	_ = c.notify("exit", nil)
+
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	err := c.conn.Close()
+	if c.cmd != nil {
+		waitDone := make(chan error, 1)
+		go func() { waitDone <- c.cmd.Wait() }()
+		select {
+		case <-waitDone:
+		case <-time.After(5 * time.Second):
+			_ = c.cmd.Process.Kill()
+			<-waitDone
+		}
+	}
+	return err
+}
+
+// Definition returns the locations defining the symbol at pos in path.
+func (c *Client) Definition(ctx context.Context, path string, pos Position) ([]Location, error) {
+	uri, err := c.sync(path)
+	if err != nil {
+		return nil, err
+	}
+	params := textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: pos}
+	var raw json.RawMessage
+	if err := c.call(ctx, "textDocument/definition", params, &raw); err != nil {
+		return nil, err
+	}
+	return decodeLocations(raw)
+}
+
+// decodeLocations accepts the Location | Location[] | LocationLink[] results of definition requests.
+func decodeLocations(raw json.RawMessage) ([]Location, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var single Location
+	if raw[0] == '{' {
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return nil, fmt.Errorf("lsp: decode locations: %w", err)
+		}
+		return []Location{single}, nil
+	}
+	var items []struct {
+		Location
+		TargetURI   string `json:"targetUri"`
+		TargetRange Range  `json:"targetSelectionRange"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("lsp: decode locations: %w", err)
+	}
+	locs := make([]Location, 0, len(items))
+	for _, item := range items {
+		if item.TargetURI != "" {
+			locs = append(locs, Location{URI: item.TargetURI, Range: item.TargetRange})
+			continue
+		}
+		locs = append(locs, item.Location)
+	}
+	return locs, nil
+}
+
+// References returns the locations referencing the symbol at pos in path.
+func (c *Client) References(ctx context.Context, path string, pos Position, includeDeclaration bool) ([]Location, error) {
+	uri, err := c.sync(path)
+	if err != nil {
+		return nil, err
+	}
+	params := referenceParams{textDocumentPositionParams: textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: uri}, Position: pos,
+	}}
+	params.Context.IncludeDeclaration = includeDeclaration
+	var locs []Location
+	if err := c.call(ctx, "textDocument/references", params, &locs); err != nil {
+		return nil, err
+	}
+	return locs, nil
+}
+
+// Diagnostics syncs path and waits up to wait for the server to publish its diagnostics.
+// Diagnostics are pushed by the server, so the last known ones are returned on timeout.
+func (c *Client) Diagnostics(ctx context.Context, path string, wait time.Duration) ([]Diagnostic, error) {
+	c.mu.Lock()
+	seq := c.diags[pathToURI(c.abs(path))].seq
+	c.mu.Unlock()
+	uri, err := c.sync(path)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		c.mu.Lock()
+		fd, ch := c.diags[uri], c.diagsCh
+		c.mu.Unlock()
+		if fd.seq > seq {
+			return fd.diagnostics, nil
+		}
+		select {
+		case <-ch:
+		case <-timer.C:
+			return fd.diagnostics, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.done:
+			return nil, c.err()
+		}
+	}
+}
+
+func (c *Client) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.rootDir, path)
+}
+
+// sync sends the current disk content of path to the server and returns its URI.
+func (c *Client) sync(path string) (string, error) {
+	abs := c.abs(path)
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", fmt.Errorf("lsp: read %s: %w", path, err)
+	}
+	uri := pathToURI(abs)
+
+	c.mu.Lock()
+	version, opened := c.versions[uri]
+	version++
+	c.versions[uri] = version
+	c.mu.Unlock()
+
+	if !opened {
+		return uri, c.notify("textDocument/didOpen", map[string]any{
+			"textDocument": textDocumentItem{URI: uri, LanguageID: "go", Version: version, Text: string(data)},
+		})
+	}
+	return uri, c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   versionedTextDocumentIdentifier{URI: uri, Version: version},
+		"contentChanges": []map[string]string{{"text": string(data)}},
+	})
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	if c.closed || c.readErr != nil {
+		c.mu.Unlock()
+		return c.err()
+	}
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.write(&message{ID: &rawID, Method: method, Params: mustMarshal(params)}); err != nil {
+		return err
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 && string(resp.Result) != "null" {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("lsp: decode %s result: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		_ = c.notify("$/cancelRequest", map[string]any{"id": id})
+		return ctx.Err()
+	case <-c.done:
+		return c.err()
+	}
+}
+
+func (c *Client) notify(method string, params any) error {
+	return c.write(&message{Method: method, Params: mustMarshal(params)})
+}
+
+func (c *Client) write(msg *message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("lsp: encode %s: %w", msg.Method, err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("lsp: write %s: %w", msg.Method, err)
+	}
+	return nil
+}
+
+func (c *Client) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readErr != nil && !c.closed {
+		return fmt.Errorf("lsp: connection lost: %w", c.readErr)
+	}
+	return ErrClosed
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	defer close(c.done)
+	tp := textproto.NewReader(r)
+	for {
+		header, err := tp.ReadMIMEHeader()
+		if err == nil && header.Get("Content-Length") == "" {
+			err = errors.New("missing Content-Length header")
+		}
+		var n int
+		if err == nil {
+			n, err = strconv.Atoi(header.Get("Content-Length"))
+		}
+		body := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(r, body)
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.readErr = err
+			c.mu.Unlock()
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.log.Debug().Err(err).Msg("lsp: decode message")
+			continue
+		}
+		c.dispatch(&msg)
+	}
+}
+
+func (c *Client) dispatch(msg *message) {
+	switch {
+	case msg.ID != nil && msg.Method == "":
+		id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		ch := c.pending[id]
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+	case msg.ID != nil:
+		// requests from the server, e.g. workspace/configuration: answer with empty results
+		var result any
+		if msg.Method == "workspace/configuration" {
+			var params struct {
+				Items []json.RawMessage `json:"items"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			result = make([]any, len(params.Items))
+		}
+		raw := mustMarshal(result)
+		if raw == nil {
+			raw = json.RawMessage("null")
+		}
+		resp := &message{ID: msg.ID, Result: raw}
+		if err := c.write(resp); err != nil {
+			c.log.Debug().Err(err).Str("method", msg.Method).Msg("lsp: reply to server request")
+		}
+	case msg.Method == "textDocument/publishDiagnostics":
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return
+		}
+		c.mu.Lock()
+		fd := c.diags[params.URI]
+		c.diags[params.URI] = fileDiagnostics{seq: fd.seq + 1, diagnostics: params.Diagnostics}
+		close(c.diagsCh)
+		c.diagsCh = make(chan struct{})
+		c.mu.Unlock()
+	}
+}
+
+func mustMarshal(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("lsp: marshal %T: %v", v, err))
+	}
+	return data
+}
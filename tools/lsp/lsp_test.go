@@ -0,0 +1,179 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe/tools"
+)
+
+// fakeServer answers the LSP requests used by the client with canned results.
+type fakeServer struct {
+	t       *testing.T
+	r       *bufio.Reader
+	w       io.WriteCloser
+	defLoc  Location
+	refLocs []Location
+	diags   []Diagnostic
+	configs chan json.RawMessage // replies to workspace/configuration requests
+}
+
+func startFake(t *testing.T, dir string) (*Client, *fakeServer) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	srv := &fakeServer{t: t, r: bufio.NewReader(serverR), w: serverW, configs: make(chan json.RawMessage, 1)}
+	c := newClient(dir, clientW, clientR, tools.Logger(context.Background()))
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = serverW.Close()
+	})
+	return c, srv
+}
+
+func (s *fakeServer) send(msg message) {
+	msg.JSONRPC = "2.0"
+	body, _ := json.Marshal(msg)
+	_, _ = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *fakeServer) serve() {
+	tp := textproto.NewReader(s.r)
+	for {
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, n)
+		if _, err := io.ReadFull(s.r, body); err != nil {
+			return
+		}
+		var msg message
+		require.NoError(s.t, json.Unmarshal(body, &msg))
+		switch msg.Method {
+		case "initialize":
+			s.send(message{ID: msg.ID, Result: mustMarshal(map[string]any{"capabilities": map[string]any{}})})
+			// exercise server-to-client requests
+			id := json.RawMessage(`"cfg"`)
+			s.send(message{ID: &id, Method: "workspace/configuration", Params: mustMarshal(map[string]any{"items": []any{map[string]any{}, map[string]any{}}})})
+		case "textDocument/definition":
+			s.send(message{ID: msg.ID, Result: mustMarshal(s.defLoc)})
+		case "textDocument/references":
+			s.send(message{ID: msg.ID, Result: mustMarshal(s.refLocs)})
+		case "textDocument/didOpen", "textDocument/didChange":
+			var params struct {
+				TextDocument struct {
+					URI string `json:"uri"`
+				} `json:"textDocument"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			s.send(message{Method: "textDocument/publishDiagnostics", Params: mustMarshal(publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: s.diags})})
+		case "shutdown":
+			s.send(message{ID: msg.ID, Result: json.RawMessage("null")})
+		case "":
+			if msg.ID != nil && string(*msg.ID) == `"cfg"` {
+				s.configs <- msg.Result
+			}
+		}
+	}
+}
+
+func writeGoFile(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	src := "package m\n\nfunc Add(a, b int) int { return a + b }\n\nvar x = Add(1, 2) + Add(3, 4)\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "m.go"), []byte(src), 0o644))
+	return dir, filepath.Join(dir, "m.go")
+}
+
+func TestClient_WithFakeServer(t *testing.T) {
+	dir, file := writeGoFile(t)
+	c, srv := startFake(t, dir)
+	uri := pathToURI(file)
+	srv.defLoc = Location{URI: uri, Range: Range{Start: Position{Line: 2, Character: 5}}}
+	srv.refLocs = []Location{
+		{URI: uri, Range: Range{Start: Position{Line: 4, Character: 8}}},
+		{URI: uri, Range: Range{Start: Position{Line: 4, Character: 20}}},
+	}
+	srv.diags = []Diagnostic{{Range: Range{Start: Position{Line: 4, Character: 4}}, Severity: SeverityError, Source: "compiler", Message: "boom"}}
+	go srv.serve()
+
+	ctx := context.Background()
+	require.NoError(t, c.initialize(ctx))
+	select {
+	case cfg := <-srv.configs:
+		assert.JSONEq(t, `[null, null]`, string(cfg))
+	case <-time.After(time.Second):
+		t.Fatal("no reply to workspace/configuration")
+	}
+
+	s := &Server{Dir: dir, client: c, DiagnosticsWait: time.Second}
+
+	out, err := (&DefinitionTool{Server: s}).InvokableRun(ctx, `{"file":"m.go","line":5,"symbol":"Add"}`)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "m.go")+":3:6: func Add(a, b int) int { return a + b }\n", out)
+
+	out, err = (&ReferencesTool{Server: s}).InvokableRun(ctx, `{"file":"m.go","line":3,"symbol":"Add"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "m.go:5:9: var x")
+	assert.Contains(t, out, "m.go:5:21: var x")
+
+	out, err = (&DiagnosticsTool{Server: s}).InvokableRun(ctx, `{"file":"m.go"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "m.go:5:5: error: boom (compiler)\n", out)
+
+	out, err = (&DefinitionTool{Server: s}).InvokableRun(ctx, `{"file":"m.go","line":5,"symbol":"Sub"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, `symbol "Sub" not found on line 5`)
+}
+
+func TestSymbolColumn(t *testing.T) {
+	col, ok := symbolColumn("var addX = add(1)", "add")
+	require.True(t, ok)
+	assert.Equal(t, 11, col)
+
+	// UTF-16 columns count the surrogate pair of the emoji twice
+	col, ok = symbolColumn(`s := "😀"; f(s)`, "f")
+	require.True(t, ok)
+	assert.Equal(t, 11, col)
+	assert.Equal(t, 11, runeColumn(`s := "😀"; f(s)`, 11))
+
+	_, ok = symbolColumn("addX", "add")
+	assert.False(t, ok)
+}
+
+func TestDecodeLocations(t *testing.T) {
+	locs, err := decodeLocations(json.RawMessage(`[{"targetUri":"file:///a.go","targetSelectionRange":{"start":{"line":1,"character":2},"end":{"line":1,"character":3}}}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []Location{{URI: "file:///a.go", Range: Range{Start: Position{1, 2}, End: Position{1, 3}}}}, locs)
+
+	locs, err = decodeLocations(json.RawMessage(`null`))
+	require.NoError(t, err)
+	assert.Empty(t, locs)
+}
+
+func TestServer_Gopls(t *testing.T) {
+	if _, err := exec.LookPath("gopls"); err != nil {
+		t.Skip("gopls not installed")
+	}
+	dir, _ := writeGoFile(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.21\n"), 0o644))
+	s := NewGoplsServer(dir)
+	defer s.Close()
+
+	out, err := (&DefinitionTool{Server: s}).InvokableRun(context.Background(), `{"file":"m.go","line":5,"symbol":"Add"}`)
+	require.NoError(t, err)
+	assert.Contains(t, out, "m.go:3:6")
+}
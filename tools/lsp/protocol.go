@@ -0,0 +1,194 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The subset of the Language Server Protocol used by the tools.
+// See https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+// Position is zero-based; Character counts UTF-16 code units.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type DiagnosticSeverity int
+
+const (
+	SeverityError       DiagnosticSeverity = 1
+	SeverityWarning     DiagnosticSeverity = 2
+	SeverityInformation DiagnosticSeverity = 3
+	SeverityHint        DiagnosticSeverity = 4
+)
+
+func (s DiagnosticSeverity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	default:
+		return "unknown"
+	}
+}
+
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity,omitempty"`
+	Source   string             `json:"source,omitempty"`
+	Message  string             `json:"message"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type versionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type referenceParams struct {
+	textDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// message is a JSON-RPC 2.0 request, response or notification.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("lsp: error %d: %s", e.Code, e.Message)
+}
+
+// pathToURI converts an absolute file path to a file:// URI.
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriToPath converts a file:// URI back to a file path.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// utf16Column converts a byte offset within line to a UTF-16 column.
+func utf16Column(line string, byteOffset int) int {
+	return len(utf16.Encode([]rune(line[:byteOffset])))
+}
+
+// runeColumn converts a UTF-16 column within line to a 1-based rune column for display.
+func runeColumn(line string, utf16Col int) int {
+	units := 0
+	col := 1
+	for _, r := range line {
+		if units >= utf16Col {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		col++
+	}
+	return col
+}
+
+// lineAt returns the zero-based line of text, without the line break.
+func lineAt(text string, line int) (string, bool) {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		return "", false
+	}
+	return strings.TrimSuffix(lines[line], "\r"), true
+}
+
+// symbolColumn returns the UTF-16 column of the first occurrence of symbol in line that is not
+// part of a longer identifier.
+func symbolColumn(line, symbol string) (int, bool) {
+	for start := 0; start <= len(line)-len(symbol); {
+		i := strings.Index(line[start:], symbol)
+		if i < 0 {
+			return 0, false
+		}
+		i += start
+		end := i + len(symbol)
+		if !isIdentByteBefore(line, i) && !isIdentByteAt(line, end) {
+			return utf16Column(line, i), true
+		}
+		start = i + 1
+	}
+	return 0, false
+}
+
+func isIdentByteBefore(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return isIdentRune(r)
+}
+
+func isIdentByteAt(s string, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return isIdentRune(r)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= utf8.RuneSelf
+}
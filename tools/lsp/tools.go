@@ -0,0 +1,289 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	DefinitionToolName  = "lsp_definition"
+	ReferencesToolName  = "lsp_references"
+	DiagnosticsToolName = "lsp_diagnostics"
+)
+
+const (
+	// DefaultDiagnosticsWait is how long lsp_diagnostics waits for the server to publish diagnostics.
+	DefaultDiagnosticsWait = 5 * time.Second
+	// maxLocations bounds the number of locations returned to the model.
+	maxLocations = 50
+)
+
+// Server lazily starts a language server for Dir on first use and exposes it as agent tools.
+// Close must be called when the server is no longer needed, typically after Runner.Run returns.
+type Server struct {
+	Dir string
+	// Command starts the language server speaking LSP on stdio, "gopls" when empty.
+	Command []string
+	// DiagnosticsWait overrides DefaultDiagnosticsWait.
+	DiagnosticsWait time.Duration
+
+	mu     sync.Mutex
+	client *Client
+}
+
+// NewGoplsServer returns a Server running gopls against dir.
+func NewGoplsServer(dir string) *Server {
+	return &Server{Dir: dir, Command: []string{"gopls"}}
+}
+
+// Tools returns the lsp_definition, lsp_references and lsp_diagnostics tools backed by s.
+func (s *Server) Tools() []tool.InvokableTool {
+	return []tool.InvokableTool{
+		&DefinitionTool{Server: s},
+		&ReferencesTool{Server: s},
+		&DiagnosticsTool{Server: s},
+	}
+}
+
+// Close stops the language server, if it was started.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
+
+// Client returns the running client, starting the server if needed. A server that exited is restarted.
+func (s *Server) Client(ctx context.Context) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		select {
+		case <-s.client.done:
+			_ = s.client.Close()
+			s.client = nil
+		default:
+			return s.client, nil
+		}
+	}
+	command := s.Command
+	if len(command) == 0 {
+		command = []string{"gopls"}
+	}
+	client, err := Start(ctx, s.Dir, command...)
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	return client, nil
+}
+
+// SymbolRequest identifies a symbol by file, line and name, which models get right far more often
+// than byte or UTF-16 columns.
+type SymbolRequest struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Symbol string `json:"symbol"`
+}
+
+func symbolParams() map[string]*schema.ParameterInfo {
+	return map[string]*schema.ParameterInfo{
+		"file":   {Type: schema.String, Required: true, Desc: "Path of the Go file containing the symbol."},
+		"line":   {Type: schema.Integer, Required: true, Desc: "1-based line number where the symbol appears."},
+		"symbol": {Type: schema.String, Required: true, Desc: "The identifier on that line, e.g. a function, type, field or variable name."},
+	}
+}
+
+// position resolves the request to a file path and an LSP position.
+func (s *Server) position(argumentsInJSON string) (string, Position, error) {
+	var req SymbolRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil {
+		return "", Position{}, fmt.Errorf("invalid arguments: %w", err)
+	}
+	if req.File == "" || req.Symbol == "" || req.Line <= 0 {
+		return "", Position{}, fmt.Errorf("file, line and symbol are required")
+	}
+	path := s.path(req.File)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", Position{}, err
+	}
+	line, ok := lineAt(string(data), req.Line-1)
+	if !ok {
+		return "", Position{}, fmt.Errorf("%s has no line %d", req.File, req.Line)
+	}
+	col, ok := symbolColumn(line, req.Symbol)
+	if !ok {
+		return "", Position{}, fmt.Errorf("symbol %q not found on line %d of %s: %q", req.Symbol, req.Line, req.File, strings.TrimSpace(line))
+	}
+	return path, Position{Line: req.Line - 1, Character: col}, nil
+}
+
+func (s *Server) path(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(s.Dir, file)
+}
+
+// formatLocations renders one location per line as path:line:column followed by the source line.
+func (s *Server) formatLocations(locs []Location) string {
+	if len(locs) == 0 {
+		return "No locations found."
+	}
+	var b strings.Builder
+	sources := map[string]string{}
+	for i, loc := range locs {
+		if i == maxLocations {
+			fmt.Fprintf(&b, "... %d more locations omitted\n", len(locs)-maxLocations)
+			break
+		}
+		path := uriToPath(loc.URI)
+		src, ok := sources[path]
+		if !ok {
+			data, _ := os.ReadFile(path)
+			src = string(data)
+			sources[path] = src
+		}
+		line, _ := lineAt(src, loc.Range.Start.Line)
+		fmt.Fprintf(&b, "%s:%d:%d: %s\n", s.display(path), loc.Range.Start.Line+1, runeColumn(line, loc.Range.Start.Character), strings.TrimSpace(line))
+	}
+	return b.String()
+}
+
+// display shortens paths inside Dir to relative paths.
+func (s *Server) display(path string) string {
+	dir, err := filepath.Abs(s.Dir)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.Join(s.Dir, rel)
+}
+
+// DefinitionTool finds where a symbol is defined.
+type DefinitionTool struct {
+	Server *Server
+}
+
+func (t *DefinitionTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        DefinitionToolName,
+		Desc:        "Go to the definition of a Go symbol, using the language server. Returns file:line:column and the source line.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(symbolParams()),
+	}, nil
+}
+
+func (t *DefinitionTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	path, pos, err := t.Server.position(argumentsInJSON)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", DefinitionToolName, err), nil
+	}
+	client, err := t.Server.Client(ctx)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", DefinitionToolName, err), nil
+	}
+	locs, err := client.Definition(ctx, path, pos)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", DefinitionToolName, err), nil
+	}
+	return t.Server.formatLocations(locs), nil
+}
+
+// ReferencesTool finds the uses of a symbol.
+type ReferencesTool struct {
+	Server *Server
+}
+
+func (t *ReferencesTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        ReferencesToolName,
+		Desc:        "Find all references to a Go symbol across the module, using the language server. Returns file:line:column and the source line per reference.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(symbolParams()),
+	}, nil
+}
+
+func (t *ReferencesTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	path, pos, err := t.Server.position(argumentsInJSON)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", ReferencesToolName, err), nil
+	}
+	client, err := t.Server.Client(ctx)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", ReferencesToolName, err), nil
+	}
+	locs, err := client.References(ctx, path, pos, false)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", ReferencesToolName, err), nil
+	}
+	return t.Server.formatLocations(locs), nil
+}
+
+// DiagnosticsTool reports compile errors and vet-style findings for a file.
+type DiagnosticsTool struct {
+	Server *Server
+}
+
+type DiagnosticsRequest struct {
+	File string `json:"file"`
+}
+
+func (t *DiagnosticsTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: DiagnosticsToolName,
+		Desc: "Get compile errors and warnings of a Go file from the language server, without running the build.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"file": {Type: schema.String, Required: true, Desc: "Path of the Go file."},
+		}),
+	}, nil
+}
+
+func (t *DiagnosticsTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var req DiagnosticsRequest
+	if err := json.Unmarshal([]byte(argumentsInJSON), &req); err != nil || req.File == "" {
+		return fmt.Sprintf("%s: file is required", DiagnosticsToolName), nil
+	}
+	client, err := t.Server.Client(ctx)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", DiagnosticsToolName, err), nil
+	}
+	wait := t.Server.DiagnosticsWait
+	if wait <= 0 {
+		wait = DefaultDiagnosticsWait
+	}
+	path := t.Server.path(req.File)
+	diags, err := client.Diagnostics(ctx, path, wait)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", DiagnosticsToolName, err), nil
+	}
+	if len(diags) == 0 {
+		return fmt.Sprintf("No diagnostics for %s.", req.File), nil
+	}
+	data, _ := os.ReadFile(path)
+	var b strings.Builder
+	for _, d := range diags {
+		line, _ := lineAt(string(data), d.Range.Start.Line)
+		fmt.Fprintf(&b, "%s:%d:%d: %s: %s", req.File, d.Range.Start.Line+1, runeColumn(line, d.Range.Start.Character), d.Severity, d.Message)
+		if d.Source != "" {
+			fmt.Fprintf(&b, " (%s)", d.Source)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
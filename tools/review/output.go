@@ -0,0 +1,63 @@
+package review
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/stumble/axe/sarif"
+)
+
+// WriteJSON writes comments as an indented JSON array.
+func WriteJSON(w io.Writer, comments []Comment) error {
+	if comments == nil {
+		comments = []Comment{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(comments)
+}
+
+// Findings converts comments into SARIF findings. The category becomes the rule id "axe/<category>".
+func Findings(comments []Comment) []sarif.Finding {
+	findings := make([]sarif.Finding, 0, len(comments))
+	for _, c := range comments {
+		category := c.Category
+		if category == "" {
+			category = CategoryOther
+		}
+		findings = append(findings, sarif.Finding{
+			RuleID:    "axe/" + category,
+			Level:     sarifLevel(c.Severity),
+			Message:   c.Message,
+			Path:      c.Path,
+			StartLine: c.StartLine,
+			EndLine:   c.EndLine,
+		})
+	}
+	return findings
+}
+
+// WriteSARIF writes comments as a SARIF 2.1.0 log, for inline annotations in code scanning UIs.
+func WriteSARIF(w io.Writer, toolName string, comments []Comment) error {
+	return sarif.Write(w, sarif.Tool{Name: toolName, RuleDescriptions: ruleDescriptions}, Findings(comments))
+}
+
+var ruleDescriptions = map[string]string{
+	"axe/" + CategoryBug:         "Bug or incorrect behavior",
+	"axe/" + CategorySecurity:    "Security issue",
+	"axe/" + CategoryPerformance: "Performance issue",
+	"axe/" + CategoryTesting:     "Missing or inadequate tests",
+	"axe/" + CategoryStyle:       "Style, naming or readability",
+	"axe/" + CategoryOther:       "Code review comment",
+}
+
+func sarifLevel(s Severity) sarif.Level {
+	switch s {
+	case SeverityError:
+		return sarif.LevelError
+	case SeverityWarning:
+		return sarif.LevelWarning
+	default:
+		return sarif.LevelNote
+	}
+}
@@ -0,0 +1,184 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	cont "github.com/stumble/axe/code/container"
+)
+
+const (
+	CommentToolName = "add_review_comment"
+)
+
+// Severity of a review comment.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // bugs, security issues, broken behavior
+	SeverityWarning Severity = "warning" // likely problems and risky code
+	SeverityInfo    Severity = "info"    // style, naming, suggestions
+)
+
+// Categories of review comments.
+const (
+	CategoryBug         = "bug"
+	CategorySecurity    = "security"
+	CategoryPerformance = "performance"
+	CategoryTesting     = "testing"
+	CategoryStyle       = "style"
+	CategoryOther       = "other"
+)
+
+var categories = []string{CategoryBug, CategorySecurity, CategoryPerformance, CategoryTesting, CategoryStyle, CategoryOther}
+
+// Comment is an inline review comment on a line range of a file.
+type Comment struct {
+	Path      string   `json:"path"`
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Severity  Severity `json:"severity"`
+	Category  string   `json:"category,omitempty"`
+	Message   string   `json:"message"`
+}
+
+// Comments collects the comments of a review. It is safe for concurrent use.
+type Comments struct {
+	mu   sync.Mutex
+	list []Comment
+}
+
+func (c *Comments) Add(comment Comment) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.list = append(c.list, comment)
+	return len(c.list)
+}
+
+// List returns a copy of the collected comments, in the order they were added.
+func (c *Comments) List() []Comment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Comment(nil), c.list...)
+}
+
+func (c *Comments) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.list = nil
+}
+
+// CommentTool lets the agent record inline review comments. Paths and line ranges are checked
+// against Code when it is set.
+type CommentTool struct {
+	Code     *cont.CodeContainer
+	Comments *Comments
+}
+
+func (t *CommentTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: CommentToolName,
+		Desc: "Record one inline review comment on a line range of a file. Call it once per finding, then summarize the review when finalizing.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"path": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "Path of the file, exactly as in the CodeInput path attribute.",
+			},
+			"start_line": {
+				Type:     schema.Integer,
+				Required: true,
+				Desc:     "First line (1-based) the comment refers to.",
+			},
+			"end_line": {
+				Type: schema.Integer,
+				Desc: "Last line the comment refers to, defaults to start_line.",
+			},
+			"severity": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "error for bugs and security issues, warning for likely problems, info for suggestions.",
+				Enum:     []string{string(SeverityError), string(SeverityWarning), string(SeverityInfo)},
+			},
+			"category": {
+				Type: schema.String,
+				Desc: "Kind of finding, defaults to other.",
+				Enum: categories,
+			},
+			"message": {
+				Type:     schema.String,
+				Required: true,
+				Desc:     "The comment: what is wrong and how to fix it.",
+			},
+		}),
+	}, nil
+}
+
+func (t *CommentTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if t == nil || t.Comments == nil {
+		return "", errors.New("add_review_comment: tool not initialized with Comments")
+	}
+	var c Comment
+	if err := json.Unmarshal([]byte(argumentsInJSON), &c); err != nil {
+		return fmt.Sprintf("%s: invalid arguments: %v", CommentToolName, err), nil
+	}
+	if err := t.validate(&c); err != nil {
+		return fmt.Sprintf("%s: %v", CommentToolName, err), nil
+	}
+	n := t.Comments.Add(c)
+	return fmt.Sprintf("Comment #%d recorded on %s:%d-%d.", n, c.Path, c.StartLine, c.EndLine), nil
+}
+
+// validate normalizes c and checks it against the code.
+func (t *CommentTool) validate(c *Comment) error {
+	c.Path = strings.TrimSpace(c.Path)
+	c.Message = strings.TrimSpace(c.Message)
+	c.Severity = Severity(strings.ToLower(strings.TrimSpace(string(c.Severity))))
+	switch {
+	case c.Path == "":
+		return errors.New("path is required")
+	case c.Message == "":
+		return errors.New("message is required")
+	case c.Severity != SeverityError && c.Severity != SeverityWarning && c.Severity != SeverityInfo:
+		return fmt.Errorf("invalid severity %q", c.Severity)
+	case c.StartLine < 1:
+		return errors.New("start_line must be >= 1")
+	}
+	c.Category = strings.ToLower(strings.TrimSpace(c.Category))
+	if c.Category == "" {
+		c.Category = CategoryOther
+	}
+	if !slices.Contains(categories, c.Category) {
+		return fmt.Errorf("invalid category %q", c.Category)
+	}
+	if c.EndLine == 0 {
+		c.EndLine = c.StartLine
+	}
+	if c.EndLine < c.StartLine {
+		return fmt.Errorf("end_line %d is before start_line %d", c.EndLine, c.StartLine)
+	}
+	if t.Code == nil {
+		return nil
+	}
+	key, err := t.Code.Normalize(c.Path)
+	if err != nil {
+		return err
+	}
+	c.Path = key
+	content, ok := t.Code.Files()[c.Path]
+	if !ok {
+		return fmt.Errorf("file %s is not in CodeInput", c.Path)
+	}
+	if lines := strings.Count(content, "\n") + 1; c.EndLine > lines {
+		return fmt.Errorf("%s has only %d lines", c.Path, lines)
+	}
+	return nil
+}
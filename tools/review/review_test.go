@@ -0,0 +1,61 @@
+package review
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cont "github.com/stumble/axe/code/container"
+	"github.com/stumble/axe/sarif"
+)
+
+func TestCommentTool(t *testing.T) {
+	comments := &Comments{}
+	tool := &CommentTool{
+		Code:     cont.NewCodeContainer(map[string]string{"a.go": "package a\n\nfunc A() {}\n"}),
+		Comments: comments,
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"valid", `{"path":"a.go","start_line":3,"severity":"Warning","message":" unused "}`, "Comment #1 recorded on a.go:3-3."},
+		{"unknown file", `{"path":"b.go","start_line":1,"severity":"info","message":"x"}`, "file b.go is not in CodeInput"},
+		{"beyond end", `{"path":"a.go","start_line":1,"end_line":9,"severity":"info","message":"x"}`, "a.go has only 4 lines"},
+		{"reversed range", `{"path":"a.go","start_line":3,"end_line":2,"severity":"info","message":"x"}`, "end_line 2 is before start_line 3"},
+		{"bad severity", `{"path":"a.go","start_line":1,"severity":"nit","message":"x"}`, `invalid severity "nit"`},
+		{"bad category", `{"path":"a.go","start_line":1,"severity":"info","category":"vibes","message":"x"}`, `invalid category "vibes"`},
+		{"no message", `{"path":"a.go","start_line":1,"severity":"info"}`, "message is required"},
+		{"malformed", `{`, "invalid arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tool.InvokableRun(context.Background(), tt.args)
+			require.NoError(t, err)
+			assert.Contains(t, out, tt.want)
+		})
+	}
+	assert.Equal(t, []Comment{{Path: "a.go", StartLine: 3, EndLine: 3, Severity: SeverityWarning, Category: CategoryOther, Message: "unused"}}, comments.List())
+}
+
+func TestFindings(t *testing.T) {
+	findings := Findings([]Comment{
+		{Path: "a.go", StartLine: 3, EndLine: 4, Severity: SeverityInfo, Message: "rename"},
+		{Path: "b.go", StartLine: 1, EndLine: 1, Severity: SeverityError, Category: CategorySecurity, Message: "sql injection"},
+	})
+	require.Len(t, findings, 2)
+	assert.Equal(t, sarif.Finding{RuleID: "axe/other", Level: sarif.LevelNote, Message: "rename", Path: "a.go", StartLine: 3, EndLine: 4}, findings[0])
+	assert.Equal(t, "axe/security", findings[1].RuleID)
+	assert.Equal(t, sarif.LevelError, findings[1].Level)
+}
+
+func TestWriteJSON_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
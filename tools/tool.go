@@ -1 +1,23 @@
 package tools
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type loggerCtxKey struct{}
+
+// WithLogger returns a context carrying the logger that tools should log to.
+func WithLogger(ctx context.Context, logger zerolog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, &logger)
+}
+
+// Logger returns the logger set by WithLogger, or the global zerolog logger.
+func Logger(ctx context.Context) *zerolog.Logger {
+	if logger, ok := ctx.Value(loggerCtxKey{}).(*zerolog.Logger); ok {
+		return logger
+	}
+	return &log.Logger
+}
@@ -0,0 +1,142 @@
+package axe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/schema"
+)
+
+// TraceEntry is a line of a run trace, see WithTrace.
+type TraceEntry struct {
+	Time  time.Time `json:"time"`
+	RunID string    `json:"run_id"`
+	Step  int       `json:"step"` // number of model responses so far; prompt messages are step 0
+	// Type is "message" for a prompt message, "assistant" for a model response and "tool" for a
+	// tool call.
+	Type      string           `json:"type"`
+	Role      schema.RoleType  `json:"role,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	ToolCalls []TraceToolCall  `json:"tool_calls,omitempty"` // tool calls requested by a model response
+	Tool      string           `json:"tool,omitempty"`
+	Arguments string           `json:"arguments,omitempty"`
+	Result    string           `json:"result,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Usage     *TraceTokenUsage `json:"usage,omitempty"`
+}
+
+// TraceToolCall is a tool call requested by the model.
+type TraceToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// TraceTokenUsage is the token usage of a model response.
+type TraceTokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// tracer appends the steps of a run to its trace file.
+type tracer struct {
+	runID string
+	path  string
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	step int
+	err  error // first write error, reported once at close
+}
+
+// newTracer creates the trace file of a run in dir.
+func newTracer(dir, runID string) (*tracer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("axe: create trace dir: %w", err)
+	}
+	path := filepath.Join(dir, runID+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("axe: create trace file: %w", err)
+	}
+	return &tracer{runID: runID, path: path, file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// write appends e, numbering model responses. Entries arriving after close are dropped.
+func (t *tracer) write(e TraceEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil || t.err != nil {
+		return
+	}
+	if e.Type == "assistant" {
+		t.step++
+	}
+	e.Time, e.RunID, e.Step = time.Now(), t.runID, t.step
+	t.err = t.enc.Encode(e)
+}
+
+func (t *tracer) messages(msgs []*schema.Message) {
+	for _, msg := range msgs {
+		t.write(TraceEntry{Type: "message", Role: msg.Role, Content: msg.Content})
+	}
+}
+
+// response records a model response from its streamed chunks. It is called by the runner's tool
+// call checker, which sees the whole response before the agent runs its tool calls.
+func (t *tracer) response(chunks []*schema.Message) {
+	if len(chunks) == 0 {
+		return
+	}
+	e := TraceEntry{Type: "assistant", Role: schema.Assistant}
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		e.Error = err.Error()
+		t.write(e)
+		return
+	}
+	e.Content = msg.Content
+	for _, call := range msg.ToolCalls {
+		e.ToolCalls = append(e.ToolCalls, TraceToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		e.Usage = &TraceTokenUsage{PromptTokens: msg.ResponseMeta.Usage.PromptTokens, CompletionTokens: msg.ResponseMeta.Usage.CompletionTokens}
+	}
+	t.write(e)
+}
+
+func (t *tracer) onTool(_ context.Context, ev ToolEvent) {
+	e := TraceEntry{Type: "tool", Tool: ev.Name, Arguments: ev.Arguments, Result: ev.Response}
+	if ev.Err != nil {
+		e.Error = ev.Err.Error()
+	}
+	t.write(e)
+}
+
+func (t *tracer) handler() callbacks.Handler {
+	return NewToolCallbackHandler(t.onTool)
+}
+
+func (t *tracer) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	if t.err != nil {
+		err = t.err
+	}
+	if err != nil {
+		return fmt.Errorf("axe: write trace %s: %w", t.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package axe_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerTrace(t *testing.T) {
+	dir := t.TempDir()
+	traces := filepath.Join(dir, "traces")
+	model := axetest.NewScriptedModel(
+		axetest.ApplyEdit("*** Begin Patch\n*** Add File: "+filepath.Join(dir, "a.txt")+"\n+hello\n*** End Patch"),
+		axetest.Finalize("success", "added a.txt"),
+	)
+	runner, err := axe.NewRunner(dir, []string{"add a.txt"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+		axe.WithTrace(traces),
+	)
+	require.NoError(t, err)
+	_, err = runner.Run(context.Background(), false)
+	require.NoError(t, err)
+
+	path := filepath.Join(traces, runner.RunID+".jsonl")
+	assert.Equal(t, path, runner.History.Changelogs[0].Trace)
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var entries []axe.TraceEntry
+	for dec := json.NewDecoder(f); dec.More(); {
+		var e axe.TraceEntry
+		require.NoError(t, dec.Decode(&e))
+		entries = append(entries, e)
+	}
+
+	var types []string
+	for _, e := range entries {
+		types = append(types, e.Type)
+		assert.Equal(t, runner.RunID, e.RunID)
+	}
+	assert.Equal(t, []string{"message", "message", "assistant", "tool", "assistant", "tool"}, types)
+	require.Len(t, entries[2].ToolCalls, 1)
+	assert.Equal(t, "apply_edit", entries[2].ToolCalls[0].Name)
+	assert.Equal(t, "apply_edit", entries[3].Tool)
+	assert.Equal(t, 1, entries[3].Step)
+	assert.Equal(t, "finalize_task", entries[5].Tool)
+	assert.Equal(t, 2, entries[5].Step)
+}
@@ -0,0 +1,176 @@
+package axe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stumble/axe/tools/finalize"
+)
+
+// ErrGoalNotReached is returned, wrapped with the last reason, by RunUntil when the predicate still
+// doesn't hold after the last attempt.
+var ErrGoalNotReached = errors.New("axe: goal not reached")
+
+// Predicate tells RunUntil whether the goal is reached after an attempt: nil if it is, else an
+// error explaining what is still wrong, which the next attempt is told.
+type Predicate func(ctx context.Context, result *RunResult) error
+
+// FinalizedWithSuccess holds when the agent finalized the task with status success.
+func FinalizedWithSuccess(_ context.Context, result *RunResult) error {
+	if result.Success() {
+		return nil
+	}
+	msg := fmt.Sprintf("the task was not finalized with status success (status %s)", result.Status)
+	if todo := strings.TrimSpace(result.TODO); todo != "" {
+		msg += ", left to do: " + todo
+	}
+	return errors.New(msg)
+}
+
+// ValidatorsPass holds when all validators pass, e.g. finalize.GoTestValidator for "the tests pass".
+func ValidatorsPass(validators ...finalize.Validator) Predicate {
+	return func(ctx context.Context, _ *RunResult) error {
+		var failures []string
+		for _, v := range validators {
+			if v.Check == nil {
+				continue
+			}
+			if err := v.Check(ctx); err != nil {
+				failures = append(failures, fmt.Sprintf("- %s: %s", v.Name, strings.TrimSpace(err.Error())))
+			}
+		}
+		if len(failures) > 0 {
+			return errors.New(strings.Join(failures, "\n"))
+		}
+		return nil
+	}
+}
+
+// AllOf holds when all predicates hold. They are checked in order, up to the first that doesn't.
+func AllOf(predicates ...Predicate) Predicate {
+	return func(ctx context.Context, result *RunResult) error {
+		for _, p := range predicates {
+			if err := p(ctx, result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// UntilOption configures RunUntil.
+type UntilOption func(*untilConfig)
+
+type untilConfig struct {
+	backoff    time.Duration // wait before the second attempt, doubled for each next one
+	maxBackoff time.Duration
+	fresh      bool
+	onAttempt  func(attempt int, result *RunResult, err error)
+}
+
+// UntilBackoff waits initial before the second attempt, doubling the wait for every next one up to
+// maxWait. There is no wait by default.
+func UntilBackoff(initial, maxWait time.Duration) UntilOption {
+	return func(c *untilConfig) {
+		c.backoff, c.maxBackoff = initial, maxWait
+	}
+}
+
+// UntilFreshAttempts starts every attempt as a new run of the instructions, with the reason of the
+// previous failure appended, instead of continuing the conversation of the previous attempt.
+func UntilFreshAttempts() UntilOption {
+	return func(c *untilConfig) {
+		c.fresh = true
+	}
+}
+
+// UntilOnAttempt calls fn after every attempt with its result and the predicate's verdict.
+func UntilOnAttempt(fn func(attempt int, result *RunResult, err error)) UntilOption {
+	return func(c *untilConfig) {
+		c.onAttempt = fn
+	}
+}
+
+// RunUntil runs the agent until predicate holds, at most maxAttempts times. After a failed attempt
+// the runner continues the conversation (see Runner.Continue, and UntilFreshAttempts) with an
+// instruction naming the attempt and the reason the predicate gave. It returns the result of the
+// last attempt, and an error wrapping ErrGoalNotReached if the predicate never held. Errors of
+// Run itself, e.g. an interruption, end the loop at once.
+func RunUntil(ctx context.Context, runner *Runner, predicate Predicate, maxAttempts int, opts ...UntilOption) (*RunResult, error) {
+	if runner == nil {
+		return nil, errors.New("axe: nil runner")
+	}
+	if predicate == nil {
+		return nil, errors.New("axe: nil predicate")
+	}
+	if maxAttempts <= 0 {
+		return nil, errors.New("axe: max attempts must be positive")
+	}
+	var cfg untilConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var result *RunResult
+	var reason error
+	wait := cfg.backoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 && wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return result, fmt.Errorf("axe: run until: %w", ctx.Err())
+			case <-timer.C:
+			}
+			wait = min(wait*2, max(cfg.maxBackoff, cfg.backoff))
+		}
+
+		var err error
+		if attempt == 1 {
+			result, err = runner.Run(ctx, false)
+		} else {
+			result, err = runAttempt(ctx, runner, cfg.fresh, retryInstruction(attempt, maxAttempts, reason))
+		}
+		if err != nil {
+			return result, err
+		}
+		if result == nil {
+			return nil, errors.New("axe: run until: the run was skipped")
+		}
+		reason = predicate(ctx, result)
+		if cfg.onAttempt != nil {
+			cfg.onAttempt(attempt, result, reason)
+		}
+		if reason == nil {
+			return result, nil
+		}
+		runner.log.Info().Int("attempt", attempt).Int("max_attempts", maxAttempts).Err(reason).Msg("axe: goal not reached")
+	}
+	return result, fmt.Errorf("%w after %d attempts: %w", ErrGoalNotReached, maxAttempts, reason)
+}
+
+// runAttempt runs a retry, continuing the conversation or running the instructions again with
+// the retry instruction appended.
+func runAttempt(ctx context.Context, runner *Runner, fresh bool, instruction string) (*RunResult, error) {
+	if !fresh && len(runner.State.Messages) > 0 {
+		return runner.Continue(ctx, instruction)
+	}
+	instructions := runner.Instructions
+	runner.Instructions = append(instructions[:len(instructions):len(instructions)], instruction)
+	defer func() { runner.Instructions = instructions }()
+	return runner.Run(ctx, false)
+}
+
+// retryInstruction tells the agent which attempt it is on and why the previous one fell short.
+func retryInstruction(attempt, maxAttempts int, reason error) string {
+	last := ""
+	if attempt == maxAttempts {
+		last = " This is the last attempt."
+	}
+	return fmt.Sprintf("This is attempt %d of %d: the previous attempt did not reach the goal.%s\nWhat is still wrong:\n%s\nFix it, then finalize the task.",
+		attempt, maxAttempts, last, strings.TrimSpace(reason.Error()))
+}
@@ -0,0 +1,50 @@
+package axe_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunUntil(t *testing.T) {
+	dir := t.TempDir()
+	model := axetest.NewScriptedModel(
+		axetest.Finalize("failure", "tests still fail"),
+		axetest.Finalize("success", "fixed"),
+		axetest.Finalize("success", "fixed again"),
+	)
+	runner, err := axe.NewRunner(dir, []string{"fix the tests"}, cont.NewCodeContainer(map[string]string{}),
+		axe.WithChatModel(model),
+		axe.WithHistory(filepath.Join(dir, "history.xml")),
+		axe.WithSink(io.Discard),
+	)
+	require.NoError(t, err)
+
+	var attempts []int
+	result, err := axe.RunUntil(context.Background(), runner, axe.FinalizedWithSuccess, 3,
+		axe.UntilOnAttempt(func(attempt int, _ *axe.RunResult, _ error) { attempts = append(attempts, attempt) }))
+	require.NoError(t, err)
+	assert.True(t, result.Success())
+	assert.Equal(t, []int{1, 2}, attempts)
+
+	requests := model.Requests()
+	require.Len(t, requests, 2)
+	retry := requests[1][len(requests[1])-1]
+	assert.Contains(t, retry.Content, "This is attempt 2 of 3")
+	assert.Contains(t, retry.Content, "status failure")
+
+	_, err = axe.RunUntil(context.Background(), runner, func(context.Context, *axe.RunResult) error {
+		return errors.New("never")
+	}, 1)
+	require.ErrorIs(t, err, axe.ErrGoalNotReached)
+	assert.ErrorContains(t, err, "after 1 attempts: never")
+}
@@ -0,0 +1,52 @@
+package axe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Verbosity selects how much of a run's output reaches the sinks and the changelog logs.
+type Verbosity int
+
+const (
+	// VerbosityVerbose keeps everything: the prompt, full tool arguments and tool outputs. It is the default.
+	VerbosityVerbose Verbosity = iota
+	// VerbosityNormal keeps the agent's text, status lines, and one line per tool call and tool result.
+	VerbosityNormal
+	// VerbosityQuiet keeps only the final status of the run.
+	VerbosityQuiet
+)
+
+// maxToolSummary is the length of a tool result line in VerbosityNormal.
+const maxToolSummary = 200
+
+// Valid reports whether v is a known verbosity.
+func (v Verbosity) Valid() bool {
+	return v >= VerbosityVerbose && v <= VerbosityQuiet
+}
+
+// filter returns the chunk as shown at this verbosity, false if it is not shown.
+func (v Verbosity) filter(chunk OutputChunk) (OutputChunk, bool) {
+	switch v {
+	case VerbosityQuiet:
+		return chunk, chunk.Kind == OutputKindSummary
+	case VerbosityNormal:
+		switch chunk.Kind {
+		case OutputKindPrompt:
+			return chunk, false
+		case OutputKindToolCall:
+			// only the header naming the tool, not the arguments
+			if chunk.Tool == "" {
+				return chunk, false
+			}
+			chunk.Text = fmt.Sprintf("\nTool call: %s\n", chunk.Tool)
+		case OutputKindToolResult:
+			result, _, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(chunk.Text, "Tool call response: ")), "\n")
+			if r := []rune(result); len(r) > maxToolSummary {
+				result = string(r[:maxToolSummary-1]) + "…"
+			}
+			chunk.Text = fmt.Sprintf("Tool call response: %s\n", result)
+		}
+	}
+	return chunk, true
+}
@@ -0,0 +1,54 @@
+package axe_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stumble/axe"
+	"github.com/stumble/axe/axetest"
+	cont "github.com/stumble/axe/code/container"
+)
+
+func TestRunnerVerbosity(t *testing.T) {
+	run := func(v axe.Verbosity) string {
+		dir := t.TempDir()
+		model := axetest.NewScriptedModel(
+			axetest.ApplyEdit("*** Begin Patch\n*** Add File: "+filepath.Join(dir, "a.txt")+"\n+hello\n*** End Patch"),
+			axetest.Finalize("success", "added a.txt"),
+		)
+		var sink bytes.Buffer
+		runner, err := axe.NewRunner(dir, []string{"add a.txt"}, cont.NewCodeContainer(map[string]string{}),
+			axe.WithChatModel(model),
+			axe.WithHistory(filepath.Join(dir, "history.xml")),
+			axe.WithSink(&sink),
+			axe.WithVerbosity(v),
+		)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), false)
+		require.NoError(t, err)
+		logs := runner.History.Changelogs[0].Logs
+		require.NotEmpty(t, logs)
+		assert.Equal(t, sink.String(), logs[len(logs)-1].Value) // after the agent's changelog
+		return sink.String()
+	}
+
+	assert.Equal(t, "Agent execution finished successfully.\n", run(axe.VerbosityQuiet))
+
+	normal := run(axe.VerbosityNormal)
+	assert.Contains(t, normal, "Tool call: apply_edit\n")
+	assert.Contains(t, normal, "Tool call response: apply_edit successfully applied edits")
+	assert.NotContains(t, normal, "+hello")
+	assert.NotContains(t, normal, "# Instruction")
+
+	verbose := run(axe.VerbosityVerbose)
+	assert.Contains(t, verbose, "+hello")
+	assert.Contains(t, verbose, "# Instruction")
+
+	_, err := axe.NewRunner(t.TempDir(), nil, nil, axe.WithVerbosity(axe.Verbosity(7)))
+	assert.Error(t, err)
+}